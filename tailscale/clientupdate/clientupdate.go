@@ -12,6 +12,7 @@
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,6 +30,7 @@
 
 	"github.com/google/uuid"
 	"tailscale.com/clientupdate/distsign"
+	"tailscale.com/envknob"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/winutil"
 	"tailscale.com/version"
@@ -96,9 +98,43 @@ func (args Arguments) validate() error {
 	return nil
 }
 
+// signingRootsFile, if set, is the path of a bundle of PEM-encoded root
+// public keys that downloaded updates must be signed with (see package
+// distsign), instead of the root keys embedded in this binary. Updates that
+// aren't downloaded and verified with distsign, such as those installed by a
+// package manager, are refused.
+var signingRootsFile = envknob.RegisterString("TS_UPDATE_SIGNING_ROOTS")
+
+// ErrUnverifiable is returned by NewUpdater when signature verification is
+// enforced (see SignatureVerificationEnforced), but updates on this
+// platform can't be verified.
+var ErrUnverifiable = errors.New("update signature verification is enforced but not possible")
+
+// SignatureVerificationEnforced reports whether updates must be signed by
+// the root keys in the file named by $TS_UPDATE_SIGNING_ROOTS.
+func SignatureVerificationEnforced() bool {
+	return signingRootsFile() != ""
+}
+
+// loadSigningRoots reads a bundle of PEM-encoded root public keys from
+// path.
+func loadSigningRoots(path string) ([]ed25519.PublicKey, error) {
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := distsign.ParseRootKeyBundle(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+	return roots, nil
+}
+
 type Updater struct {
 	Arguments
 	track string
+	// roots, if non-nil, are the only root keys trusted to sign downloads.
+	roots []ed25519.PublicKey
 	// Update is a platform-specific method that updates the installation. May be
 	// nil (not all platforms support updates from within Tailscale).
 	Update func() error
@@ -108,19 +144,26 @@ func NewUpdater(args Arguments) (*Updater, error) {
 	up := Updater{
 		Arguments: args,
 	}
-	up.Update = up.getUpdateFunction()
+	var verifies bool
+	up.Update, verifies, _ = up.getUpdateFunction()
 	if up.Update == nil {
 		return nil, errors.ErrUnsupported
 	}
+	if SignatureVerificationEnforced() {
+		if !verifies {
+			return nil, fmt.Errorf("%w: updates on this platform aren't signed by Tailscale's release keys", ErrUnverifiable)
+		}
+		roots, err := loadSigningRoots(signingRootsFile())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnverifiable, err)
+		}
+		up.roots = roots
+	}
 	switch up.Version {
 	case StableTrack, UnstableTrack:
 		up.track = up.Version
 	case CurrentTrack:
-		if version.IsUnstableBuild() {
-			up.track = UnstableTrack
-		} else {
-			up.track = StableTrack
-		}
+		up.track = Track()
 	default:
 		var err error
 		up.track, err = versionToTrack(args.Version)
@@ -136,52 +179,91 @@ func NewUpdater(args Arguments) (*Updater, error) {
 
 type updateFunction func() error
 
-func (up *Updater) getUpdateFunction() updateFunction {
+// Install methods, as returned by InstallMethod.
+const (
+	InstallMethodMSI         = "msi"
+	InstallMethodSynology    = "synology"
+	InstallMethodApt         = "apt"
+	InstallMethodPacman      = "pacman"
+	InstallMethodDNF         = "dnf"
+	InstallMethodYUM         = "yum"
+	InstallMethodApk         = "apk"
+	InstallMethodTarball     = "tarball"
+	InstallMethodMacSys      = "macsys"
+	InstallMethodMacAppStore = "appstore"
+	InstallMethodFreeBSDPkg  = "pkg"
+	InstallMethodUnknown     = "unknown"
+)
+
+// getUpdateFunction returns the update function for this platform, or nil
+// if there isn't one. verifies is whether the update function downloads
+// packages with package distsign, which verifies their signatures. method
+// is how Tailscale appears to have been installed, which is
+// InstallMethodUnknown if and only if the update function is nil.
+func (up *Updater) getUpdateFunction() (_ updateFunction, verifies bool, method string) {
 	switch runtime.GOOS {
 	case "windows":
-		return up.updateWindows
+		return up.updateWindows, true, InstallMethodMSI
 	case "linux":
 		switch distro.Get() {
 		case distro.Synology:
-			return up.updateSynology
+			return up.updateSynology, true, InstallMethodSynology
 		case distro.Debian: // includes Ubuntu
-			return up.updateDebLike
+			return up.updateDebLike, false, InstallMethodApt
 		case distro.Arch:
-			return up.updateArchLike
+			return up.updateArchLike, false, InstallMethodPacman
 		case distro.Alpine:
-			return up.updateAlpineLike
+			return up.updateAlpineLike, false, InstallMethodApk
 		}
 		switch {
 		case haveExecutable("pacman"):
-			return up.updateArchLike
+			return up.updateArchLike, false, InstallMethodPacman
 		case haveExecutable("apt-get"): // TODO(awly): add support for "apt"
 			// The distro.Debian switch case above should catch most apt-based
 			// systems, but add this fallback just in case.
-			return up.updateDebLike
+			return up.updateDebLike, false, InstallMethodApt
 		case haveExecutable("dnf"):
-			return up.updateFedoraLike("dnf")
+			return up.updateFedoraLike("dnf"), false, InstallMethodDNF
 		case haveExecutable("yum"):
-			return up.updateFedoraLike("yum")
+			return up.updateFedoraLike("yum"), false, InstallMethodYUM
 		case haveExecutable("apk"):
-			return up.updateAlpineLike
+			return up.updateAlpineLike, false, InstallMethodApk
 		}
 		// If nothing matched, fall back to tarball updates.
 		if up.Update == nil {
-			return up.updateLinuxBinary
+			return up.updateLinuxBinary, true, InstallMethodTarball
 		}
 	case "darwin":
 		switch {
 		case !up.Arguments.AppStore && !version.IsSandboxedMacOS():
-			return nil
+			return nil, false, InstallMethodUnknown
 		case !up.Arguments.AppStore && strings.HasSuffix(os.Getenv("HOME"), "/io.tailscale.ipn.macsys/Data"):
-			return up.updateMacSys
+			return up.updateMacSys, false, InstallMethodMacSys
 		default:
-			return up.updateMacAppStore
+			return up.updateMacAppStore, false, InstallMethodMacAppStore
 		}
 	case "freebsd":
-		return up.updateFreeBSD
+		return up.updateFreeBSD, false, InstallMethodFreeBSDPkg
 	}
-	return nil
+	return nil, false, InstallMethodUnknown
+}
+
+// InstallMethod returns how Tailscale appears to have been installed on this
+// node, and so how NewUpdater would update it: one of the InstallMethod*
+// constants. It's InstallMethodUnknown if Tailscale can't update itself
+// here, in which case NewUpdater returns errors.ErrUnsupported.
+func InstallMethod() string {
+	_, _, method := new(Updater).getUpdateFunction()
+	return method
+}
+
+// Track returns the track that the running version of Tailscale is on:
+// StableTrack or UnstableTrack.
+func Track() string {
+	if version.IsUnstableBuild() {
+		return UnstableTrack
+	}
+	return StableTrack
 }
 
 // Update runs a single update attempt using the platform-specific mechanism.
@@ -678,7 +760,7 @@ func (up *Updater) updateWindows() error {
 		return nil
 	}
 	if !winutil.IsCurrentProcessElevated() {
-		return errors.New("must be run as Administrator")
+		return &Error{Reason: ReasonPermissionDenied, Err: errors.New("must be run as Administrator")}
 	}
 
 	tsDir := filepath.Join(os.Getenv("ProgramData"), "Tailscale")
@@ -793,7 +875,13 @@ func makeSelfCopy() (tmpPathExe string, err error) {
 }
 
 func (up *Updater) downloadURLToFile(pathSrc, fileDst string) (ret error) {
-	c, err := distsign.NewClient(up.Logf, up.PkgsAddr)
+	var c *distsign.Client
+	var err error
+	if up.roots != nil {
+		c, err = distsign.NewClientWithRoots(up.Logf, up.PkgsAddr, up.roots)
+	} else {
+		c, err = distsign.NewClient(up.Logf, up.PkgsAddr)
+	}
 	if err != nil {
 		return err
 	}
@@ -1016,11 +1104,7 @@ func requestedTailscaleVersion(ver, track string) (string, error) {
 // track from pkgs.tailscale.com.
 func LatestTailscaleVersion(track string) (string, error) {
 	if track == CurrentTrack {
-		if version.IsUnstableBuild() {
-			track = UnstableTrack
-		} else {
-			track = StableTrack
-		}
+		track = Track()
 	}
 
 	latest, err := latestPackages(track)
@@ -1067,11 +1151,11 @@ func requireRoot() error {
 	}
 	switch runtime.GOOS {
 	case "linux":
-		return errors.New("must be root; use sudo")
+		return &Error{Reason: ReasonPermissionDenied, Err: errors.New("must be root; use sudo")}
 	case "freebsd", "openbsd":
-		return errors.New("must be root; use doas")
+		return &Error{Reason: ReasonPermissionDenied, Err: errors.New("must be root; use doas")}
 	default:
-		return errors.New("must be root")
+		return &Error{Reason: ReasonPermissionDenied, Err: errors.New("must be root")}
 	}
 }
 
@@ -13,6 +13,8 @@
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"tailscale.com/clientupdate/distsign"
 )
 
 func TestUpdateDebianAptSourcesListBytes(t *testing.T) {
@@ -761,3 +763,55 @@ func TestWriteFileSymlink(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadSigningRoots(t *testing.T) {
+	_, pub1, err := distsign.GenerateRootKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pub2, err := distsign.GenerateRootKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, signingPub, err := distsign.GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := t.TempDir()
+	write := func(name string, contents []byte) string {
+		path := filepath.Join(tmp, name)
+		if err := os.WriteFile(path, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		desc      string
+		path      string
+		wantRoots int
+	}{
+		{"one", write("one.pem", pub1), 1},
+		{"two", write("two.pem", append(append(pub1, '\n'), pub2...)), 2},
+		{"signing-key", write("signing.pem", signingPub), 0},
+		{"empty", write("empty.pem", nil), 0},
+		{"missing", filepath.Join(tmp, "missing.pem"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			roots, err := loadSigningRoots(tt.path)
+			if tt.wantRoots == 0 {
+				if err == nil {
+					t.Fatalf("got %d roots; want error", len(roots))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(roots) != tt.wantRoots {
+				t.Errorf("got %d roots; want %d", len(roots), tt.wantRoots)
+			}
+		})
+	}
+}
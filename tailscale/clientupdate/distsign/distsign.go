@@ -191,14 +191,23 @@ type Client struct {
 // NewClient returns a new client for distribution server located at pkgsAddr,
 // and uses embedded root keys from the roots/ subdirectory of this package.
 func NewClient(logf logger.Logf, pkgsAddr string) (*Client, error) {
+	return NewClientWithRoots(logf, pkgsAddr, roots())
+}
+
+// NewClientWithRoots is like NewClient, but trusts only the given root keys
+// instead of the embedded ones.
+func NewClientWithRoots(logf logger.Logf, pkgsAddr string, roots []ed25519.PublicKey) (*Client, error) {
 	if logf == nil {
 		logf = log.Printf
 	}
+	if len(roots) == 0 {
+		return nil, errors.New("no root keys")
+	}
 	u, err := url.Parse(pkgsAddr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid pkgsAddr %q: %w", pkgsAddr, err)
 	}
-	return &Client{logf: logf, roots: roots(), pkgsAddr: u}, nil
+	return &Client{logf: logf, roots: roots, pkgsAddr: u}, nil
 }
 
 func (c *Client) url(path string) string {
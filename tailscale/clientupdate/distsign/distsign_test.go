@@ -9,7 +9,6 @@
 	"crypto/ed25519"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -119,6 +118,28 @@ func TestDownload(t *testing.T) {
 	}
 }
 
+func TestDownloadOtherRoots(t *testing.T) {
+	srv := newTestServer(t)
+	srv.addSigned("hello", []byte("world"))
+
+	other := newRootKeyPair(t)
+	pub, err := parseSinglePublicKey(other.pubRaw, pemTypeRootPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClientWithRoots(t.Logf, srv.srv.URL, []ed25519.PublicKey{pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Download(context.Background(), "hello", filepath.Join(t.TempDir(), "hello")); err == nil {
+		t.Fatal("Download succeeded with untrusted roots")
+	}
+
+	if _, err := NewClientWithRoots(t.Logf, srv.srv.URL, nil); err == nil {
+		t.Fatal("NewClientWithRoots succeeded with no roots")
+	}
+}
+
 func TestRotateRoot(t *testing.T) {
 	srv := newTestServer(t)
 	c1 := srv.client(t)
@@ -353,15 +374,11 @@ func (s *testServer) client(t *testing.T) *Client {
 		}
 		roots = append(roots, pub)
 	}
-	u, err := url.Parse(s.srv.URL)
+	c, err := NewClientWithRoots(t.Logf, s.srv.URL, roots)
 	if err != nil {
 		t.Fatal(err)
 	}
-	return &Client{
-		logf:     t.Logf,
-		roots:    roots,
-		pkgsAddr: u,
-	}
+	return c
 }
 
 func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Reasons that an update can fail, as returned by ErrorReason.
+const (
+	ReasonInsufficientDisk          = "insufficient_disk"
+	ReasonUnsupportedPackageManager = "unsupported_package_manager"
+	ReasonPermissionDenied          = "permission_denied"
+	ReasonNetwork                   = "network"
+	ReasonUnsupported               = "unsupported"  // see errors.ErrUnsupported
+	ReasonUnverifiable              = "unverifiable" // see ErrUnverifiable
+	ReasonUnknown                   = "unknown"
+)
+
+// Error is an update error whose reason is known.
+type Error struct {
+	Reason string // one of the Reason* constants
+	Err    error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorReason returns which of the Reason* constants err, returned by an
+// update, is, or the empty string if err is nil.
+func ErrorReason(err error) string {
+	var e *Error
+	var ne net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &e):
+		return e.Reason
+	case errors.Is(err, syscall.ENOSPC):
+		return ReasonInsufficientDisk
+	case errors.Is(err, exec.ErrNotFound):
+		// The package manager we expected isn't installed.
+		return ReasonUnsupportedPackageManager
+	case errors.Is(err, os.ErrPermission):
+		return ReasonPermissionDenied
+	case errors.Is(err, errors.ErrUnsupported):
+		return ReasonUnsupported
+	case errors.Is(err, ErrUnverifiable):
+		return ReasonUnverifiable
+	case errors.As(err, &ne):
+		return ReasonNetwork
+	}
+	return ReasonUnknown
+}
+
+// reasonExitCodes are the exit codes that "tailscale update" fails with for
+// each reason other than ReasonUnknown, so that a caller running it can tell
+// why it failed.
+var reasonExitCodes = map[string]int{
+	ReasonInsufficientDisk:          10,
+	ReasonUnsupportedPackageManager: 11,
+	ReasonPermissionDenied:          12,
+	ReasonNetwork:                   13,
+	ReasonUnsupported:               14,
+	ReasonUnverifiable:              15,
+}
+
+// ExitCode returns the exit code that "tailscale update" exits with when it
+// fails for reason.
+func ExitCode(reason string) int {
+	if c, ok := reasonExitCodes[reason]; ok {
+		return c
+	}
+	return 1
+}
+
+// ReasonForExitCode returns the reason that "tailscale update" failed, given
+// its exit code, or the empty string if it succeeded.
+func ReasonForExitCode(code int) string {
+	if code == 0 {
+		return ""
+	}
+	for r, c := range reasonExitCodes {
+		if c == code {
+			return r
+		}
+	}
+	return ReasonUnknown
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package clientupdate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestErrorReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"typed", &Error{Reason: ReasonPermissionDenied, Err: errors.New("must be root")}, ReasonPermissionDenied},
+		{"wrapped_typed", fmt.Errorf("update: %w", &Error{Reason: ReasonNetwork, Err: errors.New("x")}), ReasonNetwork},
+		{"enospc", &fs.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC}, ReasonInsufficientDisk},
+		{"eacces", &fs.PathError{Op: "open", Path: "/usr/bin/x", Err: syscall.EACCES}, ReasonPermissionDenied},
+		{"no_package_manager", &exec.Error{Name: "apt-get", Err: exec.ErrNotFound}, ReasonUnsupportedPackageManager},
+		{"unsupported", errors.ErrUnsupported, ReasonUnsupported},
+		{"unverifiable", fmt.Errorf("%w: no signatures", ErrUnverifiable), ReasonUnverifiable},
+		{"network", &url.Error{Op: "Get", URL: "https://pkgs.tailscale.com", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}, ReasonNetwork},
+		{"other", errors.New("something else"), ReasonUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorReason(tt.err); got != tt.want {
+				t.Errorf("ErrorReason(%v) = %q; want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReasonExitCodes(t *testing.T) {
+	if got := ReasonForExitCode(0); got != "" {
+		t.Errorf("ReasonForExitCode(0) = %q; want empty", got)
+	}
+	for _, r := range []string{ReasonUnknown, "bogus"} {
+		if got := ExitCode(r); got != 1 {
+			t.Errorf("ExitCode(%q) = %d; want 1", r, got)
+		}
+	}
+	if got := ReasonForExitCode(1); got != ReasonUnknown {
+		t.Errorf("ReasonForExitCode(1) = %q; want %q", got, ReasonUnknown)
+	}
+	for r := range reasonExitCodes {
+		if got := ReasonForExitCode(ExitCode(r)); got != r {
+			t.Errorf("ReasonForExitCode(ExitCode(%q)) = %q", r, got)
+		}
+	}
+}
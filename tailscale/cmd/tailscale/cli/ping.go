@@ -159,7 +159,11 @@ func runPing(ctx context.Context, args []string) error {
 		if pr.PeerAPIPort != 0 {
 			extra = fmt.Sprintf(", %d", pr.PeerAPIPort)
 		}
-		printf("pong from %s (%s%s) via %v in %v\n", pr.NodeName, pr.NodeIP, extra, via, latency)
+		purpose := ""
+		if pingArgs.verbose && pr.Purpose != "" {
+			purpose = fmt.Sprintf(" (%s ping)", pr.Purpose)
+		}
+		printf("pong from %s (%s%s) via %v in %v%s\n", pr.NodeName, pr.NodeIP, extra, via, latency, purpose)
 		if pingArgs.tsmp || pingArgs.icmp {
 			return nil
 		}
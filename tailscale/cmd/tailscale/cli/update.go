@@ -8,6 +8,7 @@
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
 	"strings"
 
@@ -66,8 +67,18 @@ func runUpdate(ctx context.Context, args []string) error {
 		Logf:     func(format string, args ...any) { fmt.Printf(format+"\n", args...) },
 		Confirm:  confirmUpdate,
 	})
+	if err == nil {
+		return nil
+	}
+	reason := clientupdate.ErrorReason(err)
 	if errors.Is(err, errors.ErrUnsupported) {
-		return errors.New("The 'update' command is not supported on this platform; see https://tailscale.com/s/client-updates")
+		err = errors.New("The 'update' command is not supported on this platform; see https://tailscale.com/s/client-updates")
+	}
+	// Exit with a code that says why the update failed, for the benefit of
+	// tailscaled when it runs this for c2n /update.
+	if code := clientupdate.ExitCode(reason); code != 1 {
+		fmt.Fprintln(Stderr, err)
+		os.Exit(code)
 	}
 	return err
 }
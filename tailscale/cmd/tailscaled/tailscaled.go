@@ -42,6 +42,7 @@
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/netns"
 	"tailscale.com/net/proxymux"
+	"tailscale.com/net/proxystats"
 	"tailscale.com/net/socks5"
 	"tailscale.com/net/tsdial"
 	"tailscale.com/net/tshttpproxy"
@@ -509,16 +510,19 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 	if socksListener != nil || httpProxyListener != nil {
 		var addrs []string
 		if httpProxyListener != nil {
-			hs := &http.Server{Handler: httpProxyHandler(dialer.UserDial)}
+			addr := httpProxyListener.Addr().String()
+			ps := proxystats.Register(proxystats.TypeHTTP, addr)
+			hs := &http.Server{Handler: httpProxyHandler(ps.WrapDialer(dialer.UserDial))}
 			go func() {
 				log.Fatalf("HTTP proxy exited: %v", hs.Serve(httpProxyListener))
 			}()
-			addrs = append(addrs, httpProxyListener.Addr().String())
+			addrs = append(addrs, addr)
 		}
 		if socksListener != nil {
+			ps := proxystats.Register(proxystats.TypeSOCKS5, socksListener.Addr().String())
 			ss := &socks5.Server{
 				Logf:   logger.WithPrefix(logf, "socks5: "),
-				Dialer: dialer.UserDial,
+				Dialer: ps.WrapDialer(dialer.UserDial),
 			}
 			go func() {
 				log.Fatalf("SOCKS5 server exited: %v", ss.Serve(socksListener))
@@ -543,6 +547,10 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 	lb.SetVarRoot(opts.VarRoot)
 	if logPol != nil {
 		lb.SetLogFlusher(logPol.Logtail.StartFlush)
+		lb.SetLogIDRotator(logPol.RotateLogID)
+		lb.SetLogFlushWaiter(logPol.Logtail.PendingBytes, logPol.Logtail.FlushAndWait)
+		lb.SetLogUploadFilterer(logPol.Logtail.SetUploadFilter)
+		lb.SetRecentLogsReader(logPol.Logtail.RecentLogs, logPol.Logtail.TakeRecentLogs)
 	}
 	if root := lb.TailscaleVarRoot(); root != "" {
 		dnsfallback.SetCachePath(filepath.Join(root, "derpmap.cached.json"), logf)
@@ -162,6 +162,13 @@ type Auto struct {
 	inSendStatus   int        // number of sendStatus calls currently in progress
 	state          State
 
+	// lastNetMapAt is when the last netmap arrived, and lastErr and
+	// lastErrAt the last error sent to the observer. They're for
+	// ConnStatus.
+	lastNetMapAt time.Time
+	lastErr      error
+	lastErrAt    time.Time
+
 	authCtx    context.Context // context used for auth requests
 	mapCtx     context.Context // context used for netmap and update requests
 	authCancel func()          // cancel authCtx
@@ -495,6 +502,7 @@ func (mrs mapRoutineState) UpdateFullNetmap(nm *netmap.NetworkMap) {
 		c.state = StateSynchronized
 	}
 	c.expiry = nm.Expiry
+	c.lastNetMapAt = c.clock.Now()
 	stillAuthed := c.loggedIn
 	c.logf("[v1] mapRoutine: netmap received: %s", c.state)
 	c.mu.Unlock()
@@ -619,6 +627,22 @@ func (c *Auto) SetNetInfo(ni *tailcfg.NetInfo) {
 	c.updateControl()
 }
 
+// SetDiscoPublicKey changes the disco key sent to the server, restarting the
+// map poll so that peers learn it promptly.
+func (c *Auto) SetDiscoPublicKey(k key.DiscoPublic) {
+	if !c.direct.SetDiscoPublicKey(k) {
+		return
+	}
+	c.restartMap()
+}
+
+// RestartMap cancels the current map poll, if any, and starts a new one, so
+// that a full netmap is fetched from control. Calls made while a restart is
+// already pending are coalesced into it.
+func (c *Auto) RestartMap() {
+	c.restartMap()
+}
+
 // SetTKAHead updates the TKA head hash that map-request infrastructure sends.
 func (c *Auto) SetTKAHead(headHash string) {
 	if !c.direct.SetTKAHead(headHash) {
@@ -639,6 +663,9 @@ func (c *Auto) sendStatus(who string, err error, url string, nm *netmap.NetworkM
 	loggedIn := c.loggedIn
 	synced := c.synced
 	c.inSendStatus++
+	if err != nil {
+		c.lastErr, c.lastErrAt = err, c.clock.Now()
+	}
 	c.mu.Unlock()
 
 	c.logf("[v1] sendStatus: %s: %v", who, state)
@@ -679,6 +706,12 @@ func (c *Auto) Login(t *tailcfg.Oauth2Token, flags LoginFlags) {
 	c.cancelAuth()
 }
 
+// HasAuthKey reports whether c has an auth key to register with, so that it
+// can log in without a user.
+func (c *Auto) HasAuthKey() bool {
+	return c.direct.HasAuthKey()
+}
+
 func (c *Auto) Logout(ctx context.Context) error {
 	c.logf("client.Logout()")
 
@@ -12,14 +12,16 @@
 	"context"
 
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
 )
 
 type LoginFlags int
 
 const (
-	LoginDefault     = LoginFlags(0)
-	LoginInteractive = LoginFlags(1 << iota) // force user login and key refresh
-	LoginEphemeral                           // set RegisterRequest.Ephemeral
+	LoginDefault       = LoginFlags(0)
+	LoginInteractive   = LoginFlags(1 << iota) // force user login and key refresh
+	LoginEphemeral                             // set RegisterRequest.Ephemeral
+	LoginRotateNodeKey                         // register a new node key, without forcing a user login
 )
 
 // Client represents a client connection to the control server.
@@ -63,6 +65,9 @@ type Client interface {
 	// SetTKAHead changes the TKA head hash value that will be sent in
 	// subsequent netmap requests.
 	SetTKAHead(headHash string)
+	// SetDiscoPublicKey changes the disco key that will be sent in
+	// subsequent netmap requests, such as after magicsock rekeys.
+	SetDiscoPublicKey(key.DiscoPublic)
 	// UpdateEndpoints changes the Endpoint structure that will be sent
 	// in subsequent node registration requests.
 	// TODO: a server-side change would let us simply upload this
@@ -0,0 +1,84 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controlclient
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Connection states of a ConnStatus.
+const (
+	ConnPaused       = "paused"       // network activity is paused
+	ConnLoggedOut    = "logged-out"   // not logged in, so not polling for netmaps
+	ConnConnecting   = "connecting"   // logged in, but no netmap has arrived yet
+	ConnConnected    = "connected"    // the netmap poll is up and synchronized
+	ConnReconnecting = "reconnecting" // the netmap poll ended and is being retried
+)
+
+// ConnStatus is a snapshot of an Auto's connection to the control server,
+// for debugging. It's not a stable interface and could change at any time.
+type ConnStatus struct {
+	ServerURL string
+
+	// Conn is one of the Conn* connection states, and State the Auto's
+	// internal state, which they're derived from.
+	Conn  string
+	State State
+
+	// LastNetMapAt is when the last netmap arrived, or zero if none has.
+	LastNetMapAt time.Time
+
+	// LastErr is the last error from logging in or polling for netmaps,
+	// and LastErrAt when it happened, if there's been one. It may be
+	// from before the connection recovered.
+	LastErr   string
+	LastErrAt time.Time
+
+	// Noise is whether the control server supports the Noise (ts2021)
+	// protocol, which is used for everything if so. NoiseRemoteAddr,
+	// NoiseProtocolVersion and NoiseHTTPS describe the most recent Noise
+	// connection, if there's been one; NoiseHTTPS is whether it fell back
+	// to being tunneled over TLS (port 443) instead of HTTP (port 80).
+	Noise                bool
+	NoiseRemoteAddr      netip.AddrPort
+	NoiseProtocolVersion int
+	NoiseHTTPS           bool
+}
+
+// ConnStatus returns the current state of c's connection to control.
+func (c *Auto) ConnStatus() ConnStatus {
+	c.mu.Lock()
+	st := ConnStatus{
+		State:        c.state,
+		LastNetMapAt: c.lastNetMapAt,
+	}
+	if c.lastErr != nil {
+		st.LastErr, st.LastErrAt = c.lastErr.Error(), c.lastErrAt
+	}
+	switch {
+	case c.paused:
+		st.Conn = ConnPaused
+	case !c.loggedIn:
+		st.Conn = ConnLoggedOut
+	case c.synced:
+		st.Conn = ConnConnected
+	case c.lastNetMapAt.IsZero():
+		st.Conn = ConnConnecting
+	default:
+		st.Conn = ConnReconnecting
+	}
+	c.mu.Unlock()
+
+	d := c.direct
+	d.mu.Lock()
+	st.ServerURL = d.serverURL
+	st.Noise = !d.serverNoiseKey.IsZero()
+	nc := d.noiseClient
+	d.mu.Unlock()
+	if nc != nil {
+		st.NoiseRemoteAddr, st.NoiseProtocolVersion, st.NoiseHTTPS = nc.lastConnInfo()
+	}
+	return st
+}
@@ -4,8 +4,14 @@
 package controlclient
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
+
+	"tailscale.com/logtail/backoff"
+	"tailscale.com/tstest"
+	"tailscale.com/types/netmap"
 )
 
 func fieldsOf(t reflect.Type) (fields []string) {
@@ -67,3 +73,50 @@ func TestStatusEqual(t *testing.T) {
 		}
 	}
 }
+
+type statusFunc func(Status)
+
+func (f statusFunc) SetControlClientStatus(s Status) { f(s) }
+
+func TestAutoConnStatus(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	c := &Auto{
+		direct:   &Direct{serverURL: "https://controlplane.example.com"},
+		clock:    clock,
+		logf:     t.Logf,
+		observer: statusFunc(func(Status) {}),
+	}
+	mrs := mapRoutineState{c: c, bo: backoff.NewBackoff("test", t.Logf, time.Second)}
+	check := func(wantConn string) ConnStatus {
+		t.Helper()
+		st := c.ConnStatus()
+		if st.Conn != wantConn || st.ServerURL != "https://controlplane.example.com" {
+			t.Errorf("ConnStatus = %+v; want %v", st, wantConn)
+		}
+		return st
+	}
+
+	check(ConnLoggedOut)
+	c.loggedIn = true
+	check(ConnConnecting)
+
+	errAt := clock.Now()
+	c.sendStatus("test", errors.New("x509: certificate signed by unknown authority"), "", nil)
+	if st := check(ConnConnecting); st.LastErr != "x509: certificate signed by unknown authority" || !st.LastErrAt.Equal(errAt) {
+		t.Errorf("after error: %+v", st)
+	}
+
+	clock.Advance(time.Second)
+	mrs.UpdateFullNetmap(&netmap.NetworkMap{})
+	st := check(ConnConnected)
+	if st.State != StateSynchronized || !st.LastNetMapAt.Equal(clock.Now()) || st.LastErr == "" {
+		t.Errorf("connected: %+v; want synchronized, with the earlier error", st)
+	}
+
+	// As mapRoutine does when the poll ends.
+	c.synced = false
+	c.state = StateAuthenticated
+	check(ConnReconnecting)
+	c.paused = true
+	check(ConnPaused)
+}
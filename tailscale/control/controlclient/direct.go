@@ -72,7 +72,6 @@ type Direct struct {
 	keepAlive             bool
 	logf                  logger.Logf
 	netMon                *netmon.Monitor // or nil
-	discoPubKey           key.DiscoPublic
 	getMachinePrivKey     func() (key.MachinePrivate, error)
 	debugFlags            []string
 	skipIPForwardingCheck bool
@@ -98,8 +97,11 @@ type Direct struct {
 	hostinfo     *tailcfg.Hostinfo // always non-nil
 	netinfo      *tailcfg.NetInfo
 	endpoints    []tailcfg.Endpoint
+	discoPubKey  key.DiscoPublic
 	tkaHead      string
 	lastPingURL  string // last PingRequest.URL received, for dup suppression
+
+	lastC2NReplyDuration time.Duration // how long the last c2n response took to send, or zero
 }
 
 // Observer is implemented by users of the control client (such as LocalBackend)
@@ -336,6 +338,20 @@ func (c *Direct) SetNetInfo(ni *tailcfg.NetInfo) bool {
 	return true
 }
 
+// SetDiscoPublicKey stores a new disco key for the next map request.
+// It reports whether the disco key changed.
+func (c *Direct) SetDiscoPublicKey(k key.DiscoPublic) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if k == c.discoPubKey {
+		return false
+	}
+	c.discoPubKey = k
+	c.logf("discoKey: %v", k.ShortString())
+	return true
+}
+
 // SetNetInfo stores a new TKA head value for next update.
 // It reports whether the TKA head changed.
 func (c *Direct) SetTKAHead(tkaHead string) bool {
@@ -370,6 +386,14 @@ func (c *Direct) TryLogout(ctx context.Context) error {
 	return err
 }
 
+// HasAuthKey reports whether c has an auth key to register with, so that it
+// can log in without a user.
+func (c *Direct) HasAuthKey() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authKey != ""
+}
+
 func (c *Direct) TryLogin(ctx context.Context, t *tailcfg.Oauth2Token, flags LoginFlags) (url string, err error) {
 	c.logf("[v1] direct.TryLogin(token=%v, flags=%v)", t != nil, flags)
 	return c.doLoginOrRegen(ctx, loginOpt{Token: t, Flags: flags})
@@ -470,6 +494,10 @@ func (c *Direct) doLogin(ctx context.Context, opt loginOpt) (mustRegen bool, new
 			c.logf("LoginInteractive -> regen=true")
 			regen = true
 		}
+		if (opt.Flags & LoginRotateNodeKey) != 0 {
+			c.logf("LoginRotateNodeKey -> regen=true")
+			regen = true
+		}
 	}
 
 	c.logf("doLogin(regen=%v, hasUrl=%v)", regen, opt.URL != "")
@@ -829,6 +857,7 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 	serverNoiseKey := c.serverNoiseKey
 	hi := c.hostInfoLocked()
 	backendLogID := hi.BackendLogID
+	discoPubKey := c.discoPubKey
 	var epStrs []string
 	var epTypes []tailcfg.EndpointType
 	for _, ep := range c.endpoints {
@@ -865,7 +894,7 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 		Version:       tailcfg.CurrentCapabilityVersion,
 		KeepAlive:     c.keepAlive,
 		NodeKey:       persist.PublicNodeKey(),
-		DiscoKey:      c.discoPubKey,
+		DiscoKey:      discoPubKey,
 		Endpoints:     epStrs,
 		EndpointTypes: epTypes,
 		Stream:        isStreaming,
@@ -1416,7 +1445,27 @@ func (c *Direct) answerPing(pr *tailcfg.PingRequest) {
 			c.logf("refusing to answer c2n ping without noise")
 			return
 		}
-		answerC2NPing(c.logf, c.c2nHandler, httpc, pr)
+		info := C2NRequestInfo{
+			Transport:  "http",
+			ReceivedAt: c.clock.Now(),
+		}
+		if u, err := url.Parse(c.serverURL); err == nil {
+			info.ControlHost = u.Hostname()
+		}
+		if useNoise {
+			info.Transport = "noise"
+			if nc, err := c.getNoiseClient(); err == nil {
+				info.RemoteAddr, info.NoiseProtocolVersion, _ = nc.lastConnInfo()
+			}
+		}
+		c.mu.Lock()
+		info.LastReplyDuration = c.lastC2NReplyDuration
+		c.mu.Unlock()
+		if d, ok := answerC2NPing(c.logf, c.c2nHandler, httpc, pr, info); ok {
+			c.mu.Lock()
+			c.lastC2NReplyDuration = d
+			c.mu.Unlock()
+		}
 		return
 	}
 	for _, t := range strings.Split(pr.Types, ",") {
@@ -1451,15 +1500,56 @@ func answerHeadPing(logf logger.Logf, c *http.Client, pr *tailcfg.PingRequest) {
 	}
 }
 
-func answerC2NPing(logf logger.Logf, c2nHandler http.Handler, c *http.Client, pr *tailcfg.PingRequest) {
+// C2NRequestInfo describes how a c2n request reached this node. It's
+// available to the c2n handler via C2NRequestInfoFromContext.
+//
+// c2n requests always arrive in a map response on the map poll to control,
+// and their responses are sent back to control in a new request; they never
+// go via DERP or a peer.
+type C2NRequestInfo struct {
+	// Transport is "noise" if the request and its response are carried
+	// over the Noise (ts2021) connection to control, or "http" if not,
+	// which is only allowed for debugging with TS_DEBUG_PERMIT_HTTP_C2N.
+	Transport string
+
+	// ControlHost is the hostname of the control server.
+	ControlHost string
+
+	// RemoteAddr is the address of control on the most recent Noise
+	// connection to it, if known. NoiseProtocolVersion is the Noise
+	// protocol version of that connection.
+	RemoteAddr           netip.AddrPort
+	NoiseProtocolVersion int
+
+	// ReceivedAt is when the request was received.
+	ReceivedAt time.Time
+
+	// LastReplyDuration is how long sending the response to the previous
+	// c2n request to control took, or zero if that's not known.
+	LastReplyDuration time.Duration
+}
+
+type c2nRequestInfoKey struct{}
+
+// C2NRequestInfoFromContext returns how the c2n request with context ctx
+// reached this node, if it's one.
+func C2NRequestInfoFromContext(ctx context.Context) (_ C2NRequestInfo, ok bool) {
+	info, ok := ctx.Value(c2nRequestInfoKey{}).(C2NRequestInfo)
+	return info, ok
+}
+
+// answerC2NPing handles the c2n request in pr, which reached this node as
+// described by info, and sends the response to control. If that succeeds,
+// it reports how long sending it took.
+func answerC2NPing(logf logger.Logf, c2nHandler http.Handler, c *http.Client, pr *tailcfg.PingRequest, info C2NRequestInfo) (replyDuration time.Duration, ok bool) {
 	if c2nHandler == nil {
 		logf("answerC2NPing: c2nHandler not defined")
-		return
+		return 0, false
 	}
 	hreq, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(pr.Payload)))
 	if err != nil {
 		logf("answerC2NPing: ReadRequest: %v", err)
-		return
+		return 0, false
 	}
 	if pr.Log {
 		logf("answerC2NPing: got c2n request for %v ...", hreq.RequestURI)
@@ -1470,7 +1560,7 @@ func answerC2NPing(logf logger.Logf, c2nHandler http.Handler, c *http.Client, pr
 	}
 	handlerCtx, cancel := context.WithTimeout(context.Background(), handlerTimeout)
 	defer cancel()
-	hreq = hreq.WithContext(handlerCtx)
+	hreq = hreq.WithContext(context.WithValue(handlerCtx, c2nRequestInfoKey{}, info))
 	rec := httptest.NewRecorder()
 	c2nHandler.ServeHTTP(rec, hreq)
 	cancel()
@@ -1484,7 +1574,7 @@ func answerC2NPing(logf logger.Logf, c2nHandler http.Handler, c *http.Client, pr
 	req, err := http.NewRequestWithContext(replyCtx, "POST", pr.URL, c2nResBuf)
 	if err != nil {
 		logf("answerC2NPing: NewRequestWithContext: %v", err)
-		return
+		return 0, false
 	}
 	if pr.Log {
 		logf("answerC2NPing: sending POST ping to %v ...", pr.URL)
@@ -1494,9 +1584,12 @@ func answerC2NPing(logf logger.Logf, c2nHandler http.Handler, c *http.Client, pr
 	d := time.Since(t0).Round(time.Millisecond)
 	if err != nil {
 		logf("answerC2NPing error: %v to %v (after %v)", err, pr.URL, d)
-	} else if pr.Log {
+		return 0, false
+	}
+	if pr.Log {
 		logf("answerC2NPing complete to %v (after %v)", pr.URL, d)
 	}
+	return d, true
 }
 
 // sleepAsRequest implements the sleep for a tailcfg.Debug message requesting
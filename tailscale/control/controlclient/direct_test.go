@@ -4,11 +4,14 @@
 package controlclient
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
+	"strings"
 	"testing"
 	"time"
 
@@ -147,6 +150,49 @@ func TestTsmpPing(t *testing.T) {
 	}
 }
 
+func TestAnswerC2NPingRequestInfo(t *testing.T) {
+	want := C2NRequestInfo{
+		Transport:            "noise",
+		ControlHost:          "controlplane.tailscale.com",
+		RemoteAddr:           netip.MustParseAddrPort("1.2.3.4:443"),
+		NoiseProtocolVersion: 1,
+		ReceivedAt:           time.Now(),
+	}
+	var got C2NRequestInfo
+	var gotOK bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, gotOK = C2NRequestInfoFromContext(r.Context())
+		io.WriteString(w, "hi")
+	})
+
+	replies := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		replies <- string(b)
+	}))
+	defer ts.Close()
+
+	pr := &tailcfg.PingRequest{
+		URL:     ts.URL,
+		Types:   "c2n",
+		Payload: []byte("GET /echo/info HTTP/1.1\r\nHost: node\r\n\r\n"),
+	}
+	d, ok := answerC2NPing(t.Logf, handler, ts.Client(), pr, want)
+	if !ok || d < 0 {
+		t.Fatalf("answerC2NPing = %v, %v; want success", d, ok)
+	}
+	if !gotOK || got != want {
+		t.Errorf("handler got info %+v, %v; want %+v", got, gotOK, want)
+	}
+	if reply := <-replies; !strings.Contains(reply, "200 OK") || !strings.HasSuffix(reply, "hi") {
+		t.Errorf("reply = %q; want the handler's 200 response", reply)
+	}
+
+	if _, ok := C2NRequestInfoFromContext(context.Background()); ok {
+		t.Error("got info from a context without any")
+	}
+}
+
 func TestDecodeWrappedAuthkey(t *testing.T) {
 	k, isWrapped, sig, priv := decodeWrappedAuthkey("tskey-32mjsdkdsffds9o87dsfkjlh", nil)
 	if want := "tskey-32mjsdkdsffds9o87dsfkjlh"; k != want {
@@ -11,7 +11,9 @@
 	"errors"
 	"io"
 	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"sync"
 	"time"
@@ -41,6 +43,8 @@ type noiseConn struct {
 	pool *NoiseClient
 	h2cc *http2.ClientConn
 
+	overHTTPS bool // whether it's tunneled over TLS; see controlhttp.ClientConn.HTTPS
+
 	readHeaderOnce    sync.Once     // guards init of reader field
 	reader            io.Reader     // (effectively Conn.Reader after header)
 	earlyPayloadReady chan struct{} // closed after earlyPayload is set (including set to nil)
@@ -346,6 +350,23 @@ func (nc *NoiseClient) getConn(ctx context.Context) (*noiseConn, error) {
 	}
 }
 
+// lastConnInfo returns the remote address and Noise protocol version of nc's
+// most recent connection, and whether it fell back to being tunneled over
+// TLS, or zero values if it hasn't made one.
+func (nc *NoiseClient) lastConnInfo() (remote netip.AddrPort, protocolVersion int, overHTTPS bool) {
+	nc.mu.Lock()
+	last := nc.last
+	nc.mu.Unlock()
+	if last == nil {
+		return netip.AddrPort{}, 0, false
+	}
+	if a, ok := last.RemoteAddr().(*net.TCPAddr); ok {
+		ap := a.AddrPort()
+		remote = netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+	}
+	return remote, last.ProtocolVersion(), last.overHTTPS
+}
+
 func (nc *NoiseClient) RoundTrip(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
 	conn, err := nc.getConn(ctx)
@@ -462,6 +483,7 @@ func (nc *NoiseClient) dial(ctx context.Context) (*noiseConn, error) {
 		id:                connID,
 		pool:              nc,
 		earlyPayloadReady: make(chan struct{}),
+		overHTTPS:         clientConn.HTTPS,
 	}
 
 	h2cc, err := nc.h2t.NewClientConn(ncc)
@@ -377,7 +377,8 @@ func (a *Dialer) dialURL(ctx context.Context, u *url.URL, addr netip.Addr) (*Cli
 		return nil, err
 	}
 	return &ClientConn{
-		Conn: cbConn,
+		Conn:  cbConn,
+		HTTPS: u.Scheme == "https",
 	}, nil
 }
 
@@ -14,4 +14,9 @@
 type ClientConn struct {
 	// Conn is the noise connection.
 	*controlbase.Conn
+
+	// HTTPS is whether the connection is tunneled over TLS to the
+	// Dialer's HTTPSPort, the fallback for when HTTP to its HTTPPort
+	// doesn't work.
+	HTTPS bool
 }
@@ -253,6 +253,9 @@ func testControlHTTP(t *testing.T, param httpTestParam) {
 	if proxy != nil && !proxy.ConnIsFromProxy(si.clientAddr) {
 		t.Fatalf("client connected from %s, which isn't the proxy", si.clientAddr)
 	}
+	if proxy == nil && conn.HTTPS != param.makeHTTPHangAfterUpgrade {
+		t.Errorf("conn.HTTPS = %v; want it only if port 80 is broken", conn.HTTPS)
+	}
 	if param.doEarlyWrite {
 		buf := make([]byte, len(earlyWriteMsg))
 		if _, err := io.ReadFull(conn, buf); err != nil {
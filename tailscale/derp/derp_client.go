@@ -12,6 +12,7 @@
 	"io"
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go4.org/mem"
@@ -42,9 +43,52 @@ type Client struct {
 	peeked  int                      // bytes to discard on next Recv
 	readErr syncs.AtomicValue[error] // sticky (set by Recv)
 
+	// Traffic counters, reported by Stats.
+	packetsSent        atomic.Int64
+	bytesSent          atomic.Int64
+	packetsRateLimited atomic.Int64
+	packetsRecv        atomic.Int64
+	bytesRecv          atomic.Int64
+
 	clock tstime.Clock
 }
 
+// ClientStats are a Client's traffic counters, as returned by Client.Stats.
+type ClientStats struct {
+	PacketsSent int64 // packets written to the server
+	BytesSent   int64 // payload bytes of PacketsSent
+	PacketsRecv int64 // packets received from the server
+	BytesRecv   int64 // payload bytes of PacketsRecv
+
+	// PacketsRateLimited is the number of outbound packets dropped
+	// because they exceeded the rate limit requested by the server.
+	PacketsRateLimited int64
+
+	// RateLimitBytesPerSecond and RateLimitBurst are the server-requested
+	// send rate limit, if any. They're zero if the server hasn't
+	// requested one.
+	RateLimitBytesPerSecond int
+	RateLimitBurst          int
+}
+
+// Stats returns c's traffic counters.
+func (c *Client) Stats() ClientStats {
+	st := ClientStats{
+		PacketsSent:        c.packetsSent.Load(),
+		BytesSent:          c.bytesSent.Load(),
+		PacketsRecv:        c.packetsRecv.Load(),
+		BytesRecv:          c.bytesRecv.Load(),
+		PacketsRateLimited: c.packetsRateLimited.Load(),
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.rate != nil {
+		st.RateLimitBytesPerSecond = int(c.rate.Limit())
+		st.RateLimitBurst = c.rate.Burst()
+	}
+	return st
+}
+
 // ClientOpt is an option passed to NewClient.
 type ClientOpt interface {
 	update(*clientOpt)
@@ -219,6 +263,7 @@ func (c *Client) send(dstKey key.NodePublic, pkt []byte) (ret error) {
 	if c.rate != nil {
 		pktLen := frameHeaderLen + key.NodePublicRawLen + len(pkt)
 		if !c.rate.AllowN(c.clock.Now(), pktLen) {
+			c.packetsRateLimited.Add(1)
 			return nil // drop
 		}
 	}
@@ -231,7 +276,12 @@ func (c *Client) send(dstKey key.NodePublic, pkt []byte) (ret error) {
 	if _, err := c.bw.Write(pkt); err != nil {
 		return err
 	}
-	return c.bw.Flush()
+	if err := c.bw.Flush(); err != nil {
+		return err
+	}
+	c.packetsSent.Add(1)
+	c.bytesSent.Add(int64(len(pkt)))
+	return nil
 }
 
 func (c *Client) ForwardPacket(srcKey, dstKey key.NodePublic, pkt []byte) (err error) {
@@ -569,6 +619,8 @@ func (c *Client) recvTimeout(timeout time.Duration) (m ReceivedMessage, err erro
 			}
 			rp.Source = key.NodePublicFromRaw32(mem.B(b[:keyLen]))
 			rp.Data = b[keyLen:n]
+			c.packetsRecv.Add(1)
+			c.bytesRecv.Add(int64(len(rp.Data)))
 			return rp, nil
 
 		case framePing:
@@ -1485,6 +1485,20 @@ func TestClientSendRateLimiting(t *testing.T) {
 	if bytesLimited < bytes1*2 || bytesLimited >= bytes1K {
 		t.Errorf("limited conn's bytes count = %v; want >=%v, <%v", bytesLimited, bytes1K*2, bytes1K)
 	}
+
+	st := c.Stats()
+	if got, want := st.PacketsSent+st.PacketsRateLimited, int64(2001); got != want {
+		t.Errorf("sent+rate-limited packets = %v; want %v", got, want)
+	}
+	if got, want := st.PacketsRateLimited, int64(1000-writesLimited); got != want {
+		t.Errorf("PacketsRateLimited = %v; want %v", got, want)
+	}
+	if got, want := st.BytesSent, st.PacketsSent*int64(len(pkt)); got != want {
+		t.Errorf("BytesSent = %v; want %v", got, want)
+	}
+	if st.RateLimitBytesPerSecond != 1 || st.RateLimitBurst != int(bytes1*2) {
+		t.Errorf("rate limit = %v/%v; want 1/%v", st.RateLimitBytesPerSecond, st.RateLimitBurst, bytes1*2)
+	}
 }
 
 func TestServerRepliesToPing(t *testing.T) {
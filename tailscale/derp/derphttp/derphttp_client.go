@@ -242,6 +242,18 @@ func (c *Client) urlString(node *tailcfg.DERPNode) string {
 	return fmt.Sprintf("%s://%s/derp", proto, node.HostName)
 }
 
+// Stats returns the traffic counters of the current DERP connection. It
+// reports ok=false if c isn't currently connected.
+func (c *Client) Stats() (_ derp.ClientStats, ok bool) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return derp.ClientStats{}, false
+	}
+	return client.Stats(), true
+}
+
 // AddressFamilySelector decides whether IPv6 is preferred for
 // outbound dials.
 type AddressFamilySelector interface {
@@ -261,6 +273,24 @@ func (c *Client) SetAddressFamilySelector(s AddressFamilySelector) {
 	c.addrFamSelAtomic.Store(s)
 }
 
+// AddressFamilyRestrictor is an optional interface that an
+// AddressFamilySelector may implement to forbid outbound dials over an
+// address family entirely, rather than merely expressing a preference.
+type AddressFamilyRestrictor interface {
+	// AllowDialProto reports whether dials with the given network
+	// ("tcp4" or "tcp6") are permitted.
+	AllowDialProto(proto string) bool
+}
+
+// allowDialProto reports whether the AddressFamilySelector, if any,
+// permits dialing proto.
+func (c *Client) allowDialProto(proto string) bool {
+	if r, ok := c.addrFamSelAtomic.Load().(AddressFamilyRestrictor); ok {
+		return r.AllowDialProto(proto)
+	}
+	return true
+}
+
 func (c *Client) preferIPv6() bool {
 	if s, ok := c.addrFamSelAtomic.Load().(AddressFamilySelector); ok {
 		return s.PreferIPv6()
@@ -692,14 +722,14 @@ type res struct {
 			}
 		}()
 	}
-	if shouldDialProto(n.IPv4, netip.Addr.Is4) {
+	if shouldDialProto(n.IPv4, netip.Addr.Is4) && c.allowDialProto("tcp4") {
 		startDial(n.IPv4, "tcp4")
 	}
-	if shouldDialProto(n.IPv6, netip.Addr.Is6) {
+	if shouldDialProto(n.IPv6, netip.Addr.Is6) && c.allowDialProto("tcp6") {
 		startDial(n.IPv6, "tcp6")
 	}
 	if nwait == 0 {
-		return nil, errors.New("both IPv4 and IPv6 are explicitly disabled for node")
+		return nil, errors.New("both IPv4 and IPv6 are disabled for node")
 	}
 
 	var firstErr error
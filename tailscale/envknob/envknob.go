@@ -408,6 +408,21 @@ func NoLogsNoSupport() bool {
 // admin on the admin console).
 func AllowsRemoteUpdate() bool { return allowRemoteUpdate() }
 
+var allowC2NMutations = RegisterBool("TS_ALLOW_C2N_MUTATIONS")
+
+// AllowsC2NMutations reports whether this node has opted-in to letting the
+// Tailscale control plane make debug requests that change its state or have
+// external side effects (e.g. re-issuing a TLS cert), as opposed to ones that
+// only report state.
+func AllowsC2NMutations() bool { return allowC2NMutations() }
+
+var allowC2NPacketCapture = RegisterBool("TS_ALLOW_C2N_PACKET_CAPTURE")
+
+// AllowsC2NPacketCapture reports whether this node has opted-in to letting
+// the Tailscale control plane capture the packets it sends and receives over
+// Tailscale, for debugging.
+func AllowsC2NPacketCapture() bool { return allowC2NPacketCapture() }
+
 // SetNoLogsNoSupport enables no-logs-no-support mode.
 func SetNoLogsNoSupport() {
 	Setenv("TS_NO_LOGS_NO_SUPPORT", "true")
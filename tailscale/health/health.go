@@ -411,7 +411,10 @@ func selfCheckLocked() {
 		// Don't check yet.
 		return
 	}
-	setLocked(SysOverall, overallErrorLocked())
+	now := time.Now()
+	ps := problemsLocked(now)
+	noteProblemsLocked(ps, now)
+	setLocked(SysOverall, overallErrorOf(ps))
 }
 
 // OverallError returns a summary of the health state.
@@ -421,44 +424,139 @@ func selfCheckLocked() {
 func OverallError() error {
 	mu.Lock()
 	defer mu.Unlock()
-	return overallErrorLocked()
+	return overallErrorOf(problemsLocked(time.Now()))
+}
+
+// Severity is how bad a Warning is.
+type Severity string
+
+const (
+	// SeverityError is a problem that likely stops the node from working
+	// at all, such as the network being down. When there is one, the
+	// OverallError is only the first such problem.
+	SeverityError = Severity("error")
+
+	// SeverityWarning is a problem that may only affect part of what the
+	// node does, such as DNS or one DERP region.
+	SeverityWarning = Severity("warning")
+)
+
+// Warning is a current health problem.
+type Warning struct {
+	// Code identifies the kind of problem, such as "network-down" or
+	// "derp-region-problem". There may be more than one Warning with the
+	// same code, such as for different DERP regions.
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+
+	// Since is roughly when the problem started: when it was first seen
+	// by a health check, which runs on every change of health state and
+	// at least once a minute.
+	Since time.Time `json:"since"`
+}
+
+// Warnings returns the current health problems, most severe first. It's
+// empty if the node is healthy.
+func Warnings() []Warning {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	ps := problemsLocked(now)
+	noteProblemsLocked(ps, now)
+	ret := make([]Warning, len(ps))
+	for i, p := range ps {
+		ret[i] = Warning{
+			Code:     p.code,
+			Severity: p.severity,
+			Message:  p.err.Error(),
+			Since:    problemSince[p.key],
+		}
+	}
+	return ret
+}
+
+// problem is a current health problem, as found by problemsLocked.
+type problem struct {
+	code     string
+	key      string // code plus whatever distinguishes this instance of it
+	severity Severity
+	err      error
+}
+
+// problemSince is when each current problem, by problem.key, was first
+// seen. It's guarded by mu.
+var problemSince = map[string]time.Time{}
+
+// noteProblemsLocked records when each of ps was first seen, forgetting
+// those that have been resolved.
+func noteProblemsLocked(ps []problem, now time.Time) {
+	current := make(set.Set[string], len(ps))
+	for _, p := range ps {
+		current.Add(p.key)
+		if _, ok := problemSince[p.key]; !ok {
+			problemSince[p.key] = now
+		}
+	}
+	for k := range problemSince {
+		if !current.Contains(k) {
+			delete(problemSince, k)
+		}
+	}
+}
+
+// overallErrorOf returns the OverallError for problems ps, as returned by
+// problemsLocked.
+func overallErrorOf(ps []problem) error {
+	var errs []error
+	for _, p := range ps {
+		if p.severity == SeverityError {
+			return p.err
+		}
+		errs = append(errs, p.err)
+	}
+	return multierr.New(errs...)
 }
 
 var fakeErrForTesting = envknob.RegisterString("TS_DEBUG_FAKE_HEALTH_ERROR")
 
-func overallErrorLocked() error {
+// problemsLocked returns the current health problems: those of
+// SeverityError first, in the order they're checked, and then the rest
+// sorted by message.
+func problemsLocked(now time.Time) []problem {
+	var ps []problem
+	fatal := func(code string, err error) {
+		ps = append(ps, problem{code: code, key: code, severity: SeverityError, err: err})
+	}
 	if !anyInterfaceUp {
-		return errors.New("network down")
+		fatal("network-down", errors.New("network down"))
 	}
 	if localLogConfigErr != nil {
-		return localLogConfigErr
+		fatal("local-log-config", localLogConfigErr)
 	}
 	if !ipnWantRunning {
-		return fmt.Errorf("state=%v, wantRunning=%v", ipnState, ipnWantRunning)
+		fatal("not-running", fmt.Errorf("state=%v, wantRunning=%v", ipnState, ipnWantRunning))
 	}
 	if lastLoginErr != nil {
-		return fmt.Errorf("not logged in, last login error=%v", lastLoginErr)
+		fatal("login-error", fmt.Errorf("not logged in, last login error=%v", lastLoginErr))
 	}
-	now := time.Now()
 	if !inMapPoll && (lastMapPollEndedAt.IsZero() || now.Sub(lastMapPollEndedAt) > 10*time.Second) {
-		return errors.New("not in map poll")
+		fatal("not-in-map-poll", errors.New("not in map poll"))
 	}
 	const tooIdle = 2*time.Minute + 5*time.Second
 	if d := now.Sub(lastStreamedMapResponse).Round(time.Second); d > tooIdle {
-		return fmt.Errorf("no map response in %v", d)
+		fatal("map-response-idle", fmt.Errorf("no map response in %v", d))
 	}
 	rid := derpHomeRegion
 	if rid == 0 {
-		return errors.New("no DERP home")
-	}
-	if !derpRegionConnected[rid] {
-		return fmt.Errorf("not connected to home DERP region %v", rid)
-	}
-	if d := now.Sub(derpRegionLastFrame[rid]).Round(time.Second); d > tooIdle {
-		return fmt.Errorf("haven't heard from home DERP region %v in %v", rid, d)
+		fatal("no-derp-home", errors.New("no DERP home"))
+	} else if !derpRegionConnected[rid] {
+		fatal("derp-home-disconnected", fmt.Errorf("not connected to home DERP region %v", rid))
+	} else if d := now.Sub(derpRegionLastFrame[rid]).Round(time.Second); d > tooIdle {
+		fatal("derp-home-idle", fmt.Errorf("haven't heard from home DERP region %v in %v", rid, d))
 	}
 	if udp4Unbound {
-		return errors.New("no udp4 bind")
+		fatal("udp4-unbound", errors.New("no udp4 bind"))
 	}
 
 	// TODO: use
@@ -467,43 +565,47 @@ func overallErrorLocked() error {
 	_ = lastStreamedMapResponse
 	_ = lastMapRequestHeard
 
-	var errs []error
+	numFatal := len(ps)
+	warn := func(code, instance string, err error) {
+		ps = append(ps, problem{code: code, key: code + "/" + instance, severity: SeverityWarning, err: err})
+	}
 	for _, recv := range receiveFuncs {
 		if recv.missing {
-			errs = append(errs, fmt.Errorf("%s is not running", recv.name))
+			warn("receive-func-missing", recv.name, fmt.Errorf("%s is not running", recv.name))
 		}
 	}
 	for sys, err := range sysErr {
 		if err == nil || sys == SysOverall {
 			continue
 		}
-		errs = append(errs, fmt.Errorf("%v: %w", sys, err))
+		warn("subsystem-"+string(sys), "", fmt.Errorf("%v: %w", sys, err))
 	}
 	for w := range warnables {
 		if err := w.get(); err != nil {
-			errs = append(errs, err)
+			warn("warnable", fmt.Sprintf("%p", w), err)
 		}
 	}
-	for regionID, problem := range derpRegionHealthProblem {
-		errs = append(errs, fmt.Errorf("derp%d: %v", regionID, problem))
+	for regionID, msg := range derpRegionHealthProblem {
+		warn("derp-region-problem", fmt.Sprint(regionID), fmt.Errorf("derp%d: %v", regionID, msg))
 	}
 	for _, s := range controlHealth {
-		errs = append(errs, errors.New(s))
+		warn("control", s, errors.New(s))
 	}
 	if err := envknob.ApplyDiskConfigError(); err != nil {
-		errs = append(errs, err)
+		warn("disk-config", "", err)
 	}
 	for serverName, err := range tlsConnectionErrors {
-		errs = append(errs, fmt.Errorf("TLS connection error for %q: %w", serverName, err))
+		warn("tls-connection-error", serverName, fmt.Errorf("TLS connection error for %q: %w", serverName, err))
 	}
-	if e := fakeErrForTesting(); len(errs) == 0 && e != "" {
-		return errors.New(e)
+	if e := fakeErrForTesting(); len(ps) == 0 && e != "" {
+		warn("fake", "", errors.New(e))
 	}
-	sort.Slice(errs, func(i, j int) bool {
+	rest := ps[numFatal:]
+	sort.Slice(rest, func(i, j int) bool {
 		// Not super efficient (stringifying these in a sort), but probably max 2 or 3 items.
-		return errs[i].Error() < errs[j].Error()
+		return rest[i].err.Error() < rest[j].err.Error()
 	})
-	return multierr.New(errs...)
+	return ps
 }
 
 var (
@@ -32,6 +32,53 @@ func TestAppendWarnableDebugFlags(t *testing.T) {
 	}
 }
 
+func TestWarnings(t *testing.T) {
+	resetWarnables()
+	find := func(code string) *Warning {
+		for _, w := range Warnings() {
+			if w.Code == code {
+				return &w
+			}
+		}
+		return nil
+	}
+
+	SetAnyInterfaceUp(false)
+	t.Cleanup(func() { SetAnyInterfaceUp(true) })
+	SetDERPRegionHealth(7, "too slow")
+	t.Cleanup(func() { SetDERPRegionHealth(7, "") })
+
+	down := find("network-down")
+	if down == nil || down.Severity != SeverityError || down.Message != "network down" || down.Since.IsZero() {
+		t.Fatalf("network-down warning = %+v", down)
+	}
+	if got := OverallError(); got == nil || got.Error() != "network down" {
+		t.Errorf("OverallError = %v; want only the first error", got)
+	}
+	derp := find("derp-region-problem")
+	if derp == nil || derp.Severity != SeverityWarning || derp.Message != "derp7: too slow" {
+		t.Errorf("derp-region-problem warning = %+v", derp)
+	}
+	if ws := Warnings(); ws[0].Severity != SeverityError {
+		t.Errorf("first warning = %+v; want most severe first", ws[0])
+	}
+
+	// A continuing problem keeps when it started.
+	if again := find("network-down"); again == nil || !again.Since.Equal(down.Since) {
+		t.Errorf("network-down later = %+v; want Since %v", again, down.Since)
+	}
+
+	// Resolved ones go away, and if they recur, it's a new problem.
+	SetAnyInterfaceUp(true)
+	if w := find("network-down"); w != nil {
+		t.Errorf("after interface up, got %+v", w)
+	}
+	SetAnyInterfaceUp(false)
+	if w := find("network-down"); w == nil || w.Since.Before(down.Since) {
+		t.Errorf("recurring network-down = %+v", w)
+	}
+}
+
 func resetWarnables() {
 	mu.Lock()
 	defer mu.Unlock()
@@ -4,141 +4,1810 @@
 package ipnlocal
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"tailscale.com/clientupdate"
+	"tailscale.com/control/controlclient"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
+	"tailscale.com/hostinfo"
+	"tailscale.com/ipn"
+	"tailscale.com/net/dns"
+	"tailscale.com/net/dns/resolver"
+	"tailscale.com/net/dropstats"
+	"tailscale.com/net/netutil"
+	"tailscale.com/net/proxystats"
 	"tailscale.com/net/sockstats"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/net/tstun"
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logid"
+	"tailscale.com/types/preftype"
+	"tailscale.com/types/views"
 	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/cmpver"
+	"tailscale.com/util/dnsname"
 	"tailscale.com/util/goroutines"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/panics"
+	"tailscale.com/util/sysresources"
 	"tailscale.com/version"
+	"tailscale.com/version/distro"
+	"tailscale.com/wgengine/magicsock"
+	"tailscale.com/wgengine/wglog"
 )
 
-var c2nLogHeap func(http.ResponseWriter, *http.Request) // non-nil on most platforms (c2n_pprof.go)
+var c2nLogHeap func(http.ResponseWriter, *http.Request) // set by c2n_pprof.go
+
+// c2nCPUProfile writes a CPU profile of duration d to w.
+var c2nCPUProfile func(w http.ResponseWriter, r *http.Request, d time.Duration) // non-nil on most platforms (c2n_cpuprofile.go)
+
+// Default and maximum durations for /debug/cpuprofile.
+const (
+	c2nCPUProfileDefault = 30 * time.Second
+	c2nCPUProfileMax     = 120 * time.Second
+)
+
+// parseCPUProfileSeconds parses the /debug/cpuprofile "seconds" form value,
+// returning the default if it's empty and capping it at the maximum.
+func parseCPUProfileSeconds(v string) (time.Duration, error) {
+	if v == "" {
+		return c2nCPUProfileDefault, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid seconds %q", v)
+	}
+	return min(time.Duration(n)*time.Second, c2nCPUProfileMax), nil
+}
+
+// c2nRoute is how requests to a c2n path are handled.
+type c2nRoute struct {
+	// methods are the HTTP methods the path accepts, or c2nAny. Requests
+	// with any other method get a 405.
+	methods []string
+
+	// mutates is whether requests to the path with methods other than
+	// GET change the node's state or have external side effects, and so
+	// are refused unless the node has opted in with
+	// envknob.AllowsC2NMutations.
+	//
+	// Some paths that change state aren't marked as mutating:
+	//   - /update and /restart are gated by envknob.AllowsRemoteUpdate
+	//     instead, as /update was before it was in c2nRoutes.
+	//   - /logtail/rotate, POST /logtail/tail, DELETE /debug/panics and
+	//     /update/history, and POST reset=true to /debug/drops,
+	//     /debug/handshake-failures and /debug/magicsock/stats only change
+	//     what the node logs or reports, not how it's configured or connects.
+	//   - /refresh restarts the map poll, as the node does itself whenever
+	//     its network changes.
+	//   - /debug/captive-portal/recheck only probes the network and
+	//     re-STUNs, like /debug/netcheck.
+	mutates bool
+
+	// audited is whether requests to the path with methods other than
+	// GET are counted in c2nMutationMetrics, as for paths that mutate,
+	// without being refused unless the node has opted in.
+	audited bool
+
+	// maxBody is the most bytes of request body that the handler may
+	// read, or zero for c2nDefaultMaxBody. Reading more fails with an
+	// *http.MaxBytesError.
+	maxBody int64
+
+	handle func(*LocalBackend, http.ResponseWriter, *http.Request)
+}
+
+// c2nAnyMethod, in a c2nRoute's methods, accepts requests with any method.
+const c2nAnyMethod = "*"
+
+// Method lists for c2nRoutes.
+var (
+	// c2nAny is for the paths that accepted any method before c2nRoutes,
+	// which still do so as not to break their callers.
+	c2nAny = []string{c2nAnyMethod}
+
+	c2nGet      = []string{"GET"}
+	c2nPost     = []string{"POST"}
+	c2nGetPost  = []string{"GET", "POST"}
+	c2nGetPatch = []string{"GET", "PATCH"}
+)
+
+// c2nRoutes are the c2n paths that handleC2N serves, unless they're
+// disabled with TS_DISABLE_C2N_PATHS. Requests to other paths get a 400.
+var c2nRoutes = map[string]c2nRoute{
+	"/echo":           {methods: c2nAny, maxBody: 1 << 20, handle: (*LocalBackend).handleC2NEcho},
+	"/echo/info":      {methods: c2nGet, handle: (*LocalBackend).handleC2NEchoInfo},
+	"/echo/stream":    {methods: c2nGetPost, maxBody: c2nEchoStreamMaxBytes, handle: (*LocalBackend).handleC2NEchoStream},
+	"/update":         {methods: c2nGetPost, audited: true, handle: (*LocalBackend).handleC2NUpdate},
+	"/update/history": {methods: []string{"GET", "DELETE"}, handle: (*LocalBackend).handleC2NUpdateHistory},
+	"/update/info":    {methods: c2nGet, handle: (*LocalBackend).handleC2NUpdateInfo},
+	"/restart":        {methods: c2nPost, audited: true, handle: (*LocalBackend).handleC2NRestart},
+	"/ping":           {methods: c2nPost, handle: (*LocalBackend).handleC2NPing},
+	"/logtail/rotate": {methods: c2nPost, audited: true, handle: (*LocalBackend).handleC2NLogtailRotate},
+	"/logtail/flush":  {methods: c2nPost, handle: (*LocalBackend).handleC2NLogtailFlush},
+	"/logtail/level":  {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NLogtailLevel},
+	"/logtail/tail":   {methods: c2nGetPost, handle: (*LocalBackend).handleC2NLogtailTail},
+	"/refresh":        {methods: c2nPost, handle: (*LocalBackend).handleC2NRefresh},
+	"/health":         {methods: c2nGetPost, handle: (*LocalBackend).handleC2NHealth},
+
+	"/debug/goroutines":               {methods: c2nAny, handle: (*LocalBackend).handleC2NDebugGoroutines},
+	"/debug/runtime":                  {methods: c2nGet, handle: (*LocalBackend).handleC2NDebugRuntime},
+	"/debug/prefs":                    {methods: c2nAny, handle: (*LocalBackend).handleC2NDebugPrefs},
+	"/debug/metrics":                  {methods: c2nAny, handle: (*LocalBackend).handleC2NDebugMetrics},
+	"/debug/component-logging/status": {methods: c2nGet, handle: (*LocalBackend).handleC2NDebugComponentLoggingStatus},
+	"/debug/component-logging":        {methods: c2nAny, handle: (*LocalBackend).handleC2NDebugComponentLogging},
+	"/debug/panics":                   {methods: []string{"GET", "DELETE"}, handle: (*LocalBackend).handleC2NDebugPanics},
+	"/prefs":                          {methods: c2nGetPatch, mutates: true, handle: (*LocalBackend).handleC2NPrefs},
+	"/prefs/os-version":               {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NPrefsOSVersion},
+	"/prefs/exitnode":                 {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NPrefsExitNode},
+	"/prefs/shieldsup":                {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NPrefsShieldsUp},
+	"/prefs/routes":                   {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NPrefsRoutes},
+	"/keyexpiry":                      {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NKeyExpiry},
+	"/debug/node-auth":                {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugNodeAuth},
+	"/debug/advertised-tags":          {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugAdvertisedTags},
+	"/debug/magicdns-lookup":          {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugMagicDNSLookup},
+	"/debug/dns-upstream-errors":      {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugDNSUpstreamErrors},
+	"/debug/dns":                      {methods: c2nGet, handle: (*LocalBackend).handleC2NDebugDNS},
+	"/dns/reapply":                    {methods: c2nPost, mutates: true, handle: (*LocalBackend).handleC2NDNSReapply},
+	"/debug/drops":                    {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugDrops},
+	"/debug/peer-endpoints":           {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPeerEndpoints},
+	"/debug/peer-allowedips":          {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPeerAllowedIPs},
+	"/debug/wgconfig":                 {methods: c2nGet, handle: (*LocalBackend).handleC2NDebugWGConfig},
+	"/debug/handshake-failures":       {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugHandshakeFailures},
+	"/debug/path-compare":             {methods: c2nPost, handle: (*LocalBackend).handleC2NDebugPathCompare},
+	"/debug/peer-rtt":                 {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPeerRTT},
+	"/debug/ipfamily":                 {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NDebugIPFamily},
+	"/debug/disable-derp":             {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NDebugDisableDERP},
+	"/debug/derp":                     {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugDERP},
+	"/debug/derp/pin":                 {methods: c2nPost, mutates: true, handle: (*LocalBackend).handleC2NDebugDERPPin},
+	"/debug/derp/test":                {methods: c2nPost, handle: (*LocalBackend).handleC2NDebugDERPTest},
+	"/debug/netcheck":                 {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugNetcheck},
+	"/debug/portmap":                  {methods: c2nGetPost, mutates: true, handle: (*LocalBackend).handleC2NDebugPortmap},
+	"/debug/rebind":                   {methods: c2nPost, mutates: true, handle: (*LocalBackend).handleC2NDebugRebind},
+	"/debug/derp-failover-test":       {methods: c2nPost, mutates: true, handle: (*LocalBackend).handleC2NDebugDERPFailoverTest},
+	"/debug/disco-events/stream":      {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugDiscoEventsStream},
+	"/debug/pathevents":               {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPathEvents},
+	"/debug/disco-rekey":              {methods: c2nPost, mutates: true, handle: (*LocalBackend).handleC2NDebugDiscoRekey},
+	"/debug/derp-flow":                {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugDERPFlow},
+	"/debug/tun-selftest":             {methods: c2nPost, handle: (*LocalBackend).handleC2NDebugTUNSelfTest},
+	"/debug/filter-check":             {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugFilterCheck},
+	"/debug/source-addr":              {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugSourceAddr},
+	"/debug/skew-impact":              {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugSkewImpact},
+	"/debug/netmap":                   {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugNetmap},
+	"/debug/netmap-stats":             {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugNetmapStats},
+	"/debug/grants":                   {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugGrants},
+	"/debug/caps":                     {methods: c2nGet, handle: (*LocalBackend).handleC2NDebugCaps},
+	"/debug/4via6":                    {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebug4via6},
+	"/debug/subnet-routes":            {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugSubnetRoutes},
+	"/debug/log-reachability":         {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugLogReachability},
+	"/debug/control":                  {methods: c2nGet, handle: (*LocalBackend).handleC2NDebugControl},
+	"/debug/control-reachability":     {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugControlReachability},
+	"/debug/certs":                    {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugCerts},
+	"/debug/certs/renew":              {methods: c2nPost, mutates: true, handle: (*LocalBackend).handleC2NDebugCertRenew},
+	"/debug/power":                    {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPower},
+	"/debug/magicsock-config":         {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugMagicsockConfig},
+	"/debug/magicsock/stats":          {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugMagicsockStats},
+	"/debug/proxy":                    {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugProxy},
+	"/debug/peer-reachability":        {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPeerReachability},
+	"/debug/peerstate":                {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugPeerState},
+	"/debug/disco-queue":              {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugDiscoQueue},
+	"/debug/captive-portal":           {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugCaptivePortal},
+	"/debug/captive-portal/recheck":   {methods: c2nPost, handle: (*LocalBackend).handleC2NDebugCaptivePortalRecheck},
+	"/debug/heartbeat-losses":         {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugHeartbeatLosses},
+	"/debug/logheap":                  {methods: c2nAny, handle: (*LocalBackend).handleC2NDebugLogHeap},
+	"/debug/cpuprofile":               {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugCPUProfile},
+	"/debug/capture":                  {methods: c2nGetPost, handle: (*LocalBackend).handleC2NDebugCapture},
+
+	"/ssh/usernames":     {methods: c2nAny, handle: (*LocalBackend).handleC2NSSHUsernames},
+	"/sockstats":         {methods: c2nPost, handle: (*LocalBackend).handleC2NSockstats},
+	"/sockstats/current": {methods: c2nGet, handle: (*LocalBackend).handleC2NSockstatsCurrent},
+}
 
 func (b *LocalBackend) handleC2N(w http.ResponseWriter, r *http.Request) {
-	writeJSON := func(v any) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(v)
-	}
-	switch r.URL.Path {
-	case "/echo":
-		// Test handler.
-		body, _ := io.ReadAll(r.Body)
-		w.Write(body)
-	case "/update":
-		b.handleC2NUpdate(w, r)
-	case "/logtail/flush":
-		if r.Method != "POST" {
-			http.Error(w, "bad method", http.StatusMethodNotAllowed)
+	// Log every request, for an audit trail of what was done to the node.
+	// This is deferred first so that it sees the outcome of a panic.
+	aw := &c2nAuditWriter{ResponseWriter: w}
+	start := b.clock.Now()
+	logReq := r // as received, even if r is replaced below
+	defer func() { b.logC2NRequest(logReq, aw, b.clock.Since(start)) }()
+	w = aw
+
+	defer func() {
+		// A panic here would otherwise take down tailscaled, as c2n
+		// requests are answered on their own goroutine. Record it so
+		// it's visible via /debug/panics instead.
+		if p := recover(); p != nil {
+			b.logf("c2n: recovered panic handling %v: %v", r.URL.Path, p)
+			panics.RecordPanic("c2n "+r.URL.Path, p)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}()
+	if c2nPathDisabled(r.URL.Path) {
+		http.Error(w, "c2n path disabled on this node", http.StatusForbidden)
+		return
+	}
+	route, ok := c2nRoutes[r.URL.Path]
+	if !ok {
+		http.Error(w, "unknown c2n path", http.StatusBadRequest)
+		return
+	}
+	method := r.Method
+	if method == "HEAD" && slices.Contains(route.methods, "GET") {
+		// Handled as a GET whose body is discarded; see below.
+		method = "GET"
+	}
+	if !slices.Contains(route.methods, method) && !slices.Contains(route.methods, c2nAnyMethod) {
+		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+		return
+	}
+	if route.mutates && method != "GET" && !envknob.AllowsC2NMutations() {
+		http.Error(w, "c2n mutations not enabled on this node", http.StatusForbidden)
+		return
+	}
+	if !b.allowC2NRequest(w, r.URL.Path) {
+		return
+	}
+	stop, ok := b.limitC2NBody(w, r, route.maxBody)
+	defer stop()
+	if !ok {
+		return
+	}
+	if r.Method == "HEAD" {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		w = &c2nHeadWriter{ResponseWriter: w, done: cancel}
+		r = r.Clone(ctx)
+		r.Method = "GET"
+	}
+	route.handle(b, w, r)
+}
+
+// writeJSON writes v to w as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+// writeJSONStatus writes v to w as a JSON response with status code code.
+func writeJSONStatus(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleC2NEcho is a test handler that writes back the request body.
+func (b *LocalBackend) handleC2NEcho(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeC2NBodyError(w, err)
+		return
+	}
+	w.Write(body)
+}
+
+// c2nEchoInfo is the response to c2n /echo/info. See
+// controlclient.C2NRequestInfo for what the fields mean.
+type c2nEchoInfo struct {
+	// Path is how c2n requests reach the node, which is always "control":
+	// in a map response from control, never via DERP or a peer.
+	Path string `json:"path"`
+
+	// Transport is "noise" or "http", or "unknown" if the request didn't
+	// come from controlclient.
+	Transport            string    `json:"transport"`
+	ControlHost          string    `json:"controlHost,omitempty"`
+	RemoteAddr           string    `json:"remoteAddr,omitempty"`
+	NoiseProtocolVersion int       `json:"noiseProtocolVersion,omitempty"`
+	ReceivedAt           time.Time `json:"receivedAt"`
+
+	// LastReplyMs is how long, in milliseconds, sending the response to the
+	// previous c2n request to control took, if known.
+	LastReplyMs float64 `json:"lastReplyMs,omitempty"`
+}
+
+// handleC2NEchoInfo reports how the request reached the node, for
+// debugging slow c2n requests.
+func (b *LocalBackend) handleC2NEchoInfo(w http.ResponseWriter, r *http.Request) {
+	res := c2nEchoInfo{Path: "control", Transport: "unknown"}
+	if info, ok := controlclient.C2NRequestInfoFromContext(r.Context()); ok {
+		res.Transport = info.Transport
+		res.ControlHost = info.ControlHost
+		if info.RemoteAddr.IsValid() {
+			res.RemoteAddr = info.RemoteAddr.String()
+		}
+		res.NoiseProtocolVersion = info.NoiseProtocolVersion
+		res.ReceivedAt = info.ReceivedAt
+		res.LastReplyMs = float64(info.LastReplyDuration) / float64(time.Millisecond)
+	}
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NHealth(w http.ResponseWriter, r *http.Request) {
+	ws := health.Warnings()
+	writeJSON(w, struct {
+		Healthy  bool             `json:"healthy"`
+		Warnings []health.Warning `json:"warnings"`
+	}{len(ws) == 0, ws})
+}
+
+func (b *LocalBackend) handleC2NDebugGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, goroutines.ScrubbedGoroutines())
+	} else {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(goroutines.ScrubbedGoroutineDump(true))
+	}
+}
+
+// handleC2NDebugMetrics writes the clientmetrics in the Prometheus text
+// format or, if the request accepts it, OpenMetrics. The "names" parameter,
+// a comma-separated list that may be repeated, limits them to those with
+// the given names. The output is flushed as it's written, so a large
+// exposition isn't buffered whole.
+func (b *LocalBackend) handleC2NDebugMetrics(w http.ResponseWriter, r *http.Request) {
+	var match func(name string) bool
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if vv := r.Form["names"]; len(vv) > 0 {
+		names := make(map[string]bool)
+		for _, v := range vv {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names[name] = true
+				}
+			}
+		}
+		match = func(name string) bool { return names[name] }
+	}
+
+	var out io.Writer = w
+	if f, ok := w.(http.Flusher); ok {
+		out = c2nFlushWriter{w, f}
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", clientmetric.OpenMetricsContentType)
+		clientmetric.WriteOpenMetricsMatching(out, match)
+	} else {
+		w.Header().Set("Content-Type", "text/plain")
+		clientmetric.WritePrometheusExpositionFormatMatching(out, match)
+	}
+}
+
+// c2nFlushWriter is an io.Writer that flushes an http.ResponseWriter after
+// each write to it.
+type c2nFlushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw c2nFlushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
+func (b *LocalBackend) handleC2NDebugComponentLoggingStatus(w http.ResponseWriter, r *http.Request) {
+	// Seconds remaining, rounded up so that nothing enabled
+	// reports zero.
+	now := b.clock.Now()
+	remaining := make(map[string]int64)
+	for component, until := range b.ComponentDebugLoggingStates() {
+		remaining[component] = int64((until.Sub(now) + time.Second - 1) / time.Second)
+	}
+	writeJSON(w, remaining)
+}
+
+func (b *LocalBackend) handleC2NDebugComponentLogging(w http.ResponseWriter, r *http.Request) {
+	component := r.FormValue("component")
+	secs := 0 // disables it
+	if v := r.FormValue("secs"); v != "" {
+		var err error
+		if secs, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	until, err := b.SetComponentDebugLoggingFor(component, time.Duration(secs)*time.Second)
+	var res struct {
+		Error string `json:",omitempty"`
+		// Until is when component's debug logging is enabled
+		// until, or nil if it's disabled.
+		Until *time.Time `json:",omitempty"`
+		// Enabled is when each component whose debug logging is
+		// enabled has it enabled until.
+		Enabled map[string]time.Time
+	}
+	if err != nil {
+		res.Error = err.Error()
+	} else if !until.IsZero() {
+		res.Until = &until
+	}
+	res.Enabled = b.ComponentDebugLoggingStates()
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NDebugPanics(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "DELETE" {
+		panics.Clear()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, struct{ Panics []panics.Record }{panics.Recent()})
+}
+
+func (b *LocalBackend) handleC2NDebugDNSUpstreamErrors(w http.ResponseWriter, r *http.Request) {
+	dm, ok := b.sys.DNSManager.GetOK()
+	if !ok {
+		http.Error(w, "no DNS manager", http.StatusServiceUnavailable)
+		return
+	}
+	stats, recent := dm.Resolver().UpstreamErrors()
+	writeJSON(w, struct {
+		Upstreams []resolver.UpstreamErrorStats
+		Recent    []resolver.UpstreamError // oldest first
+	}{stats, recent})
+}
+
+// handleC2NDebugDNS reports the DNS configuration that's been applied to the
+// OS and to tailscaled's resolver, and the most recent error applying it.
+func (b *LocalBackend) handleC2NDebugDNS(w http.ResponseWriter, r *http.Request) {
+	dm, ok := b.sys.DNSManager.GetOK()
+	if !ok {
+		http.Error(w, "no DNS manager", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, dm.Status())
+}
+
+// c2nDNSReapplyResponse is the result of c2n /dns/reapply.
+type c2nDNSReapplyResponse struct {
+	// Applied is whether the DNS config was programmed into the OS again.
+	Applied bool
+	// Flushed is whether the OS's resolver cache was then flushed.
+	// FlushSkipped is whether it wasn't because there's no way to on this
+	// platform.
+	Flushed      bool
+	FlushSkipped bool
+
+	Error string     `json:",omitempty"`
+	DNS   dns.Status // as applied
+}
+
+// handleC2NDNSReapply programs the OS with the node's DNS config again, in
+// case something else has changed the OS's DNS settings, and then flushes
+// the OS's resolver cache where that's supported.
+func (b *LocalBackend) handleC2NDNSReapply(w http.ResponseWriter, r *http.Request) {
+	dm, ok := b.sys.DNSManager.GetOK()
+	if !ok {
+		http.Error(w, "no DNS manager", http.StatusServiceUnavailable)
+		return
+	}
+	var res c2nDNSReapplyResponse
+	if err := dm.Reapply(); err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Applied = true
+		if !dm.CanFlushCaches() {
+			res.FlushSkipped = true
+		} else if err := dm.FlushCaches(); err != nil {
+			res.Error = fmt.Sprintf("flushing DNS caches: %v", err)
+		} else {
+			res.Flushed = true
+		}
+	}
+	res.DNS = dm.Status()
+	writeJSON(w, res)
+}
+
+// handleC2NDebugDrops reports the counts of dropped inbound packets, by
+// reason; see dropstats. A POST with reset=true zeroes them after reporting
+// them.
+func (b *LocalBackend) handleC2NDebugDrops(w http.ResponseWriter, r *http.Request) {
+	var drops map[dropstats.Reason]int64
+	switch {
+	case r.Method == "GET":
+		drops = dropstats.Counts()
+	case r.FormValue("reset") == "true":
+		drops = dropstats.Reset() // the counts as of the reset
+	default:
+		http.Error(w, "missing 'reset=true' parameter", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, struct {
+		Drops map[dropstats.Reason]int64
+	}{drops})
+}
+
+// handleC2NDebugPower reports whether the node is on battery or AC power,
+// which is only known on Linux (other than Android), and magicsock's disco
+// and heartbeat timings. magicsock doesn't back off on battery, so the
+// timings are the same on either; heartbeats only back off for idle peers.
+func (b *LocalBackend) handleC2NDebugPower(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Power sysresources.PowerSource
+		// FixedDiscoTimings don't depend on Power.
+		FixedDiscoTimings magicsock.DiscoTimings
+	}{
+		Power:             sysresources.CurrentPowerSource(),
+		FixedDiscoTimings: magicsock.CurrentDiscoTimings(),
+	})
+}
+
+func (b *LocalBackend) handleC2NDebugMagicsockConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Params []magicsock.ConfigParam
+	}{magicsock.CurrentConfig()})
+}
+
+func (b *LocalBackend) handleC2NDebugProxy(w http.ResponseWriter, r *http.Request) {
+	proxies := proxystats.Snapshot()
+	writeJSON(w, struct {
+		Configured bool // whether any outbound proxy is running
+		Proxies    []proxystats.Stats
+	}{len(proxies) > 0, proxies})
+}
+
+func (b *LocalBackend) handleC2NDebugPeerReachability(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Peers []magicsock.PeerReachability
+	}{mc.PeerReachability()})
+}
+
+// handleC2NDebugPeerState reports magicsock's state for the peers with
+// recent traffic, or for all of them with all=1.
+func (b *LocalBackend) handleC2NDebugPeerState(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Peers []magicsock.PeerState
+	}{mc.PeerStates(r.FormValue("all") != "1")})
+}
+
+func (b *LocalBackend) handleC2NDebugDiscoQueue(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Purposes map[string]magicsock.DiscoQueueDepth
+	}{mc.DiscoQueue()})
+}
+
+func (b *LocalBackend) handleC2NDebugCaptivePortal(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, mc.CaptivePortal())
+}
+
+func (b *LocalBackend) handleC2NDebugHeartbeatLosses(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Losses []magicsock.HeartbeatLoss
+	}{mc.HeartbeatLosses()})
+}
+
+func (b *LocalBackend) handleC2NDebugLogHeap(w http.ResponseWriter, r *http.Request) {
+	if c2nLogHeap == nil {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+	c2nLogHeap(w, r)
+}
+
+func (b *LocalBackend) handleC2NDebugCPUProfile(w http.ResponseWriter, r *http.Request) {
+	if c2nCPUProfile == nil {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+	d, err := parseCPUProfileSeconds(r.FormValue("seconds"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c2nCPUProfile(w, r, d)
+}
+
+func (b *LocalBackend) handleC2NSSHUsernames(w http.ResponseWriter, r *http.Request) {
+	var req tailcfg.C2NSSHUsernamesRequest
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeC2NBodyError(w, err)
+			return
+		}
+	}
+	res, err := b.getSSHUsernamesCached(&req)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NSockstats(w http.ResponseWriter, r *http.Request) {
+	if b.sockstatLogger == nil {
+		http.Error(w, "no sockstatLogger", http.StatusInternalServerError)
+		return
+	}
+	b.sockstatLogger.Flush()
+	if r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, struct {
+			LogID     string                    `json:"logID"`
+			DebugInfo *sockstats.DebugSockStats `json:"debugInfo"` // nil if sockstats are unavailable
+		}{b.sockstatLogger.LogID(), sockstats.GetDebug()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "logid: %s\n", b.sockstatLogger.LogID())
+	fmt.Fprintf(w, "debug info: %v\n", sockstats.DebugInfo())
+}
+
+// c2nSockStatsResponse is the result of c2n /sockstats/current.
+type c2nSockStatsResponse struct {
+	// Available is whether sockstats are tracked in this build. If not,
+	// the other fields are empty.
+	Available bool
+
+	CurrentInterfaceCellular bool
+
+	// Stats are the bytes sent and received by each labeled socket
+	// since tailscaled started, keyed by label (such as
+	// "LogtailLogger").
+	Stats map[string]sockstats.SockStat
+}
+
+// handleC2NSockstatsCurrent returns the current sockstats counters, without
+// flushing them to the sockstats logger like /sockstats does.
+func (b *LocalBackend) handleC2NSockstatsCurrent(w http.ResponseWriter, r *http.Request) {
+	res := c2nSockStatsResponse{Stats: map[string]sockstats.SockStat{}}
+	if ss := c2nSockStats(); ss != nil {
+		res.Available = true
+		res.CurrentInterfaceCellular = ss.CurrentInterfaceCellular
+		for label, st := range ss.Stats {
+			res.Stats[label.String()] = st
+		}
+	}
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NDebugPeerEndpoints(w http.ResponseWriter, r *http.Request) {
+	peer, ok := b.c2nPeer(w, r)
+	if !ok {
+		return
+	}
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	offers, err := mc.GetEndpointOffers(peer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Peer      tailcfg.StableNodeID
+		Endpoints []magicsock.EndpointOffer
+	}{peer.StableID(), offers})
+}
+
+// c2nFilteredIP is an allowed IP that the netmap offered for a peer but that
+// wasn't configured into WireGuard.
+type c2nFilteredIP struct {
+	Prefix netip.Prefix
+	Reason string // best guess at why it was dropped
+}
+
+func (b *LocalBackend) handleC2NDebugPeerAllowedIPs(w http.ResponseWriter, r *http.Request) {
+	peer, ok := b.c2nPeer(w, r)
+	if !ok {
+		return
+	}
+	var res struct {
+		Peer       tailcfg.StableNodeID
+		InWGConfig bool           // whether the peer is in the WireGuard config at all
+		Offered    []netip.Prefix // from the netmap
+		Programmed []netip.Prefix // configured into WireGuard
+		Filtered   []c2nFilteredIP
+		Extra      []netip.Prefix `json:",omitempty"` // programmed but not offered; unexpected
+	}
+	res.Peer = peer.StableID()
+	res.Offered = peer.AllowedIPs().AsSlice()
+	res.Programmed, res.InWGConfig = b.e.PeerAllowedIPs(peer.Key())
+
+	prefs := b.Prefs()
+	for _, p := range res.Offered {
+		if slices.Contains(res.Programmed, p) {
+			continue
+		}
+		var reason string
+		switch {
+		case !res.InWGConfig:
+			reason = "peer not in WireGuard config"
+		case p.Bits() == 0:
+			reason = "exit node route, but peer isn't the selected exit node"
+		case p.IsSingleIP() && tsaddr.IsTailscaleIP(p.Addr()):
+			reason = "single-host routes not allowed"
+		case !prefs.RouteAll():
+			reason = "subnet routes not accepted (--accept-routes is off)"
+		default:
+			reason = "subnet routes disabled"
+		}
+		res.Filtered = append(res.Filtered, c2nFilteredIP{p, reason})
+	}
+	for _, p := range res.Programmed {
+		if !slices.Contains(res.Offered, p) {
+			res.Extra = append(res.Extra, p)
+		}
+	}
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NDebugPeerRTT(w http.ResponseWriter, r *http.Request) {
+	peer, ok := b.c2nPeer(w, r)
+	if !ok {
+		return
+	}
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	samples, err := mc.GetPeerRTT(peer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Peer    tailcfg.StableNodeID
+		Samples []magicsock.RTTSample
+	}{peer.StableID(), samples})
+}
+
+func (b *LocalBackend) handleC2NDebugIPFamily(w http.ResponseWriter, r *http.Request) {
+	secs := 0
+	if v := r.FormValue("secs"); v != "" {
+		var err error
+		if secs, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
 			return
 		}
-		if b.TryFlushLogs() {
-			w.WriteHeader(http.StatusNoContent)
-		} else {
-			http.Error(w, "no log flusher wired up", http.StatusInternalServerError)
+	}
+	if secs <= 0 {
+		secs = 300
+	}
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var res struct {
+		Family magicsock.IPFamily
+		Until  time.Time // when the override reverts to auto; zero if none
+	}
+	if r.Method == "POST" {
+		fam := magicsock.IPFamily(r.FormValue("force"))
+		if _, _, err := mc.ForceIPFamily(fam, time.Duration(secs)*time.Second); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	res.Family, res.Until = mc.ForcedIPFamily()
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NDebugDisableDERP(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == "POST" {
+		secs, err := strconv.Atoi(r.FormValue("secs"))
+		if err != nil {
+			http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
+			return
+		}
+		if _, err := mc.DisableDERP(time.Duration(secs) * time.Second); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var res struct {
+		Disabled bool
+		Until    time.Time `json:",omitempty"` // when DERP is re-enabled
+		Warning  string    `json:",omitempty"`
+	}
+	res.Until = mc.DERPDisabledUntil()
+	if res.Disabled = !res.Until.IsZero(); res.Disabled {
+		res.Warning = "DERP is disabled; peers reachable only via DERP are unreachable until it's re-enabled"
+	}
+	writeJSON(w, res)
+}
+
+// derpRemeasureTimeout bounds how long a POST to /debug/derp or
+// /debug/derp/pin waits for netcheck.
+const derpRemeasureTimeout = 10 * time.Second
+
+// defaultDERPPinDuration is how long /debug/derp/pin pins the home
+// region for if "secs" isn't given.
+const defaultDERPPinDuration = 10 * time.Minute
+
+// handleC2NDebugDERP reports the node's home DERP region, why it was
+// picked, and the latency to each region. A POST runs netcheck again first.
+// Pinning the home region changes how the node connects, so it's done
+// separately by /debug/derp/pin, which requires c2n mutations be enabled.
+func (b *LocalBackend) handleC2NDebugDERP(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("pin") != "" {
+		http.Error(w, "pin the home region with /debug/derp/pin", http.StatusBadRequest)
+		return
+	}
+	if r.Method == "GET" {
+		writeJSON(w, c2nDERPHomeResponse{DERPHome: mc.DERPHome()})
+		return
+	}
+	writeJSON(w, remeasureC2NDERPHome(r.Context(), mc))
+}
+
+// handleC2NDebugDERPPin pins the node's home DERP region to the "pin"
+// parameter (zero to unpin) for "secs" seconds, then runs netcheck again
+// and reports the result like /debug/derp.
+func (b *LocalBackend) handleC2NDebugDERPPin(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	region, err := strconv.Atoi(r.FormValue("pin"))
+	if err != nil {
+		http.Error(w, "invalid 'pin' parameter", http.StatusBadRequest)
+		return
+	}
+	d := defaultDERPPinDuration
+	if v := r.FormValue("secs"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
+			return
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if _, err := mc.PinDERPHome(region, d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, remeasureC2NDERPHome(r.Context(), mc))
+}
+
+// c2nDERPHomeResponse is the response to /debug/derp and /debug/derp/pin.
+type c2nDERPHomeResponse struct {
+	magicsock.DERPHome
+	Error string `json:",omitempty"`
+}
+
+// remeasureC2NDERPHome runs netcheck again, waiting up to
+// derpRemeasureTimeout, and reports the resulting home region.
+func remeasureC2NDERPHome(ctx context.Context, mc *magicsock.Conn) c2nDERPHomeResponse {
+	ctx, cancel := context.WithTimeout(ctx, derpRemeasureTimeout)
+	defer cancel()
+	var res c2nDERPHomeResponse
+	var err error
+	res.DERPHome, err = mc.RemeasureDERPHome(ctx)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// netcheckTimeout bounds how long a POST to /debug/netcheck waits for
+// netcheck.
+const netcheckTimeout = 10 * time.Second
+
+// handleC2NDebugNetcheck reports the node's most recent netcheck. A POST
+// runs a full netcheck first; if it doesn't finish within netcheckTimeout,
+// the previous report is returned, marked Incomplete.
+func (b *LocalBackend) handleC2NDebugNetcheck(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var res magicsock.NetcheckReport
+	if r.Method == "GET" {
+		res = mc.LastNetcheck()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), netcheckTimeout)
+		defer cancel()
+		res, err = mc.RunNetcheck(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, res)
+}
+
+// derpFailoverTestTimeout bounds how long /debug/derp-failover-test waits
+// for a failover.
+const derpFailoverTestTimeout = 30 * time.Second
+
+// handleC2NDebugDERPFailoverTest treats the node's home DERP region as failed
+// until it fails over to another region, or derpFailoverTestTimeout elapses;
+// see magicsock.Conn.TestDERPFailover.
+func (b *LocalBackend) handleC2NDebugDERPFailoverTest(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), derpFailoverTestTimeout)
+	defer cancel()
+	res, err := mc.TestDERPFailover(ctx)
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+	writeJSON(w, struct {
+		OK bool
+		magicsock.DERPFailoverResult
+		Error string `json:",omitempty"`
+	}{err == nil, res, errStr})
+}
+
+// captivePortalRecheckTimeout bounds /debug/captive-portal/recheck.
+const captivePortalRecheckTimeout = 10 * time.Second
+
+// handleC2NDebugCaptivePortalRecheck checks for a captive portal now; see
+// magicsock.Conn.RecheckCaptivePortal.
+func (b *LocalBackend) handleC2NDebugCaptivePortalRecheck(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), captivePortalRecheckTimeout)
+	defer cancel()
+	res, err := mc.RecheckCaptivePortal(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// maxDiscoEventStreamDuration is the longest that /debug/disco-events/stream
+// will collect events for.
+const maxDiscoEventStreamDuration = 10 * time.Minute
+
+// c2nClampToDeadline returns d, or the time left until ctx's deadline if
+// that's sooner. c2n responses aren't sent to control until their handler
+// returns, so a handler that collects for a window of time must end it by
+// the request's deadline.
+func c2nClampToDeadline(ctx context.Context, d time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		d = min(d, time.Until(deadline))
+	}
+	return d
+}
+
+// handleC2NDebugDiscoEventsStream collects magicsock's disco events for
+// "secs" seconds (default 30), bounded by maxDiscoEventStreamDuration and
+// the request's deadline, and returns them as newline-delimited JSON.
+// Despite the path, it's not a stream: as c2n responses are buffered, the
+// events are only sent to control once the window ends.
+func (b *LocalBackend) handleC2NDebugDiscoEventsStream(w http.ResponseWriter, r *http.Request) {
+	d := 30 * time.Second
+	if v := r.FormValue("secs"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			http.Error(w, "bad 'secs' parameter", http.StatusBadRequest)
+			return
+		}
+		d = min(time.Duration(secs)*time.Second, maxDiscoEventStreamDuration)
+	}
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), c2nClampToDeadline(r.Context(), d))
+	defer cancel()
+	events, unsubscribe := mc.SubscribeDiscoEvents()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// maxPathEventStreamDuration is the longest that /debug/pathevents may be
+// asked to collect events for.
+const maxPathEventStreamDuration = 10 * time.Minute
+
+// c2nPathEventsEnd is the last record in a /debug/pathevents response,
+// after the PathEvents.
+type c2nPathEventsEnd struct {
+	Done bool `json:"done"` // always true, to tell it apart from the events
+
+	// DroppedEvents is how many events were dropped because they
+	// couldn't be collected fast enough.
+	DroppedEvents int64 `json:"droppedEvents"`
+}
+
+// handleC2NDebugPathEvents collects magicsock's PathEvents, each time a
+// peer's path changes between direct addresses and DERP, for "secs" seconds
+// (default 30), bounded by maxPathEventStreamDuration and the request's
+// deadline. It returns them as newline-delimited JSON, followed by a
+// c2nPathEventsEnd. As c2n responses are buffered, they're only sent to
+// control once the window ends.
+func (b *LocalBackend) handleC2NDebugPathEvents(w http.ResponseWriter, r *http.Request) {
+	d := 30 * time.Second
+	if v := r.FormValue("secs"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			http.Error(w, "bad 'secs' parameter", http.StatusBadRequest)
+			return
+		}
+		d = min(time.Duration(secs)*time.Second, maxPathEventStreamDuration)
+	}
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), c2nClampToDeadline(r.Context(), d))
+	defer cancel()
+	events, unsubscribe := mc.SubscribePathEvents()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case ev := <-events:
+			enc.Encode(ev)
+		}
+	}
+	// Include the events that were delivered before unsubscribing.
+	end := c2nPathEventsEnd{Done: true, DroppedEvents: unsubscribe()}
+	for len(events) > 0 {
+		enc.Encode(<-events)
+	}
+	enc.Encode(end)
+}
+
+// handleC2NDebugDiscoRekey replaces the node's disco key and tells control
+// and the tun device about it; see magicsock.Conn.RekeyDisco.
+func (b *LocalBackend) handleC2NDebugDiscoRekey(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	k, err := mc.RekeyDisco()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tun, ok := b.sys.Tun.GetOK(); ok {
+		tun.SetDiscoKey(k)
+	}
+	b.mu.Lock()
+	cc := b.cc
+	b.mu.Unlock()
+	if cc != nil {
+		cc.SetDiscoPublicKey(k)
+	}
+	writeJSON(w, struct {
+		DiscoKey string // ShortString of the new key
+		Warning  string
+	}{
+		DiscoKey: k.ShortString(),
+		Warning:  "direct paths to peers are down, and traffic goes via DERP, until peers learn the new key from control",
+	})
+}
+
+// handleC2NPrefsOSVersion reports the OS version the node sends to control
+// and, on POST, overrides it with the "version" param until tailscaled
+// restarts. An empty version removes the override.
+func (b *LocalBackend) handleC2NPrefsOSVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		v := r.FormValue("version")
+		b.mu.Lock()
+		b.osVersionOverride = v
+		var hi *tailcfg.Hostinfo
+		if b.hostinfo != nil {
+			hi = b.hostinfo.Clone()
+			hi.OSVersion = v
+			if v == "" {
+				hi.OSVersion = hostinfo.GetOSVersion()
+			}
+			b.hostinfo = hi
+		}
+		b.mu.Unlock()
+		if v != "" {
+			b.logf("c2n: overriding reported OS version with %q", v)
+		} else {
+			b.logf("c2n: removed OS version override")
+		}
+		if hi != nil {
+			b.doSetHostinfoFilterServices(hi)
+		}
+	}
+
+	b.mu.Lock()
+	res := struct {
+		OSVersion  string // as reported to control
+		Real       string // the node's actual OS version
+		Overridden bool   // whether OSVersion is a temporary override that's lost on restart
+	}{
+		OSVersion:  hostinfo.GetOSVersion(),
+		Real:       hostinfo.GetOSVersion(),
+		Overridden: b.osVersionOverride != "",
+	}
+	if b.hostinfo != nil {
+		res.OSVersion = b.hostinfo.OSVersion
+	}
+	b.mu.Unlock()
+	writeJSON(w, res)
+}
+
+// handleC2NDebugAdvertisedTags compares the tags this node asked for in its
+// prefs with the tags control gave it.
+func (b *LocalBackend) handleC2NDebugAdvertisedTags(w http.ResponseWriter, r *http.Request) {
+	nm := b.NetMap()
+	if nm == nil || !nm.SelfNode.Valid() {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	var res struct {
+		Requested []string // from prefs (--advertise-tags)
+		Granted   []string // from control
+		Missing   []string // requested but not granted, typically because of ACL tagOwners
+		Extra     []string // granted but not requested, such as from an auth key
+	}
+	res.Requested = b.Prefs().AdvertiseTags().AsSlice()
+	res.Granted = nm.SelfNode.Tags().AsSlice()
+	for _, t := range res.Requested {
+		if !slices.Contains(res.Granted, t) {
+			res.Missing = append(res.Missing, t)
+		}
+	}
+	for _, t := range res.Granted {
+		if !slices.Contains(res.Requested, t) {
+			res.Extra = append(res.Extra, t)
+		}
+	}
+	writeJSON(w, res)
+}
+
+func (b *LocalBackend) handleC2NDebugDERPFlow(w http.ResponseWriter, r *http.Request) {
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		Regions []magicsock.DERPFlow
+	}{mc.DERPFlows()})
+}
+
+// handleC2NDebugMagicDNSLookup resolves the "name" param using only the
+// MagicDNS records built from the netmap, as quad-100 would answer it, without
+// involving the OS resolver or upstream DNS.
+func (b *LocalBackend) handleC2NDebugMagicDNSLookup(w http.ResponseWriter, r *http.Request) {
+	nm := b.NetMap()
+	if nm == nil {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "missing 'name' parameter", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(strings.TrimSuffix(name, "."), ".") {
+		// A bare machine name; qualify it as the OS search domain would.
+		name += "." + nm.MagicDNSSuffix()
+	}
+	fqdn, err := dnsname.ToFQDN(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefs := b.Prefs()
+	addrs, ok := dnsConfigForNetmap(nm, prefs, b.logf, version.OS()).Hosts[fqdn]
+	if !ok {
+		http.Error(w, "no MagicDNS record for "+string(fqdn), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, struct {
+		Name  dnsname.FQDN
+		Addrs []netip.Addr
+		// MagicDNS is whether the OS is configured to send MagicDNS
+		// queries to quad-100. If not, the OS can't resolve Name even
+		// though quad-100 can.
+		MagicDNS bool
+	}{fqdn, addrs, prefs.CorpDNS() && nm.DNS.Proxied})
+}
+
+// c2nTUNSelfTestTimeout bounds how long /debug/tun-selftest waits for the
+// OS to answer its probe.
+const c2nTUNSelfTestTimeout = 5 * time.Second
+
+// handleC2NDebugTUNSelfTest round-trips a packet through the tun device; see
+// tstun.Wrapper.SelfTest.
+func (b *LocalBackend) handleC2NDebugTUNSelfTest(w http.ResponseWriter, r *http.Request) {
+	var res struct {
+		Pass    bool
+		Addr    netip.Addr    // the local address probed
+		Stage   string        `json:",omitempty"` // the stage that failed; see tstun.SelfTestStage*
+		Error   string        `json:",omitempty"`
+		Latency time.Duration `json:",omitempty"`
+	}
+	defer func() {
+		writeJSON(w, res)
+	}()
+
+	tun, ok := b.sys.Tun.GetOK()
+	if !ok || b.sys.IsNetstack() {
+		res.Error = "skipped: userspace networking, no tun device"
+		return
+	}
+	nm := b.NetMap()
+	if nm == nil || !nm.SelfNode.Valid() {
+		res.Error = "skipped: no netmap"
+		return
+	}
+	addrs := nm.SelfNode.Addresses()
+	for i := 0; i < addrs.Len(); i++ {
+		if a := addrs.At(i).Addr(); !res.Addr.IsValid() || (a.Is4() && !res.Addr.Is4()) {
+			res.Addr = a
+		}
+	}
+	if !res.Addr.IsValid() {
+		res.Error = "skipped: node has no Tailscale addresses"
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c2nTUNSelfTestTimeout)
+	defer cancel()
+	start := b.clock.Now()
+	err := tun.SelfTest(ctx, res.Addr)
+	var se *tstun.SelfTestError
+	switch {
+	case err == nil:
+		res.Pass = true
+		res.Latency = b.clock.Since(start)
+	case errors.As(err, &se):
+		res.Stage = se.Stage
+		res.Error = se.Err.Error()
+	default:
+		res.Error = err.Error()
+	}
+}
+
+// c2nSubnetRoute is the status of a single route advertised by the node,
+// as returned by /debug/subnet-routes.
+type c2nSubnetRoute struct {
+	Prefix   netip.Prefix
+	Approved bool // whether control has approved it (it's in our AllowedIPs)
+	Primary  bool // whether we're the primary router for it
+}
+
+// c2nSubnetRoutes is the response to /debug/subnet-routes. It combines each
+// prerequisite for subnet routing into one view, with Problems listing any
+// that aren't met.
+type c2nSubnetRoutes struct {
+	Routes []c2nSubnetRoute
+
+	// NetstackRouter is whether routed packets are forwarded by netstack
+	// rather than by the OS, in which case IPForwarding and the netfilter
+	// settings don't apply.
+	NetstackRouter bool
+
+	// IPForwarding is whether the OS is configured to forward packets
+	// for the advertised routes. IPForwardingWarning explains why not.
+	IPForwarding        bool
+	IPForwardingWarning string `json:",omitempty"`
+
+	// NetfilterMode and SNAT are the firewall settings handed to the OS
+	// router for the advertised routes.
+	NetfilterMode string
+	SNAT          bool
+
+	Problems []string
+}
+
+func (b *LocalBackend) handleC2NDebugSubnetRoutes(w http.ResponseWriter, r *http.Request) {
+	prefs := b.Prefs()
+	if !prefs.Valid() {
+		http.Error(w, "no prefs", http.StatusServiceUnavailable)
+		return
+	}
+	nm := b.NetMap()
+	if nm == nil || !nm.SelfNode.Valid() {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	self := nm.SelfNode
+
+	var res c2nSubnetRoutes
+	routes := prefs.AdvertiseRoutes().AsSlice()
+	for _, p := range routes {
+		sr := c2nSubnetRoute{
+			Prefix:   p,
+			Approved: views.SliceContains(self.AllowedIPs(), p),
+			Primary:  views.SliceContains(self.PrimaryRoutes(), p),
 		}
-	case "/debug/goroutines":
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write(goroutines.ScrubbedGoroutineDump(true))
-	case "/debug/prefs":
-		writeJSON(b.Prefs())
-	case "/debug/metrics":
-		w.Header().Set("Content-Type", "text/plain")
-		clientmetric.WritePrometheusExpositionFormat(w)
-	case "/debug/component-logging":
-		component := r.FormValue("component")
-		secs, _ := strconv.Atoi(r.FormValue("secs"))
-		if secs == 0 {
-			secs -= 1
-		}
-		until := b.clock.Now().Add(time.Duration(secs) * time.Second)
-		err := b.SetComponentDebugLogging(component, until)
-		var res struct {
-			Error string `json:",omitempty"`
+		if !sr.Approved {
+			res.Problems = append(res.Problems, fmt.Sprintf("route %v is advertised but not approved", p))
+		}
+		res.Routes = append(res.Routes, sr)
+	}
+	if len(routes) == 0 {
+		res.Problems = append(res.Problems, "no routes are advertised")
+	}
+
+	res.NetstackRouter = b.sys.IsNetstackRouter()
+	res.NetfilterMode = prefs.NetfilterMode().String()
+	res.SNAT = !prefs.NoSNAT()
+	if distro.Get() == distro.Synology {
+		res.NetfilterMode = preftype.NetfilterOff.String() // see routerConfig
+	}
+	if res.NetstackRouter {
+		res.IPForwarding = true
+	} else {
+		warn, err := netutil.CheckIPForwarding(routes, b.sys.NetMon.Get().InterfaceState())
+		if err == nil {
+			err = warn
 		}
+		res.IPForwarding = err == nil
 		if err != nil {
-			res.Error = err.Error()
+			res.IPForwardingWarning = err.Error()
+			res.Problems = append(res.Problems, "IP forwarding: "+err.Error())
 		}
-		writeJSON(res)
-	case "/debug/logheap":
-		if c2nLogHeap != nil {
-			c2nLogHeap(w, r)
-		} else {
-			http.Error(w, "not implemented", http.StatusNotImplemented)
+		if len(routes) > 0 && res.NetfilterMode == preftype.NetfilterOff.String() && res.SNAT {
+			res.Problems = append(res.Problems, "netfilter is off, so routed traffic is not masqueraded")
+		}
+	}
+
+	writeJSON(w, res)
+}
+
+// handleC2NDebugHandshakeFailures reports how the WireGuard handshakes with
+// the "peer" param have gone. A POST with reset=true zeroes the counts after
+// reporting them.
+func (b *LocalBackend) handleC2NDebugHandshakeFailures(w http.ResponseWriter, r *http.Request) {
+	var reset bool
+	switch {
+	case r.Method == "GET":
+	case r.FormValue("reset") == "true":
+		reset = true
+	default:
+		http.Error(w, "missing 'reset=true' parameter", http.StatusBadRequest)
+		return
+	}
+	peer, ok := b.c2nPeer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, struct {
+		Peer tailcfg.StableNodeID
+		wglog.HandshakeStats
+	}{peer.StableID(), b.e.PeerHandshakeStats(peer.Key(), reset)})
+}
+
+// pathCompareTimeout bounds how long /debug/path-compare pings for.
+const pathCompareTimeout = 30 * time.Second
+
+// handleC2NDebugPathCompare pings the "peer" param "count" times (default 5)
+// over both its direct and DERP paths, to compare the two.
+func (b *LocalBackend) handleC2NDebugPathCompare(w http.ResponseWriter, r *http.Request) {
+	peer, ok := b.c2nPeer(w, r)
+	if !ok {
+		return
+	}
+	count := 5
+	if v := r.FormValue("count"); v != "" {
+		var err error
+		if count, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid 'count' parameter", http.StatusBadRequest)
 			return
 		}
-	case "/ssh/usernames":
-		var req tailcfg.C2NSSHUsernamesRequest
-		if r.Method == "POST" {
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
+	}
+	mc, err := b.magicConn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), pathCompareTimeout)
+	defer cancel()
+	direct, derp, err := mc.ComparePaths(ctx, peer.Key(), count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := struct {
+		Peer   tailcfg.StableNodeID
+		Direct magicsock.PathRTTs
+		DERP   magicsock.PathRTTs
+		// DERPCost is how much slower DERP is than the direct path, on
+		// average. It's omitted unless both paths answered.
+		DERPCost time.Duration `json:",omitempty"`
+	}{Peer: peer.StableID(), Direct: direct, DERP: derp}
+	if len(direct.RTTs) > 0 && len(derp.RTTs) > 0 {
+		res.DERPCost = derp.Mean - direct.Mean
+	}
+	writeJSON(w, res)
+}
+
+// c2nPeer returns the peer named by r's "peer" form value, which may be a
+// Tailscale IP, node key, or stable node ID. If the peer can't be found, it
+// writes an HTTP error to w and returns ok=false.
+func (b *LocalBackend) c2nPeer(w http.ResponseWriter, r *http.Request) (peer tailcfg.NodeView, ok bool) {
+	id := r.FormValue("peer")
+	if id == "" {
+		http.Error(w, "missing 'peer' parameter", http.StatusBadRequest)
+		return peer, false
+	}
+	nm := b.NetMap()
+	if nm == nil {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return peer, false
+	}
+	if ip, err := netip.ParseAddr(id); err == nil {
+		peer, ok = nm.PeerByTailscaleIP(ip)
+	} else if strings.HasPrefix(id, "nodekey:") {
+		var nk key.NodePublic
+		if err := nk.UnmarshalText([]byte(id)); err != nil {
+			http.Error(w, "invalid node key", http.StatusBadRequest)
+			return peer, false
+		}
+		for _, p := range nm.Peers {
+			if p.Key() == nk {
+				peer, ok = p, true
+				break
 			}
 		}
-		res, err := b.getSSHUsernames(&req)
-		if err != nil {
-			http.Error(w, err.Error(), 500)
-			return
+	} else {
+		peer, ok = nm.PeerWithStableID(tailcfg.StableNodeID(id))
+	}
+	if !ok {
+		http.Error(w, "unknown peer", http.StatusNotFound)
+	}
+	return peer, ok
+}
+
+// c2nLogFlushMaxTimeout is the longest that /logtail/flush may be asked to
+// wait for logs to be uploaded.
+const c2nLogFlushMaxTimeout = 60 * time.Second
+
+// c2nLogFlushResponse is the result of c2n /logtail/flush when it's asked
+// to wait.
+type c2nLogFlushResponse struct {
+	// Flushed is whether all the logs written before the request were
+	// uploaded within its timeout.
+	Flushed bool `json:"flushed"`
+
+	PendingBytesBefore int64 `json:"pendingBytesBefore"`
+	PendingBytesAfter  int64 `json:"pendingBytesAfter"`
+
+	Err string `json:"err,omitempty"`
+}
+
+// handleC2NLogtailFlush starts a flush of log uploads. Without a "timeout"
+// parameter, it responds immediately with a 204. Otherwise it waits up to
+// that many seconds for the logs to be uploaded, and responds with a
+// c2nLogFlushResponse: a 200 if they were, or a 202 if some are still
+// pending.
+func (b *LocalBackend) handleC2NLogtailFlush(w http.ResponseWriter, r *http.Request) {
+	v := r.FormValue("timeout")
+	if v == "" {
+		if b.TryFlushLogs() {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			http.Error(w, "no log flusher wired up", http.StatusInternalServerError)
 		}
-		writeJSON(res)
-	case "/sockstats":
-		if r.Method != "POST" {
-			http.Error(w, "bad method", http.StatusMethodNotAllowed)
-			return
+		return
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || secs <= 0 {
+		http.Error(w, "invalid 'timeout' parameter", http.StatusBadRequest)
+		return
+	}
+	if b.logFlushWaitFunc == nil || b.logPendingFunc == nil {
+		http.Error(w, "no log flush waiter wired up", http.StatusNotImplemented)
+		return
+	}
+	timeout := min(time.Duration(secs*float64(time.Second)), c2nLogFlushMaxTimeout)
+
+	res := c2nLogFlushResponse{PendingBytesBefore: b.logPendingFunc()}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	err = b.logFlushWaitFunc(ctx)
+	res.PendingBytesAfter = b.logPendingFunc()
+	res.Flushed = err == nil
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		res.Err = fmt.Sprintf("timeout: logs still pending after %v", timeout)
+		status = http.StatusAccepted
+	case err != nil:
+		res.Err = err.Error()
+		status = http.StatusInternalServerError
+	}
+	writeJSONStatus(w, status, res)
+}
+
+// handleC2NLogtailRotate switches log uploads to a new log ID, after
+// starting a flush of the logs buffered for the old one.
+func (b *LocalBackend) handleC2NLogtailRotate(w http.ResponseWriter, r *http.Request) {
+	if b.logIDRotateFunc == nil {
+		http.Error(w, "no log ID rotator configured", http.StatusNotImplemented)
+		return
+	}
+	b.TryFlushLogs()
+	oldID, newID, err := b.logIDRotateFunc()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b.logf("c2n: rotated log ID from %v to %v", oldID, newID)
+
+	b.mu.Lock()
+	b.backendLogID = newID
+	var hi *tailcfg.Hostinfo
+	if b.hostinfo != nil {
+		hi = b.hostinfo.Clone()
+		hi.BackendLogID = newID.String()
+		b.hostinfo = hi
+	}
+	b.mu.Unlock()
+	if hi != nil {
+		b.doSetHostinfoFilterServices(hi)
+	}
+	blid := newID.String()
+	b.send(ipn.Notify{BackendLogID: &blid})
+
+	writeJSON(w, struct {
+		OldLogID logid.PublicID
+		NewLogID logid.PublicID
+	}{oldID, newID})
+}
+
+// sshUsernamesCacheTTL is how long c2n /ssh/usernames reuses the usernames
+// that it found for an identical request.
+const sshUsernamesCacheTTL = 5 * time.Second
+
+type sshUsernamesCacheEntry struct {
+	res *tailcfg.C2NSSHUsernamesResponse
+	at  time.Time
+}
+
+// sshUsernamesCacheKey returns the key for req in
+// LocalBackend.sshUsernamesCache. It ignores req.NoCache.
+func sshUsernamesCacheKey(req *tailcfg.C2NSSHUsernamesRequest) string {
+	var exclude []string
+	for u, ok := range req.Exclude {
+		if ok {
+			exclude = append(exclude, u)
 		}
-		w.Header().Set("Content-Type", "text/plain")
-		if b.sockstatLogger == nil {
-			http.Error(w, "no sockstatLogger", http.StatusInternalServerError)
-			return
+	}
+	slices.Sort(exclude)
+	return fmt.Sprintf("%d %q", req.Max, exclude)
+}
+
+// getSSHUsernamesCached is like getSSHUsernames, but returns the result of
+// an identical request made within sshUsernamesCacheTTL, unless req.NoCache
+// is set. Errors aren't cached.
+func (b *LocalBackend) getSSHUsernamesCached(req *tailcfg.C2NSSHUsernamesRequest) (*tailcfg.C2NSSHUsernamesResponse, error) {
+	key := sshUsernamesCacheKey(req)
+	now := b.clock.Now()
+	b.mu.Lock()
+	ent, ok := b.sshUsernamesCache[key]
+	gen := b.sshUsernamesCacheGen
+	b.mu.Unlock()
+	if ok && !req.NoCache && now.Sub(ent.at) < sshUsernamesCacheTTL {
+		return &tailcfg.C2NSSHUsernamesResponse{Usernames: slices.Clone(ent.res.Usernames)}, nil
+	}
+
+	res, err := c2nSSHUsernames(b, req)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.sshUsernamesCacheGen {
+		// Invalidated while we were looking; the result may be stale
+		// already, so don't keep it.
+		return res, nil
+	}
+	for k, ent := range b.sshUsernamesCache {
+		if now.Sub(ent.at) >= sshUsernamesCacheTTL {
+			delete(b.sshUsernamesCache, k)
 		}
-		b.sockstatLogger.Flush()
-		fmt.Fprintf(w, "logid: %s\n", b.sockstatLogger.LogID())
-		fmt.Fprintf(w, "debug info: %v\n", sockstats.DebugInfo())
-	default:
-		http.Error(w, "unknown c2n path", http.StatusBadRequest)
 	}
+	mak.Set(&b.sshUsernamesCache, key, sshUsernamesCacheEntry{
+		res: &tailcfg.C2NSSHUsernamesResponse{Usernames: slices.Clone(res.Usernames)},
+		at:  now,
+	})
+	return res, nil
 }
 
-func (b *LocalBackend) handleC2NUpdate(w http.ResponseWriter, r *http.Request) {
-	// TODO(bradfitz): add some sort of semaphore that prevents two concurrent
-	// updates, or if one happened in the past 5 minutes, or something.
+// invalidateSSHUsernamesCacheLocked forgets the cached results of c2n
+// /ssh/usernames, because the prefs that they depend on may have changed.
+//
+// b.mu must be held.
+func (b *LocalBackend) invalidateSSHUsernamesCacheLocked() {
+	b.sshUsernamesCache = nil
+	b.sshUsernamesCacheGen++
+}
 
-	// GET returns the current status, and POST actually begins an update.
-	if r.Method != "GET" && r.Method != "POST" {
-		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+// c2nUpdateCooldown is how long after an update starts that c2n /update
+// refuses to start another, even if the first one's already finished.
+const c2nUpdateCooldown = 5 * time.Minute
+
+// These are variables for testing.
+var (
+	// c2nUpdateUnsupported returns why c2n /update can't update this
+	// installation, and which of the clientupdate.Reason* constants that
+	// is, or empty strings if it can.
+	c2nUpdateUnsupported = func() (msg, reason string) {
+		// Note that we create the Updater solely to check for errors; we
+		// do not invoke it here. For this purpose, it is ok to pass it a
+		// zero Arguments.
+		_, err := clientupdate.NewUpdater(clientupdate.Arguments{})
+		return updateUnsupportedReason(err, version.IsMacSysExt())
+	}
+
+	// c2nSSHUsernames is getSSHUsernames.
+	c2nSSHUsernames = (*LocalBackend).getSSHUsernames
+
+	// c2nFindCmdTailscale is findCmdTailscale.
+	c2nFindCmdTailscale = findCmdTailscale
+
+	// c2nLatestVersion returns the latest version on this node's track.
+	c2nLatestVersion = func() (string, error) {
+		return clientupdate.LatestTailscaleVersion(clientupdate.CurrentTrack)
+	}
+
+	// c2nInstallMethod is clientupdate.InstallMethod.
+	c2nInstallMethod = clientupdate.InstallMethod
+
+	// c2nSockStats is sockstats.Get.
+	c2nSockStats = sockstats.Get
+)
+
+// c2nUpdateStreamResult is the JSON object that ends the output of a c2n
+// /update with ?stream=1.
+type c2nUpdateStreamResult struct {
+	tailcfg.C2NUpdateResponse
+
+	// ExitCode is the exit code of "tailscale update", or -1 if it was
+	// killed by a signal.
+	ExitCode int
+
+	// InstalledVersion is the version of cmd/tailscale after the update,
+	// if known.
+	InstalledVersion string `json:",omitempty"`
+}
+
+// handleC2NUpdate handles c2n /update.
+//
+// The body is an optional tailcfg.C2NUpdateRequest. By default, a POST
+// responds once the update has finished, with ErrReason saying why, if it
+// failed. With ?stream=1, it instead responds with the update's combined
+// output, followed by a c2nUpdateStreamResult. Despite the name, that's not
+// a stream: as c2n responses are buffered, control gets the output all at
+// once, when the update finishes.
+func (b *LocalBackend) handleC2NUpdate(w http.ResponseWriter, r *http.Request) {
+	stream := r.FormValue("stream") == "1"
+	var req tailcfg.C2NUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeC2NBodyError(w, err)
+		return
+	}
+	if req.Version != "" && !isUpdateVersion(req.Version) {
+		http.Error(w, fmt.Sprintf("malformed version %q", req.Version), http.StatusBadRequest)
 		return
 	}
 
-	// If NewUpdater does not return an error, we can update the installation.
-	// Exception: When version.IsMacSysExt returns true, we don't support that
-	// yet. TODO(cpalmer, #6995): Implement it.
-	//
-	// Note that we create the Updater solely to check for errors; we do not
-	// invoke it here. For this purpose, it is ok to pass it a zero Arguments.
-	_, err := clientupdate.NewUpdater(clientupdate.Arguments{})
+	unsupported, unsupportedReason := c2nUpdateUnsupported()
 	res := tailcfg.C2NUpdateResponse{
-		Enabled:   envknob.AllowsRemoteUpdate(),
-		Supported: err == nil && !version.IsMacSysExt(),
+		Enabled:        envknob.AllowsRemoteUpdate(),
+		Supported:      unsupported == "",
+		Version:        req.Version,
+		CurrentVersion: version.Short(),
+
+		SignaturesEnforced: clientupdate.SignatureVerificationEnforced(),
 	}
+	b.mu.Lock()
+	res.Running = b.c2nUpdateRunning
+	b.mu.Unlock()
 
+	start := b.clock.Now()
+	var target string
+	streaming := false
 	defer func() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(res)
+		if r.Method == "POST" {
+			b.recordC2NUpdateAttempt(start, target, res)
+		}
+		if streaming {
+			return
+		}
+		writeJSON(w, res)
 	}()
 
 	if r.Method == "GET" {
+		// Looking up the latest version can mean asking the package
+		// server, so a plain GET doesn't, and leaves Version empty.
+		if r.FormValue("check") != "1" {
+			return
+		}
+		latest, err := b.c2nCachedLatestVersion()
+		if err != nil {
+			res.CheckErr = err.Error()
+			return
+		}
+		res.LatestVersion = latest
+		available := cmpver.Compare(updateRelease(latest), updateRelease(res.CurrentVersion)) > 0
+		res.UpdateAvailable = &available
+		if res.Version == "" && res.Supported {
+			res.Version = latest
+		}
 		return
 	}
 	if !res.Enabled {
@@ -146,37 +1815,85 @@ func (b *LocalBackend) handleC2NUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !res.Supported {
-		res.Err = "not supported"
+		res.Err = unsupported
+		res.ErrReason = unsupportedReason
 		return
 	}
-
-	cmdTS, err := findCmdTailscale()
-	if err != nil {
-		res.Err = fmt.Sprintf("failed to find cmd/tailscale binary: %v", err)
+	target = req.Version
+	if target == "" {
+		// Best effort; if it can't be found, cmd/tailscale update finds
+		// out for itself.
+		target, _ = c2nLatestVersion()
+	}
+	if target != "" && sameUpdateVersion(version.Long(), target) {
+		res.Version = target
+		res.AlreadyUpToDate = true
 		return
 	}
-	var ver struct {
-		Long string `json:"long"`
+	if !b.trySetC2NUpdateStarted() {
+		res.Err = "update already in progress"
+		return
 	}
-	out, err := exec.Command(cmdTS, "version", "--json").Output()
+	started := false
+	defer func() {
+		if !started {
+			b.setC2NUpdateFinished(false)
+		}
+	}()
+
+	cmdTS, err := c2nFindCmdTailscale()
 	if err != nil {
 		res.Err = fmt.Sprintf("failed to find cmd/tailscale binary: %v", err)
+		res.ErrReason = clientupdate.ReasonUnknown
 		return
 	}
-	if err := json.Unmarshal(out, &ver); err != nil {
-		res.Err = "invalid JSON from cmd/tailscale version --json"
+	ver, err := cmdTailscaleVersion(cmdTS)
+	if err != nil {
+		res.Err = err.Error()
+		res.ErrReason = clientupdate.ReasonUnknown
 		return
 	}
-	if ver.Long != version.Long() {
-		res.Err = "cmd/tailscale version mismatch"
-		return
+	// cmd/tailscale does the update, so it must agree with us about
+	// what's installed. Builds of the same major.minor release (which
+	// can differ by their patch version or build suffix midway through
+	// a rollout) are close enough.
+	if ver != version.Long() {
+		if !version.SameMajorMinor(ver, version.Long()) {
+			res.Err = fmt.Sprintf("cmd/tailscale version mismatch: cmd/tailscale is %q, tailscaled is %q", ver, version.Long())
+			res.ErrReason = clientupdate.ReasonUnknown
+			return
+		}
+		b.logf("c2n: update: cmd/tailscale version %q differs from tailscaled %q; continuing", ver, version.Long())
+	}
+	args := []string{"update", "--yes"}
+	if req.Version != "" {
+		args = append(args, "--version="+req.Version)
+	}
+	cmd := exec.Command(cmdTS, args...)
+	var out io.Reader
+	if stream {
+		out, err = cmd.StdoutPipe()
+		if err != nil {
+			res.Err = fmt.Sprintf("failed to start cmd/tailscale update: %v", err)
+			res.ErrReason = clientupdate.ErrorReason(err)
+			return
+		}
+		cmd.Stderr = cmd.Stdout
 	}
-	cmd := exec.Command(cmdTS, "update", "--yes")
 	if err := cmd.Start(); err != nil {
 		res.Err = fmt.Sprintf("failed to start cmd/tailscale update: %v", err)
+		res.ErrReason = clientupdate.ErrorReason(err)
 		return
 	}
+	started = true
 	res.Started = true
+	res.Running = true
+
+	if stream {
+		streaming = true
+		res = b.streamC2NUpdate(w, cmd, out, cmdTS, res)
+		return
+	}
 
 	// TODO(bradfitz,andrew): There might be a race condition here on Windows:
 	// * We start the update process.
@@ -185,8 +1902,191 @@ func (b *LocalBackend) handleC2NUpdate(w http.ResponseWriter, r *http.Request) {
 	// * This doesn't return because the process is dead.
 	//
 	// This seems fairly unlikely, but worth checking.
-	defer cmd.Wait()
-	return
+	err = cmd.Wait()
+	b.setC2NUpdateFinished(true)
+	res.Running = false
+	res.Err, res.ErrReason = c2nUpdateExitError(cmd, err)
+}
+
+// streamC2NUpdate copies the combined output of the started update cmd to
+// w, then waits for cmd to exit and writes the c2nUpdateStreamResult. It
+// returns res as updated with the result.
+func (b *LocalBackend) streamC2NUpdate(w http.ResponseWriter, cmd *exec.Cmd, out io.Reader, cmdTS string, res tailcfg.C2NUpdateResponse) tailcfg.C2NUpdateResponse {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	// Keep reading after any write error, as the update carries on
+	// without the caller and cmd.Wait mustn't be called until the output
+	// is drained.
+	br := bufio.NewReader(out)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			w.Write(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	err := cmd.Wait()
+	b.setC2NUpdateFinished(true)
+
+	final := c2nUpdateStreamResult{
+		C2NUpdateResponse: res,
+		ExitCode:          cmd.ProcessState.ExitCode(),
+	}
+	final.Running = false
+	final.Err, final.ErrReason = c2nUpdateExitError(cmd, err)
+	if v, err := cmdTailscaleVersion(cmdTS); err == nil {
+		final.InstalledVersion = v
+	}
+	json.NewEncoder(w).Encode(final)
+	return final.C2NUpdateResponse
+}
+
+// c2nUpdateExitError returns C2NUpdateResponse.Err and ErrReason for the
+// finished update cmd, given the error from cmd.Wait. They're empty if the
+// update succeeded.
+func c2nUpdateExitError(cmd *exec.Cmd, waitErr error) (msg, reason string) {
+	var exitErr *exec.ExitError
+	switch {
+	case waitErr != nil && !errors.As(waitErr, &exitErr):
+		return waitErr.Error(), clientupdate.ErrorReason(waitErr)
+	case cmd.ProcessState.ExitCode() != 0:
+		// cmd/tailscale exits with a code that says why.
+		return fmt.Sprintf("cmd/tailscale update failed: %v", waitErr), clientupdate.ReasonForExitCode(cmd.ProcessState.ExitCode())
+	}
+	return "", ""
+}
+
+// cmdTailscaleVersion returns the long version of the cmd/tailscale binary
+// at cmdTS.
+func cmdTailscaleVersion(cmdTS string) (string, error) {
+	var ver struct {
+		Long string `json:"long"`
+	}
+	out, err := exec.Command(cmdTS, "version", "--json").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find cmd/tailscale binary: %v", err)
+	}
+	if err := json.Unmarshal(out, &ver); err != nil {
+		return "", errors.New("invalid JSON from cmd/tailscale version --json")
+	}
+	return ver.Long, nil
+}
+
+// Errors returned by c2n /update when it can't update this installation.
+const (
+	c2nUpdateErrUnsupported = "not supported"
+	c2nUpdateErrMacSysExt   = "not supported: macOS system extension builds are updated by the Tailscale app's own updater"
+)
+
+// updateUnsupportedReason returns why c2n /update can't update this
+// installation, and which of the clientupdate.Reason* constants that is,
+// given the error from clientupdate.NewUpdater and whether this is a macOS
+// system extension build, or empty strings if it can.
+func updateUnsupportedReason(updaterErr error, macSysExt bool) (msg, reason string) {
+	switch {
+	case macSysExt:
+		// clientupdate's updater for these builds is a stub, because
+		// "tailscale update" there is handled in Swift by launching the
+		// GUI updater, which tailscaled can't drive.
+		// TODO(cpalmer, #6995): Implement it.
+		return c2nUpdateErrMacSysExt, clientupdate.ReasonUnsupported
+	case errors.Is(updaterErr, clientupdate.ErrUnverifiable):
+		return "not supported: " + updaterErr.Error(), clientupdate.ReasonUnverifiable
+	case updaterErr != nil:
+		return c2nUpdateErrUnsupported, clientupdate.ReasonUnsupported
+	}
+	return "", ""
+}
+
+// isUpdateVersion reports whether v looks like a version that c2n /update
+// can install: three dot-separated numbers, such as "1.56.1".
+func isUpdateVersion(v string) bool {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || len(p) > 5 || strings.Trim(p, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// sameUpdateVersion reports whether running and target, which are version
+// strings like "1.56.1", "v1.56.1" or "1.56.1-t1234abcd-g5678", are the same
+// release, ignoring any build suffixes.
+func sameUpdateVersion(running, target string) bool {
+	return updateRelease(running) != "" && updateRelease(running) == updateRelease(target)
+}
+
+// updateRelease returns the release in version string v, as for
+// sameUpdateVersion: "1.56.1" for "v1.56.1-t1234abcd-g5678".
+func updateRelease(v string) string {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	return v
+}
+
+// c2nUpdateCheckCacheTime is how long c2n /update GETs reuse the result of
+// looking up the latest version, so that many of them don't each hit the
+// update server.
+const c2nUpdateCheckCacheTime = time.Minute
+
+// c2nUpdateCheck is a cached result of c2nLatestVersion.
+type c2nUpdateCheck struct {
+	at      time.Time
+	version string
+	err     error
+}
+
+// c2nCachedLatestVersion returns c2nLatestVersion, or what it returned
+// within the past c2nUpdateCheckCacheTime. Errors are cached too.
+func (b *LocalBackend) c2nCachedLatestVersion() (string, error) {
+	b.mu.Lock()
+	c := b.c2nUpdateCheck
+	b.mu.Unlock()
+	now := b.clock.Now()
+	if c != nil && now.Sub(c.at) < c2nUpdateCheckCacheTime {
+		return c.version, c.err
+	}
+	v, err := c2nLatestVersion()
+	b.mu.Lock()
+	b.c2nUpdateCheck = &c2nUpdateCheck{at: now, version: v, err: err}
+	b.mu.Unlock()
+	return v, err
+}
+
+// trySetC2NUpdateStarted records that a c2n update is starting. It reports
+// false, without recording anything, if an update is already running or
+// one started within the past c2nUpdateCooldown.
+func (b *LocalBackend) trySetC2NUpdateStarted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	if b.c2nUpdateRunning || (!b.c2nUpdateStarted.IsZero() && now.Sub(b.c2nUpdateStarted) < c2nUpdateCooldown) {
+		return false
+	}
+	b.c2nUpdateRunning = true
+	b.c2nUpdateStarted = now
+	return true
+}
+
+// setC2NUpdateFinished records that the c2n update recorded by
+// trySetC2NUpdateStarted is no longer running. If ran is false, the update
+// process never started, so it doesn't count towards c2nUpdateCooldown.
+func (b *LocalBackend) setC2NUpdateFinished(ran bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.c2nUpdateRunning = false
+	if !ran {
+		b.c2nUpdateStarted = time.Time{}
+	}
 }
 
 // findCmdTailscale looks for the cmd/tailscale that corresponds to the
@@ -198,19 +2098,49 @@ func findCmdTailscale() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	switch runtime.GOOS {
-	case "linux":
-		if self == "/usr/sbin/tailscaled" {
-			return "/usr/bin/tailscale", nil
-		}
-		return "", errors.New("tailscale not found in expected place")
+	return findCmdTailscaleIn(runtime.GOOS, self, os.Stat)
+}
+
+// findCmdTailscaleIn is findCmdTailscale for a cmd/tailscaled at self on
+// goos, using stat to look at the filesystem.
+func findCmdTailscaleIn(goos, self string, stat func(string) (fs.FileInfo, error)) (string, error) {
+	// isExecutable reports whether name is a regular file that's
+	// executable. Windows has no executable bits.
+	isExecutable := func(name string) bool {
+		fi, err := stat(name)
+		return err == nil && fi.Mode().IsRegular() && (goos == "windows" || fi.Mode().Perm()&0111 != 0)
+	}
+	switch goos {
 	case "windows":
 		dir := filepath.Dir(self)
 		ts := filepath.Join(dir, "tailscale.exe")
-		if fi, err := os.Stat(ts); err == nil && fi.Mode().IsRegular() {
+		if isExecutable(ts) {
 			return ts, nil
 		}
 		return "", errors.New("tailscale.exe not found in expected place")
+	case "linux", "darwin", "freebsd":
+		// Prefer the tailscale next to tailscaled, as installed by
+		// tarballs, Homebrew, FreeBSD's pkg, or "go install", then the
+		// one in the sibling bin directory, as installed by Linux
+		// packages (/usr/sbin/tailscaled and /usr/bin/tailscale) and in
+		// /usr/local, and finally the usual install locations.
+		dir := path.Dir(self)
+		candidates := []string{
+			path.Join(dir, "tailscale"),
+			path.Join(dir, "..", "bin", "tailscale"),
+		}
+		switch goos {
+		case "darwin":
+			candidates = append(candidates, "/usr/local/bin/tailscale", "/opt/homebrew/bin/tailscale")
+		case "freebsd":
+			candidates = append(candidates, "/usr/local/bin/tailscale")
+		}
+		for _, ts := range candidates {
+			if isExecutable(ts) {
+				return ts, nil
+			}
+		}
+		return "", errors.New("tailscale not found in expected place")
 	}
-	return "", fmt.Errorf("unsupported OS %v", runtime.GOOS)
+	return "", fmt.Errorf("unsupported OS %v", goos)
 }
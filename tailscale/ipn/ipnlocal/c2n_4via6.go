@@ -0,0 +1,91 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/views"
+	"tailscale.com/util/clientmetric"
+)
+
+// c2nViaRoute is a 4via6 route, as returned by /debug/4via6.
+type c2nViaRoute struct {
+	Via    netip.Prefix // in tsaddr.TailscaleViaRange
+	SiteID uint32
+	IPv4   netip.Prefix // the IPv4 prefix that Via maps to in the site
+
+	// Peer is the peer that routes Via, for routes learned from the
+	// netmap.
+	Peer tailcfg.StableNodeID `json:",omitempty"`
+
+	// Approved and Primary are, for routes advertised by this node,
+	// whether control approved the route and whether this node is its
+	// primary router.
+	Approved bool `json:",omitempty"`
+	Primary  bool `json:",omitempty"`
+}
+
+// handleC2NDebug4via6 reports the 4via6 routes that this node advertises,
+// the ones it can reach via peers, and how many connections it has
+// translated.
+func (b *LocalBackend) handleC2NDebug4via6(w http.ResponseWriter, r *http.Request) {
+	nm := b.NetMap()
+	if nm == nil || !nm.SelfNode.Valid() {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	self := nm.SelfNode
+	var res struct {
+		Advertised []c2nViaRoute
+		Peers      []c2nViaRoute
+		// Translations counts the 4via6 connections (or pings)
+		// translated to IPv4, keyed by protocol.
+		Translations map[string]int64
+	}
+	for _, p := range b.Prefs().AdvertiseRoutes().AsSlice() {
+		vr, ok := viaRouteOf(p)
+		if !ok {
+			continue
+		}
+		vr.Approved = views.SliceContains(self.AllowedIPs(), p)
+		vr.Primary = views.SliceContains(self.PrimaryRoutes(), p)
+		res.Advertised = append(res.Advertised, vr)
+	}
+	for _, peer := range nm.Peers {
+		aips := peer.AllowedIPs()
+		for i := 0; i < aips.Len(); i++ {
+			if vr, ok := viaRouteOf(aips.At(i)); ok {
+				vr.Peer = peer.StableID()
+				res.Peers = append(res.Peers, vr)
+			}
+		}
+	}
+	res.Translations = make(map[string]int64)
+	for _, m := range clientmetric.Metrics() {
+		if proto, ok := strings.CutPrefix(m.Name(), "netstack_4via6_"); ok {
+			res.Translations[proto] = m.Value()
+		}
+	}
+	writeJSON(w, res)
+}
+
+// viaRouteOf returns the 4via6 route that p is, the inverse of
+// tsaddr.MapVia. It reports false if p isn't a 4via6 route.
+func viaRouteOf(p netip.Prefix) (_ c2nViaRoute, ok bool) {
+	if !tsaddr.IsViaPrefix(p) || p.Bits() < 96 {
+		return c2nViaRoute{}, false
+	}
+	a := p.Addr().As16()
+	return c2nViaRoute{
+		Via:    p,
+		SiteID: binary.BigEndian.Uint32(a[8:12]),
+		IPv4:   netip.PrefixFrom(tsaddr.UnmapVia(p.Addr()), p.Bits()-96),
+	}, true
+}
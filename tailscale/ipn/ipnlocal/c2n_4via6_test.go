@@ -0,0 +1,32 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/net/tsaddr"
+)
+
+func TestViaRouteOf(t *testing.T) {
+	v4 := netip.MustParsePrefix("10.1.0.0/16")
+	via, err := tsaddr.MapVia(7, v4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := viaRouteOf(via)
+	if !ok {
+		t.Fatalf("viaRouteOf(%v) not ok", via)
+	}
+	if got.Via != via || got.SiteID != 7 || got.IPv4 != v4 {
+		t.Errorf("viaRouteOf(%v) = %+v; want site 7, %v", via, got, v4)
+	}
+
+	for _, p := range []string{"10.1.0.0/16", "fd7a:115c:a1e0::/48", "fd7a:115c:a1e0:b1a::/64"} {
+		if got, ok := viaRouteOf(netip.MustParsePrefix(p)); ok {
+			t.Errorf("viaRouteOf(%v) = %+v; want not ok", p, got)
+		}
+	}
+}
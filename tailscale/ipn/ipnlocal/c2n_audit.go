@@ -0,0 +1,145 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"tailscale.com/util/clientmetric"
+)
+
+// c2nMutationMetrics count the requests with methods other than GET to
+// each of the c2nRoutes that mutate or are audited, whether or not they
+// succeed, named like "c2n_mutation_prefs_routes" for /prefs/routes.
+var c2nMutationMetrics = func() map[string]*clientmetric.Metric {
+	ret := make(map[string]*clientmetric.Metric)
+	for path, route := range c2nRoutes {
+		if !route.mutates && !route.audited {
+			continue
+		}
+		name, ok := c2nShippedMutationMetricNames[path]
+		if !ok {
+			name = "c2n_mutation_" + c2nMetricName(path)
+		}
+		ret[path] = clientmetric.NewCounter(name)
+	}
+	return ret
+}()
+
+// c2nShippedMutationMetricNames are the names of the c2nMutationMetrics
+// that were released before the names were derived from the path, which
+// are kept so as not to break anything that reads them.
+var c2nShippedMutationMetricNames = map[string]string{
+	"/debug/certs/renew":        "c2n_mutation_certs_renew",
+	"/debug/derp-failover-test": "c2n_mutation_derp_failover_test",
+	"/debug/disco-rekey":        "c2n_mutation_disco_rekey",
+	"/prefs/exitnode":           "c2n_mutation_exit_node",
+	"/prefs/shieldsup":          "c2n_mutation_shields_up",
+}
+
+// c2nRequestMetrics are the counters of requests to a c2n path, by the
+// class of their response's status code. Responses with other codes aren't
+// counted.
+type c2nRequestMetrics struct {
+	ok        *clientmetric.Metric // 2xx
+	clientErr *clientmetric.Metric // 4xx
+	serverErr *clientmetric.Metric // 5xx
+}
+
+func (m *c2nRequestMetrics) count(code int) {
+	switch code / 100 {
+	case 2:
+		m.ok.Add(1)
+	case 4:
+		m.clientErr.Add(1)
+	case 5:
+		m.serverErr.Add(1)
+	}
+}
+
+// c2nRouteMetrics are the c2nRequestMetrics of each of c2nRoutes, named
+// like "c2n_requests_debug_derp_test_4xx" for /debug/derp/test, as
+// clientmetric has no labels.
+var c2nRouteMetrics = func() map[string]*c2nRequestMetrics {
+	ret := make(map[string]*c2nRequestMetrics, len(c2nRoutes))
+	for path := range c2nRoutes {
+		name := "c2n_requests_" + c2nMetricName(path)
+		ret[path] = &c2nRequestMetrics{
+			ok:        clientmetric.NewCounter(name + "_2xx"),
+			clientErr: clientmetric.NewCounter(name + "_4xx"),
+			serverErr: clientmetric.NewCounter(name + "_5xx"),
+		}
+	}
+	return ret
+}()
+
+// c2nMetricName returns the c2n path as it appears in metric names, like
+// "debug_derp_test" for /debug/derp/test.
+func c2nMetricName(path string) string {
+	return c2nMetricNameReplacer.Replace(strings.TrimPrefix(path, "/"))
+}
+
+var c2nMetricNameReplacer = strings.NewReplacer("/", "_", "-", "_")
+
+// metricC2NUnknownPath counts the requests to paths not in c2nRoutes.
+var metricC2NUnknownPath = clientmetric.NewCounter("c2n_requests_unknown_path")
+
+// c2nAuditWriter is an http.ResponseWriter that records the outcome of a
+// c2n request for logC2NRequest.
+type c2nAuditWriter struct {
+	http.ResponseWriter
+	code    int   // status code written, or zero if none yet
+	written int64 // bytes of body written
+}
+
+func (w *c2nAuditWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *c2nAuditWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, for the handlers that stream their
+// responses.
+func (w *c2nAuditWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *c2nAuditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logC2NRequest logs that r was handled, with the outcome recorded by w.
+// Only the method and path are logged; the query and body may contain
+// things that shouldn't be.
+func (b *LocalBackend) logC2NRequest(r *http.Request, w *c2nAuditWriter, d time.Duration) {
+	if m, ok := c2nMutationMetrics[r.URL.Path]; ok && r.Method != "GET" && r.Method != "HEAD" {
+		m.Add(1)
+	}
+	code := w.code
+	if code == 0 {
+		// Nothing was written, so net/http will send a 200.
+		code = http.StatusOK
+	}
+	if m, ok := c2nRouteMetrics[r.URL.Path]; ok {
+		m.count(code)
+	} else {
+		metricC2NUnknownPath.Add(1)
+	}
+	b.logf("c2n: %s %s: %d %s (%d bytes in %v)", r.Method, r.URL.Path, code, http.StatusText(code), w.written, d.Round(time.Millisecond))
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/tstime"
+)
+
+func TestHandleC2NAuditLog(t *testing.T) {
+	var logs []string
+	b := &LocalBackend{
+		logf: func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+		clock: tstime.StdClock{},
+	}
+	tests := []struct {
+		method, path, query string
+		wantLog             string
+	}{
+		{"POST", "/echo", "", "c2n: POST /echo: 200 OK (6 bytes in "},
+		{"GET", "/no-such-path", "", "c2n: GET /no-such-path: 400 Bad Request ("},
+		{"GET", "/logtail/rotate", "?secret=hunter2", "c2n: GET /logtail/rotate: 405 Method Not Allowed ("},
+	}
+	for _, tt := range tests {
+		logs = nil
+		b.handleC2N(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path+tt.query, strings.NewReader("secret")))
+		got := strings.Join(logs, "\n")
+		if !strings.HasPrefix(got, tt.wantLog) {
+			t.Errorf("%s %s: logged %q; want prefix %q", tt.method, tt.path, got, tt.wantLog)
+		}
+		if strings.Contains(got, "secret") || strings.Contains(got, "hunter2") {
+			t.Errorf("%s %s: logged request body or query: %q", tt.method, tt.path, got)
+		}
+	}
+
+	// Requests to mutating and audited paths with methods other than GET
+	// are counted, even if they're refused.
+	for _, tt := range []struct {
+		method, path string
+		want         int64
+	}{
+		{"GET", "/dns/reapply", 0},
+		{"POST", "/dns/reapply", 1},
+		{"GET", "/prefs", 0},
+		{"HEAD", "/prefs", 0},
+		{"PATCH", "/prefs", 1},
+		{"POST", "/keyexpiry", 1},
+		{"POST", "/debug/rebind", 1},
+		{"GET", "/logtail/rotate", 0},
+		{"POST", "/logtail/rotate", 1},
+		{"GET", "/update", 0},
+		{"POST", "/update", 1},
+		{"POST", "/restart", 1},
+	} {
+		m := c2nMutationMetrics[tt.path]
+		before := m.Value()
+		b.handleC2N(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}")))
+		if got := m.Value() - before; got != tt.want {
+			t.Errorf("%s %s: %s increased by %d; want %d", tt.method, tt.path, m.Name(), got, tt.want)
+		}
+	}
+}
+
+func TestC2NMutationMetrics(t *testing.T) {
+	for path, want := range map[string]string{
+		// As originally released.
+		"/update":                   "c2n_mutation_update",
+		"/restart":                  "c2n_mutation_restart",
+		"/logtail/rotate":           "c2n_mutation_logtail_rotate",
+		"/debug/certs/renew":        "c2n_mutation_certs_renew",
+		"/debug/derp-failover-test": "c2n_mutation_derp_failover_test",
+		"/debug/disco-rekey":        "c2n_mutation_disco_rekey",
+		"/dns/reapply":              "c2n_mutation_dns_reapply",
+		"/prefs/exitnode":           "c2n_mutation_exit_node",
+		"/prefs/shieldsup":          "c2n_mutation_shields_up",
+
+		"/prefs/routes": "c2n_mutation_prefs_routes",
+	} {
+		if m, ok := c2nMutationMetrics[path]; !ok {
+			t.Errorf("%s: no mutation metric", path)
+		} else if got := m.Name(); got != want {
+			t.Errorf("%s: name = %q; want %q", path, got, want)
+		}
+	}
+	for path, route := range c2nRoutes {
+		want := route.mutates || route.audited
+		if _, ok := c2nMutationMetrics[path]; ok != want {
+			t.Errorf("%s: has mutation metric = %v; want %v", path, ok, want)
+		}
+	}
+	for path := range c2nShippedMutationMetricNames {
+		if _, ok := c2nMutationMetrics[path]; !ok {
+			t.Errorf("%s: shipped mutation metric name, but no metric", path)
+		}
+	}
+}
+
+func TestC2NRouteMetrics(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	m := c2nRouteMetrics["/echo"]
+	if got := m.clientErr.Name(); got != "c2n_requests_echo_4xx" {
+		t.Errorf("name = %q; want c2n_requests_echo_4xx", got)
+	}
+	if got := c2nRouteMetrics["/debug/derp-failover-test"].ok.Name(); got != "c2n_requests_debug_derp_failover_test_2xx" {
+		t.Errorf("name = %q; want c2n_requests_debug_derp_failover_test_2xx", got)
+	}
+	for path, m := range c2nRouteMetrics {
+		if _, ok := c2nRoutes[path]; !ok || m.ok == nil || m.clientErr == nil || m.serverErr == nil {
+			t.Errorf("bad metrics for %q", path)
+		}
+	}
+	if len(c2nRouteMetrics) != len(c2nRoutes) {
+		t.Errorf("%d paths have metrics; want all %d", len(c2nRouteMetrics), len(c2nRoutes))
+	}
+
+	ok, clientErr, serverErr, unknown := m.ok.Value(), m.clientErr.Value(), m.serverErr.Value(), metricC2NUnknownPath.Value()
+	b.handleC2N(httptest.NewRecorder(), httptest.NewRequest("POST", "/echo", nil))
+	b.handleC2N(httptest.NewRecorder(), httptest.NewRequest("POST", "/echo", nil))
+	b.handleC2N(httptest.NewRecorder(), httptest.NewRequest("POST", "/echo", strings.NewReader(strings.Repeat("x", 1<<20+1)))) // too big
+	b.handleC2N(httptest.NewRecorder(), httptest.NewRequest("GET", "/no-such-path", nil))
+	if got := [4]int64{m.ok.Value() - ok, m.clientErr.Value() - clientErr, m.serverErr.Value() - serverErr, metricC2NUnknownPath.Value() - unknown}; got != [4]int64{2, 1, 0, 1} {
+		t.Errorf("2xx, 4xx, 5xx and unknown path counts increased by %v; want [2 1 0 1]", got)
+	}
+}
+
+func TestC2NAuditWriterFlusher(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var w http.ResponseWriter = &c2nAuditWriter{ResponseWriter: rec}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("c2nAuditWriter isn't an http.Flusher")
+	}
+	f.Flush()
+	if !rec.Flushed {
+		t.Error("Flush didn't flush the underlying ResponseWriter")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// c2nDefaultMaxBody is the most bytes of request body that a c2n handler
+// reads, unless its c2nRoute says otherwise.
+const c2nDefaultMaxBody = 64 << 10
+
+// c2nBodyTimeout is how long a c2n request's body has to arrive, from when
+// handling the request starts.
+const c2nBodyTimeout = 30 * time.Second
+
+// errC2NBodyTimeout is returned by reads of a c2n request body that didn't
+// arrive within c2nBodyTimeout.
+var errC2NBodyTimeout = errors.New("timed out reading c2n request body")
+
+// c2nBody is a c2n request body that's closed, failing any blocked and
+// later reads, if it's not all read in time.
+type c2nBody struct {
+	io.ReadCloser
+	expired atomic.Bool
+}
+
+func (b *c2nBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.expired.Load() {
+		err = errC2NBodyTimeout
+	}
+	return n, err
+}
+
+func (b *c2nBody) expire() {
+	b.expired.Store(true)
+	b.ReadCloser.Close()
+}
+
+// limitC2NBody replaces r's body with one that fails with an
+// *http.MaxBytesError after max bytes, and with errC2NBodyTimeout if it's
+// not read within c2nBodyTimeout. If r has a form body, it's read now; if
+// that fails, the error is written to w and limitC2NBody returns false.
+//
+// The returned stop func must be called once the request is handled.
+func (b *LocalBackend) limitC2NBody(w http.ResponseWriter, r *http.Request, max int64) (stop func(), ok bool) {
+	if max == 0 {
+		max = c2nDefaultMaxBody
+	}
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	body := &c2nBody{ReadCloser: http.MaxBytesReader(w, r.Body, max)}
+	t := b.clock.AfterFunc(c2nBodyTimeout, body.expire)
+	r.Body = body
+	stop = func() { t.Stop() }
+
+	// Parse any form body now, as FormValue ignores errors doing so.
+	if err := r.ParseForm(); err != nil {
+		writeC2NBodyError(w, err)
+		return stop, false
+	}
+	return stop, true
+}
+
+// writeC2NBodyError writes a response for err, which was returned reading
+// a c2n request's body: a 413 if it was too big, a 408 if it was too slow,
+// and otherwise a 400.
+func writeC2NBodyError(w http.ResponseWriter, err error) {
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &mbe):
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errC2NBodyTimeout):
+		http.Error(w, err.Error(), http.StatusRequestTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/tstest"
+	"tailscale.com/tstime"
+)
+
+// zeros is an io.Reader of endless zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestHandleC2NBodyLimit(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/echo", io.LimitReader(zeros{}, 100<<20)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("100MB echo: status = %d; want 413", rec.Code)
+	}
+	if rec.Body.Len() > 1<<10 {
+		t.Errorf("100MB echo: got %d bytes of response; want just an error", rec.Body.Len())
+	}
+
+	rec = httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/echo", strings.NewReader("hello")))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("small echo: got %d %q; want 200 hello", rec.Code, rec.Body.Bytes())
+	}
+
+	// Form bodies are limited too, rather than FormValue silently
+	// ignoring the error.
+	req := httptest.NewRequest("POST", "/debug/component-logging", io.LimitReader(zeros{}, c2nDefaultMaxBody+1))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	b.handleC2N(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("big form: status = %d; want 413", rec.Code)
+	}
+}
+
+func TestHandleC2NBodyTimeout(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b := &LocalBackend{logf: t.Logf, clock: clock}
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.handleC2N(rec, httptest.NewRequest("POST", "/echo", pr))
+	}()
+	// The body never arrives, so once the handler's timer is running,
+	// advancing past it should fail the read.
+	for {
+		select {
+		case <-done:
+			if rec.Code != http.StatusRequestTimeout {
+				t.Errorf("status = %d; want 408", rec.Code)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+			clock.Advance(c2nBodyTimeout)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Statuses of a c2n /debug/caps response.
+const (
+	c2nCapsOK       = "ok"
+	c2nCapsNoNetmap = "no-netmap" // the node hasn't received a netmap yet
+	c2nCapsNoSelf   = "no-self"   // the netmap has no self node
+)
+
+// c2nCapsResult is the response to c2n /debug/caps.
+type c2nCapsResult struct {
+	// Status is one of the c2nCaps* statuses. Capabilities and CapMap are
+	// empty unless it's "ok".
+	Status string
+
+	// Capabilities are the self node's capabilities as received from
+	// control, sorted.
+	Capabilities []string
+
+	// CapMap is Capabilities keyed by capability with any query removed,
+	// each with the values it was given. A capability's values are its
+	// query parameters (as in tailcfg.CapabilityFunnelPorts' "?ports="),
+	// as a JSON object of parameter name to values; one with no
+	// parameters has none.
+	CapMap map[string][]json.RawMessage
+}
+
+// handleC2NDebugCaps reports the capabilities that the node has in its
+// current netmap, so that it can be seen whether one reached it. Before the
+// node has a netmap it reports no capabilities rather than failing.
+func (b *LocalBackend) handleC2NDebugCaps(w http.ResponseWriter, r *http.Request) {
+	res := c2nCapsResult{
+		Status:       c2nCapsOK,
+		Capabilities: []string{},
+		CapMap:       map[string][]json.RawMessage{},
+	}
+	nm := b.NetMap()
+	switch {
+	case nm == nil:
+		res.Status = c2nCapsNoNetmap
+	case !nm.SelfNode.Valid():
+		res.Status = c2nCapsNoSelf
+	default:
+		res.Capabilities = append(res.Capabilities, nm.SelfNode.Capabilities().AsSlice()...)
+		slices.Sort(res.Capabilities)
+		res.Capabilities = slices.Compact(res.Capabilities)
+		for _, c := range res.Capabilities {
+			name, vals := parseC2NCap(c)
+			res.CapMap[name] = append(res.CapMap[name], vals...)
+		}
+	}
+	writeJSON(w, res)
+}
+
+// parseC2NCap splits c into the capability name and, if it has query
+// parameters, their values as a JSON object. A capability that isn't a URL,
+// or whose query doesn't parse, is returned whole with no values.
+func parseC2NCap(c string) (name string, vals []json.RawMessage) {
+	base, rawQuery, ok := strings.Cut(c, "?")
+	if !ok {
+		return c, nil
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil || len(q) == 0 {
+		return c, nil
+	}
+	j, err := json.Marshal(q)
+	if err != nil {
+		return c, nil
+	}
+	return base, []json.RawMessage{j}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/netmap"
+)
+
+func TestHandleC2NDebugCaps(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	get := func() (res c2nCapsResult) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/caps", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := get(); res.Status != c2nCapsNoNetmap || len(res.Capabilities) != 0 || len(res.CapMap) != 0 {
+		t.Errorf("with no netmap = %+v", res)
+	}
+
+	b.netMap = &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{
+			Capabilities: []string{
+				tailcfg.CapabilityFunnelPorts + "?ports=443,8443",
+				tailcfg.NodeAttrFunnel,
+				tailcfg.CapabilityAdmin,
+				tailcfg.CapabilityAdmin,
+			},
+		}).View(),
+	}
+	res := get()
+	wantCaps := []string{
+		tailcfg.NodeAttrFunnel,
+		tailcfg.CapabilityFunnelPorts + "?ports=443,8443",
+		tailcfg.CapabilityAdmin,
+	}
+	if res.Status != c2nCapsOK || !reflect.DeepEqual(res.Capabilities, wantCaps) {
+		t.Errorf("caps = %q, %q; want ok, %q", res.Status, res.Capabilities, wantCaps)
+	}
+	if len(res.CapMap) != 3 || res.CapMap[tailcfg.CapabilityAdmin] != nil || res.CapMap[tailcfg.NodeAttrFunnel] != nil {
+		t.Errorf("CapMap = %v", res.CapMap)
+	}
+	vals := res.CapMap[tailcfg.CapabilityFunnelPorts]
+	if len(vals) != 1 {
+		t.Fatalf("funnel-ports values = %s", vals)
+	}
+	var ports map[string][]string
+	if err := json.Unmarshal(vals[0], &ports); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"ports": {"443,8443"}}; !reflect.DeepEqual(ports, want) {
+		t.Errorf("funnel-ports values = %v; want %v", ports, want)
+	}
+}
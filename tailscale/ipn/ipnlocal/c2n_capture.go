@@ -0,0 +1,144 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/envknob"
+)
+
+// Bounds on c2n /debug/capture.
+const (
+	c2nCaptureDefaultDuration = 10 * time.Second
+	c2nCaptureMaxDuration     = 60 * time.Second
+	c2nCaptureDefaultPackets  = 1000
+	c2nCaptureMaxPackets      = 100000
+
+	// c2nCaptureMaxBytes bounds the capture, which is held in memory
+	// until it's returned.
+	c2nCaptureMaxBytes = 8 << 20
+
+	// c2nCaptureQueueLen is how many captured packets may be waiting to
+	// be collected before more are dropped, so that collecting them
+	// doesn't stall the data path.
+	c2nCaptureQueueLen = 256
+)
+
+// pcapFileHeaderLen is the size of the header at the start of a pcap
+// stream, which a capture.Sink writes in several pieces before any packets.
+const pcapFileHeaderLen = 24
+
+// c2nCaptureWriter is the io.Writer that a c2n /debug/capture registers
+// with the capture.Sink. It queues what it's given for the handler to
+// collect, dropping packets if the queue's full.
+type c2nCaptureWriter struct {
+	ch      chan []byte
+	dropped atomic.Int64
+}
+
+func (w *c2nCaptureWriter) Write(p []byte) (int, error) {
+	select {
+	case w.ch <- append([]byte(nil), p...): // the sink reuses p
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// handleC2NDebugCapture captures the packets the node sends and receives
+// over Tailscale in pcap format, as "tailscale debug capture" does, for up
+// to "secs" seconds or "packets" packets, whichever comes first, and then
+// returns them. As c2n responses are buffered until the handler returns,
+// the capture is collected in full first, and the number of packets
+// captured and dropped (because they couldn't be collected fast enough) are
+// in the Tailscale-Capture-Packets and Tailscale-Capture-Dropped headers.
+//
+// The node has to opt in with TS_ALLOW_C2N_PACKET_CAPTURE, and only one
+// capture may run at a time.
+func (b *LocalBackend) handleC2NDebugCapture(w http.ResponseWriter, r *http.Request) {
+	if !envknob.AllowsC2NPacketCapture() {
+		http.Error(w, "c2n packet capture not enabled on this node", http.StatusForbidden)
+		return
+	}
+	d := c2nCaptureDefaultDuration
+	if v := r.FormValue("secs"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
+			return
+		}
+		d = min(time.Duration(secs)*time.Second, c2nCaptureMaxDuration)
+	}
+	maxPackets := c2nCaptureDefaultPackets
+	if v := r.FormValue("packets"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid 'packets' parameter", http.StatusBadRequest)
+			return
+		}
+		maxPackets = min(n, c2nCaptureMaxPackets)
+	}
+
+	b.mu.Lock()
+	if b.c2nCapturing {
+		b.mu.Unlock()
+		http.Error(w, "a capture is already running", http.StatusConflict)
+		return
+	}
+	b.c2nCapturing = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.c2nCapturing = false
+		b.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	defer cancel()
+	cw := &c2nCaptureWriter{ch: make(chan []byte, c2nCaptureQueueLen)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := b.StreamDebugCapture(ctx, cw); err != nil {
+			b.logf("c2n: capture: %v", err)
+		}
+	}()
+
+	var buf bytes.Buffer
+	var packets int
+	collect := func(p []byte) {
+		if buf.Len() >= pcapFileHeaderLen {
+			packets++
+		}
+		buf.Write(p)
+		if packets >= maxPackets || buf.Len() >= c2nCaptureMaxBytes {
+			cancel()
+		}
+	}
+	// Collect what's captured until the capture ends (including because
+	// a limit was reached), then what was queued before then.
+	for running := true; running; {
+		select {
+		case p := <-cw.ch:
+			collect(p)
+		case <-done:
+			running = false
+		}
+	}
+	for len(cw.ch) > 0 && packets < maxPackets && buf.Len() < c2nCaptureMaxBytes {
+		collect(<-cw.ch)
+	}
+	dropped := cw.dropped.Load()
+	b.logf("c2n: captured %d packets (%d dropped)", packets, dropped)
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Tailscale-Capture-Packets", strconv.Itoa(packets))
+	w.Header().Set("Tailscale-Capture-Dropped", strconv.FormatInt(dropped, 10))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/net/packet"
+	"tailscale.com/wgengine/capture"
+)
+
+func TestHandleC2NDebugCapture(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/capture?"+query, nil))
+		return rec
+	}
+	if rec := get(""); rec.Code != http.StatusForbidden {
+		t.Fatalf("without opting in: status = %d; want 403", rec.Code)
+	}
+	old := envknob.String("TS_ALLOW_C2N_PACKET_CAPTURE")
+	envknob.Setenv("TS_ALLOW_C2N_PACKET_CAPTURE", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_PACKET_CAPTURE", old) })
+	if rec := get("packets=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("packets=0: status = %d; want 400", rec.Code)
+	}
+
+	recc := make(chan *httptest.ResponseRecorder, 1)
+	go func() { recc <- get("packets=2&secs=30") }()
+	var sink *capture.Sink
+	for i := 0; sink == nil; i++ {
+		if i == 100 {
+			t.Fatal("capture didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+		b.mu.Lock()
+		sink = b.debugSink
+		b.mu.Unlock()
+	}
+	if rec := get(""); rec.Code != http.StatusConflict {
+		t.Errorf("concurrent capture: status = %d; want 409", rec.Code)
+	}
+
+	// Keep logging packets until the capture stops at its limit.
+	pkt := make([]byte, 20)
+	var rec *httptest.ResponseRecorder
+	for rec == nil {
+		sink.LogPacket(capture.FromLocal, time.Now(), pkt, packet.CaptureMeta{})
+		select {
+		case rec = <-recc:
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/vnd.tcpdump.pcap"; got != want {
+		t.Errorf("Content-Type = %q; want %q", got, want)
+	}
+	// A 24 byte file header, then 2 packets, each with a 16 byte packet
+	// header and 4 bytes of Tailscale metadata.
+	if got, want := rec.Body.Len(), 24+2*(16+4+len(pkt)); got != want {
+		t.Errorf("got %d bytes of pcap; want %d", got, want)
+	}
+	// The counts are in headers, not trailers, as controlclient only sends
+	// control the status, headers and body of c2n responses.
+	if got := rec.Header().Get("Tailscale-Capture-Packets"); got != "2" {
+		t.Errorf("Tailscale-Capture-Packets = %q; want 2", got)
+	}
+	if got := rec.Header().Get("Tailscale-Capture-Dropped"); got == "" {
+		t.Error("no Tailscale-Capture-Dropped header")
+	}
+	if len(rec.Result().Trailer) != 0 {
+		t.Errorf("trailers = %v; want none", rec.Result().Trailer)
+	}
+
+	// Another capture may run now.
+	b.mu.Lock()
+	capturing := b.c2nCapturing
+	b.mu.Unlock()
+	if capturing {
+		t.Error("capture still marked as running")
+	}
+}
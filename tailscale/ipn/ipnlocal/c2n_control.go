@@ -0,0 +1,75 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"time"
+
+	"tailscale.com/control/controlclient"
+)
+
+// c2nControlStatus is the response to c2n /debug/control.
+type c2nControlStatus struct {
+	ControlURL string `json:"controlURL"`
+
+	// Conn is "connected", "connecting", "reconnecting", "logged-out" or
+	// "paused", and State is controlclient's state, which it's derived
+	// from.
+	Conn  string `json:"conn"`
+	State string `json:"state"`
+
+	// LastNetMapAt is when a netmap last arrived from control.
+	LastNetMapAt *time.Time `json:"lastNetMapAt,omitempty"`
+
+	// LastErr is the last error from talking to control, even if the
+	// connection has recovered since LastErrAt.
+	LastErr   string     `json:"lastErr,omitempty"`
+	LastErrAt *time.Time `json:"lastErrAt,omitempty"`
+
+	// Noise is whether control is spoken to with the Noise protocol.
+	// NoiseTransport is how its last connection was made: "http", or
+	// "https" if it fell back to tunneling it over TLS.
+	Noise                bool   `json:"noise"`
+	NoiseTransport       string `json:"noiseTransport,omitempty"`
+	NoiseRemoteAddr      string `json:"noiseRemoteAddr,omitempty"`
+	NoiseProtocolVersion int    `json:"noiseProtocolVersion,omitempty"`
+}
+
+// handleC2NDebugControl reports the node's view of its connection to
+// control, for when control thinks it's offline.
+func (b *LocalBackend) handleC2NDebugControl(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	cc, ok := b.cc.(interface {
+		ConnStatus() controlclient.ConnStatus
+	})
+	b.mu.Unlock()
+	if !ok {
+		http.Error(w, "no control client", http.StatusServiceUnavailable)
+		return
+	}
+	st := cc.ConnStatus()
+	res := c2nControlStatus{
+		ControlURL: st.ServerURL,
+		Conn:       st.Conn,
+		State:      st.State.String(),
+		LastErr:    st.LastErr,
+		Noise:      st.Noise,
+	}
+	if !st.LastNetMapAt.IsZero() {
+		res.LastNetMapAt = &st.LastNetMapAt
+	}
+	if !st.LastErrAt.IsZero() {
+		res.LastErrAt = &st.LastErrAt
+	}
+	if st.NoiseRemoteAddr.IsValid() {
+		res.NoiseRemoteAddr = st.NoiseRemoteAddr.String()
+		res.NoiseProtocolVersion = st.NoiseProtocolVersion
+		res.NoiseTransport = "http"
+		if st.NoiseHTTPS {
+			res.NoiseTransport = "https"
+		}
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/tstime"
+)
+
+// connStatusClient is a controlclient.Client with a canned ConnStatus.
+type connStatusClient struct {
+	controlclient.Client
+	st controlclient.ConnStatus
+}
+
+func (c *connStatusClient) ConnStatus() controlclient.ConnStatus { return c.st }
+
+func TestHandleC2NDebugControl(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	get := func(wantCode int) (res c2nControlStatus) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/control", nil))
+		if rec.Code != wantCode {
+			t.Fatalf("status = %d; want %d: %s", rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	get(http.StatusServiceUnavailable)
+
+	netMapAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cc := &connStatusClient{st: controlclient.ConnStatus{
+		ServerURL:            "https://controlplane.example.com",
+		Conn:                 controlclient.ConnReconnecting,
+		State:                controlclient.StateAuthenticated,
+		LastNetMapAt:         netMapAt,
+		LastErr:              "PollNetMap: tls: failed to verify certificate",
+		LastErrAt:            netMapAt.Add(time.Minute),
+		Noise:                true,
+		NoiseRemoteAddr:      netip.MustParseAddrPort("192.0.2.1:443"),
+		NoiseProtocolVersion: 1,
+		NoiseHTTPS:           true,
+	}}
+	b.cc = cc
+	res := get(http.StatusOK)
+	if res.Conn != "reconnecting" || res.State != "state:authenticated" || res.ControlURL != cc.st.ServerURL {
+		t.Errorf("reconnecting: got %+v", res)
+	}
+	if res.LastNetMapAt == nil || !res.LastNetMapAt.Equal(netMapAt) || res.LastErr != cc.st.LastErr || res.LastErrAt == nil {
+		t.Errorf("reconnecting: got %+v; want last netmap and error", res)
+	}
+	if !res.Noise || res.NoiseTransport != "https" || res.NoiseRemoteAddr != "192.0.2.1:443" {
+		t.Errorf("reconnecting: got %+v; want Noise over HTTPS", res)
+	}
+
+	cc.st = controlclient.ConnStatus{Conn: controlclient.ConnConnecting, State: controlclient.StateAuthenticating}
+	if res := get(http.StatusOK); res.Conn != "connecting" || res.LastNetMapAt != nil || res.LastErrAt != nil || res.NoiseTransport != "" {
+		t.Errorf("connecting: got %+v", res)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !js && !wasm
+
+package ipnlocal
+
+import (
+	"net/http"
+	"runtime/pprof"
+	"time"
+)
+
+// CPU profiles need a profiling signal, which the js and wasip1 runtimes
+// don't have. There, c2nCPUProfile stays nil and /debug/cpuprofile is a 501.
+func init() {
+	c2nCPUProfile = func(w http.ResponseWriter, r *http.Request, d time.Duration) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+		if err := pprof.StartCPUProfile(w); err != nil {
+			// Only one CPU profile can run at a time.
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		defer pprof.StopCPUProfile()
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+		}
+	}
+}
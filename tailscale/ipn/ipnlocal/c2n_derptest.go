@@ -0,0 +1,196 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/net/netmon"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+)
+
+const (
+	// c2nDERPTestDefaultTimeout is how long /debug/derp/test waits for all
+	// its probes, unless it's given a "timeout".
+	c2nDERPTestDefaultTimeout = 10 * time.Second
+
+	// c2nDERPTestMaxTimeout is the longest that /debug/derp/test may be
+	// asked to wait for its probes.
+	c2nDERPTestMaxTimeout = 30 * time.Second
+)
+
+// c2nDERPNodeTest is the result of testing one DERP server, as returned by
+// /debug/derp/test.
+type c2nDERPNodeTest struct {
+	RegionID int
+	Node     string // the DERPNode's Name
+	HostName string
+
+	// Reachable is whether a DERP connection was made to the server and
+	// it answered a ping over it.
+	Reachable bool
+
+	// TLSHandshake is how long it took to establish a TLS connection to
+	// the server. Connect is how long a DERP client took to connect to it,
+	// including its own TLS and DERP handshakes, and Latency the round
+	// trip time of a DERP ping over that connection.
+	TLSHandshake time.Duration `json:",omitempty"`
+	Connect      time.Duration `json:",omitempty"`
+	Latency      time.Duration `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+// handleC2NDebugDERPTest connects to each server in the DERP region named
+// by the "region" param (a region ID, or "all") with a DERP client of its
+// own, rather than magicsock's, and reports how that went. Servers are
+// tested concurrently, for up to "timeout" seconds (default 10) in all;
+// servers whose tests didn't finish by then are reported as timed out.
+func (b *LocalBackend) handleC2NDebugDERPTest(w http.ResponseWriter, r *http.Request) {
+	timeout := c2nDERPTestDefaultTimeout
+	if v := r.FormValue("timeout"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs <= 0 {
+			http.Error(w, "invalid 'timeout' parameter", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(secs*float64(time.Second)), c2nDERPTestMaxTimeout)
+	}
+	dm := b.DERPMap()
+	if dm == nil {
+		http.Error(w, "no DERP map", http.StatusServiceUnavailable)
+		return
+	}
+	var regions []*tailcfg.DERPRegion
+	switch v := r.FormValue("region"); v {
+	case "all":
+		for _, id := range dm.RegionIDs() {
+			regions = append(regions, dm.Regions[id])
+		}
+	default:
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid 'region' parameter; want a region ID or \"all\"", http.StatusBadRequest)
+			return
+		}
+		reg, ok := dm.Regions[id]
+		if !ok {
+			http.Error(w, fmt.Sprintf("no DERP region %d", id), http.StatusBadRequest)
+			return
+		}
+		regions = append(regions, reg)
+	}
+
+	var res []c2nDERPNodeTest
+	var nodes []*tailcfg.DERPNode
+	for _, reg := range regions {
+		for _, n := range reg.Nodes {
+			if n.STUNOnly {
+				continue
+			}
+			res = append(res, c2nDERPNodeTest{
+				RegionID: reg.RegionID,
+				Node:     n.Name,
+				HostName: n.HostName,
+				Error:    "timed out",
+			})
+			nodes = append(nodes, n)
+		}
+	}
+
+	var netMon *netmon.Monitor
+	if b.sys != nil {
+		netMon, _ = b.sys.NetMon.GetOK()
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i int, t c2nDERPNodeTest, n *tailcfg.DERPNode) {
+			defer wg.Done()
+			t = b.testDERPNode(ctx, netMon, t, n)
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Err() == nil {
+				res[i] = t
+			}
+		}(i, res[i], n)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	writeJSON(w, res)
+}
+
+// testDERPNode returns res filled in with the result of testing DERP
+// server n.
+func (b *LocalBackend) testDERPNode(ctx context.Context, netMon *netmon.Monitor, res c2nDERPNodeTest, n *tailcfg.DERPNode) c2nDERPNodeTest {
+	res.Error = ""
+	fail := func(what string, err error) c2nDERPNodeTest {
+		res.Error = fmt.Sprintf("%s: %v", what, err)
+		return res
+	}
+	reg := &tailcfg.DERPRegion{RegionID: n.RegionID, Nodes: []*tailcfg.DERPNode{n}}
+	dc := derphttp.NewRegionClient(key.NewNode(), logger.Discard, netMon, func() *tailcfg.DERPRegion { return reg })
+	defer dc.Close()
+
+	start := b.clock.Now()
+	tc, closer, _, err := dc.DialRegionTLS(ctx, reg)
+	if err != nil {
+		return fail("TLS", err)
+	}
+	res.TLSHandshake = b.clock.Since(start)
+	tc.Close()
+	closer.Close()
+
+	start = b.clock.Now()
+	if err := dc.Connect(ctx); err != nil {
+		return fail("connect", err)
+	}
+	res.Connect = b.clock.Since(start)
+
+	// Pongs are only handled while receiving. The loop ends when dc is
+	// closed.
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := dc.Recv(); err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+	start = b.clock.Now()
+	if err := dc.Ping(ctx); err != nil {
+		select {
+		case rerr := <-recvErr:
+			err = errors.Join(err, rerr)
+		default:
+		}
+		return fail("ping", err)
+	}
+	res.Latency = b.clock.Since(start)
+	res.Reachable = true
+	return res
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/derp"
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
+)
+
+func TestHandleC2NDebugDERPTest(t *testing.T) {
+	setC2NExpensiveInterval(t, "-1s")
+	d := derp.NewServer(key.NewNode(), t.Logf)
+	defer d.Close()
+	srv := httptest.NewUnstartedServer(derphttp.Handler(d))
+	srv.Config.ErrorLog = logger.StdLogger(t.Logf)
+	srv.Config.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	srv.StartTLS()
+	defer srv.Close()
+
+	// A closed port fails right away, and a listener that never answers
+	// the TLS handshake times out.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	hang, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hang.Close()
+	go func() {
+		for {
+			c, err := hang.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	node := func(region int, name string, ln net.Addr) *tailcfg.DERPNode {
+		return &tailcfg.DERPNode{
+			Name:             name,
+			RegionID:         region,
+			HostName:         "test-node.unused",
+			IPv4:             "127.0.0.1",
+			IPv6:             "none",
+			DERPPort:         ln.(*net.TCPAddr).Port,
+			InsecureForTests: true,
+		}
+	}
+	dm := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+		1: {RegionID: 1, Nodes: []*tailcfg.DERPNode{
+			node(1, "1a", srv.Listener.Addr()),
+			{Name: "1stun", RegionID: 1, STUNOnly: true},
+		}},
+		2: {RegionID: 2, Nodes: []*tailcfg.DERPNode{node(2, "2a", closed.Addr())}},
+		3: {RegionID: 3, Nodes: []*tailcfg.DERPNode{node(3, "3a", hang.Addr())}},
+	}}
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+
+	post := func(query string) (int, []c2nDERPNodeTest) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/debug/derp/test?"+query, nil))
+		var res []c2nDERPNodeTest
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, res
+	}
+
+	if code, _ := post("region=1"); code != http.StatusServiceUnavailable {
+		t.Errorf("without a DERP map, status = %d; want 503", code)
+	}
+	b.netMap = &netmap.NetworkMap{DERPMap: dm}
+	for _, q := range []string{"", "region=x", "region=9", "region=1&timeout=0"} {
+		if code, _ := post(q); code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d; want 400", q, code)
+		}
+	}
+
+	_, res := post("region=1")
+	if len(res) != 1 {
+		t.Fatalf("region 1 = %+v; want one non-STUN server", res)
+	}
+	if r := res[0]; !r.Reachable || r.Node != "1a" || r.TLSHandshake <= 0 || r.Connect <= 0 || r.Latency <= 0 || r.Error != "" {
+		t.Errorf("reachable server = %+v", r)
+	}
+
+	_, res = post("region=all&timeout=1")
+	if len(res) != 3 {
+		t.Fatalf("all regions = %+v; want 3 servers", res)
+	}
+	if r := res[0]; r.RegionID != 1 || !r.Reachable {
+		t.Errorf("region 1 = %+v; want reachable", r)
+	}
+	if r := res[1]; r.RegionID != 2 || r.Reachable || r.Error == "" || r.Error == "timed out" {
+		t.Errorf("region 2 = %+v; want a dial error", r)
+	}
+	if r := res[2]; r.RegionID != 3 || r.Reachable || r.Error != "timed out" {
+		t.Errorf("region 3 = %+v; want timed out", r)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"strings"
+	"sync"
+
+	"tailscale.com/envknob"
+)
+
+// disableC2NPaths is a comma-separated list of c2n paths that handleC2N
+// refuses with a 403, such as "/debug/goroutines,/debug/logheap". An entry
+// ending in "*" disables every path with that prefix, so "/debug/*" disables
+// all the debug paths.
+var disableC2NPaths = envknob.RegisterString("TS_DISABLE_C2N_PATHS")
+
+// c2nPathMatcher matches c2n paths against a list parsed from
+// disableC2NPaths.
+type c2nPathMatcher struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+// parseC2NPathMatcher parses a comma-separated list of paths and "*"
+// wildcards, as for TS_DISABLE_C2N_PATHS.
+func parseC2NPathMatcher(s string) c2nPathMatcher {
+	var m c2nPathMatcher
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			m.prefixes = append(m.prefixes, prefix)
+			continue
+		}
+		if p != "" {
+			if m.exact == nil {
+				m.exact = map[string]bool{}
+			}
+			m.exact[p] = true
+		}
+	}
+	return m
+}
+
+// matches reports whether path is in m's list.
+func (m c2nPathMatcher) matches(path string) bool {
+	if m.exact[path] {
+		return true
+	}
+	for _, p := range m.prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// c2nDisabled caches disableC2NPaths, parsed.
+var c2nDisabled struct {
+	sync.Mutex
+	raw string // that m was parsed from
+	m   c2nPathMatcher
+}
+
+// c2nPathDisabled reports whether path is disabled by TS_DISABLE_C2N_PATHS.
+func c2nPathDisabled(path string) bool {
+	raw := disableC2NPaths()
+	if raw == "" {
+		return false
+	}
+	c2nDisabled.Lock()
+	defer c2nDisabled.Unlock()
+	if raw != c2nDisabled.raw {
+		c2nDisabled.raw = raw
+		c2nDisabled.m = parseC2NPathMatcher(raw)
+	}
+	return c2nDisabled.m.matches(path)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstime"
+)
+
+func TestC2NPathMatcher(t *testing.T) {
+	tests := []struct {
+		list string
+		path string
+		want bool
+	}{
+		{"", "/debug/goroutines", false},
+		{"/debug/goroutines", "/debug/goroutines", true},
+		{"/debug/goroutines", "/debug/goroutines/x", false},
+		{"/debug/goroutines", "/debug/logheap", false},
+		{" /debug/goroutines , /debug/logheap ", "/debug/logheap", true},
+		{"/debug/*", "/debug/goroutines", true},
+		{"/debug/*", "/debug/certs/renew", true},
+		{"/debug/*", "/debug", false},
+		{"/debug/*", "/update", false},
+		{"/update,/debug/*", "/update", true},
+		{"*", "/echo", true},
+		{",,", "/echo", false},
+	}
+	for _, tt := range tests {
+		if got := parseC2NPathMatcher(tt.list).matches(tt.path); got != tt.want {
+			t.Errorf("list %q, path %q: got %v; want %v", tt.list, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHandleC2NDisabledPaths(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+	t.Cleanup(func() { envknob.Setenv("TS_DISABLE_C2N_PATHS", "") })
+
+	envknob.Setenv("TS_DISABLE_C2N_PATHS", "/echo")
+	if got := status("/echo"); got != http.StatusForbidden {
+		t.Errorf("/echo disabled: got status %d; want 403", got)
+	}
+	if got := status("/debug/power"); got != http.StatusOK {
+		t.Errorf("/debug/power with /echo disabled: got status %d; want 200", got)
+	}
+
+	// The list is parsed again when it changes.
+	envknob.Setenv("TS_DISABLE_C2N_PATHS", "/debug/*")
+	if got := status("/echo"); got != http.StatusOK {
+		t.Errorf("/echo with /debug/* disabled: got status %d; want 200", got)
+	}
+	if got := status("/debug/power"); got != http.StatusForbidden {
+		t.Errorf("/debug/power with /debug/* disabled: got status %d; want 403", got)
+	}
+
+	envknob.Setenv("TS_DISABLE_C2N_PATHS", "")
+	if got := status("/debug/power"); got != http.StatusOK {
+		t.Errorf("/debug/power with nothing disabled: got status %d; want 200", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// c2nEchoStreamMaxBytes is the most bytes that c2n /echo/stream sends or
+// reads in one request. c2n requests and responses are held in memory in
+// full by controlclient, so it's kept small.
+const c2nEchoStreamMaxBytes = 4 << 20
+
+// c2nEchoStreamPattern is what c2n GET /echo/stream repeats: the byte at
+// offset n of its response is n%251, which a client can check. It's a
+// multiple of 251 bytes long, so that the pattern continues from one copy
+// to the next.
+var c2nEchoStreamPattern = func() []byte {
+	b := make([]byte, 251*128)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}()
+
+// c2nEchoStreamResult is the response to a c2n POST /echo/stream.
+type c2nEchoStreamResult struct {
+	// Bytes is how many bytes of request body were read.
+	Bytes int64 `json:"bytes"`
+
+	// DurationMs is how long, in milliseconds, reading them took from when
+	// the request started to be handled. As controlclient receives the
+	// whole c2n request before handling it, that's how long copying it
+	// from memory took, not how long uploading it did.
+	DurationMs float64 `json:"durationMs"`
+}
+
+// handleC2NEchoStream is a test handler for sending and receiving c2n
+// requests of a given size, for measuring their throughput. A GET writes
+// back as many bytes as the "bytes" param says, each byte being its offset
+// mod 251. A POST reads and discards the request body, which like any c2n
+// request body must arrive within c2nBodyTimeout, and reports how many bytes
+// it was. Either stops early if the request's context is done.
+//
+// As c2n requests and responses are buffered by controlclient, the
+// throughput can only be measured by control: by how long the request took
+// from being sent to being answered, less how long the node spent sending
+// the reply, as reported in lastReplyMs by the next c2n /echo/info.
+func (b *LocalBackend) handleC2NEchoStream(w http.ResponseWriter, r *http.Request) {
+	start := b.clock.Now()
+	ctx := r.Context()
+
+	if r.Method == "POST" {
+		var res c2nEchoStreamResult
+		buf := make([]byte, 32<<10)
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			n, err := r.Body.Read(buf)
+			res.Bytes += int64(n)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeC2NBodyError(w, err)
+				return
+			}
+		}
+		res.DurationMs = float64(b.clock.Since(start)) / float64(time.Millisecond)
+		writeJSON(w, res)
+		return
+	}
+
+	n, err := strconv.ParseInt(r.FormValue("bytes"), 10, 64)
+	if err != nil || n < 0 {
+		http.Error(w, "invalid 'bytes' parameter", http.StatusBadRequest)
+		return
+	}
+	if n > c2nEchoStreamMaxBytes {
+		http.Error(w, "'bytes' exceeds "+strconv.Itoa(c2nEchoStreamMaxBytes), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	for n > 0 {
+		if ctx.Err() != nil {
+			return
+		}
+		chunk := c2nEchoStreamPattern[:min(n, int64(len(c2nEchoStreamPattern)))]
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+		n -= int64(len(chunk))
+	}
+}
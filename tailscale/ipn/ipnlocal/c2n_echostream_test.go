@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tailscale.com/tstime"
+)
+
+// zeroReader is an io.Reader of endless zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestHandleC2NEchoStream(t *testing.T) {
+	setC2NExpensiveInterval(t, "-1s")
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, req)
+		return rec
+	}
+
+	n := 3*len(c2nEchoStreamPattern) + 7
+	rec := do(httptest.NewRequest("GET", "/echo/stream?bytes="+strconv.Itoa(n), nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != n || rec.Header().Get("Content-Length") != strconv.Itoa(n) {
+		t.Fatalf("GET = %d, %d bytes, Content-Length %q; want 200, %d bytes", rec.Code, rec.Body.Len(), rec.Header().Get("Content-Length"), n)
+	}
+	for i, c := range rec.Body.Bytes() {
+		if c != byte(i%251) {
+			t.Fatalf("byte %d = %d; want %d", i, c, i%251)
+		}
+	}
+
+	for _, q := range []string{"", "bytes=-1", "bytes=x", "bytes=" + strconv.Itoa(c2nEchoStreamMaxBytes+1)} {
+		if rec := do(httptest.NewRequest("GET", "/echo/stream?"+q, nil)); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET ?%s = %d; want 400", q, rec.Code)
+		}
+	}
+
+	// A request whose context is already done gets nothing.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if rec := do(httptest.NewRequest("GET", "/echo/stream?bytes=1000", nil).WithContext(ctx)); rec.Body.Len() != 0 {
+		t.Errorf("GET with done context wrote %d bytes", rec.Body.Len())
+	}
+
+	rec = do(httptest.NewRequest("POST", "/echo/stream", io.LimitReader(zeroReader{}, 3<<20)))
+	var res c2nEchoStreamResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("POST = %d: %v: %s", rec.Code, err, rec.Body.Bytes())
+	}
+	if res.Bytes != 3<<20 || res.DurationMs < 0 {
+		t.Errorf("POST = %+v; want %d bytes", res, 3<<20)
+	}
+
+	rec = do(httptest.NewRequest("POST", "/echo/stream", io.LimitReader(zeroReader{}, c2nEchoStreamMaxBytes+1)))
+	if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "too large") {
+		t.Errorf("POST over the limit = %d: %s; want 413", rec.Code, rec.Body.Bytes())
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+)
+
+// c2nExitNodeMaxTTL is the longest that /prefs/exitnode may be asked to
+// keep an exit node before reverting it.
+const c2nExitNodeMaxTTL = 7 * 24 * time.Hour
+
+// c2nExitNodeOverride is an exit node set by c2n /prefs/exitnode.
+//
+// The revert is in memory only: if tailscaled restarts before it's due, the
+// exit node stays selected in the saved prefs and is never reverted.
+type c2nExitNodeOverride struct {
+	id   tailcfg.StableNodeID // the exit node that was set
+	prev tailcfg.StableNodeID // what to revert to; zero for none
+
+	until time.Time              // when to revert; zero for never
+	timer tstime.TimerController // or nil if until is zero
+}
+
+// c2nExitNodeResponse is the result of c2n /prefs/exitnode.
+type c2nExitNodeResponse struct {
+	// ExitNodeID is the exit node in use, if any.
+	ExitNodeID tailcfg.StableNodeID `json:",omitempty"`
+
+	// SetViaC2N is whether ExitNodeID was set by /prefs/exitnode, and
+	// hasn't been changed by anything else since.
+	SetViaC2N bool
+
+	// RevertAt is when ExitNodeID will be reverted to RevertTo (or to no
+	// exit node, if that's empty), if it was set via c2n with a TTL. The
+	// revert is lost if tailscaled restarts before then.
+	RevertAt time.Time            `json:",omitempty"`
+	RevertTo tailcfg.StableNodeID `json:",omitempty"`
+}
+
+// handleC2NPrefsExitNode reports the node's exit node and, on POST, sets it
+// to the "peer" param (a node key, stable node ID, or Tailscale IP of a peer
+// in the netmap that offers to be an exit node) via EditPrefs, like the CLI.
+// An empty peer clears the exit node. If "secs" is positive, the previous
+// exit node is restored after that many seconds, unless the exit node has
+// been changed by something else in the meantime.
+func (b *LocalBackend) handleC2NPrefsExitNode(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		var ttl time.Duration
+		if v := r.FormValue("secs"); v != "" {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs < 0 {
+				http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
+				return
+			}
+			ttl = time.Duration(secs) * time.Second
+			if ttl > c2nExitNodeMaxTTL {
+				http.Error(w, "'secs' is longer than "+c2nExitNodeMaxTTL.String(), http.StatusBadRequest)
+				return
+			}
+		}
+		var id tailcfg.StableNodeID
+		if r.FormValue("peer") != "" {
+			peer, ok := b.c2nPeer(w, r)
+			if !ok {
+				return
+			}
+			if !tsaddr.ContainsExitRoutes(peer.AllowedIPs()) {
+				http.Error(w, "peer is not offering to be an exit node", http.StatusBadRequest)
+				return
+			}
+			id = peer.StableID()
+		}
+		if err := b.setC2NExitNode(id, ttl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	p := b.Prefs()
+	b.mu.Lock()
+	var res c2nExitNodeResponse
+	if p.Valid() {
+		res.ExitNodeID = p.ExitNodeID()
+	}
+	if o := b.c2nExitNode; o != nil && o.id == res.ExitNodeID {
+		res.SetViaC2N = true
+		res.RevertAt = o.until
+		if !o.until.IsZero() {
+			res.RevertTo = o.prev
+		}
+	}
+	b.mu.Unlock()
+	writeJSON(w, res)
+}
+
+// setC2NExitNode sets the exit node to id (or none, if zero) and records it
+// as b.c2nExitNode. If ttl is positive, the exit node from before is
+// restored after it.
+func (b *LocalBackend) setC2NExitNode(id tailcfg.StableNodeID, ttl time.Duration) error {
+	b.mu.Lock()
+	prev := b.pm.CurrentPrefs().ExitNodeID()
+	if o := b.c2nExitNode; o != nil {
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+		if o.id == prev {
+			// Revert to what was there before c2n got involved,
+			// not to the previous c2n exit node.
+			prev = o.prev
+		}
+		b.c2nExitNode = nil
+	}
+	b.mu.Unlock()
+
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{ExitNodeID: id},
+		ExitNodeIDSet: true,
+		ExitNodeIPSet: true,
+	}); err != nil {
+		return err
+	}
+
+	o := &c2nExitNodeOverride{id: id, prev: prev}
+	if ttl > 0 {
+		o.until = b.clock.Now().Add(ttl)
+		o.timer = b.clock.AfterFunc(ttl, func() { b.revertC2NExitNode(o) })
+	}
+	b.mu.Lock()
+	b.c2nExitNode = o
+	b.mu.Unlock()
+	if ttl > 0 {
+		b.logf("c2n: set exit node to %q, reverting to %q in %v", id, prev, ttl)
+	} else {
+		b.logf("c2n: set exit node to %q", id)
+	}
+	return nil
+}
+
+// revertC2NExitNode restores the exit node from before o was set, if o is
+// still the current c2n exit node and hasn't been changed since.
+func (b *LocalBackend) revertC2NExitNode(o *c2nExitNodeOverride) {
+	b.mu.Lock()
+	if b.c2nExitNode != o {
+		b.mu.Unlock()
+		return
+	}
+	b.c2nExitNode = nil
+	cur := b.pm.CurrentPrefs().ExitNodeID()
+	b.mu.Unlock()
+
+	if cur != o.id {
+		b.logf("c2n: exit node changed to %q since it was set to %q; not reverting", cur, o.id)
+		return
+	}
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{ExitNodeID: o.prev},
+		ExitNodeIDSet: true,
+		ExitNodeIPSet: true,
+	}); err != nil {
+		b.logf("c2n: reverting exit node to %q: %v", o.prev, err)
+		return
+	}
+	b.logf("c2n: reverted exit node to %q", o.prev)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsd"
+	"tailscale.com/tstest"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/logid"
+	"tailscale.com/types/netmap"
+	"tailscale.com/wgengine"
+)
+
+func TestHandleC2NPrefsExitNode(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b.clock = clock
+
+	pfx := netip.MustParsePrefix
+	exitKey := key.NewNode().Public()
+	b.netMap = &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{
+			Addresses: []netip.Prefix{pfx("100.64.0.1/32")},
+		}).View(),
+		Peers: []tailcfg.NodeView{
+			(&tailcfg.Node{
+				ID:         1,
+				StableID:   "exit",
+				Key:        exitKey,
+				Addresses:  []netip.Prefix{pfx("100.64.0.2/32")},
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32"), pfx("0.0.0.0/0"), pfx("::/0")},
+			}).View(),
+			(&tailcfg.Node{
+				ID:         2,
+				StableID:   "other-exit",
+				Key:        key.NewNode().Public(),
+				Addresses:  []netip.Prefix{pfx("100.64.0.3/32")},
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32"), pfx("0.0.0.0/0"), pfx("::/0")},
+			}).View(),
+			(&tailcfg.Node{
+				ID:         3,
+				StableID:   "not-exit",
+				Key:        key.NewNode().Public(),
+				Addresses:  []netip.Prefix{pfx("100.64.0.4/32")},
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.4/32")},
+			}).View(),
+		},
+	}
+
+	do := func(method, query string, wantCode int) (res c2nExitNodeResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/prefs/exitnode?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+
+	if res := do("GET", "", http.StatusOK); res.ExitNodeID != "" || res.SetViaC2N {
+		t.Fatalf("initially: got %+v; want no exit node", res)
+	}
+	do("POST", "peer=missing", http.StatusNotFound)
+	do("POST", "peer=not-exit", http.StatusBadRequest)
+	do("POST", "peer=exit&secs=-1", http.StatusBadRequest)
+	if got := b.Prefs().ExitNodeID(); got != "" {
+		t.Fatalf("after bad requests: ExitNodeID = %q; want none", got)
+	}
+
+	// Without a TTL, the exit node stays.
+	res := do("POST", "peer="+exitKey.String(), http.StatusOK)
+	if res.ExitNodeID != "exit" || !res.SetViaC2N || !res.RevertAt.IsZero() {
+		t.Fatalf("set by node key: got %+v", res)
+	}
+	if got := b.Prefs().ExitNodeID(); got != "exit" {
+		t.Fatalf("ExitNodeID = %q; want exit", got)
+	}
+
+	// With one, it reverts to the exit node from before c2n set any,
+	// even after several changes.
+	do("POST", "", http.StatusOK) // clears it
+	do("POST", "peer=exit&secs=60", http.StatusOK)
+	res = do("POST", "peer=other-exit&secs=60", http.StatusOK)
+	if want := clock.Now().Add(time.Minute); res.ExitNodeID != "other-exit" || !res.SetViaC2N || !res.RevertAt.Equal(want) {
+		t.Fatalf("set with TTL: got %+v; want other-exit until %v", res, want)
+	}
+	clock.Advance(time.Minute)
+	waitExitNode(t, b, "")
+	if res := do("GET", "", http.StatusOK); res.SetViaC2N {
+		t.Errorf("after revert: got %+v; want not SetViaC2N", res)
+	}
+
+	// It's not reverted if something else changed it in the meantime.
+	do("POST", "peer=exit&secs=60", http.StatusOK)
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{ExitNodeID: "other-exit"},
+		ExitNodeIDSet: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res := do("GET", "", http.StatusOK); res.ExitNodeID != "other-exit" || res.SetViaC2N {
+		t.Errorf("after local change: got %+v; want other-exit, not SetViaC2N", res)
+	}
+	clock.Advance(time.Minute)
+	waitC2NExitNodeCleared(t, b)
+	if got := b.Prefs().ExitNodeID(); got != "other-exit" {
+		t.Errorf("after TTL following local change: ExitNodeID = %q; want other-exit", got)
+	}
+}
+
+// waitExitNode waits for b's exit node to become want, for timers that run
+// their funcs asynchronously.
+func waitExitNode(t *testing.T, b *LocalBackend, want tailcfg.StableNodeID) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if b.Prefs().ExitNodeID() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("ExitNodeID = %q; want %q", b.Prefs().ExitNodeID(), want)
+}
+
+// waitC2NExitNodeCleared waits for b to forget its c2n exit node.
+func waitC2NExitNodeCleared(t *testing.T, b *LocalBackend) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		b.mu.Lock()
+		o := b.c2nExitNode
+		b.mu.Unlock()
+		if o == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("c2n exit node wasn't cleared")
+}
+
+// newC2NPrefsTestBackend returns a LocalBackend whose prefs can be edited
+// via c2n, with remote mutations allowed.
+func newC2NPrefsTestBackend(t *testing.T) *LocalBackend {
+	t.Helper()
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+
+	sys := new(tsd.System)
+	sys.Set(new(mem.Store))
+	eng, err := wgengine.NewFakeUserspaceEngine(logger.Discard, sys.Set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(eng.Close)
+	sys.Set(eng)
+	b, err := NewLocalBackend(t.Logf, logid.PublicID{}, sys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.hostinfo = new(tailcfg.Hostinfo) // as set by Start
+	return b
+}
@@ -0,0 +1,99 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"tailscale.com/types/ipproto"
+)
+
+// handleC2NDebugFilterCheck runs the "src", "dst", "proto" (default tcp) and
+// "dport" params through the node's packet filter, as if they were the first
+// packet of a new inbound connection, and reports the verdict and the rule
+// responsible.
+func (b *LocalBackend) handleC2NDebugFilterCheck(w http.ResponseWriter, r *http.Request) {
+	src, err := netip.ParseAddr(r.FormValue("src"))
+	if err != nil {
+		http.Error(w, "bad 'src' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	dst, err := netip.ParseAddr(r.FormValue("dst"))
+	if err != nil {
+		http.Error(w, "bad 'dst' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	proto, err := parseFilterCheckProto(r.FormValue("proto"), dst.Is6())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var dport uint16
+	if v := r.FormValue("dport"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			http.Error(w, "bad 'dport' parameter", http.StatusBadRequest)
+			return
+		}
+		dport = uint16(n)
+	}
+	filt := b.filterAtomic.Load()
+	if filt == nil {
+		http.Error(w, "no packet filter", http.StatusServiceUnavailable)
+		return
+	}
+
+	verdict, why, rule := filt.Check(src, dst, proto, dport)
+	res := struct {
+		Verdict string // "Accept" or "Drop"
+		Reason  string // as the filter would log it
+		Rule    string // the first rule accepting the packet
+	}{
+		Verdict: verdict.String(),
+		Reason:  why,
+	}
+	switch {
+	case rule != nil:
+		res.Rule = rule.String()
+	case verdict.IsDrop() && why == "no rules matched":
+		res.Rule = "no match; default drop"
+	}
+	writeJSON(w, res)
+}
+
+// parseFilterCheckProto parses the protocol given to /debug/filter-check: a
+// name as used in ACLs, or an IP protocol number. An empty s means TCP. isV6
+// reports whether the packet is IPv6, which determines what "icmp" means.
+func parseFilterCheckProto(s string, isV6 bool) (ipproto.Proto, error) {
+	switch strings.ToLower(s) {
+	case "", "tcp":
+		return ipproto.TCP, nil
+	case "udp":
+		return ipproto.UDP, nil
+	case "sctp":
+		return ipproto.SCTP, nil
+	case "icmp":
+		if isV6 {
+			return ipproto.ICMPv6, nil
+		}
+		return ipproto.ICMPv4, nil
+	case "ipv6-icmp", "icmpv6":
+		return ipproto.ICMPv6, nil
+	case "igmp":
+		return ipproto.IGMP, nil
+	case "gre":
+		return ipproto.GRE, nil
+	case "dccp":
+		return ipproto.DCCP, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown protocol %q", s)
+	}
+	return ipproto.Proto(n), nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+
+	"tailscale.com/types/ipproto"
+)
+
+func TestParseFilterCheckProto(t *testing.T) {
+	tests := []struct {
+		in   string
+		isV6 bool
+		want ipproto.Proto
+	}{
+		{"", false, ipproto.TCP},
+		{"TCP", false, ipproto.TCP},
+		{"udp", true, ipproto.UDP},
+		{"icmp", false, ipproto.ICMPv4},
+		{"icmp", true, ipproto.ICMPv6},
+		{"ipv6-icmp", false, ipproto.ICMPv6},
+		{"132", false, ipproto.SCTP},
+	}
+	for _, tt := range tests {
+		got, err := parseFilterCheckProto(tt.in, tt.isV6)
+		if err != nil || got != tt.want {
+			t.Errorf("parseFilterCheckProto(%q, %v) = %v, %v; want %v", tt.in, tt.isV6, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"tcpp", "256", "-1"} {
+		if got, err := parseFilterCheckProto(bad, false); err == nil {
+			t.Errorf("parseFilterCheckProto(%q) = %v; want error", bad, got)
+		}
+	}
+}
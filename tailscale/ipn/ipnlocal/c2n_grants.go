@@ -0,0 +1,143 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ipproto"
+	"tailscale.com/wgengine/filter"
+)
+
+// c2nGrant is a packet filter match expressed in the shape of an ACL grant,
+// as returned by /debug/grants.
+type c2nGrant struct {
+	// AppliesAs is how the grant involves this node: "src", "dst", or
+	// both.
+	AppliesAs []string
+
+	Src []netip.Prefix
+	Dst []netip.Prefix
+
+	// IP is the network access granted, as "proto:ports" (e.g.
+	// "tcp:443"), where proto "*" means TCP, UDP and ICMP, and ports "*"
+	// means all ports. It's empty for app-only grants.
+	IP []string `json:",omitempty"`
+
+	// App is the application capabilities granted, with their values.
+	App map[tailcfg.PeerCapability][]json.RawMessage `json:",omitempty"`
+
+	// SrcNodes and DstNodes are the names of the nodes in the netmap
+	// (including this one) whose addresses are in Src and Dst.
+	SrcNodes []string `json:",omitempty"`
+	DstNodes []string `json:",omitempty"`
+}
+
+func (b *LocalBackend) handleC2NDebugGrants(w http.ResponseWriter, r *http.Request) {
+	nm := b.NetMap()
+	if nm == nil || !nm.SelfNode.Valid() {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	nodes := append([]tailcfg.NodeView{nm.SelfNode}, nm.Peers...)
+	writeJSON(w, struct {
+		Grants []c2nGrant
+	}{grantsForNode(nm.PacketFilter, nm.SelfNode, nodes)})
+}
+
+// grantsForNode returns the grants in matches that involve self as a source
+// or destination. nodes are the nodes whose names are reported as matching
+// each grant's sources and destinations.
+func grantsForNode(matches []filter.Match, self tailcfg.NodeView, nodes []tailcfg.NodeView) []c2nGrant {
+	selfAddrs := self.Addresses()
+	involves := func(pfxs []netip.Prefix) bool {
+		for i := 0; i < selfAddrs.Len(); i++ {
+			if prefixesContain(pfxs, selfAddrs.At(i).Addr()) {
+				return true
+			}
+		}
+		return false
+	}
+	nodesIn := func(pfxs []netip.Prefix) []string {
+		var ret []string
+		for _, n := range nodes {
+			addrs := n.Addresses()
+			for i := 0; i < addrs.Len(); i++ {
+				if prefixesContain(pfxs, addrs.At(i).Addr()) {
+					ret = append(ret, strings.TrimSuffix(n.Name(), "."))
+					break
+				}
+			}
+		}
+		return ret
+	}
+
+	ret := []c2nGrant{} // non-nil, so none encodes as []
+	for _, m := range matches {
+		g := c2nGrant{Src: m.Srcs}
+		protos := "*"
+		if !isDefaultProtos(m.IPProto) {
+			var ps []string
+			for _, p := range m.IPProto {
+				ps = append(ps, strings.ToLower(p.String()))
+			}
+			protos = strings.Join(ps, ",")
+		}
+		for _, d := range m.Dsts {
+			if !slices.Contains(g.Dst, d.Net) {
+				g.Dst = append(g.Dst, d.Net)
+			}
+			ip := protos + ":" + d.Ports.String()
+			if !slices.Contains(g.IP, ip) {
+				g.IP = append(g.IP, ip)
+			}
+		}
+		for _, c := range m.Caps {
+			if !slices.Contains(g.Dst, c.Dst) {
+				g.Dst = append(g.Dst, c.Dst)
+			}
+			if g.App == nil {
+				g.App = make(map[tailcfg.PeerCapability][]json.RawMessage)
+			}
+			g.App[c.Cap] = append(g.App[c.Cap], c.Values...)
+		}
+		if involves(g.Src) {
+			g.AppliesAs = append(g.AppliesAs, "src")
+		}
+		if involves(g.Dst) {
+			g.AppliesAs = append(g.AppliesAs, "dst")
+		}
+		if len(g.AppliesAs) == 0 {
+			continue
+		}
+		g.SrcNodes = nodesIn(g.Src)
+		g.DstNodes = nodesIn(g.Dst)
+		ret = append(ret, g)
+	}
+	return ret
+}
+
+// isDefaultProtos reports whether protos is the set of protocols that a
+// filter rule gets when it doesn't specify any.
+func isDefaultProtos(protos []ipproto.Proto) bool {
+	return len(protos) == 4 &&
+		slices.Contains(protos, ipproto.TCP) &&
+		slices.Contains(protos, ipproto.UDP) &&
+		slices.Contains(protos, ipproto.ICMPv4) &&
+		slices.Contains(protos, ipproto.ICMPv6)
+}
+
+func prefixesContain(pfxs []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range pfxs {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ipproto"
+	"tailscale.com/wgengine/filter"
+)
+
+func TestGrantsForNode(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	self := (&tailcfg.Node{
+		Name:      "self.ts.net.",
+		Addresses: []netip.Prefix{pfx("100.64.0.1/32")},
+	}).View()
+	peer := (&tailcfg.Node{
+		Name:      "peer.ts.net.",
+		Addresses: []netip.Prefix{pfx("100.64.0.2/32")},
+	}).View()
+	nodes := []tailcfg.NodeView{self, peer}
+
+	matches, err := filter.MatchesFromFilterRules([]tailcfg.FilterRule{
+		{
+			// peer -> self, tcp:22 and tcp:443.
+			SrcIPs: []string{"100.64.0.2"},
+			DstPorts: []tailcfg.NetPortRange{
+				{IP: "100.64.0.1", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+				{IP: "100.64.0.1", Ports: tailcfg.PortRange{First: 443, Last: 443}},
+			},
+			IPProto: []int{int(ipproto.TCP)},
+		},
+		{
+			// Unrelated to self.
+			SrcIPs:   []string{"100.64.0.2"},
+			DstPorts: []tailcfg.NetPortRange{{IP: "100.64.0.3", Ports: tailcfg.PortRangeAny}},
+		},
+		{
+			// self -> peer, app capability.
+			SrcIPs: []string{"100.64.0.1"},
+			CapGrant: []tailcfg.CapGrant{{
+				Dsts: []netip.Prefix{pfx("100.64.0.2/32")},
+				CapMap: tailcfg.PeerCapMap{
+					"example.com/cap/foo": {json.RawMessage(`{"x":1}`)},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := grantsForNode(matches, self, nodes)
+	want := []c2nGrant{
+		{
+			AppliesAs: []string{"dst"},
+			Src:       []netip.Prefix{pfx("100.64.0.2/32")},
+			Dst:       []netip.Prefix{pfx("100.64.0.1/32")},
+			IP:        []string{"tcp:22", "tcp:443"},
+			SrcNodes:  []string{"peer.ts.net"},
+			DstNodes:  []string{"self.ts.net"},
+		},
+		{
+			AppliesAs: []string{"src"},
+			Src:       []netip.Prefix{pfx("100.64.0.1/32")},
+			Dst:       []netip.Prefix{pfx("100.64.0.2/32")},
+			App: map[tailcfg.PeerCapability][]json.RawMessage{
+				"example.com/cap/foo": {json.RawMessage(`{"x":1}`)},
+			},
+			SrcNodes: []string{"self.ts.net"},
+			DstNodes: []string{"peer.ts.net"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gj, _ := json.MarshalIndent(got, "", "\t")
+		wj, _ := json.MarshalIndent(want, "", "\t")
+		t.Errorf("got:\n%s\nwant:\n%s", gj, wj)
+	}
+}
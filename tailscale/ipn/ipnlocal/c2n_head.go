@@ -0,0 +1,50 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import "net/http"
+
+// c2nHeadWriter is the http.ResponseWriter that a c2n GET handler writes to
+// when handling a HEAD request. It passes on the headers and status code,
+// but discards the body.
+type c2nHeadWriter struct {
+	http.ResponseWriter
+	done        func() // called when the header is written, to stop the handler
+	wroteHeader bool
+}
+
+func (w *c2nHeadWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+	// There's nothing more to send, so streaming handlers may as well
+	// stop now.
+	w.done()
+}
+
+func (w *c2nHeadWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// As net/http would for a GET, sniff the Content-Type if the
+		// handler didn't set one, so that it's the same for both.
+		if h := w.Header(); h.Get("Content-Type") == "" && len(p) > 0 {
+			h.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return len(p), nil
+}
+
+// Flush implements http.Flusher, for handlers that stream their response.
+func (w *c2nHeadWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *c2nHeadWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
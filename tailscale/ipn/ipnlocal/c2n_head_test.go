@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/tstime"
+)
+
+func TestHandleC2NHead(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+
+	tests := []struct {
+		path     string
+		body     string
+		wantCode int
+		wantType string // prefix of the Content-Type
+	}{
+		{"/update/history", "", http.StatusOK, "application/json"},
+		{"/echo", "<html>hi</html>", http.StatusOK, "text/html"}, // sniffed
+		{"/refresh", "", http.StatusMethodNotAllowed, "text/plain"},
+		{"/nope", "", http.StatusBadRequest, "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			b.handleC2N(rec, httptest.NewRequest("HEAD", tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantType) {
+				t.Errorf("Content-Type = %q; want %q", got, tt.wantType)
+			}
+			if tt.wantCode == http.StatusOK && rec.Body.Len() != 0 {
+				t.Errorf("got body %q; want none", rec.Body.Bytes())
+			}
+		})
+	}
+}
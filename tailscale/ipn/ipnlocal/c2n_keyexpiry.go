@@ -0,0 +1,136 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tailscale.com/control/controlclient"
+)
+
+// c2nKeyExpiryDefaultTimeout is how long a POST to /keyexpiry waits for
+// control to extend the node key's expiry, unless it's given a "timeout".
+// The longest it may be asked to wait is c2nRefreshMaxTimeout.
+const c2nKeyExpiryDefaultTimeout = 30 * time.Second
+
+// c2nKeyExpiryResponse is the result of c2n /keyexpiry.
+type c2nKeyExpiryResponse struct {
+	// KeyExpiry is when the node key expires, after which the node is
+	// logged out. It's zero if it doesn't expire.
+	KeyExpiry time.Time `json:",omitempty"`
+
+	// ExpiresInSecs is how long until KeyExpiry, which is negative if it's
+	// passed. It's omitted if the key doesn't expire.
+	ExpiresInSecs *float64 `json:",omitempty"`
+
+	// Refreshed is whether a POST got control to extend KeyExpiry.
+	Refreshed bool `json:",omitempty"`
+
+	// Err is why a POST didn't extend KeyExpiry, if it didn't.
+	Err string `json:",omitempty"`
+}
+
+// handleC2NKeyExpiry reports when the node key expires. A POST asks control
+// to extend it by rotating the node key, registering a new one with the auth
+// key that tailscaled was given, and waits up to "timeout" seconds (default
+// 30) for the new key's expiry. Control ties expiry to the node key, so
+// re-registering the same key wouldn't move it. As the rotation must happen
+// unattended, it fails straight away if the control client has no auth key,
+// or if control asks for an interactive login instead, as it does if the
+// auth key was single-use.
+func (b *LocalBackend) handleC2NKeyExpiry(w http.ResponseWriter, r *http.Request) {
+	var res c2nKeyExpiryResponse
+	if r.Method == "POST" {
+		timeout := c2nKeyExpiryDefaultTimeout
+		if v := r.FormValue("timeout"); v != "" {
+			secs, err := strconv.ParseFloat(v, 64)
+			if err != nil || secs <= 0 {
+				http.Error(w, "invalid 'timeout' parameter", http.StatusBadRequest)
+				return
+			}
+			timeout = min(time.Duration(secs*float64(time.Second)), c2nRefreshMaxTimeout)
+		}
+		b.mu.Lock()
+		cc := b.cc
+		b.mu.Unlock()
+		if cc == nil {
+			http.Error(w, "no control client", http.StatusServiceUnavailable)
+			return
+		}
+		res.Refreshed, res.Err = b.refreshC2NKeyExpiry(r.Context(), timeout)
+	}
+
+	b.mu.Lock()
+	nm := b.netMap
+	b.mu.Unlock()
+	if nm == nil || !nm.SelfNode.Valid() {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	if exp := nm.SelfNode.KeyExpiry(); !exp.IsZero() {
+		res.KeyExpiry = exp
+		secs := exp.Sub(b.clock.Now()).Seconds()
+		res.ExpiresInSecs = &secs
+	}
+	writeJSON(w, res)
+}
+
+// c2nAuthKeyHolder is implemented by control clients that can report whether
+// they have an auth key, as *controlclient.Auto does.
+type c2nAuthKeyHolder interface {
+	HasAuthKey() bool
+}
+
+// refreshC2NKeyExpiry rotates the node key non-interactively and waits up to
+// timeout for the new key's expiry. It returns whether the expiry was
+// extended, or why not.
+func (b *LocalBackend) refreshC2NKeyExpiry(ctx context.Context, timeout time.Duration) (refreshed bool, errMsg string) {
+	b.mu.Lock()
+	cc := b.cc
+	nm := b.netMap
+	flags := b.loginFlags
+	b.mu.Unlock()
+	// The auth key must be one the control client has now: tailscaled
+	// doesn't keep it across restarts. Whether control still accepts it
+	// (it's reusable, and hasn't expired or been revoked) is only known to
+	// control, which asks for an interactive login if not.
+	if h, ok := cc.(c2nAuthKeyHolder); !ok || !h.HasAuthKey() {
+		return false, "control client has no auth key to rotate the node key with unattended (none was given since tailscaled started); an interactive login is needed"
+	}
+	if nm == nil || !nm.SelfNode.Valid() {
+		return false, "no netmap"
+	}
+	before := nm.SelfNode.KeyExpiry()
+	if before.IsZero() {
+		return false, "node key doesn't expire"
+	}
+	oldKey := nm.SelfNode.Key()
+
+	b.logf("c2n: rotating node key %v to extend its expiry %v", oldKey.ShortString(), before.UTC().Format(time.RFC3339))
+	cc.Login(nil, flags|controlclient.LoginRotateNodeKey)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	t, tc := b.clock.NewTicker(c2nRefreshPollInterval)
+	defer t.Stop()
+	for {
+		b.mu.Lock()
+		nm, authURL := b.netMap, b.authURL
+		b.mu.Unlock()
+		if nm != nil && nm.SelfNode.Valid() && nm.SelfNode.Key() != oldKey && nm.SelfNode.KeyExpiry().After(before) {
+			return true, ""
+		}
+		if authURL != "" {
+			return false, "control asked for an interactive login; the auth key may be single-use, expired or revoked"
+		}
+		select {
+		case <-tc:
+		case <-ctx.Done():
+			return false, "timed out waiting for a new node key expiry"
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/envknob"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+)
+
+// fakeKeyControl is a controlclient.Client that acts like control as far as
+// key expiry goes: each node key it registers gets its own expiry, so logging
+// in again with the same key doesn't change it, and only rotating the key
+// does.
+type fakeKeyControl struct {
+	controlclient.Client
+	b *LocalBackend
+
+	authKey     bool // whether it has an auth key
+	interactive bool // whether control wants a user to log in
+	stall       bool // whether control never answers
+
+	mu      sync.Mutex
+	nodeKey key.NodePublic
+	expiry  map[key.NodePublic]time.Time
+	logins  []controlclient.LoginFlags
+}
+
+const fakeKeyTTL = 180 * 24 * time.Hour
+
+func (c *fakeKeyControl) HasAuthKey() bool { return c.authKey }
+
+// register registers k, as when the node first logs in, and sends the
+// backend a netmap with its expiry.
+func (c *fakeKeyControl) register(k key.NodePublic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expiry == nil {
+		c.expiry = map[key.NodePublic]time.Time{}
+	}
+	if _, ok := c.expiry[k]; !ok {
+		c.expiry[k] = time.Now().Add(fakeKeyTTL)
+	}
+	c.nodeKey = k
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	c.b.netMap = &netmap.NetworkMap{SelfNode: (&tailcfg.Node{Key: k, KeyExpiry: c.expiry[k]}).View()}
+}
+
+func (c *fakeKeyControl) Login(_ *tailcfg.Oauth2Token, flags controlclient.LoginFlags) {
+	c.mu.Lock()
+	c.logins = append(c.logins, flags)
+	k := c.nodeKey
+	c.mu.Unlock()
+	switch {
+	case c.stall:
+	case c.interactive:
+		c.b.mu.Lock()
+		c.b.authURL = "https://login.example.com/a/123"
+		c.b.mu.Unlock()
+	default:
+		if flags&controlclient.LoginRotateNodeKey != 0 {
+			k = key.NewNode().Public()
+		}
+		go c.register(k)
+	}
+}
+
+func TestHandleC2NKeyExpiry(t *testing.T) {
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	do := func(method, query string, wantCode int) (res c2nKeyExpiryResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/keyexpiry?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+
+	do("GET", "", http.StatusServiceUnavailable)
+	cc := &fakeKeyControl{b: b}
+	firstKey := key.NewNode().Public()
+	cc.register(firstKey)
+	expiry := cc.expiry[firstKey]
+	res := do("GET", "", http.StatusOK)
+	if !res.KeyExpiry.Equal(expiry) || res.ExpiresInSecs == nil || *res.ExpiresInSecs <= fakeKeyTTL.Seconds()-100 || *res.ExpiresInSecs > fakeKeyTTL.Seconds() {
+		t.Errorf("GET = %+v; want expiry %v", res, expiry)
+	}
+
+	do("POST", "", http.StatusServiceUnavailable) // no control client
+	b.cc = cc
+	do("POST", "timeout=x", http.StatusBadRequest)
+
+	// Without an auth key, it fails straight away rather than waiting
+	// for a login that nobody's there to do.
+	res = do("POST", "", http.StatusOK)
+	if res.Refreshed || !strings.Contains(res.Err, "interactive login is needed") || len(cc.logins) != 0 {
+		t.Errorf("without auth key: %+v, %d logins", res, len(cc.logins))
+	}
+
+	// The expiry only moves because the key is rotated: logging in again
+	// with the same key would leave it where it is.
+	cc.authKey = true
+	b.loginFlags = controlclient.LoginEphemeral
+	res = do("POST", "", http.StatusOK)
+	cc.mu.Lock()
+	newKey := cc.nodeKey
+	cc.mu.Unlock()
+	if !res.Refreshed || res.Err != "" || newKey == firstKey || !res.KeyExpiry.Equal(cc.expiry[newKey]) || !res.KeyExpiry.After(expiry) {
+		t.Errorf("refresh: got %+v; want a rotated key with a later expiry than %v", res, expiry)
+	}
+	if len(cc.logins) != 1 || cc.logins[0] != controlclient.LoginEphemeral|controlclient.LoginRotateNodeKey {
+		t.Errorf("logins = %v; want one, rotating the key, non-interactive and ephemeral", cc.logins)
+	}
+
+	// Control wants the user, as when the auth key was single-use.
+	cc.interactive = true
+	if res := do("POST", "timeout=5", http.StatusOK); res.Refreshed || !strings.Contains(res.Err, "interactive") {
+		t.Errorf("interactive: got %+v", res)
+	}
+	cc.interactive = false
+	b.authURL = ""
+
+	cc.stall = true
+	if res := do("POST", "timeout=0.05", http.StatusOK); res.Refreshed || !strings.Contains(res.Err, "timed out") || !res.KeyExpiry.Equal(cc.expiry[newKey]) {
+		t.Errorf("timeout: got %+v", res)
+	}
+}
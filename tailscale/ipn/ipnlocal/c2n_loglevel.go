@@ -0,0 +1,155 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tailscale.com/tstime"
+)
+
+// Levels of logs uploaded, as set by c2n /logtail/level, from most to least
+// verbose.
+const (
+	c2nLogLevelDebug = "debug" // all logs; the default
+	c2nLogLevelInfo  = "info"  // all but verbose ("[v1]", "[v2]") logs
+	c2nLogLevelWarn  = "warn"  // only non-verbose logs that look like errors or warnings
+)
+
+// c2nLogLevelMaxTTL is the longest that c2n /logtail/level may lower the
+// level of logs uploaded for.
+const c2nLogLevelMaxTTL = 24 * time.Hour
+
+// c2nLogLevelOverride is a level of logs uploaded that was set by c2n
+// /logtail/level, other than c2nLogLevelDebug.
+type c2nLogLevelOverride struct {
+	level string
+	until time.Time              // or zero if it doesn't expire
+	timer tstime.TimerController // reverts it at until, or nil
+}
+
+// c2nLogLevelResponse is the response to c2n /logtail/level.
+type c2nLogLevelResponse struct {
+	Level string     `json:"level"`
+	Until *time.Time `json:"until,omitempty"` // when Level reverts to debug, if it will
+}
+
+// warnWords are the words that c2nLogLevelWarn looks for in logs, as
+// tailscaled's logs have no level more severe than the default.
+var warnWords = [][]byte{
+	[]byte("error"), []byte("Error"), []byte("ERROR"),
+	[]byte("warn"), []byte("Warn"), []byte("WARN"),
+	[]byte("fail"), []byte("Fail"),
+	[]byte("panic"),
+}
+
+// c2nAuditLogPrefix is the prefix of the logs of c2n activity, which are
+// always uploaded so that lowering the level can't hide what c2n did.
+var c2nAuditLogPrefix = []byte("c2n: ")
+
+// c2nLogUploadFilter returns the logtail upload filter for level, or nil if
+// all logs should be uploaded.
+func c2nLogUploadFilter(level string) func(v int, msg []byte) bool {
+	switch level {
+	case c2nLogLevelInfo:
+		return func(v int, _ []byte) bool { return v == 0 }
+	case c2nLogLevelWarn:
+		return func(v int, msg []byte) bool {
+			if v != 0 {
+				return false
+			}
+			if bytes.Contains(msg, c2nAuditLogPrefix) {
+				return true
+			}
+			for _, w := range warnWords {
+				if bytes.Contains(msg, w) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return nil
+}
+
+// handleC2NLogtailLevel reports the level of logs being uploaded. A POST
+// sets it to "level" (debug, info or warn, dropping the others before
+// they're buffered for upload), for "secs" seconds if given, after which it
+// reverts to debug. Like any override, that's lost if tailscaled restarts.
+// As the logs it drops are gone for good, a POST requires c2n mutations be
+// enabled.
+func (b *LocalBackend) handleC2NLogtailLevel(w http.ResponseWriter, r *http.Request) {
+	if b.setLogUploadFilterFunc == nil {
+		http.Error(w, "no log upload filter wired up", http.StatusNotImplemented)
+		return
+	}
+	if r.Method == "POST" {
+		level := r.FormValue("level")
+		switch level {
+		case c2nLogLevelDebug, c2nLogLevelInfo, c2nLogLevelWarn:
+		default:
+			http.Error(w, "invalid 'level' parameter; want debug, info or warn", http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if v := r.FormValue("secs"); v != "" {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs < 0 {
+				http.Error(w, "invalid 'secs' parameter", http.StatusBadRequest)
+				return
+			}
+			ttl = min(time.Duration(secs)*time.Second, c2nLogLevelMaxTTL)
+		}
+		b.setC2NLogLevel(level, ttl)
+	}
+
+	res := c2nLogLevelResponse{Level: c2nLogLevelDebug}
+	b.mu.Lock()
+	if o := b.c2nLogLevel; o != nil {
+		res.Level = o.level
+		if !o.until.IsZero() {
+			until := o.until
+			res.Until = &until
+		}
+	}
+	b.mu.Unlock()
+	writeJSON(w, res)
+}
+
+// setC2NLogLevel sets the level of logs uploaded to level, reverting to
+// c2nLogLevelDebug after ttl if it's non-zero.
+func (b *LocalBackend) setC2NLogLevel(level string, ttl time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o := b.c2nLogLevel; o != nil && o.timer != nil {
+		o.timer.Stop()
+	}
+	b.c2nLogLevel = nil
+	if level != c2nLogLevelDebug {
+		o := &c2nLogLevelOverride{level: level}
+		if ttl > 0 {
+			o.until = b.clock.Now().Add(ttl)
+			o.timer = b.clock.AfterFunc(ttl, func() { b.revertC2NLogLevel(o) })
+		}
+		b.c2nLogLevel = o
+	}
+	b.setLogUploadFilterFunc(c2nLogUploadFilter(level))
+	b.logf("c2n: uploading logs at level %v", level)
+}
+
+// revertC2NLogLevel reverts the level of logs uploaded to c2nLogLevelDebug
+// when o expires, unless o has since been replaced.
+func (b *LocalBackend) revertC2NLogLevel(o *c2nLogLevelOverride) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.c2nLogLevel != o {
+		return
+	}
+	b.c2nLogLevel = nil
+	b.setLogUploadFilterFunc(nil)
+	b.logf("c2n: log upload level %v expired; uploading logs at level %v", o.level, c2nLogLevelDebug)
+}
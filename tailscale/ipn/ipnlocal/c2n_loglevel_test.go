@@ -0,0 +1,98 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstest"
+)
+
+func TestHandleC2NLogtailLevel(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b := &LocalBackend{logf: t.Logf, clock: clock}
+
+	var mu sync.Mutex
+	var filter func(int, []byte) bool
+	b.SetLogUploadFilterer(func(keep func(int, []byte) bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		filter = keep
+	})
+	uploads := func(level int, msg string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return filter == nil || filter(level, []byte(msg))
+	}
+
+	do := func(method, query string) (int, c2nLogLevelResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/logtail/level?"+query, nil))
+		var res c2nLogLevelResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, res
+	}
+
+	if code, res := do("GET", ""); code != http.StatusOK || res.Level != "debug" || res.Until != nil {
+		t.Fatalf("initially: %d, %+v; want debug", code, res)
+	}
+	if code, _ := do("POST", "level=warn"); code != http.StatusForbidden {
+		t.Errorf("without c2n mutations: status = %d; want 403", code)
+	}
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+
+	if code, _ := do("POST", "level=trace"); code != http.StatusBadRequest {
+		t.Errorf("bad level: status = %d; want 400", code)
+	}
+
+	code, res := do("POST", "level=warn&secs=60")
+	if code != http.StatusOK || res.Level != "warn" || res.Until == nil || !res.Until.Equal(clock.Now().Add(time.Minute)) {
+		t.Fatalf("set warn: %d, %+v", code, res)
+	}
+	for _, tt := range []struct {
+		level int
+		msg   string
+		want  bool
+	}{
+		{0, "magicsock: endpoints changed", false},
+		{0, "dns: error applying config", true},
+		{1, "netcheck: report failed", false},
+		{0, "c2n: POST /logtail/level: 200 OK", true},
+	} {
+		if got := uploads(tt.level, tt.msg); got != tt.want {
+			t.Errorf("at warn, uploads(%d, %q) = %v; want %v", tt.level, tt.msg, got, tt.want)
+		}
+	}
+
+	// Replacing the level replaces its expiry too.
+	do("POST", "level=info&secs=120")
+	if uploads(1, "[v1] verbose") || !uploads(0, "magicsock: endpoints changed") {
+		t.Error("at info, want only non-verbose logs uploaded")
+	}
+	clock.Advance(90 * time.Second)
+	if _, res := do("GET", ""); res.Level != "info" {
+		t.Errorf("after the first expiry: level = %q; want info", res.Level)
+	}
+
+	clock.Advance(time.Minute)
+	if _, res := do("GET", ""); res.Level != "debug" || res.Until != nil {
+		t.Errorf("after expiry: %+v; want debug", res)
+	}
+	if !uploads(2, "[v2] very verbose") {
+		t.Error("after expiry, verbose logs not uploaded")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// c2nLogTailDefaultLines is how many logs c2n /logtail/tail returns if it's
+// not given "lines".
+const c2nLogTailDefaultLines = 100
+
+// handleC2NLogtailTail returns the most recent logs in memory, up to "lines"
+// of them, oldest first. They're the logs as uploaded, so they've been
+// through the same filtering, and only include logs that are uploaded. That
+// makes them useful when uploads aren't reaching the log server.
+//
+// By default, they're returned as a JSON array of the uploaded JSON objects.
+// With "format=text", they're returned one per line as text, each with its
+// client time if it has one.
+//
+// A POST instead returns up to "lines" of the oldest logs and discards them,
+// in one operation, so that repeated POSTs return each log exactly once.
+func (b *LocalBackend) handleC2NLogtailTail(w http.ResponseWriter, r *http.Request) {
+	if b.recentLogsFunc == nil {
+		http.Error(w, "no recent logs reader wired up", http.StatusNotImplemented)
+		return
+	}
+	n := c2nLogTailDefaultLines
+	if v := r.FormValue("lines"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid 'lines' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	format := r.FormValue("format")
+	if format != "" && format != "json" && format != "text" {
+		http.Error(w, "invalid 'format' parameter; want \"json\" or \"text\"", http.StatusBadRequest)
+		return
+	}
+
+	var logs [][]byte
+	if r.Method == "POST" {
+		logs = b.takeRecentLogsFunc(n)
+	} else {
+		logs = b.recentLogsFunc(n)
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, l := range logs {
+			w.Write(c2nLogText(l))
+			w.Write([]byte("\n"))
+		}
+		return
+	}
+	res := make([]json.RawMessage, len(logs))
+	for i, l := range logs {
+		res[i] = l
+	}
+	writeJSON(w, res)
+}
+
+// c2nLogText returns the text of the uploaded log l, prefixed by its client
+// time if it has one, or l itself if it has no text.
+func c2nLogText(l []byte) []byte {
+	var m struct {
+		Text    *string
+		Logtail struct {
+			ClientTime string `json:"client_time"`
+		}
+	}
+	if err := json.Unmarshal(l, &m); err != nil || m.Text == nil {
+		return l
+	}
+	text := strings.TrimSuffix(*m.Text, "\n")
+	if m.Logtail.ClientTime == "" {
+		return []byte(text)
+	}
+	return []byte(m.Logtail.ClientTime + " " + text)
+}
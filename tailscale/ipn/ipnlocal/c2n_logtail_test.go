@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/tstime"
+)
+
+func TestHandleC2NLogtailTail(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	do := func(method, query string, wantCode int) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/logtail/tail?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %q: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		return rec.Body.String()
+	}
+	do("GET", "", http.StatusNotImplemented)
+
+	logs := [][]byte{
+		[]byte(`{"logtail":{"client_time":"2026-10-14T01:02:03Z"},"text":"one\n"}`),
+		[]byte(`{"text":"two\n"}`),
+		[]byte(`{"logtail":{"client_time":"2026-10-14T01:02:04Z"},"event":"three"}`),
+	}
+	var gotN int
+	b.SetRecentLogsReader(func(n int) [][]byte {
+		gotN = n
+		return logs[max(0, len(logs)-n):]
+	}, func(n int) [][]byte {
+		n = min(n, len(logs))
+		ret := logs[:n]
+		logs = logs[n:]
+		return ret
+	})
+
+	for _, q := range []string{"lines=0", "lines=x", "format=xml"} {
+		do("GET", q, http.StatusBadRequest)
+	}
+
+	var res []json.RawMessage
+	if err := json.Unmarshal([]byte(do("GET", "", http.StatusOK)), &res); err != nil {
+		t.Fatal(err)
+	}
+	if gotN != c2nLogTailDefaultLines || len(res) != 3 || string(res[1]) != string(logs[1]) {
+		t.Errorf("GET asked for %d logs, got %s", gotN, res)
+	}
+
+	got := do("GET", "lines=2&format=text", http.StatusOK)
+	want := "two\n" + `{"logtail":{"client_time":"2026-10-14T01:02:04Z"},"event":"three"}` + "\n"
+	if got != want {
+		t.Errorf("text, 2 lines = %q; want %q", got, want)
+	}
+	got = do("GET", "format=text", http.StatusOK)
+	if want = "2026-10-14T01:02:03Z one\n" + want; got != want {
+		t.Errorf("text = %q; want %q", got, want)
+	}
+
+	// A POST takes the oldest logs, so repeated ones return each once.
+	all := logs
+	for i, want := range []string{
+		"[" + string(all[0]) + "," + string(all[1]) + "]\n",
+		"[" + string(all[2]) + "]\n",
+		"[]\n",
+	} {
+		if got := do("POST", "lines=2", http.StatusOK); got != want {
+			t.Errorf("POST %d = %q; want %q", i, got, want)
+		}
+	}
+	if got := do("GET", "", http.StatusOK); got != "[]\n" {
+		t.Errorf("after POSTs = %q; want no logs", got)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"strconv"
+
+	"tailscale.com/wgengine/magicsock"
+)
+
+// c2nMagicsockCounters is the part of *magicsock.Conn that c2n
+// /debug/magicsock/stats uses.
+type c2nMagicsockCounters interface {
+	Counters() magicsock.Counters
+	ResetCounters() magicsock.Counters
+}
+
+// c2nGetMagicsockCounters returns the magicsock.Conn. It's a var for tests.
+var c2nGetMagicsockCounters = func(b *LocalBackend) (c2nMagicsockCounters, error) {
+	mc, err := b.magicConn()
+	if err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
+
+// handleC2NDebugMagicsockStats reports magicsock's counters of packets sent
+// and received per path and of disco outcomes. A POST with reset=true zeroes
+// them as they're read, so that a later request reports just what happened
+// in between and no counts are lost in the gap.
+func (b *LocalBackend) handleC2NDebugMagicsockStats(w http.ResponseWriter, r *http.Request) {
+	var reset bool
+	if v := r.FormValue("reset"); v != "" {
+		var err error
+		if reset, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid 'reset' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if reset && r.Method != "POST" {
+		http.Error(w, "reset requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	mc, err := c2nGetMagicsockCounters(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reset {
+		writeJSON(w, mc.ResetCounters())
+	} else {
+		writeJSON(w, mc.Counters())
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/tstime"
+	"tailscale.com/wgengine/magicsock"
+)
+
+// fakeMagicsockCounters is a c2nMagicsockCounters whose counters are set
+// by the test.
+type fakeMagicsockCounters struct {
+	c magicsock.Counters
+}
+
+func (m *fakeMagicsockCounters) Counters() magicsock.Counters { return m.c }
+
+func (m *fakeMagicsockCounters) ResetCounters() magicsock.Counters {
+	ret := m.c
+	m.c = magicsock.Counters{}
+	return ret
+}
+
+func TestHandleC2NDebugMagicsockStats(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	mc := &fakeMagicsockCounters{magicsock.Counters{SendDirect: 5, RecvDERP: 2}}
+	defer func(f func(*LocalBackend) (c2nMagicsockCounters, error)) { c2nGetMagicsockCounters = f }(c2nGetMagicsockCounters)
+	c2nGetMagicsockCounters = func(*LocalBackend) (c2nMagicsockCounters, error) { return mc, nil }
+
+	do := func(method, target string, wantCode int) (res magicsock.Counters) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, target, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, target, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+
+	if res := do("GET", "/debug/magicsock/stats", http.StatusOK); res.SendDirect != 5 || res.RecvDERP != 2 {
+		t.Errorf("GET = %+v", res)
+	}
+	do("GET", "/debug/magicsock/stats?reset=1", http.StatusMethodNotAllowed)
+	do("POST", "/debug/magicsock/stats?reset=maybe", http.StatusBadRequest)
+	if mc.c.SendDirect != 5 {
+		t.Fatalf("counters were reset by a rejected request")
+	}
+
+	if res := do("POST", "/debug/magicsock/stats?reset=1", http.StatusOK); res.SendDirect != 5 || res.RecvDERP != 2 {
+		t.Errorf("POST reset = %+v; want the counters before the reset", res)
+	}
+	if res := do("GET", "/debug/magicsock/stats", http.StatusOK); res.SendDirect != 0 || res.RecvDERP != 0 {
+		t.Errorf("GET after reset = %+v; want zero", res)
+	}
+}
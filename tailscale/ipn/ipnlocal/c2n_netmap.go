@@ -0,0 +1,88 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"strconv"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+)
+
+// c2nNetmap is the response to /debug/netmap.
+type c2nNetmap struct {
+	// Status is "ok", or "no netmap" if the node hasn't received one
+	// yet, in which case NetMap is nil.
+	Status string
+
+	// Version is incremented each time the node's netmap changes. It can
+	// be passed back as the "since" parameter to only get a changed
+	// netmap.
+	Version uint64
+
+	NetMap *netmap.NetworkMap `json:",omitempty"`
+}
+
+// handleC2NDebugNetmap returns the current netmap, without its private
+// key. With ?redact=1, the public keys of the node and its peers are
+// removed too. With ?since=N, it returns 304 Not Modified if the netmap
+// is still at version N.
+func (b *LocalBackend) handleC2NDebugNetmap(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	nm := b.netMap
+	gen := b.netMapGen
+	b.mu.Unlock()
+
+	if v := r.FormValue("since"); v != "" {
+		since, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		if since == gen {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	res := c2nNetmap{Status: "ok", Version: gen}
+	if nm == nil {
+		res.Status = "no netmap"
+	} else {
+		res.NetMap = sharableNetmap(nm, r.FormValue("redact") == "1")
+	}
+	writeJSON(w, res)
+}
+
+// sharableNetmap returns a shallow copy of nm without its private key,
+// and, if redactKeys, without the public keys of the node and its peers.
+// nm is not modified.
+func sharableNetmap(nm *netmap.NetworkMap, redactKeys bool) *netmap.NetworkMap {
+	ret := *nm
+	ret.PrivateKey = key.NodePrivate{}
+	if !redactKeys {
+		return &ret
+	}
+	ret.NodeKey = key.NodePublic{}
+	ret.MachineKey = key.MachinePublic{}
+	redactNode := func(nv tailcfg.NodeView) tailcfg.NodeView {
+		if !nv.Valid() {
+			return nv
+		}
+		n := nv.AsStruct()
+		n.Key = key.NodePublic{}
+		n.KeySignature = nil
+		n.Machine = key.MachinePublic{}
+		n.DiscoKey = key.DiscoPublic{}
+		return n.View()
+	}
+	ret.SelfNode = redactNode(nm.SelfNode)
+	ret.Peers = make([]tailcfg.NodeView, len(nm.Peers))
+	for i, p := range nm.Peers {
+		ret.Peers[i] = redactNode(p)
+	}
+	return &ret
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+)
+
+func TestHandleC2NDebugNetmap(t *testing.T) {
+	priv := key.NewNode()
+	peerKey := key.NewNode().Public()
+	b := &LocalBackend{clock: tstime.StdClock{}}
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.handleC2NDebugNetmap(rec, httptest.NewRequest("GET", "/debug/netmap"+query, nil))
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder) c2nNetmap {
+		t.Helper()
+		if rec.Code != 200 {
+			t.Fatalf("got status %d; want 200", rec.Code)
+		}
+		var res c2nNetmap
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := decode(get("")); res.Status != "no netmap" || res.NetMap != nil {
+		t.Errorf("before netmap: got %+v; want no netmap", res)
+	}
+
+	nm := &netmap.NetworkMap{
+		SelfNode:   (&tailcfg.Node{Name: "self.", Key: priv.Public()}).View(),
+		NodeKey:    priv.Public(),
+		PrivateKey: priv,
+		Peers:      []tailcfg.NodeView{(&tailcfg.Node{ID: 2, Name: "peer.", Key: peerKey}).View()},
+	}
+	b.mu.Lock()
+	b.netMap = nm
+	b.netMapGen++
+	b.mu.Unlock()
+
+	privText, _ := priv.MarshalText()
+	rec := get("")
+	if body := rec.Body.String(); strings.Contains(body, string(privText)) {
+		t.Fatal("response contains private key")
+	}
+	res := decode(rec)
+	if res.Status != "ok" || res.Version != 1 || res.NetMap == nil {
+		t.Fatalf("got %+v; want netmap at version 1", res)
+	}
+	if len(res.NetMap.Peers) != 1 || res.NetMap.Peers[0].Key() != peerKey {
+		t.Errorf("peers = %v; want peer with key %v", res.NetMap.Peers, peerKey)
+	}
+
+	rec = get("?redact=1")
+	if body := rec.Body.String(); strings.Contains(body, peerKey.String()) || strings.Contains(body, priv.Public().String()) {
+		t.Errorf("redacted response contains node keys: %s", body)
+	}
+	if res := decode(rec); res.NetMap.Peers[0].Name() != "peer." {
+		t.Errorf("redacted peer = %v; want peer. with its key removed", res.NetMap.Peers[0])
+	}
+	if nm.Peers[0].Key() != peerKey || !nm.PrivateKey.Equal(priv) {
+		t.Error("redaction modified the backend's netmap")
+	}
+
+	if rec := get("?since=1"); rec.Code != 304 {
+		t.Errorf("since current version: got status %d; want 304", rec.Code)
+	}
+	if res := decode(get("?since=0")); res.Version != 1 {
+		t.Errorf("since old version: got version %d; want 1", res.Version)
+	}
+	if rec := get("?since=x"); rec.Code != 400 {
+		t.Errorf("bad since: got status %d; want 400", rec.Code)
+	}
+}
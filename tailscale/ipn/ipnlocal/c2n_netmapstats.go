@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"tailscale.com/types/netmap"
+)
+
+// c2nNetmapStats is the response to /debug/netmap-stats: the size of the
+// current netmap, without its contents.
+type c2nNetmapStats struct {
+	Peers       int
+	OnlinePeers int // peers that control reports as online
+	// Routes is the number of subnet and exit node routes advertised
+	// by peers and accepted by control, excluding the peers' own
+	// addresses.
+	Routes      int
+	FilterRules int // rules in the packet filter, as sent by control
+	// Bytes is the size of the netmap encoded as JSON, which is
+	// roughly proportional to the memory it takes.
+	Bytes   int
+	Updated time.Time // when the netmap was last updated
+}
+
+func (b *LocalBackend) handleC2NDebugNetmapStats(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	nm := b.netMap
+	updated := b.netMapSetAt
+	b.mu.Unlock()
+	if nm == nil {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	res := netmapStats(nm)
+	res.Updated = updated
+	writeJSON(w, res)
+}
+
+// netmapStats returns the counts of things in nm. It doesn't set Updated.
+func netmapStats(nm *netmap.NetworkMap) c2nNetmapStats {
+	res := c2nNetmapStats{
+		Peers:       len(nm.Peers),
+		FilterRules: nm.PacketFilterRules.Len(),
+	}
+	for _, p := range nm.Peers {
+		if o := p.Online(); o != nil && *o {
+			res.OnlinePeers++
+		}
+		addrs := p.Addresses().AsSlice()
+		aips := p.AllowedIPs()
+		for i := 0; i < aips.Len(); i++ {
+			if !slices.Contains(addrs, aips.At(i)) {
+				res.Routes++
+			}
+		}
+	}
+	if j, err := json.Marshal(nm); err == nil {
+		res.Bytes = len(j)
+	}
+	return res
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/ptr"
+	"tailscale.com/types/views"
+)
+
+func TestNetmapStats(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	nm := &netmap.NetworkMap{
+		Peers: []tailcfg.NodeView{
+			(&tailcfg.Node{
+				Addresses:  []netip.Prefix{pfx("100.64.0.2/32")},
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/24"), pfx("0.0.0.0/0")},
+				Online:     ptr.To(true),
+			}).View(),
+			(&tailcfg.Node{
+				Addresses:  []netip.Prefix{pfx("100.64.0.3/32")},
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32")},
+				Online:     ptr.To(false),
+			}).View(),
+			(&tailcfg.Node{
+				Addresses:  []netip.Prefix{pfx("100.64.0.4/32")},
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.4/32")},
+			}).View(),
+		},
+		PacketFilterRules: views.SliceOf([]tailcfg.FilterRule{
+			{SrcIPs: []string{"*"}, DstPorts: []tailcfg.NetPortRange{{IP: "*", Ports: tailcfg.PortRangeAny}}},
+		}),
+	}
+	got := netmapStats(nm)
+	if got.Bytes == 0 {
+		t.Error("Bytes = 0")
+	}
+	got.Bytes = 0
+	want := c2nNetmapStats{
+		Peers:       3,
+		OnlinePeers: 1,
+		Routes:      2,
+		FilterRules: 1,
+	}
+	if got != want {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"tailscale.com/control/controlclient"
+)
+
+// c2nAuthKey is what's known locally about an auth key, without its secret.
+type c2nAuthKey struct {
+	// ID is the key's ID, as shown in the admin console, or empty if
+	// the key isn't in a recognized format.
+	ID string `json:",omitempty"`
+	// Wrapped is whether the key was wrapped for tailnet lock, so the
+	// node signs itself.
+	Wrapped bool
+}
+
+// redactAuthKey returns the non-secret parts of auth key k, which is in the
+// form "tskey-auth-<id>-<secret>" or "tskey-<id>-<secret>", optionally with a
+// "--TL" tailnet lock suffix.
+func redactAuthKey(k string) c2nAuthKey {
+	var ret c2nAuthKey
+	k, _, ret.Wrapped = strings.Cut(k, "--TL")
+	parts := strings.Split(k, "-")
+	if len(parts) < 3 || parts[0] != "tskey" {
+		return ret
+	}
+	if parts[1] == "auth" {
+		if len(parts) >= 4 {
+			ret.ID = parts[2]
+		}
+		return ret
+	}
+	ret.ID = parts[1]
+	return ret
+}
+
+// handleC2NDebugNodeAuth reports how this node was authorized and whether
+// it's ephemeral, as far as it knows.
+func (b *LocalBackend) handleC2NDebugNodeAuth(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	ephemeral := b.loginFlags&controlclient.LoginEphemeral != 0
+	authKey := b.authKeyUsed
+	nm := b.netMap
+	b.mu.Unlock()
+
+	var res struct {
+		// Lifecycle is "ephemeral" if this node asked to be ephemeral
+		// (as with tailscaled --state=mem:), and otherwise "persistent".
+		// A node authorized with an ephemeral auth key is ephemeral
+		// too, but it doesn't know that.
+		Lifecycle string
+		// AuthKey is the auth key given to this node since tailscaled
+		// started, if any.
+		AuthKey *c2nAuthKey `json:",omitempty"`
+		// Tags are this node's tags, which include those of the auth
+		// key it was authorized with.
+		Tags []string
+		// KeyExpiry is when the node key expires; zero if it doesn't.
+		KeyExpiry time.Time `json:",omitempty"`
+		// Unknown lists the auth key metadata that isn't sent to nodes.
+		Unknown []string
+	}
+	res.Lifecycle = "persistent"
+	if ephemeral {
+		res.Lifecycle = "ephemeral"
+	}
+	res.AuthKey = authKey
+	if nm != nil && nm.SelfNode.Valid() {
+		res.Tags = nm.SelfNode.Tags().AsSlice()
+		res.KeyExpiry = nm.SelfNode.KeyExpiry()
+	}
+	res.Unknown = []string{"ephemeral auth key", "reusable auth key"}
+	writeJSON(w, res)
+}
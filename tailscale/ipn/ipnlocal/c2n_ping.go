@@ -0,0 +1,104 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+const (
+	// c2nPingDefaultTimeout is how long /ping waits for a reply by default.
+	c2nPingDefaultTimeout = 10 * time.Second
+	// c2nPingMaxTimeout is the longest that /ping may be asked to wait.
+	c2nPingMaxTimeout = 30 * time.Second
+)
+
+// c2nPingResponse is the result of c2n /ping.
+type c2nPingResponse struct {
+	// Endpoint is where the reply came from: an ip:port for a direct
+	// disco pong, or empty if it came via DERP or wasn't a disco ping.
+	Endpoint string `json:",omitempty"`
+
+	// DERPRegionID is the DERP region that the reply came through, if
+	// any.
+	DERPRegionID int `json:",omitempty"`
+
+	LatencySeconds float64 `json:",omitempty"`
+
+	// Err is why there was no reply, including if none arrived in time.
+	Err string `json:",omitempty"`
+}
+
+// handleC2NPing pings a peer, like "tailscale ping", and reports the
+// result. It always responds within the requested timeout; if no reply has
+// arrived by then, that's reported in the response's Err.
+func (b *LocalBackend) handleC2NPing(w http.ResponseWriter, r *http.Request) {
+	pingType, err := parseC2NPingType(r.FormValue("type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := c2nPingDefaultTimeout
+	if v := r.FormValue("timeout"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs <= 0 {
+			http.Error(w, "invalid 'timeout' parameter", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(secs*float64(time.Second)), c2nPingMaxTimeout)
+	}
+	peer, ok := b.c2nPeer(w, r)
+	if !ok {
+		return
+	}
+	addrs := peer.Addresses()
+	if addrs.Len() == 0 {
+		http.Error(w, "peer has no addresses", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	pr, err := b.Ping(ctx, addrs.At(0).Addr(), pingType, 0)
+	writeJSON(w, c2nPingResult(pr, err, timeout))
+}
+
+// parseC2NPingType parses the type of ping requested from /ping. It
+// defaults to a disco ping.
+func parseC2NPingType(s string) (tailcfg.PingType, error) {
+	switch t := tailcfg.PingType(s); t {
+	case "":
+		return tailcfg.PingDisco, nil
+	case tailcfg.PingDisco, tailcfg.PingTSMP, tailcfg.PingICMP:
+		return t, nil
+	}
+	return "", fmt.Errorf("unsupported ping type %q; want %q, %q or %q", s, tailcfg.PingDisco, tailcfg.PingTSMP, tailcfg.PingICMP)
+}
+
+// c2nPingResult returns the /ping response for the result of
+// LocalBackend.Ping with the given timeout.
+func c2nPingResult(pr *ipnstate.PingResult, err error, timeout time.Duration) c2nPingResponse {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return c2nPingResponse{Err: fmt.Sprintf("timeout: no reply in %v", timeout)}
+	case err != nil:
+		return c2nPingResponse{Err: err.Error()}
+	case pr == nil:
+		return c2nPingResponse{Err: "no result"}
+	}
+	return c2nPingResponse{
+		Endpoint:       pr.Endpoint,
+		DERPRegionID:   pr.DERPRegionID,
+		LatencySeconds: pr.LatencySeconds,
+		Err:            pr.Err,
+	}
+}
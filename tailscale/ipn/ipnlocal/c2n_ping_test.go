@@ -0,0 +1,77 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+func TestParseC2NPingType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    tailcfg.PingType
+		wantErr bool
+	}{
+		{"", tailcfg.PingDisco, false},
+		{"disco", tailcfg.PingDisco, false},
+		{"TSMP", tailcfg.PingTSMP, false},
+		{"ICMP", tailcfg.PingICMP, false},
+		{"peerapi", "", true},
+		{"bogus", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseC2NPingType(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseC2NPingType(%q) = %q, %v; want %q, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestC2NPingResult(t *testing.T) {
+	tests := []struct {
+		name string
+		pr   *ipnstate.PingResult
+		err  error
+		want c2nPingResponse
+	}{
+		{
+			name: "direct",
+			pr:   &ipnstate.PingResult{Endpoint: "1.2.3.4:41641", LatencySeconds: 0.01},
+			want: c2nPingResponse{Endpoint: "1.2.3.4:41641", LatencySeconds: 0.01},
+		},
+		{
+			name: "derp",
+			pr:   &ipnstate.PingResult{DERPRegionID: 7, LatencySeconds: 0.05},
+			want: c2nPingResponse{DERPRegionID: 7, LatencySeconds: 0.05},
+		},
+		{
+			name: "ping-error",
+			pr:   &ipnstate.PingResult{Err: "no matching peer"},
+			want: c2nPingResponse{Err: "no matching peer"},
+		},
+		{
+			name: "timeout",
+			err:  context.DeadlineExceeded,
+			want: c2nPingResponse{Err: "timeout: no reply in 10s"},
+		},
+		{
+			name: "other-error",
+			err:  errors.New("boom"),
+			want: c2nPingResponse{Err: "boom"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c2nPingResult(tt.pr, tt.err, 10*time.Second); got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
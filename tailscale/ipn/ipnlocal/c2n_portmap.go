@@ -0,0 +1,124 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"time"
+
+	"tailscale.com/net/portmapper"
+)
+
+// Outcomes of a c2n POST /debug/portmap.
+const (
+	c2nPortmapMapped     = "mapped"      // a mapping was created or renewed
+	c2nPortmapNoGateway  = "no-gateway"  // there's no gateway to ask for one
+	c2nPortmapNoServices = "no-services" // the gateway didn't answer any protocol's probe
+	c2nPortmapFailed     = "failed"      // probing or mapping failed otherwise; see Error
+)
+
+// c2nPortmapTimeout is how long c2n /debug/portmap waits for a mapping,
+// as the portmapper does when it makes one in the background.
+const c2nPortmapTimeout = 5 * time.Second
+
+// c2nPortmapResult is the response to c2n /debug/portmap.
+type c2nPortmapResult struct {
+	// Outcome is one of the c2nPortmap* outcomes, on POST.
+	Outcome string `json:",omitempty"`
+
+	// UPnP, PMP and PCP are whether the gateway answered each protocol's
+	// probe, on POST, or was seen to support it recently, on GET.
+	UPnP bool
+	PMP  bool
+	PCP  bool
+
+	// Mapping is the current mapping, if there is one, and LifetimeSecs
+	// how long it has left.
+	Mapping      *portmapper.Mapping `json:",omitempty"`
+	LifetimeSecs float64             `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+// c2nPortMapper is the part of *portmapper.Client that c2n /debug/portmap
+// uses.
+type c2nPortMapper interface {
+	CurrentMapping() (portmapper.Mapping, bool)
+	RecentServices() portmapper.ProbeResult
+	Probe(context.Context) (portmapper.ProbeResult, error)
+	CreateMapping(context.Context) (portmapper.Mapping, error)
+}
+
+// c2nGetPortMapper returns magicsock's port mapping client. It's a var for
+// tests.
+var c2nGetPortMapper = func(b *LocalBackend) (c2nPortMapper, error) {
+	mc, err := b.magicConn()
+	if err != nil {
+		return nil, err
+	}
+	return mc.PortMapper(), nil
+}
+
+// handleC2NDebugPortmap reports magicsock's current port mapping, if any, and
+// which protocols the gateway was seen to support. A POST first probes the
+// gateway for UPnP, NAT-PMP and PCP and, if any answer, creates or renews a
+// mapping with the portmapper that magicsock uses, so one that's made is
+// used for the node's endpoints.
+func (b *LocalBackend) handleC2NDebugPortmap(w http.ResponseWriter, r *http.Request) {
+	if runtime.GOOS == "js" {
+		http.Error(w, "port mapping not supported on "+runtime.GOOS, http.StatusNotImplemented)
+		return
+	}
+	pm, err := c2nGetPortMapper(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var res c2nPortmapResult
+	if r.Method == "POST" {
+		ctx, cancel := context.WithTimeout(r.Context(), c2nPortmapTimeout)
+		defer cancel()
+		probe, err := pm.Probe(ctx)
+		res.UPnP, res.PMP, res.PCP = probe.UPnP, probe.PMP, probe.PCP
+		switch {
+		case errors.Is(err, portmapper.ErrGatewayRange):
+			res.Outcome, res.Error = c2nPortmapNoGateway, "no gateway found"
+		case err != nil:
+			res.Outcome, res.Error = c2nPortmapFailed, "probe: "+err.Error()
+		case !probe.UPnP && !probe.PMP && !probe.PCP:
+			res.Outcome, res.Error = c2nPortmapNoServices, "UPnP, NAT-PMP and PCP probes all timed out"
+		default:
+			_, err := pm.CreateMapping(ctx)
+			switch {
+			case errors.Is(err, portmapper.ErrMappingInProgress):
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case errors.Is(err, portmapper.ErrGatewayRange):
+				res.Outcome, res.Error = c2nPortmapNoGateway, "no gateway found"
+			case err != nil:
+				res.Outcome, res.Error = c2nPortmapFailed, "mapping: "+err.Error()
+			default:
+				res.Outcome = c2nPortmapMapped
+			}
+		}
+		if res.Error != "" {
+			b.logf("c2n: portmap: %s: %s", res.Outcome, res.Error)
+		} else {
+			b.logf("c2n: portmap: %s", res.Outcome)
+		}
+	} else {
+		seen := pm.RecentServices()
+		res.UPnP, res.PMP, res.PCP = seen.UPnP, seen.PMP, seen.PCP
+	}
+
+	if m, ok := pm.CurrentMapping(); ok {
+		res.Mapping = &m
+		res.LifetimeSecs = max(0, m.GoodUntil.Sub(b.clock.Now()).Seconds())
+	}
+	writeJSON(w, res)
+}
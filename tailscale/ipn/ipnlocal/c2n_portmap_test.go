@@ -0,0 +1,118 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/net/portmapper"
+	"tailscale.com/tstest"
+)
+
+// fakePortMapper is a c2nPortMapper with canned results.
+type fakePortMapper struct {
+	seen     portmapper.ProbeResult
+	probe    portmapper.ProbeResult
+	probeErr error
+	mapErr   error
+	mapping  *portmapper.Mapping // the one CreateMapping makes
+	current  *portmapper.Mapping
+	mapped   int // CreateMapping calls
+}
+
+func (pm *fakePortMapper) CurrentMapping() (portmapper.Mapping, bool) {
+	if pm.current == nil {
+		return portmapper.Mapping{}, false
+	}
+	return *pm.current, true
+}
+
+func (pm *fakePortMapper) RecentServices() portmapper.ProbeResult { return pm.seen }
+
+func (pm *fakePortMapper) Probe(context.Context) (portmapper.ProbeResult, error) {
+	return pm.probe, pm.probeErr
+}
+
+func (pm *fakePortMapper) CreateMapping(context.Context) (portmapper.Mapping, error) {
+	pm.mapped++
+	if pm.mapErr != nil {
+		return portmapper.Mapping{}, pm.mapErr
+	}
+	pm.current = pm.mapping
+	return *pm.mapping, nil
+}
+
+func TestHandleC2NDebugPortmap(t *testing.T) {
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b := &LocalBackend{logf: t.Logf, clock: clock}
+	var pm *fakePortMapper
+	defer func(f func(*LocalBackend) (c2nPortMapper, error)) { c2nGetPortMapper = f }(c2nGetPortMapper)
+	c2nGetPortMapper = func(*LocalBackend) (c2nPortMapper, error) { return pm, nil }
+
+	do := func(method string, wantCode int) (res c2nPortmapResult) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/debug/portmap", nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s: status = %d; want %d: %s", method, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	mapping := &portmapper.Mapping{
+		Type:       "pmp",
+		External:   netip.MustParseAddrPort("203.0.113.1:41641"),
+		GoodUntil:  clock.Now().Add(2 * time.Hour),
+		RenewAfter: clock.Now().Add(time.Hour),
+	}
+
+	pm = &fakePortMapper{seen: portmapper.ProbeResult{UPnP: true}}
+	if res := do("GET", http.StatusOK); res.Outcome != "" || !res.UPnP || res.PMP || res.Mapping != nil {
+		t.Errorf("GET with no mapping = %+v", res)
+	}
+
+	pm = &fakePortMapper{probeErr: portmapper.ErrGatewayRange}
+	if res := do("POST", http.StatusOK); res.Outcome != c2nPortmapNoGateway || res.Error == "" || pm.mapped != 0 {
+		t.Errorf("POST with no gateway = %+v, %d mappings", res, pm.mapped)
+	}
+	pm = &fakePortMapper{}
+	if res := do("POST", http.StatusOK); res.Outcome != c2nPortmapNoServices || res.Error == "" || pm.mapped != 0 {
+		t.Errorf("POST with no services = %+v, %d mappings", res, pm.mapped)
+	}
+	pm = &fakePortMapper{probeErr: errors.New("boom")}
+	if res := do("POST", http.StatusOK); res.Outcome != c2nPortmapFailed || res.Error != "probe: boom" {
+		t.Errorf("POST with probe error = %+v", res)
+	}
+	pm = &fakePortMapper{probe: portmapper.ProbeResult{PCP: true}, mapErr: errors.New("refused")}
+	if res := do("POST", http.StatusOK); res.Outcome != c2nPortmapFailed || res.Error != "mapping: refused" || !res.PCP {
+		t.Errorf("POST with mapping error = %+v", res)
+	}
+	pm = &fakePortMapper{probe: portmapper.ProbeResult{PMP: true}, mapErr: portmapper.ErrMappingInProgress}
+	do("POST", http.StatusConflict)
+
+	pm = &fakePortMapper{probe: portmapper.ProbeResult{PMP: true}, mapping: mapping}
+	res := do("POST", http.StatusOK)
+	if res.Outcome != c2nPortmapMapped || res.Error != "" || !res.PMP || res.Mapping == nil || res.Mapping.External != mapping.External || res.LifetimeSecs != 7200 {
+		t.Errorf("POST with mapping = %+v", res)
+	}
+	clock.Advance(time.Hour)
+	if res := do("GET", http.StatusOK); res.Mapping == nil || res.Mapping.Type != "pmp" || res.LifetimeSecs != 3600 {
+		t.Errorf("GET with mapping = %+v", res)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/netutil"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/views"
+)
+
+// c2nRedactedPrefs are the JSON keys of the ipn.Prefs fields that c2n
+// /debug/prefs omits unless it's asked for them with unredacted=1.
+var c2nRedactedPrefs = []string{
+	"Config", // Persist: the node's identity, and its keys (which are always stripped)
+}
+
+// handleC2NDebugPrefs returns the node's prefs. The "fields" parameter
+// optionally selects a comma-separated list of them by JSON key, such as
+// "ExitNodeID,RouteAll".
+func (b *LocalBackend) handleC2NDebugPrefs(w http.ResponseWriter, r *http.Request) {
+	var fields []string
+	if v := r.FormValue("fields"); v != "" {
+		fields = strings.Split(v, ",")
+	}
+	res, err := filterPrefs(b.Prefs(), fields, r.FormValue("unredacted") == "1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// filterPrefs returns the JSON-encoded fields of p, keyed by their JSON
+// keys. If fields is non-empty, only those are returned. The fields in
+// c2nRedactedPrefs are omitted unless unredacted is set.
+func filterPrefs(p ipn.PrefsView, fields []string, unredacted bool) (map[string]json.RawMessage, error) {
+	all := map[string]json.RawMessage{}
+	if p.Valid() {
+		j, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(j, &all); err != nil {
+			return nil, err
+		}
+	}
+	if !unredacted {
+		for _, k := range c2nRedactedPrefs {
+			delete(all, k)
+		}
+	}
+	if len(fields) == 0 {
+		return all, nil
+	}
+	ret := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		switch {
+		case !prefsJSONKeys()[f]:
+			return nil, fmt.Errorf("unknown field %q", f)
+		case !unredacted && slices.Contains(c2nRedactedPrefs, f):
+			return nil, fmt.Errorf("field %q is redacted; use unredacted=1", f)
+		}
+		if v, ok := all[f]; ok {
+			ret[f] = v
+		}
+		// Otherwise it's empty and omitted from the JSON.
+	}
+	return ret, nil
+}
+
+// prefsJSONKeys returns the JSON keys of all of ipn.Prefs's fields, whether
+// or not they're omitted when empty.
+var prefsJSONKeys = sync.OnceValue(func() map[string]bool {
+	ret := map[string]bool{}
+	t := reflect.TypeOf(ipn.Prefs{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		ret[name] = true
+	}
+	return ret
+})
+
+// c2nUnsettablePrefs are the ipn.Prefs fields, by Go name, that c2n /prefs
+// may not change, because changing them could cut the node off from
+// control or the tailnet, or they're only meant to be set locally.
+//
+// Prefs not listed, such as CorpDNS, may be changed, as doing so can be
+// undone by c2n again.
+var c2nUnsettablePrefs = []string{
+	"ControlURL",
+	"WantRunning",
+	"LoggedOut",
+	"ForceDaemon",
+	"OperatorUser",
+	"AdvertiseTags",   // requires re-authenticating
+	"AdvertiseRoutes", // set with /prefs/routes, which checks them
+	"RunSSH",          // opens a new way into the node, so it's opted in to locally
+	"NetfilterMode",   // can leave the node's traffic unfiltered or undeliverable
+	"ExitNodeID",      // set with /prefs/exitnode, which checks the peer and can revert it
+	"ExitNodeIP",      // likewise
+	"ProfileName",
+	"Egg",
+}
+
+// c2nPrefsPaths maps c2nUnsettablePrefs that another c2n path sets
+// instead to that path, for the error that refuses them.
+var c2nPrefsPaths = map[string]string{
+	"AdvertiseRoutes": "/prefs/routes",
+	"ExitNodeID":      "/prefs/exitnode",
+	"ExitNodeIP":      "/prefs/exitnode",
+}
+
+// c2nPrefsPatchError is the response to a c2n PATCH /prefs that's refused
+// because it sets c2nUnsettablePrefs.
+type c2nPrefsPatchError struct {
+	Error      string
+	Disallowed []string // the unsettable fields that were set
+}
+
+// handleC2NPrefs returns the node's prefs, redacted as by /debug/prefs, and on
+// PATCH first applies the ipn.MaskedPrefs in the request body via EditPrefs,
+// like the CLI, so only the fields it sets are changed. The whole patch is
+// checked before any of it is applied, so an invalid one changes nothing.
+// Patches that set any of c2nUnsettablePrefs are refused with a 403.
+func (b *LocalBackend) handleC2NPrefs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PATCH" {
+		mp := new(ipn.MaskedPrefs)
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(mp); err != nil {
+			writeC2NBodyError(w, err)
+			return
+		}
+		set := maskedPrefsFields(mp)
+		if len(set) == 0 {
+			http.Error(w, "patch sets no prefs", http.StatusBadRequest)
+			return
+		}
+		var disallowed, paths []string
+		for _, f := range set {
+			if slices.Contains(c2nUnsettablePrefs, f) {
+				disallowed = append(disallowed, f)
+				if p, ok := c2nPrefsPaths[f]; ok && !slices.Contains(paths, p) {
+					paths = append(paths, p)
+				}
+			}
+		}
+		if len(disallowed) > 0 {
+			msg := "prefs not settable by c2n: " + strings.Join(disallowed, ", ")
+			if len(paths) > 0 {
+				msg += "; use " + strings.Join(paths, ", ") + " instead"
+			}
+			writeJSONStatus(w, http.StatusForbidden, c2nPrefsPatchError{
+				Error:      msg,
+				Disallowed: disallowed,
+			})
+			return
+		}
+		b.logf("c2n: patching prefs: %v", mp.Pretty())
+		if _, err := b.EditPrefs(mp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := filterPrefs(b.Prefs(), nil, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// maskedPrefsFields returns the Go names of the ipn.Prefs fields that mp sets.
+func maskedPrefsFields(mp *ipn.MaskedPrefs) []string {
+	var ret []string
+	mv := reflect.ValueOf(mp).Elem()
+	mt := mv.Type()
+	for i := 1; i < mt.NumField(); i++ { // field 0 is the embedded Prefs
+		if mv.Field(i).Bool() {
+			ret = append(ret, strings.TrimSuffix(mt.Field(i).Name, "Set"))
+		}
+	}
+	return ret
+}
+
+// c2nShieldsUpResponse is the result of c2n /prefs/shieldsup.
+type c2nShieldsUpResponse struct {
+	ShieldsUp bool
+
+	// Changed is whether a POST changed ShieldsUp. It's false if it already
+	// had the requested value.
+	Changed bool `json:",omitempty"`
+
+	// Inbound summarizes which inbound connections the packet filter
+	// allows as a result.
+	Inbound string
+}
+
+// handleC2NPrefsShieldsUp reports whether the node has shields up and, on
+// POST, sets it to the "shieldsup" param via EditPrefs, like the CLI, so that
+// the packet filter is updated.
+func (b *LocalBackend) handleC2NPrefsShieldsUp(w http.ResponseWriter, r *http.Request) {
+	var res c2nShieldsUpResponse
+	if r.Method == "POST" {
+		want, err := strconv.ParseBool(r.FormValue("shieldsup"))
+		if err != nil {
+			http.Error(w, "invalid 'shieldsup' parameter", http.StatusBadRequest)
+			return
+		}
+		was := b.Prefs().ShieldsUp()
+		p, err := b.EditPrefs(&ipn.MaskedPrefs{
+			Prefs:        ipn.Prefs{ShieldsUp: want},
+			ShieldsUpSet: true,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res.Changed = p.ShieldsUp() != was
+		if res.Changed {
+			b.logf("c2n: set ShieldsUp to %v", p.ShieldsUp())
+		}
+	}
+
+	p := b.Prefs()
+	res.ShieldsUp = !p.Valid() || p.ShieldsUp()
+	nm := b.NetMap()
+	switch {
+	case res.ShieldsUp:
+		res.Inbound = "none: shields up"
+	case nm == nil:
+		res.Inbound = "none: no netmap yet"
+	default:
+		res.Inbound = fmt.Sprintf("as allowed by the tailnet policy: %d packet filter rules", len(nm.PacketFilter))
+	}
+	writeJSON(w, res)
+}
+
+// c2nRoutesResponse is the result of c2n /prefs/routes.
+type c2nRoutesResponse struct {
+	// Advertised are the routes the node advertises, including the
+	// default routes if it offers to be an exit node.
+	Advertised []netip.Prefix
+
+	// Active are the Advertised routes that control has approved, and
+	// Unapproved those it hasn't (or all of them, with no netmap yet).
+	Active     []netip.Prefix
+	Unapproved []netip.Prefix
+
+	// Changed is whether a POST changed Advertised.
+	Changed bool `json:",omitempty"`
+}
+
+// handleC2NPrefsRoutes reports the routes the node advertises and, on POST,
+// replaces them with the "routes" param, a comma-separated list of CIDR
+// prefixes like the CLI's --advertise-routes, via EditPrefs so that they're
+// re-advertised. An empty list stops advertising any. Whether the node
+// offers to be an exit node is left as it is.
+func (b *LocalBackend) handleC2NPrefsRoutes(w http.ResponseWriter, r *http.Request) {
+	var res c2nRoutesResponse
+	if r.Method == "POST" {
+		was := b.Prefs().AdvertiseRoutes()
+		exitNode := tsaddr.ContainsExitRoutes(was)
+		routes, err := parseC2NRoutes(r.FormValue("routes"), exitNode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, err := b.EditPrefs(&ipn.MaskedPrefs{
+			Prefs:              ipn.Prefs{AdvertiseRoutes: routes},
+			AdvertiseRoutesSet: true,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res.Changed = !views.SliceEqualAnyOrder(p.AdvertiseRoutes(), was)
+		if res.Changed {
+			b.logf("c2n: set advertised routes to %v", p.AdvertiseRoutes().AsSlice())
+		}
+	}
+
+	if p := b.Prefs(); p.Valid() {
+		res.Advertised = p.AdvertiseRoutes().AsSlice()
+	}
+	nm := b.NetMap()
+	for _, p := range res.Advertised {
+		if nm != nil && nm.SelfNode.Valid() && views.SliceContains(nm.SelfNode.AllowedIPs(), p) {
+			res.Active = append(res.Active, p)
+		} else {
+			res.Unapproved = append(res.Unapproved, p)
+		}
+	}
+	writeJSON(w, res)
+}
+
+// parseC2NRoutes parses the comma-separated routes for c2n /prefs/routes,
+// returning them along with the default routes if exitNode is set. The
+// routes may not include the default routes themselves, nor overlap each
+// other.
+func parseC2NRoutes(s string, exitNode bool) ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid CIDR prefix", v)
+		}
+		if p.Bits() == 0 {
+			return nil, fmt.Errorf("%v is an exit node route, which /prefs/routes doesn't change", p)
+		}
+		for _, q := range routes {
+			if p.Overlaps(q) {
+				return nil, fmt.Errorf("routes %v and %v overlap", q, p)
+			}
+		}
+		routes = append(routes, p)
+	}
+	strs := make([]string, len(routes))
+	for i, p := range routes {
+		strs[i] = p.String()
+	}
+	// For the CLI's other checks, such as of non-address bits and 4via6
+	// site IDs, and its ordering.
+	return netutil.CalcAdvertiseRoutes(strings.Join(strs, ","), exitNode)
+}
@@ -0,0 +1,338 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/maps"
+	"tailscale.com/envknob"
+	"tailscale.com/hostinfo"
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/persist"
+	"tailscale.com/wgengine/filter"
+)
+
+func TestFilterPrefs(t *testing.T) {
+	p := &ipn.Prefs{
+		ExitNodeID: "n123",
+		RouteAll:   true,
+		Persist:    &persist.Persist{UserProfile: tailcfg.UserProfile{LoginName: "someone@example.com"}},
+	}
+	pv := p.View()
+
+	keys := func(fields []string, unredacted bool) []string {
+		t.Helper()
+		m, err := filterPrefs(pv, fields, unredacted)
+		if err != nil {
+			t.Fatalf("filterPrefs(%q, %v): %v", fields, unredacted, err)
+		}
+		ks := maps.Keys(m)
+		slices.Sort(ks)
+		return ks
+	}
+
+	all := keys(nil, false)
+	if slices.Contains(all, "Config") {
+		t.Errorf("default output includes Config: %q", all)
+	}
+	if !slices.Contains(all, "ExitNodeID") || !slices.Contains(all, "ShieldsUp") {
+		t.Errorf("default output = %q; want all unredacted prefs", all)
+	}
+	if got := keys(nil, true); !slices.Contains(got, "Config") {
+		t.Errorf("unredacted output = %q; want Config", got)
+	}
+
+	// OperatorUser is omitted from the JSON when empty, but still valid.
+	if got, want := keys([]string{"ExitNodeID", " RouteAll", "OperatorUser"}, false), []string{"ExitNodeID", "RouteAll"}; !slices.Equal(got, want) {
+		t.Errorf("selected fields = %q; want %q", got, want)
+	}
+	if got := keys([]string{"Config"}, true); !slices.Equal(got, []string{"Config"}) {
+		t.Errorf("unredacted Config = %q", got)
+	}
+
+	for _, fields := range [][]string{{"Config"}, {"Bogus"}, {"Persist"}} {
+		if _, err := filterPrefs(pv, fields, false); err == nil {
+			t.Errorf("filterPrefs(%q) succeeded; want error", fields)
+		}
+	}
+}
+
+func TestHandleC2NPrefsShieldsUp(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	b.netMap = &netmap.NetworkMap{PacketFilter: make([]filter.Match, 3)}
+
+	do := func(method, query string, wantCode int) (res c2nShieldsUpResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/prefs/shieldsup?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+
+	want := c2nShieldsUpResponse{Inbound: "as allowed by the tailnet policy: 3 packet filter rules"}
+	if got := do("GET", "", http.StatusOK); got != want {
+		t.Errorf("initially: got %+v; want %+v", got, want)
+	}
+	do("POST", "shieldsup=maybe", http.StatusBadRequest)
+
+	want = c2nShieldsUpResponse{ShieldsUp: true, Changed: true, Inbound: "none: shields up"}
+	if got := do("POST", "shieldsup=true", http.StatusOK); got != want {
+		t.Errorf("raise: got %+v; want %+v", got, want)
+	}
+	if !b.Prefs().ShieldsUp() {
+		t.Error("prefs don't have ShieldsUp set")
+	}
+	want.Changed = false
+	if got := do("POST", "shieldsup=true", http.StatusOK); got != want {
+		t.Errorf("raise again: got %+v; want %+v", got, want)
+	}
+
+	want = c2nShieldsUpResponse{Changed: true, Inbound: "as allowed by the tailnet policy: 3 packet filter rules"}
+	if got := do("POST", "shieldsup=false", http.StatusOK); got != want {
+		t.Errorf("lower: got %+v; want %+v", got, want)
+	}
+}
+
+func TestHandleC2NPrefsRoutes(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	b.netMap = &netmap.NetworkMap{SelfNode: (&tailcfg.Node{
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32"), netip.MustParsePrefix("10.0.0.0/24")},
+	}).View()}
+
+	do := func(method, query string, wantCode int) (res c2nRoutesResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/prefs/routes?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	pfxs := func(s ...string) []netip.Prefix {
+		var ret []netip.Prefix
+		for _, v := range s {
+			ret = append(ret, netip.MustParsePrefix(v))
+		}
+		return ret
+	}
+
+	if got := do("GET", "", http.StatusOK); !reflect.DeepEqual(got, c2nRoutesResponse{}) {
+		t.Errorf("initially: got %+v; want none", got)
+	}
+
+	for _, routes := range []string{
+		"10.0.0.0",                           // not a CIDR
+		"10.0.0.1/24",                        // non-address bits
+		"10.0.0.0/24,10.0.0.0/16",            // overlapping
+		"10.0.0.0/24,10.0.0.0/24",            // duplicate
+		"0.0.0.0/0,::/0",                     // exit node routes
+		"fd7a:115c:a1e0:b1a:0:1ff:a00:0/120", // bad 4via6 site ID
+	} {
+		do("POST", "routes="+url.QueryEscape(routes), http.StatusBadRequest)
+	}
+	if got := b.Prefs().AdvertiseRoutes().Len(); got != 0 {
+		t.Fatalf("rejected routes were applied: %d routes", got)
+	}
+
+	want := c2nRoutesResponse{
+		Advertised: pfxs("192.168.0.0/16", "10.0.0.0/24"),
+		Active:     pfxs("10.0.0.0/24"),
+		Unapproved: pfxs("192.168.0.0/16"),
+		Changed:    true,
+	}
+	if got := do("POST", "routes="+url.QueryEscape("10.0.0.0/24, 192.168.0.0/16"), http.StatusOK); !reflect.DeepEqual(got, want) {
+		t.Errorf("set: got %+v; want %+v", got, want)
+	}
+	want.Changed = false
+	if got := do("GET", "", http.StatusOK); !reflect.DeepEqual(got, want) {
+		t.Errorf("after set: got %+v; want %+v", got, want)
+	}
+
+	// Offering to be an exit node survives replacing the routes.
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:              ipn.Prefs{AdvertiseRoutes: pfxs("0.0.0.0/0", "::/0", "10.0.0.0/24")},
+		AdvertiseRoutesSet: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = c2nRoutesResponse{
+		Advertised: pfxs("0.0.0.0/0", "::/0"),
+		Unapproved: pfxs("0.0.0.0/0", "::/0"),
+		Changed:    true,
+	}
+	if got := do("POST", "routes=", http.StatusOK); !reflect.DeepEqual(got, want) {
+		t.Errorf("clear: got %+v; want %+v", got, want)
+	}
+}
+
+func TestHandleC2NPrefs(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	do := func(method, body string, wantCode int) (res map[string]json.RawMessage, raw []byte) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/prefs", strings.NewReader(body)))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, body, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res, rec.Body.Bytes()
+	}
+
+	res, _ := do("GET", "", http.StatusOK)
+	if _, ok := res["Config"]; ok {
+		t.Errorf("GET includes the redacted Config: %s", res["Config"])
+	}
+	do("POST", "", http.StatusMethodNotAllowed)
+
+	for _, body := range []string{
+		`{`,                  // malformed
+		`{"ShieldsUp":true}`, // no mask
+		`{"ShieldsUpSet":1}`, // wrong type
+		`{"BogusSet":true}`,  // unknown field
+	} {
+		do("PATCH", body, http.StatusBadRequest)
+	}
+
+	_, raw := do("PATCH", `{"ControlURL":"https://evil.example","ControlURLSet":true,"WantRunning":false,"WantRunningSet":true,"ShieldsUp":true,"ShieldsUpSet":true}`, http.StatusForbidden)
+	var perr c2nPrefsPatchError
+	if err := json.Unmarshal(raw, &perr); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ControlURL", "WantRunning"}; !reflect.DeepEqual(perr.Disallowed, want) {
+		t.Errorf("disallowed = %q; want %q", perr.Disallowed, want)
+	}
+	if b.Prefs().ShieldsUp() || b.Prefs().ControlURL() == "https://evil.example" {
+		t.Fatal("refused patch was applied")
+	}
+
+	// Enabling the SSH server admits SSH connections that the node hasn't
+	// itself opted in to, so it's only done locally. Routes and exit nodes
+	// go through /prefs/routes and /prefs/exitnode instead, for their
+	// checks.
+	for _, tt := range []struct {
+		body    string
+		want    []string
+		wantErr string
+	}{
+		{`{"RunSSH":true,"RunSSHSet":true}`, []string{"RunSSH"}, "prefs not settable by c2n: RunSSH"},
+		{`{"AdvertiseRoutes":["0.0.0.0/0","::/0"],"AdvertiseRoutesSet":true}`, []string{"AdvertiseRoutes"}, "prefs not settable by c2n: AdvertiseRoutes; use /prefs/routes instead"},
+		{`{"NetfilterMode":0,"NetfilterModeSet":true,"CorpDNS":false,"CorpDNSSet":true}`, []string{"NetfilterMode"}, "prefs not settable by c2n: NetfilterMode"},
+		{`{"ExitNodeID":"nExit","ExitNodeIDSet":true}`, []string{"ExitNodeID"}, "prefs not settable by c2n: ExitNodeID; use /prefs/exitnode instead"},
+		{`{"ExitNodeIP":"100.64.0.1","ExitNodeIPSet":true,"ExitNodeID":"","ExitNodeIDSet":true}`, []string{"ExitNodeID", "ExitNodeIP"}, "prefs not settable by c2n: ExitNodeID, ExitNodeIP; use /prefs/exitnode instead"},
+	} {
+		_, raw := do("PATCH", tt.body, http.StatusForbidden)
+		var perr c2nPrefsPatchError
+		if err := json.Unmarshal(raw, &perr); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(perr.Disallowed, tt.want) {
+			t.Errorf("%s: disallowed = %q; want %q", tt.body, perr.Disallowed, tt.want)
+		}
+		if perr.Error != tt.wantErr {
+			t.Errorf("%s: error = %q; want %q", tt.body, perr.Error, tt.wantErr)
+		}
+	}
+	if p := b.Prefs(); p.RunSSH() || p.AdvertiseRoutes().Len() != 0 || !p.CorpDNS() || p.ExitNodeID() != "" || p.ExitNodeIP().IsValid() {
+		t.Fatalf("refused patch was applied: %v", p.Pretty())
+	}
+
+	// A patch that fails the prefs check changes nothing.
+	do("PATCH", `{"ShieldsUp":true,"ShieldsUpSet":true,"Hostname":"badhostname.tailscale.","HostnameSet":true}`, http.StatusBadRequest)
+	if p := b.Prefs(); p.ShieldsUp() || p.Hostname() != "" {
+		t.Fatalf("invalid patch was partly applied: %v", p.Pretty())
+	}
+
+	res, _ = do("PATCH", `{"ShieldsUp":true,"ShieldsUpSet":true,"Hostname":"foo","HostnameSet":true,"RouteAll":false}`, http.StatusOK)
+	if p := b.Prefs(); !p.ShieldsUp() || p.Hostname() != "foo" || !p.RouteAll() {
+		t.Errorf("after patch, prefs = %v; want only the masked fields changed", p.Pretty())
+	}
+	if string(res["ShieldsUp"]) != "true" || string(res["Hostname"]) != `"foo"` {
+		t.Errorf("PATCH returned %v", res)
+	}
+
+	if do("PATCH", `{"CorpDNS":false,"CorpDNSSet":true}`, http.StatusOK); b.Prefs().CorpDNS() {
+		t.Error("CorpDNS wasn't changed")
+	}
+}
+
+func TestHandleC2NPrefsOSVersion(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	osVersion := hostinfo.GetOSVersion()
+	b.hostinfo.OSVersion = osVersion
+
+	type response struct {
+		OSVersion  string
+		Real       string
+		Overridden bool
+	}
+	do := func(method, query string, wantCode int) (res response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/prefs/os-version?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+
+	if got, want := do("GET", "", http.StatusOK), (response{OSVersion: osVersion, Real: osVersion}); got != want {
+		t.Errorf("initially: got %+v; want %+v", got, want)
+	}
+
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "")
+	do("POST", "version=1.2.3", http.StatusForbidden)
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	if got := b.hostinfo.OSVersion; got != osVersion {
+		t.Fatalf("refused override was applied: OSVersion = %q", got)
+	}
+
+	if got, want := do("POST", "version=1.2.3", http.StatusOK), (response{OSVersion: "1.2.3", Real: osVersion, Overridden: true}); got != want {
+		t.Errorf("override: got %+v; want %+v", got, want)
+	}
+	if got := b.hostinfo.OSVersion; got != "1.2.3" {
+		t.Errorf("after override, Hostinfo.OSVersion = %q; want 1.2.3", got)
+	}
+	if got, want := do("GET", "", http.StatusOK), (response{OSVersion: "1.2.3", Real: osVersion, Overridden: true}); got != want {
+		t.Errorf("after override: got %+v; want %+v", got, want)
+	}
+
+	if got, want := do("POST", "version=", http.StatusOK), (response{OSVersion: osVersion, Real: osVersion}); got != want {
+		t.Errorf("remove override: got %+v; want %+v", got, want)
+	}
+	if got := b.hostinfo.OSVersion; got != osVersion {
+		t.Errorf("after removing override, Hostinfo.OSVersion = %q; want %q", got, osVersion)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstime/rate"
+)
+
+// c2nExpensivePaths are the c2n paths that are costly for the whole process
+// to answer, and so are rate limited to one request per
+// c2nExpensiveInterval each.
+var c2nExpensivePaths = map[string]bool{
+	"/debug/goroutines": true,
+	"/debug/logheap":    true,
+	"/debug/cpuprofile": true,
+	"/debug/derp/test":  true,
+	"/echo/stream":      true,
+}
+
+// c2nExpensiveDefaultInterval is the default minimum interval between
+// requests to each of c2nExpensivePaths.
+const c2nExpensiveDefaultInterval = 10 * time.Second
+
+// debugC2NExpensiveInterval overrides c2nExpensiveDefaultInterval if
+// positive. If negative, the expensive paths aren't rate limited.
+var debugC2NExpensiveInterval = envknob.RegisterDuration("TS_DEBUG_C2N_EXPENSIVE_INTERVAL")
+
+// c2nLimiter is the rate limiter for one of c2nExpensivePaths.
+type c2nLimiter struct {
+	interval time.Duration // that lim was made for
+	lim      *rate.Limiter
+}
+
+// c2nExpensiveInterval returns the minimum interval between requests to each
+// of c2nExpensivePaths, or zero if they're not limited.
+func c2nExpensiveInterval() time.Duration {
+	switch d := debugC2NExpensiveInterval(); {
+	case d < 0:
+		return 0
+	case d > 0:
+		return d
+	}
+	return c2nExpensiveDefaultInterval
+}
+
+// allowC2NRequest reports whether a c2n request to path may be handled now.
+// If not, it writes a 429 response to w.
+func (b *LocalBackend) allowC2NRequest(w http.ResponseWriter, path string) bool {
+	if !c2nExpensivePaths[path] {
+		return true
+	}
+	interval := c2nExpensiveInterval()
+	if interval == 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	l, ok := b.c2nLimiters[path]
+	if !ok || l.interval != interval {
+		l = c2nLimiter{interval, rate.NewLimiter(rate.Every(interval), 1)}
+		if b.c2nLimiters == nil {
+			b.c2nLimiters = map[string]c2nLimiter{}
+		}
+		b.c2nLimiters[path] = l
+	}
+	b.mu.Unlock()
+
+	if l.lim.Allow() {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(interval.Seconds()))))
+	http.Error(w, "too many requests to "+path, http.StatusTooManyRequests)
+	return false
+}
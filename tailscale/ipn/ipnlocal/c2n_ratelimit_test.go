@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstime"
+)
+
+// setC2NExpensiveInterval sets TS_DEBUG_C2N_EXPENSIVE_INTERVAL for the
+// duration of the test. "-1s" disables the rate limit.
+func setC2NExpensiveInterval(t *testing.T, v string) {
+	envknob.Setenv("TS_DEBUG_C2N_EXPENSIVE_INTERVAL", v)
+	t.Cleanup(func() { envknob.Setenv("TS_DEBUG_C2N_EXPENSIVE_INTERVAL", "") })
+}
+
+func TestHandleC2NRateLimit(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	if rec := get("/debug/goroutines"); rec.Code != http.StatusOK {
+		t.Fatalf("first call: status = %d; want 200", rec.Code)
+	}
+	rec := get("/debug/goroutines")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second call: status = %d; want 429", rec.Code)
+	}
+	if got, want := rec.Header().Get("Retry-After"), "10"; got != want {
+		t.Errorf("Retry-After = %q; want %q", got, want)
+	}
+
+	// Cheap paths aren't limited.
+	for i := 0; i < 5; i++ {
+		if rec := get("/echo"); rec.Code != http.StatusOK {
+			t.Fatalf("/echo call %d: status = %d; want 200", i, rec.Code)
+		}
+	}
+
+	// The limit can be changed, or disabled.
+	setC2NExpensiveInterval(t, "1h")
+	if rec := get("/debug/goroutines"); rec.Code != http.StatusOK {
+		t.Fatalf("after new interval: status = %d; want 200", rec.Code)
+	}
+	if rec := get("/debug/goroutines"); rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Retry-After = %q; want 3600", rec.Header().Get("Retry-After"))
+	}
+	setC2NExpensiveInterval(t, "-1s")
+	for i := 0; i < 3; i++ {
+		if rec := get("/debug/goroutines"); rec.Code != http.StatusOK {
+			t.Fatalf("with limit disabled: status = %d; want 200", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"tailscale.com/control/controlhttp"
+	"tailscale.com/logpolicy"
+	"tailscale.com/net/tlsdial"
+	"tailscale.com/net/tshttpproxy"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// c2nReachabilityTimeout bounds each probe made by /debug/control-reachability.
+const c2nReachabilityTimeout = 10 * time.Second
+
+// c2nNewLogtailTransport is logpolicy.NewLogtailTransport. It's a var for
+// tests, where that returns a transport that doesn't connect.
+var c2nNewLogtailTransport = logpolicy.NewLogtailTransport
+
+// c2nReachability is the result of probing a single control-related
+// endpoint.
+type c2nReachability struct {
+	Addr    string        // what was probed
+	OK      bool          // whether it was reachable
+	Latency time.Duration `json:",omitempty"` // time to a successful response or handshake
+	Error   string        `json:",omitempty"` // why it wasn't reachable
+}
+
+// handleC2NDebugControlReachability independently probes the control
+// server's HTTPS endpoint, its Noise endpoint, and each DERP region, so that
+// it's possible to tell which of them a node can't reach.
+func (b *LocalBackend) handleC2NDebugControlReachability(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	serverURL := b.Prefs().ControlURLOrDefault()
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := make(map[string]c2nReachability)
+	var mu sync.Mutex
+	set := func(name string, v c2nReachability) {
+		mu.Lock()
+		defer mu.Unlock()
+		res[name] = v
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// The Noise handshake needs the control server's key, which
+		// comes from the HTTPS probe.
+		controlKey, v := b.probeControlHTTPS(ctx, serverURL)
+		set("https", v)
+		set("noise", b.probeControlNoise(ctx, u, controlKey))
+	}()
+	if dm := b.DERPMap(); dm != nil {
+		for _, rid := range dm.RegionIDs() {
+			region := dm.Regions[rid]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				set(fmt.Sprintf("derp-%d", region.RegionID), b.probeDERPRegion(ctx, region))
+			}()
+		}
+	}
+	wg.Wait()
+
+	writeJSON(w, res)
+}
+
+// handleC2NDebugLogReachability probes the logtail server that logs are
+// uploaded to, the same way as the log uploader connects to it.
+func (b *LocalBackend) handleC2NDebugLogReachability(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), c2nReachabilityTimeout)
+	defer cancel()
+
+	logURL := logpolicy.LogURL()
+	res := c2nReachability{Addr: logURL}
+	u, err := url.Parse(logURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tr := c2nNewLogtailTransport(u.Hostname(), b.sys.NetMon.Get(), b.logf)
+	if t, ok := tr.(*http.Transport); ok {
+		defer t.CloseIdleConnections()
+	}
+	req, err := http.NewRequestWithContext(ctx, "HEAD", logURL+"/", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Any HTTP response at all means that the server's reachable and
+	// its certificate is valid.
+	start := b.clock.Now()
+	if hres, err := tr.RoundTrip(req); err != nil {
+		res.Error = err.Error()
+	} else {
+		hres.Body.Close()
+		res.OK = true
+		res.Latency = b.clock.Since(start)
+	}
+	writeJSON(w, res)
+}
+
+// probeControlHTTPS fetches the control server's public key over HTTPS.
+func (b *LocalBackend) probeControlHTTPS(ctx context.Context, serverURL string) (controlKey key.MachinePublic, res c2nReachability) {
+	ctx, cancel := context.WithTimeout(ctx, c2nReachabilityTimeout)
+	defer cancel()
+
+	keyURL := fmt.Sprintf("%v/key?v=%d", serverURL, tailcfg.CurrentCapabilityVersion)
+	res.Addr = keyURL
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = tshttpproxy.ProxyFromEnvironment
+	tr.DialContext = b.dialer.SystemDial
+	if u, err := url.Parse(serverURL); err == nil {
+		tr.TLSClientConfig = tlsdial.Config(u.Hostname(), tr.TLSClientConfig)
+	}
+	defer tr.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", keyURL, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return controlKey, res
+	}
+	start := b.clock.Now()
+	hres, err := tr.RoundTrip(req)
+	if err != nil {
+		res.Error = err.Error()
+		return controlKey, res
+	}
+	defer hres.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(hres.Body, 64<<10))
+	if err != nil {
+		res.Error = err.Error()
+		return controlKey, res
+	}
+	if hres.StatusCode != 200 {
+		res.Error = hres.Status
+		return controlKey, res
+	}
+	res.OK = true
+	res.Latency = b.clock.Since(start)
+
+	var keys tailcfg.OverTLSPublicKeyResponse
+	if err := json.Unmarshal(body, &keys); err == nil {
+		controlKey = keys.PublicKey
+	}
+	return controlKey, res
+}
+
+// probeControlNoise performs a Noise handshake with the control server.
+func (b *LocalBackend) probeControlNoise(ctx context.Context, u *url.URL, controlKey key.MachinePublic) (res c2nReachability) {
+	res.Addr = u.Host
+	b.mu.Lock()
+	machineKey := b.machinePrivKey
+	b.mu.Unlock()
+	switch {
+	case controlKey.IsZero():
+		res.Error = "skipped: control server key unavailable"
+		return res
+	case machineKey.IsZero():
+		res.Error = "skipped: no machine key"
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c2nReachabilityTimeout)
+	defer cancel()
+	httpPort, httpsPort := "80", "443"
+	if port := u.Port(); port != "" {
+		if u.Scheme == "http" {
+			httpPort = port
+		} else {
+			httpsPort = port
+		}
+	}
+	start := b.clock.Now()
+	cc, err := (&controlhttp.Dialer{
+		Hostname:        u.Hostname(),
+		HTTPPort:        httpPort,
+		HTTPSPort:       httpsPort,
+		MachineKey:      machineKey,
+		ControlKey:      controlKey,
+		ProtocolVersion: uint16(tailcfg.CurrentCapabilityVersion),
+		Dialer:          b.dialer.SystemDial,
+		Logf:            b.logf,
+		NetMon:          b.sys.NetMon.Get(),
+		Clock:           b.clock,
+	}).Dial(ctx)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	cc.Close()
+	res.OK = true
+	res.Latency = b.clock.Since(start)
+	return res
+}
+
+// probeDERPRegion makes a TLS connection to the first DERP node in region.
+func (b *LocalBackend) probeDERPRegion(ctx context.Context, region *tailcfg.DERPRegion) (res c2nReachability) {
+	var node *tailcfg.DERPNode
+	for _, n := range region.Nodes {
+		if !n.STUNOnly {
+			node = n
+			break
+		}
+	}
+	if node == nil {
+		res.Error = "no DERP nodes in region"
+		return res
+	}
+	host := node.HostName
+	if node.IPv4 != "" && node.IPv4 != "none" {
+		host = node.IPv4
+	}
+	port := 443
+	if node.DERPPort != 0 {
+		port = node.DERPPort
+	}
+	res.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+
+	ctx, cancel := context.WithTimeout(ctx, c2nReachabilityTimeout)
+	defer cancel()
+	start := b.clock.Now()
+	c, err := b.dialer.SystemDial(ctx, "tcp", res.Addr)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer c.Close()
+	tlsConf := tlsdial.Config(node.HostName, nil)
+	if node.CertName != "" {
+		tlsdial.SetConfigExpectedCert(tlsConf, node.CertName)
+	}
+	if node.InsecureForTests {
+		tlsConf.InsecureSkipVerify = true
+		tlsConf.VerifyConnection = nil
+	}
+	tc := tls.Client(c, tlsConf)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("TLS handshake timed out: %w", err)
+		}
+		res.Error = err.Error()
+		return res
+	}
+	res.OK = true
+	res.Latency = b.clock.Since(start)
+	return res
+}
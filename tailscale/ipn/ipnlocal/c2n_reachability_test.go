@@ -0,0 +1,171 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/logpolicy"
+	"tailscale.com/net/netmon"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
+)
+
+func TestHandleC2NDebugControlReachability(t *testing.T) {
+	derp := httptest.NewTLSServer(http.NotFoundHandler())
+	defer derp.Close()
+	_, port, _ := net.SplitHostPort(derp.Listener.Addr().String())
+	derpPort, _ := strconv.Atoi(port)
+	dm := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+		1: {RegionID: 1, Nodes: []*tailcfg.DERPNode{
+			{Name: "1a", RegionID: 1, HostName: "derp.test", IPv4: "127.0.0.1", DERPPort: derpPort, InsecureForTests: true},
+		}},
+		2: {RegionID: 2, Nodes: []*tailcfg.DERPNode{
+			{Name: "2a", RegionID: 2, HostName: "stun.test", STUNOnly: true},
+		}},
+	}}
+	controlKey := key.NewMachine().Public()
+
+	tests := []struct {
+		name    string
+		control http.HandlerFunc
+		want    map[string]c2nReachability // with only OK and Error checked
+	}{
+		{
+			name: "up",
+			control: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(tailcfg.OverTLSPublicKeyResponse{PublicKey: controlKey})
+			},
+			want: map[string]c2nReachability{
+				"https":  {OK: true},
+				"derp-1": {OK: true},
+				"derp-2": {Error: "no DERP nodes in region"},
+			},
+		},
+		{
+			name: "control error",
+			control: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "oops", http.StatusInternalServerError)
+			},
+			want: map[string]c2nReachability{
+				"https":  {Error: "500 Internal Server Error"},
+				"noise":  {Error: "skipped: control server key unavailable"},
+				"derp-1": {OK: true},
+				"derp-2": {Error: "no DERP nodes in region"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			control := httptest.NewServer(tt.control)
+			defer control.Close()
+			b := newC2NPrefsTestBackend(t)
+			b.netMap = &netmap.NetworkMap{DERPMap: dm}
+			if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+				Prefs:         ipn.Prefs{ControlURL: control.URL},
+				ControlURLSet: true,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			b.handleC2N(rec, httptest.NewRequest("GET", "/debug/control-reachability", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+			}
+			var res map[string]c2nReachability
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != 4 {
+				t.Errorf("probed %d endpoints; want https, noise and 2 DERP regions: %+v", len(res), res)
+			}
+			if got := res["https"].Addr; !strings.HasPrefix(got, control.URL+"/key?v=") {
+				t.Errorf("https probed %q; want %s/key", got, control.URL)
+			}
+			// The test backend has no machine key, so it can't try Noise.
+			if res["noise"].OK {
+				t.Errorf("noise = %+v; want not OK", res["noise"])
+			}
+			for name, want := range tt.want {
+				if got := res[name]; got.OK != want.OK || got.Error != want.Error {
+					t.Errorf("%s = %+v; want OK %v, error %q", name, got, want.OK, want.Error)
+				}
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestHandleC2NDebugLogReachability(t *testing.T) {
+	tests := []struct {
+		name      string
+		roundTrip roundTripFunc
+		want      c2nReachability // with only OK and Error checked
+	}{
+		{
+			name: "up",
+			roundTrip: func(r *http.Request) (*http.Response, error) {
+				// Any response will do, even an error.
+				return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+			},
+			want: c2nReachability{OK: true},
+		},
+		{
+			name: "down",
+			roundTrip: func(r *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+			want: c2nReachability{Error: "connection refused"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotReq *http.Request
+			tstest.Replace(t, &c2nNewLogtailTransport, func(host string, _ *netmon.Monitor, _ logger.Logf) http.RoundTripper {
+				if u, _ := url.Parse(logpolicy.LogURL()); host != u.Hostname() {
+					t.Errorf("transport for %q; want %q", host, u.Hostname())
+				}
+				return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					gotReq = r
+					return tt.roundTrip(r)
+				})
+			})
+			b := newC2NPrefsTestBackend(t)
+			rec := httptest.NewRecorder()
+			b.handleC2N(rec, httptest.NewRequest("GET", "/debug/log-reachability", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+			}
+			var res c2nReachability
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.OK != tt.want.OK || res.Error != tt.want.Error {
+				t.Errorf("got %+v; want OK %v, error %q", res, tt.want.OK, tt.want.Error)
+			}
+			if res.Addr != logpolicy.LogURL() {
+				t.Errorf("probed %q; want %q", res.Addr, logpolicy.LogURL())
+			}
+			if gotReq == nil || gotReq.Method != "HEAD" {
+				t.Errorf("request = %v; want a HEAD", gotReq)
+			}
+		})
+	}
+}
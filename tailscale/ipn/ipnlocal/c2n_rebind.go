@@ -0,0 +1,91 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"tailscale.com/wgengine/magicsock"
+)
+
+// c2nRebindCoalesceTime is how recently a c2n /debug/rebind must have
+// finished for another to reuse its result instead of rebinding again.
+const c2nRebindCoalesceTime = 5 * time.Second
+
+// c2nRebindResult is the response to c2n /debug/rebind.
+type c2nRebindResult struct {
+	At time.Time // when the rebind finished
+
+	// LocalPort4 and LocalPort6 are the ports of magicsock's UDP sockets
+	// after the rebind, or zero for one that couldn't be bound.
+	LocalPort4 uint16
+	LocalPort6 uint16
+
+	// Netcheck is the netcheck run after the rebind.
+	Netcheck magicsock.NetcheckReport
+
+	// Coalesced is whether this is the result of a rebind that had just
+	// finished when the request arrived, rather than one it caused.
+	Coalesced bool `json:",omitempty"`
+
+	Error string `json:",omitempty"`
+}
+
+// c2nRebinder is the part of *magicsock.Conn that c2n /debug/rebind uses.
+type c2nRebinder interface {
+	Rebind()
+	LocalPorts() (v4, v6 uint16)
+	RunNetcheck(context.Context) (magicsock.NetcheckReport, error)
+}
+
+// c2nGetRebinder returns the magicsock.Conn. It's a var for tests.
+var c2nGetRebinder = func(b *LocalBackend) (c2nRebinder, error) {
+	mc, err := b.magicConn()
+	if err != nil {
+		return nil, err
+	}
+	return mc, nil
+}
+
+// handleC2NDebugRebind closes and re-binds magicsock's UDP sockets and then
+// re-STUNs, as on a major link change, and returns the new local ports and
+// the resulting netcheck. The sockets keep their ports if they can, so
+// WireGuard sessions survive; only DERP connections over addresses that are
+// gone are closed. Requests that arrive while a rebind is running, or just
+// after it finished, get its result instead of rebinding again.
+func (b *LocalBackend) handleC2NDebugRebind(w http.ResponseWriter, r *http.Request) {
+	mc, err := c2nGetRebinder(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b.c2nRebindMu.Lock()
+	defer b.c2nRebindMu.Unlock()
+	if last := b.c2nLastRebind; last != nil && b.clock.Since(last.At) < c2nRebindCoalesceTime {
+		res := *last
+		res.Coalesced = true
+		writeJSON(w, res)
+		return
+	}
+
+	b.logf("c2n: rebinding magicsock")
+	mc.Rebind()
+	var res c2nRebindResult
+	res.LocalPort4, res.LocalPort6 = mc.LocalPorts()
+	if res.LocalPort4 == 0 {
+		res.Error = "failed to bind the IPv4 UDP socket"
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), netcheckTimeout)
+	defer cancel()
+	res.Netcheck, err = mc.RunNetcheck(ctx)
+	if err != nil && res.Error == "" {
+		res.Error = "netcheck: " + err.Error()
+	}
+	res.At = b.clock.Now()
+	b.c2nLastRebind = &res
+	writeJSON(w, res)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstest"
+	"tailscale.com/wgengine/magicsock"
+)
+
+// fakeRebinder is a c2nRebinder that counts rebinds.
+type fakeRebinder struct {
+	clock      *tstest.Clock
+	rebinds    int
+	port4      uint16
+	port6      uint16
+	netcheckAt time.Time
+}
+
+func (m *fakeRebinder) Rebind() {
+	m.rebinds++
+	m.port6++
+}
+
+func (m *fakeRebinder) LocalPorts() (v4, v6 uint16) { return m.port4, m.port6 }
+
+func (m *fakeRebinder) RunNetcheck(context.Context) (magicsock.NetcheckReport, error) {
+	m.netcheckAt = m.clock.Now()
+	return magicsock.NetcheckReport{At: m.netcheckAt}, nil
+}
+
+func TestHandleC2NDebugRebind(t *testing.T) {
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b := &LocalBackend{logf: t.Logf, clock: clock}
+	mc := &fakeRebinder{clock: clock, port4: 41641, port6: 100}
+	defer func(f func(*LocalBackend) (c2nRebinder, error)) { c2nGetRebinder = f }(c2nGetRebinder)
+	c2nGetRebinder = func(*LocalBackend) (c2nRebinder, error) { return mc, nil }
+
+	post := func() (res c2nRebindResult) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/debug/rebind", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := post()
+	if mc.rebinds != 1 || res.Coalesced || res.LocalPort4 != 41641 || res.LocalPort6 != 101 || !res.Netcheck.At.Equal(mc.netcheckAt) || res.Error != "" {
+		t.Errorf("first rebind = %+v, %d rebinds", res, mc.rebinds)
+	}
+
+	// One right after reuses its result.
+	clock.Advance(time.Second)
+	if res := post(); mc.rebinds != 1 || !res.Coalesced || res.LocalPort6 != 101 {
+		t.Errorf("rapid second rebind = %+v, %d rebinds", res, mc.rebinds)
+	}
+
+	clock.Advance(c2nRebindCoalesceTime)
+	mc.port4 = 0
+	if res := post(); mc.rebinds != 2 || res.Coalesced || res.LocalPort6 != 102 || res.Error == "" {
+		t.Errorf("later rebind with IPv4 unbound = %+v, %d rebinds", res, mc.rebinds)
+	}
+}
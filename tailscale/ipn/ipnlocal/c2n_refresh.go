@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// c2nRefreshDefaultTimeout is how long /refresh waits for the new
+	// netmap, unless it's given a "timeout".
+	c2nRefreshDefaultTimeout = 10 * time.Second
+
+	// c2nRefreshMaxTimeout is the longest that /refresh may be asked to
+	// wait for the new netmap.
+	c2nRefreshMaxTimeout = 60 * time.Second
+
+	// c2nRefreshPollInterval is how often /refresh checks whether the new
+	// netmap has arrived.
+	c2nRefreshPollInterval = 100 * time.Millisecond
+)
+
+// c2nRefreshResponse is the result of c2n /refresh.
+type c2nRefreshResponse struct {
+	// Refreshed is whether a new netmap arrived within the timeout.
+	Refreshed bool `json:"refreshed"`
+
+	// Coalesced is whether the request joined a refresh that was already
+	// in progress, rather than starting one.
+	Coalesced bool `json:"coalesced,omitempty"`
+
+	// NetMapGen is how many times the node's netmap has been set since
+	// tailscaled started, including to any new one. It's also incremented
+	// when the netmap is cleared, such as on logout.
+	NetMapGen uint64 `json:"netMapGen"`
+
+	// LastNetMapAt is when the netmap was last set, or zero if it hasn't
+	// been.
+	LastNetMapAt time.Time `json:"lastNetMapAt"`
+}
+
+// handleC2NRefresh restarts the node's map poll, as if it had reconnected
+// to control, without changing its prefs, and waits up to "timeout" seconds
+// (default 10) for the full netmap that results. It responds with a 200 if
+// that arrived in time, or a 202 if it's still pending. Requests made while
+// a refresh is pending wait for that one, rather than restarting the map
+// poll again, unless that was so long ago that it must have failed.
+func (b *LocalBackend) handleC2NRefresh(w http.ResponseWriter, r *http.Request) {
+	timeout := c2nRefreshDefaultTimeout
+	if v := r.FormValue("timeout"); v != "" {
+		secs, err := strconv.ParseFloat(v, 64)
+		if err != nil || secs <= 0 {
+			http.Error(w, "invalid 'timeout' parameter", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(secs*float64(time.Second)), c2nRefreshMaxTimeout)
+	}
+
+	b.mu.Lock()
+	cc, ok := b.cc.(interface{ RestartMap() })
+	if !ok {
+		b.mu.Unlock()
+		http.Error(w, "no control client", http.StatusServiceUnavailable)
+		return
+	}
+	var res c2nRefreshResponse
+	before := b.netMapGen
+	now := b.clock.Now()
+	if started := b.c2nRefreshStarted; !started.IsZero() && now.Sub(started) < c2nRefreshMaxTimeout {
+		res.Coalesced = true
+	} else {
+		b.c2nRefreshStarted = now
+	}
+	b.mu.Unlock()
+	if !res.Coalesced {
+		b.logf("c2n: restarting map poll")
+		cc.RestartMap()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	t, tc := b.clock.NewTicker(c2nRefreshPollInterval)
+	defer t.Stop()
+	refreshed := func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		res.NetMapGen = b.netMapGen
+		res.LastNetMapAt = b.netMapSetAt
+		res.Refreshed = res.NetMapGen > before && b.netMap != nil
+		return res.Refreshed
+	}
+	status := http.StatusOK
+wait:
+	for !refreshed() {
+		select {
+		case <-tc:
+		case <-ctx.Done():
+			status = http.StatusAccepted
+			break wait
+		}
+	}
+	writeJSONStatus(w, status, res)
+}
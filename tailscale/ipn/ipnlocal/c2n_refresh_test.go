@@ -0,0 +1,81 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/tstime"
+	"tailscale.com/types/netmap"
+)
+
+// restartMapClient is a controlclient.Client that records calls to
+// RestartMap, and calls onRestart (if non-nil) for each.
+type restartMapClient struct {
+	controlclient.Client
+	restarts  atomic.Int32
+	onRestart func()
+}
+
+func (c *restartMapClient) RestartMap() {
+	c.restarts.Add(1)
+	if c.onRestart != nil {
+		go c.onRestart()
+	}
+}
+
+func TestHandleC2NRefresh(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	refresh := func(query string, wantCode int) (res c2nRefreshResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/refresh?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s: status = %d; want %d: %s", query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK || wantCode == http.StatusAccepted {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	refresh("", http.StatusServiceUnavailable)
+
+	cc := &restartMapClient{}
+	cc.onRestart = func() {
+		// As SetControlClientStatus does when the netmap arrives.
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.netMap = new(netmap.NetworkMap)
+		b.netMapSetAt = b.clock.Now()
+		b.netMapGen++
+		b.c2nRefreshStarted = time.Time{}
+	}
+	b.cc = cc
+	refresh("timeout=x", http.StatusBadRequest)
+	res := refresh("", http.StatusOK)
+	if !res.Refreshed || res.Coalesced || res.NetMapGen != 1 || res.LastNetMapAt.IsZero() {
+		t.Errorf("refresh: got %+v", res)
+	}
+
+	// If the netmap doesn't arrive in time, later requests wait for the
+	// same refresh.
+	cc.onRestart = nil
+	if res := refresh("timeout=0.05", http.StatusAccepted); res.Refreshed || res.Coalesced || res.NetMapGen != 1 {
+		t.Errorf("timed out refresh: got %+v", res)
+	}
+	if res := refresh("timeout=0.05", http.StatusAccepted); !res.Coalesced {
+		t.Errorf("concurrent refresh: got %+v; want Coalesced", res)
+	}
+	if got := cc.restarts.Load(); got != 2 {
+		t.Errorf("map poll restarted %d times; want 2", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/version"
+)
+
+// c2nExecSelf replaces the current process, as syscall.Exec does. It's nil
+// on platforms where tailscaled can't re-exec itself (c2n_restart_exec.go).
+var c2nExecSelf func(argv0 string, argv []string, envv []string) error
+
+// c2nRestartDelay is how long c2n /restart waits before restarting, so its
+// response can be delivered first.
+const c2nRestartDelay = time.Second
+
+// c2nRestartResponse is the response from c2n /restart.
+type c2nRestartResponse struct {
+	Started bool   // whether the restart has begun
+	Err     string `json:",omitempty"`
+}
+
+// handleC2NRestart restarts tailscaled by shutting down the LocalBackend
+// and re-executing the current binary with the same arguments and
+// environment.
+func (b *LocalBackend) handleC2NRestart(w http.ResponseWriter, r *http.Request) {
+	// Re-exec is only safe for a standalone tailscaled, whose service
+	// manager doesn't care. GUI platforms, the macOS network extensions,
+	// and programs embedding tsnet would be replaced by tailscaled or
+	// leave their process manager confused.
+	if c2nExecSelf == nil || version.IsSandboxedMacOS() || version.CmdName() != "tailscaled" {
+		http.Error(w, "restart not supported on this platform", http.StatusNotImplemented)
+		return
+	}
+
+	var res c2nRestartResponse
+	defer func() {
+		writeJSON(w, res)
+	}()
+	if !envknob.AllowsRemoteUpdate() {
+		res.Err = "not enabled"
+		return
+	}
+	self, err := os.Executable()
+	if err != nil {
+		res.Err = err.Error()
+		return
+	}
+	if _, err := os.Stat(self); err != nil {
+		res.Err = err.Error()
+		return
+	}
+	argv0, argv, envv := restartCommand(self, os.Args, os.Environ())
+	res.Started = true
+
+	go func() {
+		time.Sleep(c2nRestartDelay)
+		b.logf("c2n: restarting: %q", argv)
+		b.TryFlushLogs()
+		b.Shutdown()
+		err := c2nExecSelf(argv0, argv, envv)
+		// The backend's already shut down, so there's nothing left to
+		// do but exit and let the service manager start us again.
+		b.logf("c2n: restart failed: %v", err)
+		os.Exit(1)
+	}()
+}
+
+// restartCommand returns the arguments to c2nExecSelf to re-execute the
+// binary at self, which was run with args and env.
+func restartCommand(self string, args, env []string) (argv0 string, argv, envv []string) {
+	argv = append([]string(nil), args...)
+	if len(argv) == 0 {
+		argv = []string{self}
+	}
+	return self, argv, append([]string(nil), env...)
+}
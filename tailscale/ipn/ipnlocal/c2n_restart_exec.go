@@ -0,0 +1,12 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build (linux && !android) || freebsd || (darwin && !ios)
+
+package ipnlocal
+
+import "syscall"
+
+func init() {
+	c2nExecSelf = syscall.Exec
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tstime"
+)
+
+func TestRestartCommand(t *testing.T) {
+	self := "/usr/sbin/tailscaled"
+	args := []string{"tailscaled", "--state=/var/lib/tailscale/tailscaled.state", "--port=41641"}
+	env := []string{"PATH=/usr/bin", "TS_DEBUG_MTU=1280"}
+
+	argv0, argv, envv := restartCommand(self, args, env)
+	if argv0 != self {
+		t.Errorf("argv0 = %q; want %q", argv0, self)
+	}
+	if !reflect.DeepEqual(argv, args) {
+		t.Errorf("argv = %q; want %q", argv, args)
+	}
+	if !reflect.DeepEqual(envv, env) {
+		t.Errorf("envv = %q; want %q", envv, env)
+	}
+	// The results mustn't alias the process's own args and env.
+	argv[1] = "x"
+	envv[0] = "x"
+	if args[1] == "x" || env[0] == "x" {
+		t.Error("restartCommand result aliases its input")
+	}
+
+	if _, argv, _ := restartCommand(self, nil, nil); !reflect.DeepEqual(argv, []string{self}) {
+		t.Errorf("argv with no args = %q; want [%q]", argv, self)
+	}
+}
+
+func TestHandleC2NRestartRefused(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("GET", "/restart", nil))
+	if rec.Code != 405 {
+		t.Errorf("GET: got status %d; want 405", rec.Code)
+	}
+
+	// The test binary isn't tailscaled, so mustn't re-exec itself.
+	rec = httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/restart", nil))
+	if rec.Code != 501 {
+		t.Errorf("POST: got status %d; want 501", rec.Code)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// processStartTime approximates when the process started: when this
+// package was initialized.
+var processStartTime = time.Now()
+
+// c2nRuntimeStats is the response to c2n /debug/runtime.
+type c2nRuntimeStats struct {
+	StartTime  time.Time `json:"startTime"`
+	UptimeSecs float64   `json:"uptimeSecs"`
+
+	NumGoroutine int `json:"numGoroutine"`
+	GOMAXPROCS   int `json:"gomaxprocs"`
+	NumCPU       int `json:"numCPU"`
+
+	// From runtime.MemStats.
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"numGC"`
+	PauseTotalNs uint64 `json:"pauseTotalNs"`
+}
+
+// handleC2NDebugRuntime reports goroutine and memory counts, for watching
+// for leaks and growth more cheaply than with /debug/goroutines or
+// /debug/logheap. It's cheap enough to not be rate limited.
+func (b *LocalBackend) handleC2NDebugRuntime(w http.ResponseWriter, r *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	writeJSON(w, c2nRuntimeStats{
+		StartTime:    processStartTime,
+		UptimeSecs:   time.Since(processStartTime).Seconds(),
+		NumGoroutine: runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		Sys:          ms.Sys,
+		NumGC:        ms.NumGC,
+		PauseTotalNs: ms.PauseTotalNs,
+	})
+}
@@ -0,0 +1,38 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"tailscale.com/tstime"
+)
+
+func TestHandleC2NDebugRuntime(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	runtime.GC()
+
+	// Not rate limited, unlike the full dumps.
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/runtime", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		var res c2nRuntimeStats
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.NumGoroutine < 1 || res.GOMAXPROCS < 1 || res.HeapAlloc == 0 || res.NumGC == 0 {
+			t.Errorf("got %+v; want non-zero stats", res)
+		}
+		if !res.StartTime.Equal(processStartTime) || res.UptimeSecs <= 0 {
+			t.Errorf("start time %v, uptime %v; want %v, positive", res.StartTime, res.UptimeSecs, processStartTime)
+		}
+	}
+}
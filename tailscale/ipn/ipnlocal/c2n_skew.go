@@ -0,0 +1,66 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"time"
+)
+
+// tlsSkewTolerance is how far the local clock can be off before TLS
+// certificate validation is at risk. CAs such as Let's Encrypt backdate
+// NotBefore by an hour, so a clock further behind than that rejects newly
+// issued certificates, and a clock further ahead than that starts to treat
+// certificates that are about to expire as expired.
+const tlsSkewTolerance = time.Hour
+
+// c2nSkewRisk is the impact of the measured clock skew on one feature.
+type c2nSkewRisk struct {
+	AtRisk    bool
+	Tolerance time.Duration `json:",omitempty"` // how much skew the feature tolerates, if limited
+	Reason    string
+}
+
+func (b *LocalBackend) handleC2NDebugSkewImpact(w http.ResponseWriter, r *http.Request) {
+	skew := b.em.lastSkew.Load()
+	if skew.At.IsZero() {
+		http.Error(w, "no time received from control yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, struct {
+		Skew       time.Duration // control's time minus the local time
+		MeasuredAt time.Time     // local time
+		Features   map[string]c2nSkewRisk
+	}{skew.Delta, skew.At, skewImpact(skew.Delta)})
+}
+
+// skewImpact returns the features affected by the local clock being delta
+// behind control's (or ahead, if negative), keyed by feature name.
+func skewImpact(delta time.Duration) map[string]c2nSkewRisk {
+	tls := c2nSkewRisk{
+		Tolerance: tlsSkewTolerance,
+		Reason:    "within tolerance",
+	}
+	switch {
+	case delta > tlsSkewTolerance:
+		tls.AtRisk = true
+		tls.Reason = "local clock is behind; recently issued certificates appear not yet valid"
+	case delta < -tlsSkewTolerance:
+		tls.AtRisk = true
+		tls.Reason = "local clock is ahead; certificates near expiry appear expired"
+	}
+
+	keyExpiry := c2nSkewRisk{Reason: "within tolerance"}
+	if delta.Abs() > minClockDelta {
+		keyExpiry.Reason = "compensated: peer key expiry is checked against control's time"
+	}
+
+	return map[string]c2nSkewRisk{
+		"tls":        tls,
+		"key-expiry": keyExpiry,
+		"tailnet-lock": {
+			Reason: "not affected: signature verification doesn't depend on the time",
+		},
+	}
+}
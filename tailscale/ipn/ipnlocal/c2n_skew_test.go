@@ -0,0 +1,36 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSkewImpact(t *testing.T) {
+	tests := []struct {
+		delta    time.Duration
+		tlsRisk  bool
+		anyRisks bool
+	}{
+		{0, false, false},
+		{30 * time.Minute, false, false},
+		{-30 * time.Minute, false, false},
+		{2 * time.Hour, true, true},
+		{-2 * time.Hour, true, true},
+	}
+	for _, tt := range tests {
+		got := skewImpact(tt.delta)
+		if got["tls"].AtRisk != tt.tlsRisk {
+			t.Errorf("skewImpact(%v)[tls].AtRisk = %v; want %v", tt.delta, got["tls"].AtRisk, tt.tlsRisk)
+		}
+		var anyRisks bool
+		for _, r := range got {
+			anyRisks = anyRisks || r.AtRisk
+		}
+		if anyRisks != tt.anyRisks {
+			t.Errorf("skewImpact(%v) has risks = %v; want %v", tt.delta, anyRisks, tt.anyRisks)
+		}
+	}
+}
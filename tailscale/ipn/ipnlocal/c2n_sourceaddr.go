@@ -0,0 +1,65 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+
+	"tailscale.com/net/interfaces"
+	"tailscale.com/net/netns"
+)
+
+// handleC2NDebugSourceAddr reports the local address and interface that the
+// OS picks to reach the "dst" IP, for sockets like magicsock's that don't
+// route via Tailscale.
+func (b *LocalBackend) handleC2NDebugSourceAddr(w http.ResponseWriter, r *http.Request) {
+	dst, err := netip.ParseAddr(r.FormValue("dst"))
+	if err != nil {
+		http.Error(w, "invalid 'dst' parameter", http.StatusBadRequest)
+		return
+	}
+	var res struct {
+		Dst       netip.Addr
+		Source    netip.Addr // zero if there's no route to Dst
+		Interface string     `json:",omitempty"`
+		// Gateway is the default gateway, if Interface has the default
+		// route and the gateway is a private IPv4 address (see
+		// interfaces.LikelyHomeRouterIP). The gateway used for other
+		// routes isn't known.
+		Gateway       netip.Addr `json:",omitempty"`
+		MagicsockPort uint16     `json:",omitempty"` // the UDP port magicsock is bound to
+		Error         string     `json:",omitempty"`
+	}
+	res.Dst = dst
+	if mc, err := b.magicConn(); err == nil {
+		res.MagicsockPort = mc.LocalPort()
+	}
+
+	// Connecting a UDP socket sends nothing, but makes the OS pick the
+	// route and source address it'd use.
+	c, err := netns.NewDialer(b.logf, b.sys.NetMon.Get()).DialContext(r.Context(), "udp", netip.AddrPortFrom(dst, 443).String())
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		if la, ok := c.LocalAddr().(*net.UDPAddr); ok {
+			res.Source = la.AddrPort().Addr().Unmap()
+		}
+		c.Close()
+	}
+	if res.Source.IsValid() {
+		interfaces.ForeachInterfaceAddress(func(i interfaces.Interface, pfx netip.Prefix) {
+			if res.Interface == "" && pfx.Addr() == res.Source {
+				res.Interface = i.Name
+			}
+		})
+		if dr, err := interfaces.DefaultRouteInterface(); err == nil && dr == res.Interface {
+			if gw, _, ok := interfaces.LikelyHomeRouterIP(); ok {
+				res.Gateway = gw
+			}
+		}
+	}
+	writeJSON(w, res)
+}
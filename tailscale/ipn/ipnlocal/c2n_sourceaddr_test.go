@@ -0,0 +1,58 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestHandleC2NDebugSourceAddr(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	tests := []struct {
+		query      string
+		wantCode   int
+		wantSource netip.Addr
+	}{
+		{"", http.StatusBadRequest, netip.Addr{}},
+		{"dst=bogus", http.StatusBadRequest, netip.Addr{}},
+		{"dst=127.0.0.1", http.StatusOK, netip.MustParseAddr("127.0.0.1")},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/source-addr?"+tt.query, nil))
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status = %d; want %d: %s", tt.query, rec.Code, tt.wantCode, rec.Body.Bytes())
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		var res struct {
+			Dst           netip.Addr
+			Source        netip.Addr
+			Interface     string
+			MagicsockPort uint16
+			Error         string
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Error != "" {
+			t.Fatalf("%s: error: %s", tt.query, res.Error)
+		}
+		if res.Dst.String() != "127.0.0.1" || res.Source != tt.wantSource {
+			t.Errorf("%s: got dst %v, source %v; want source %v", tt.query, res.Dst, res.Source, tt.wantSource)
+		}
+		if res.Interface == "" {
+			t.Errorf("%s: no interface for source %v", tt.query, res.Source)
+		}
+		if res.MagicsockPort == 0 {
+			t.Errorf("%s: no magicsock port", tt.query)
+		}
+	}
+}
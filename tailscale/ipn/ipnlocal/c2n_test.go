@@ -0,0 +1,1741 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"tailscale.com/clientupdate"
+	"tailscale.com/envknob"
+	"tailscale.com/health"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/net/dns"
+	"tailscale.com/net/dropstats"
+	"tailscale.com/net/sockstats"
+	"tailscale.com/net/tsdial"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsd"
+	"tailscale.com/tstest"
+	"tailscale.com/tstime"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/logid"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/dnsname"
+	"tailscale.com/util/goroutines"
+	"tailscale.com/util/must"
+	"tailscale.com/version"
+	"tailscale.com/wgengine"
+	"tailscale.com/wgengine/magicsock"
+)
+
+// fakeCmdTailscale writes a shell script that stands in for cmd/tailscale
+// in c2n /update, and returns the path of the file that each run of
+// "tailscale update" appends a line to.
+//
+// If unstartable, running "tailscale version" makes the script
+// non-executable, so that starting "tailscale update" fails.
+func fakeCmdTailscale(t *testing.T, unstartable bool) (launches string) {
+	return fakeCmdTailscaleVersion(t, version.Long(), unstartable)
+}
+
+// fakeCmdTailscaleVersion is like fakeCmdTailscale, but the script reports
+// its version as ver.
+func fakeCmdTailscaleVersion(t *testing.T, ver string, unstartable bool) (launches string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+	dir := t.TempDir()
+	chmod := ""
+	if unstartable {
+		chmod = `; chmod -x "$0"`
+	}
+	launches = filepath.Join(dir, "launches")
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+version) echo '{"long": "%s"}'%s ;;
+update) echo "$@" >> %s; echo updating; sleep 1; echo "oops" >&2; exit 3 ;;
+esac
+`, ver, chmod, launches)
+	cmdTS := filepath.Join(dir, "tailscale")
+	if err := os.WriteFile(cmdTS, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldUnsupported, oldFind, oldLatest := c2nUpdateUnsupported, c2nFindCmdTailscale, c2nLatestVersion
+	c2nUpdateUnsupported = func() (string, string) { return "", "" }
+	c2nFindCmdTailscale = func() (string, error) { return cmdTS, nil }
+	c2nLatestVersion = func() (string, error) { return "1.99.0", nil }
+	t.Cleanup(func() {
+		c2nUpdateUnsupported, c2nFindCmdTailscale, c2nLatestVersion = oldUnsupported, oldFind, oldLatest
+	})
+	old := envknob.String("TS_ALLOW_ADMIN_CONSOLE_REMOTE_UPDATE")
+	envknob.Setenv("TS_ALLOW_ADMIN_CONSOLE_REMOTE_UPDATE", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_ADMIN_CONSOLE_REMOTE_UPDATE", old) })
+	return launches
+}
+
+func TestHandleC2NUpdateConcurrent(t *testing.T) {
+	launches := fakeCmdTailscale(t, false)
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	update := func(method string) tailcfg.C2NUpdateResponse {
+		rec := httptest.NewRecorder()
+		b.handleC2NUpdate(rec, httptest.NewRequest(method, "/update", nil))
+		var res tailcfg.C2NUpdateResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Errorf("bad response %q: %v", rec.Body.Bytes(), err)
+		}
+		return res
+	}
+
+	var wg sync.WaitGroup
+	results := make([]tailcfg.C2NUpdateResponse, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = update("POST")
+		}(i)
+	}
+	wg.Wait()
+
+	var started int
+	for _, res := range results {
+		if res.Started {
+			started++
+		} else if res.Err != "update already in progress" {
+			t.Errorf("Err = %q; want update already in progress", res.Err)
+		}
+	}
+	if started != 1 {
+		t.Errorf("%d updates started; want 1", started)
+	}
+	got, err := os.ReadFile(launches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(got), "\n"); n != 1 {
+		t.Errorf("update launched %d times; want 1", n)
+	}
+
+	// The update's finished, but another within the cooldown is refused.
+	if res := update("GET"); res.Running {
+		t.Error("GET reports update still running")
+	}
+	if res := update("POST"); res.Started || res.Err != "update already in progress" {
+		t.Errorf("POST within cooldown = %+v; want refused", res)
+	}
+}
+
+func TestHandleC2NUpdateStartFails(t *testing.T) {
+	launches := fakeCmdTailscale(t, true)
+	cmdTS, _ := c2nFindCmdTailscale()
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	for i := 0; i < 2; i++ {
+		if err := os.Chmod(cmdTS, 0755); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		b.handleC2NUpdate(rec, httptest.NewRequest("POST", "/update", nil))
+		var res tailcfg.C2NUpdateResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Started || !strings.HasPrefix(res.Err, "failed to start") {
+			t.Errorf("attempt %d: got %+v; want failure to start", i, res)
+		}
+	}
+	if _, err := os.Stat(launches); err == nil {
+		t.Error("update launched")
+	}
+}
+
+func TestHandleC2NUpdateStream(t *testing.T) {
+	fakeCmdTailscale(t, false)
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	rec := httptest.NewRecorder()
+	b.handleC2NUpdate(rec, httptest.NewRequest("POST", "/update?stream=1", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %q; want 2 lines of output and a result", lines)
+	}
+	if lines[0] != "updating" || lines[1] != "oops" {
+		t.Errorf("output = %q; want updating, oops", lines[:2])
+	}
+	var res c2nUpdateStreamResult
+	if err := json.Unmarshal([]byte(lines[2]), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Started || res.Running || res.ExitCode != 3 || res.Err == "" || res.InstalledVersion != version.Long() {
+		t.Errorf("result = %+v; want started, finished, exit code 3, an error, and version %q", res, version.Long())
+	}
+	if res.ErrReason != clientupdate.ReasonUnknown {
+		t.Errorf("ErrReason = %q; want %q for an unrecognized exit code", res.ErrReason, clientupdate.ReasonUnknown)
+	}
+}
+
+func TestHandleC2NUpdateExitReason(t *testing.T) {
+	fakeCmdTailscale(t, false)
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	rec := httptest.NewRecorder()
+	b.handleC2NUpdate(rec, httptest.NewRequest("POST", "/update", nil))
+	var res tailcfg.C2NUpdateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// The fake update exits with 3, which doesn't match any reason.
+	if !res.Started || res.Running || res.Err == "" || res.ErrReason != clientupdate.ReasonUnknown {
+		t.Errorf("got %+v; want started, finished, and failed for an unknown reason", res)
+	}
+	b.mu.Lock()
+	history := b.c2nUpdateHistory
+	b.mu.Unlock()
+	if len(history) != 1 || history[0].Err != res.Err || history[0].ErrReason != clientupdate.ReasonUnknown {
+		t.Errorf("history = %+v; want the failure and its reason", history)
+	}
+}
+
+func TestHandleC2NUpdateUnverifiable(t *testing.T) {
+	fakeCmdTailscale(t, false)
+	c2nUpdateUnsupported = func() (string, string) {
+		return updateUnsupportedReason(fmt.Errorf("%w: apt", clientupdate.ErrUnverifiable), false)
+	}
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	rec := httptest.NewRecorder()
+	b.handleC2NUpdate(rec, httptest.NewRequest("POST", "/update", nil))
+	var res tailcfg.C2NUpdateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Supported || res.Started || res.ErrReason != clientupdate.ReasonUnverifiable {
+		t.Errorf("got %+v; want unsupported with ErrReason %q", res, clientupdate.ReasonUnverifiable)
+	}
+}
+
+func TestHandleC2NUpdateVersion(t *testing.T) {
+	launches := fakeCmdTailscale(t, false)
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	update := func(method, body string) (int, tailcfg.C2NUpdateResponse) {
+		rec := httptest.NewRecorder()
+		b.handleC2NUpdate(rec, httptest.NewRequest(method, "/update", strings.NewReader(body)))
+		var res tailcfg.C2NUpdateResponse
+		if rec.Code == 200 {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, res
+	}
+	check := func() (int, tailcfg.C2NUpdateResponse) {
+		rec := httptest.NewRecorder()
+		b.handleC2NUpdate(rec, httptest.NewRequest("GET", "/update?check=1", nil))
+		var res tailcfg.C2NUpdateResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, res
+	}
+
+	// A plain GET doesn't look up the latest version.
+	if _, res := update("GET", ""); res.Version != "" || res.SignaturesEnforced {
+		t.Errorf("GET = %+v; want no version and signatures not enforced", res)
+	}
+	if _, res := check(); res.Version != "1.99.0" {
+		t.Errorf("GET ?check=1 = %+v; want latest version, 1.99.0", res)
+	}
+	envknob.Setenv("TS_UPDATE_SIGNING_ROOTS", "/etc/tailscale/roots.pem")
+	t.Cleanup(func() { envknob.Setenv("TS_UPDATE_SIGNING_ROOTS", "") })
+	if _, res := update("GET", ""); !res.SignaturesEnforced {
+		t.Error("GET reports signatures not enforced")
+	}
+	if _, res := update("GET", `{"Version": "1.50.2"}`); res.Version != "1.50.2" {
+		t.Errorf("GET Version = %q; want requested, 1.50.2", res.Version)
+	}
+	if code, _ := update("POST", `{"Version": "1.50.2; rm -rf /"}`); code != 400 {
+		t.Errorf("malformed version: got status %d; want 400", code)
+	}
+	if code, res := update("POST", `{"Version": "1.50.2"}`); code != 200 || !res.Started {
+		t.Fatalf("POST = %d, %+v; want started", code, res)
+	}
+	got, err := os.ReadFile(launches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "update --yes --version=1.50.2\n"; string(got) != want {
+		t.Errorf("update args = %q; want %q", got, want)
+	}
+}
+
+func TestHandleC2NUpdateCmdTailscaleVersion(t *testing.T) {
+	major, minor, _ := strings.Cut(version.Short(), ".")
+	minor, _, _ = strings.Cut(minor, ".")
+	samePatch := major + "." + minor + ".99-t1234abcd"
+	nextMinor := major + "." + minor + "1.0"
+	tests := []struct {
+		ver     string
+		wantErr string // or empty if the update should start
+	}{
+		{version.Long(), ""},
+		{samePatch, ""},
+		{nextMinor, fmt.Sprintf("cmd/tailscale version mismatch: cmd/tailscale is %q, tailscaled is %q", nextMinor, version.Long())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ver, func(t *testing.T) {
+			fakeCmdTailscaleVersion(t, tt.ver, false)
+			b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+			rec := httptest.NewRecorder()
+			b.handleC2NUpdate(rec, httptest.NewRequest("POST", "/update", nil))
+			var res tailcfg.C2NUpdateResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr == "" {
+				// The fake update ran, and failed with its own error.
+				if !res.Started || strings.Contains(res.Err, "version mismatch") {
+					t.Errorf("got %+v; want started", res)
+				}
+			} else if res.Err != tt.wantErr || res.Started {
+				t.Errorf("got %+v; want Err %q", res, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleC2NUpdateAlreadyUpToDate(t *testing.T) {
+	launches := fakeCmdTailscale(t, false)
+	// The release that's running, without any suffix from a dev build.
+	current, _, _ := strings.Cut(version.Short(), "-")
+	c2nLatestVersion = func() (string, error) { return current, nil }
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	update := func(method, body string) tailcfg.C2NUpdateResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		target := "/update"
+		if method == "GET" {
+			target += "?check=1"
+		}
+		b.handleC2NUpdate(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var res tailcfg.C2NUpdateResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := update("GET", ""); res.CurrentVersion != version.Short() || res.Version != current {
+		t.Errorf("GET = %+v; want current version %q, available %q", res, version.Short(), current)
+	}
+	for _, body := range []string{"", `{"Version": "` + current + `"}`} {
+		res := update("POST", body)
+		if res.Started || !res.AlreadyUpToDate || res.Err != "" {
+			t.Errorf("POST %q = %+v; want already up to date", body, res)
+		}
+	}
+	if _, err := os.Stat(launches); !os.IsNotExist(err) {
+		t.Errorf("update was launched when up to date")
+	}
+}
+
+func TestHandleC2NUpdateCheck(t *testing.T) {
+	oldUnsupported, oldLatest := c2nUpdateUnsupported, c2nLatestVersion
+	t.Cleanup(func() { c2nUpdateUnsupported, c2nLatestVersion = oldUnsupported, oldLatest })
+	c2nUpdateUnsupported = func() (string, string) { return "", "" }
+	current, _, _ := strings.Cut(version.Short(), "-")
+	latest, latestErr := "999.0.0", error(nil)
+	lookups := 0
+	c2nLatestVersion = func() (string, error) {
+		lookups++
+		return latest, latestErr
+	}
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b := &LocalBackend{logf: t.Logf, clock: clock}
+
+	get := func(query string) tailcfg.C2NUpdateResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/update?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		var res tailcfg.C2NUpdateResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := get(""); res.LatestVersion != "" || res.UpdateAvailable != nil || res.Version != "" || lookups != 0 {
+		t.Errorf("without check: %+v, %d lookups; want no check", res, lookups)
+	}
+	res := get("check=1")
+	if res.LatestVersion != latest || res.UpdateAvailable == nil || !*res.UpdateAvailable || res.CheckErr != "" {
+		t.Errorf("newer available: %+v", res)
+	}
+	if lookups != 1 {
+		t.Errorf("%d lookups; want 1, cached", lookups)
+	}
+
+	latest = current
+	get("check=1")
+	if lookups != 1 {
+		t.Errorf("%d lookups within the cache time; want 1", lookups)
+	}
+	clock.Advance(c2nUpdateCheckCacheTime)
+	res = get("check=1")
+	if res.LatestVersion != current || res.UpdateAvailable == nil || *res.UpdateAvailable {
+		t.Errorf("up to date: %+v", res)
+	}
+
+	// A failed lookup is reported, not fatal, and cached too.
+	latest, latestErr = "", errors.New("no route to pkgs.tailscale.com")
+	clock.Advance(c2nUpdateCheckCacheTime)
+	res = get("check=1")
+	if res.UpdateAvailable != nil || res.LatestVersion != "" || res.CheckErr != latestErr.Error() || res.CurrentVersion != version.Short() {
+		t.Errorf("lookup failure: %+v", res)
+	}
+	get("check=1")
+	if lookups != 3 {
+		t.Errorf("%d lookups; want 3", lookups)
+	}
+}
+
+func TestSameUpdateVersion(t *testing.T) {
+	tests := []struct {
+		running, target string
+		want            bool
+	}{
+		{"1.56.1", "1.56.1", true},
+		{"1.56.1-t1234abcd-g5678", "1.56.1", true},
+		{"1.56.1", "v1.56.1", true},
+		{"1.56.1+dirty", "1.56.1", true},
+		{"1.56.1", "1.56.2", false},
+		{"1.56.1-t1234abcd", "1.56.10", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := sameUpdateVersion(tt.running, tt.target); got != tt.want {
+			t.Errorf("sameUpdateVersion(%q, %q) = %v; want %v", tt.running, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateUnsupportedReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		updaterErr error
+		macSysExt  bool
+		want       string
+		wantReason string
+	}{
+		{"supported", nil, false, "", ""},
+		{"no-updater", errors.ErrUnsupported, false, c2nUpdateErrUnsupported, clientupdate.ReasonUnsupported},
+		// The macsys updater is a stub, so NewUpdater succeeds.
+		{"macsys", nil, true, c2nUpdateErrMacSysExt, clientupdate.ReasonUnsupported},
+		{"macsys-no-updater", errors.ErrUnsupported, true, c2nUpdateErrMacSysExt, clientupdate.ReasonUnsupported},
+		{
+			"unverifiable",
+			fmt.Errorf("%w: apt", clientupdate.ErrUnverifiable),
+			false,
+			"not supported: update signature verification is enforced but not possible: apt",
+			clientupdate.ReasonUnverifiable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotReason := updateUnsupportedReason(tt.updaterErr, tt.macSysExt)
+			if got != tt.want || gotReason != tt.wantReason {
+				t.Errorf("got %q, %q; want %q, %q", got, gotReason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestHandleC2NUpdateUnsupported(t *testing.T) {
+	fakeCmdTailscale(t, false)
+	c2nUpdateUnsupported = func() (string, string) { return updateUnsupportedReason(nil, true) }
+	b := &LocalBackend{clock: tstime.StdClock{}}
+
+	rec := httptest.NewRecorder()
+	b.handleC2NUpdate(rec, httptest.NewRequest("POST", "/update", nil))
+	var res tailcfg.C2NUpdateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Supported || res.Started || res.Err != c2nUpdateErrMacSysExt {
+		t.Errorf("got %+v; want unsupported with Err %q", res, c2nUpdateErrMacSysExt)
+	}
+	if res.ErrReason != clientupdate.ReasonUnsupported {
+		t.Errorf("ErrReason = %q; want %q", res.ErrReason, clientupdate.ReasonUnsupported)
+	}
+}
+
+func TestIsUpdateVersion(t *testing.T) {
+	tests := []struct {
+		v    string
+		want bool
+	}{
+		{"1.56.1", true},
+		{"1.57.0", true},
+		{"10.200.3000", true},
+		{"", false},
+		{"1.56", false},
+		{"1.56.1.2", false},
+		{"1.56.x", false},
+		{"v1.56.1", false},
+		{"1..1", false},
+		{"1.56.1-pre", false},
+		{"stable", false},
+		{"1.56.1 --yes", false},
+	}
+	for _, tt := range tests {
+		if got := isUpdateVersion(tt.v); got != tt.want {
+			t.Errorf("isUpdateVersion(%q) = %v; want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+// fakeStat returns a stat func for findCmdTailscaleIn that looks at fsys
+// as if it were mounted at /.
+func fakeStat(fsys fstest.MapFS) func(string) (fs.FileInfo, error) {
+	return func(name string) (fs.FileInfo, error) {
+		return fs.Stat(fsys, strings.TrimPrefix(name, "/"))
+	}
+}
+
+func TestFindCmdTailscaleIn(t *testing.T) {
+	exe := &fstest.MapFile{Mode: 0755}
+	nonExe := &fstest.MapFile{Mode: 0644}
+	tests := []struct {
+		name    string
+		goos    string
+		self    string
+		fs      fstest.MapFS
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "linux-package",
+			goos: "linux",
+			self: "/usr/sbin/tailscaled",
+			fs:   fstest.MapFS{"usr/sbin/tailscaled": exe, "usr/bin/tailscale": exe},
+			want: "/usr/bin/tailscale",
+		},
+		{
+			name:    "linux-package-missing",
+			goos:    "linux",
+			self:    "/usr/sbin/tailscaled",
+			fs:      fstest.MapFS{"usr/sbin/tailscaled": exe},
+			wantErr: true,
+		},
+		{
+			name: "linux-usr-local",
+			goos: "linux",
+			self: "/usr/local/sbin/tailscaled",
+			fs:   fstest.MapFS{"usr/local/sbin/tailscaled": exe, "usr/local/bin/tailscale": exe},
+			want: "/usr/local/bin/tailscale",
+		},
+		{
+			name: "linux-same-dir",
+			goos: "linux",
+			self: "/opt/tailscale_1.56.1_amd64/tailscaled",
+			fs: fstest.MapFS{
+				"opt/tailscale_1.56.1_amd64/tailscaled": exe,
+				"opt/tailscale_1.56.1_amd64/tailscale":  exe,
+			},
+			want: "/opt/tailscale_1.56.1_amd64/tailscale",
+		},
+		{
+			name: "linux-nix",
+			goos: "linux",
+			self: "/nix/store/abc-tailscale-1.56.1/bin/tailscaled",
+			fs: fstest.MapFS{
+				"nix/store/abc-tailscale-1.56.1/bin/tailscaled": exe,
+				"nix/store/abc-tailscale-1.56.1/bin/tailscale":  exe,
+			},
+			want: "/nix/store/abc-tailscale-1.56.1/bin/tailscale",
+		},
+		{
+			name: "linux-prefers-same-dir",
+			goos: "linux",
+			self: "/usr/local/sbin/tailscaled",
+			fs: fstest.MapFS{
+				"usr/local/sbin/tailscaled": exe,
+				"usr/local/sbin/tailscale":  exe,
+				"usr/local/bin/tailscale":   exe,
+			},
+			want: "/usr/local/sbin/tailscale",
+		},
+		{
+			name: "linux-skips-non-executable",
+			goos: "linux",
+			self: "/usr/local/sbin/tailscaled",
+			fs: fstest.MapFS{
+				"usr/local/sbin/tailscaled": exe,
+				"usr/local/sbin/tailscale":  nonExe,
+				"usr/local/bin/tailscale":   exe,
+			},
+			want: "/usr/local/bin/tailscale",
+		},
+		{
+			name:    "linux-non-executable",
+			goos:    "linux",
+			self:    "/usr/local/sbin/tailscaled",
+			fs:      fstest.MapFS{"usr/local/sbin/tailscaled": exe, "usr/local/bin/tailscale": nonExe},
+			wantErr: true,
+		},
+		{
+			// Unlike on macOS and FreeBSD, there are no well-known
+			// locations to fall back to.
+			name:    "linux-elsewhere",
+			goos:    "linux",
+			self:    "/opt/tailscaled",
+			fs:      fstest.MapFS{"opt/tailscaled": exe, "usr/local/bin/tailscale": exe},
+			wantErr: true,
+		},
+		{
+			name: "darwin-same-dir",
+			goos: "darwin",
+			self: "/opt/homebrew/bin/tailscaled",
+			fs:   fstest.MapFS{"opt/homebrew/bin/tailscaled": exe, "opt/homebrew/bin/tailscale": exe},
+			want: "/opt/homebrew/bin/tailscale",
+		},
+		{
+			name: "darwin-prefers-same-dir",
+			goos: "darwin",
+			self: "/Users/me/go/bin/tailscaled",
+			fs: fstest.MapFS{
+				"Users/me/go/bin/tailscaled": exe,
+				"Users/me/go/bin/tailscale":  exe,
+				"usr/local/bin/tailscale":    exe,
+			},
+			want: "/Users/me/go/bin/tailscale",
+		},
+		{
+			name: "darwin-usr-local",
+			goos: "darwin",
+			self: "/usr/local/sbin/tailscaled",
+			fs:   fstest.MapFS{"usr/local/sbin/tailscaled": exe, "usr/local/bin/tailscale": exe},
+			want: "/usr/local/bin/tailscale",
+		},
+		{
+			name: "darwin-homebrew",
+			goos: "darwin",
+			self: "/Library/Tailscale/tailscaled",
+			fs:   fstest.MapFS{"Library/Tailscale/tailscaled": exe, "opt/homebrew/bin/tailscale": exe},
+			want: "/opt/homebrew/bin/tailscale",
+		},
+		{
+			name:    "darwin-dir-not-file",
+			goos:    "darwin",
+			self:    "/usr/local/bin/tailscaled",
+			fs:      fstest.MapFS{"usr/local/bin/tailscaled": exe, "usr/local/bin/tailscale/x": exe},
+			wantErr: true,
+		},
+		{
+			name:    "darwin-missing",
+			goos:    "darwin",
+			self:    "/usr/local/bin/tailscaled",
+			fs:      fstest.MapFS{"usr/local/bin/tailscaled": exe},
+			wantErr: true,
+		},
+		{
+			name: "freebsd-pkg",
+			goos: "freebsd",
+			self: "/usr/local/bin/tailscaled",
+			fs:   fstest.MapFS{"usr/local/bin/tailscaled": exe, "usr/local/bin/tailscale": exe},
+			want: "/usr/local/bin/tailscale",
+		},
+		{
+			name: "freebsd-usr-local",
+			goos: "freebsd",
+			self: "/usr/local/sbin/tailscaled",
+			fs:   fstest.MapFS{"usr/local/sbin/tailscaled": exe, "usr/local/bin/tailscale": exe},
+			want: "/usr/local/bin/tailscale",
+		},
+		{
+			// Homebrew's location is only used on macOS.
+			name:    "freebsd-missing",
+			goos:    "freebsd",
+			self:    "/usr/local/sbin/tailscaled",
+			fs:      fstest.MapFS{"usr/local/sbin/tailscaled": exe, "opt/homebrew/bin/tailscale": exe},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported",
+			goos:    "plan9",
+			self:    "/bin/tailscaled",
+			fs:      fstest.MapFS{"bin/tailscaled": exe, "bin/tailscale": exe},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findCmdTailscaleIn(tt.goos, tt.self, fakeStat(tt.fs))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q; want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCPUProfileSeconds(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 30 * time.Second, false},
+		{"5", 5 * time.Second, false},
+		{"120", 120 * time.Second, false},
+		{"600", 120 * time.Second, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"1.5", 0, true},
+		{"x", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUProfileSeconds(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCPUProfileSeconds(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleC2NCPUProfile(t *testing.T) {
+	if c2nCPUProfile == nil {
+		t.Skip("CPU profiles not supported")
+	}
+	setC2NExpensiveInterval(t, "-1s")
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	profile := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/cpuprofile?seconds=1", nil))
+		return rec
+	}
+
+	rec := profile()
+	if rec.Code != 200 {
+		t.Fatalf("got status %d; want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if rec.Body.Len() == 0 {
+		t.Error("empty profile")
+	}
+
+	// A profile's already running, so another is refused.
+	if err := pprof.StartCPUProfile(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	defer pprof.StopCPUProfile()
+	if rec := profile(); rec.Code != 409 {
+		t.Errorf("concurrent profile: got status %d; want 409", rec.Code)
+	}
+}
+
+func TestHandleC2NGoroutinesJSON(t *testing.T) {
+	setC2NExpensiveInterval(t, "-1s")
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/debug/goroutines?format=json", nil),
+		func() *http.Request {
+			r := httptest.NewRequest("GET", "/debug/goroutines", nil)
+			r.Header.Set("Accept", "application/json")
+			return r
+		}(),
+	} {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, req)
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%v: Content-Type = %q", req.URL, ct)
+		}
+		var gs []goroutines.Goroutine
+		if err := json.Unmarshal(rec.Body.Bytes(), &gs); err != nil {
+			t.Fatalf("%v: %v", req.URL, err)
+		}
+		if len(gs) == 0 || len(gs[0].Frames) == 0 {
+			t.Errorf("%v: got %+v; want goroutines with stacks", req.URL, gs)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("GET", "/debug/goroutines", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("default Content-Type = %q; want text/plain", ct)
+	}
+}
+
+func TestHandleC2NDebugMetricsNames(t *testing.T) {
+	setC2NExpensiveInterval(t, "-1s")
+	clientmetric.NewCounter("test_c2n_metrics_names_counter").Add(2)
+	clientmetric.NewGauge("test_c2n_metrics_names_gauge").Set(5)
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/debug/metrics?names=test_c2n_metrics_names_gauge,,test_c2n_metrics_names_counter&names=nonexistent", nil)
+	b.handleC2N(rec, req)
+	const want = `# TYPE test_c2n_metrics_names_counter counter
+test_c2n_metrics_names_counter 2
+# TYPE test_c2n_metrics_names_gauge gauge
+test_c2n_metrics_names_gauge 5
+`
+	if got := rec.Body.String(); rec.Code != http.StatusOK || got != want {
+		t.Errorf("got %d:\n%s\nwant:\n%s", rec.Code, got, want)
+	}
+	if !rec.Flushed {
+		t.Errorf("response wasn't flushed")
+	}
+
+	rec = httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("GET", "/debug/metrics", nil))
+	if got := rec.Body.String(); !strings.Contains(got, want) || len(got) == len(want) {
+		t.Errorf("without names, got:\n%s", got)
+	}
+}
+
+func TestHandleC2NLogtailRotate(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/logtail/rotate", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("without rotator: status = %d; want %d", rec.Code, http.StatusNotImplemented)
+	}
+
+	oldID := must.Get(logid.NewPrivateID()).Public()
+	newID := must.Get(logid.NewPrivateID()).Public()
+	b.backendLogID = oldID
+	var flushed bool
+	b.SetLogFlusher(func() { flushed = true })
+	b.SetLogIDRotator(func() (_, _ logid.PublicID, err error) {
+		if !flushed {
+			t.Error("rotated before flushing")
+		}
+		return oldID, newID, nil
+	})
+
+	rec = httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("GET", "/logtail/rotate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d; want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	rec = httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/logtail/rotate", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+	}
+	var res struct{ OldLogID, NewLogID logid.PublicID }
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.OldLogID != oldID || res.NewLogID != newID {
+		t.Errorf("got %+v; want old %v, new %v", res, oldID, newID)
+	}
+	if b.backendLogID != newID {
+		t.Errorf("backendLogID = %v; want %v", b.backendLogID, newID)
+	}
+}
+
+func TestHandleC2NLogtailFlush(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	flush := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/logtail/flush"+query, nil))
+		return rec
+	}
+	if rec := flush("?timeout=1"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("without waiter: status = %d; want %d", rec.Code, http.StatusNotImplemented)
+	}
+
+	var pending int64 = 100
+	b.SetLogFlusher(func() {})
+	b.SetLogFlushWaiter(func() int64 { return pending }, func(ctx context.Context) error {
+		if pending > 50 {
+			pending = 0
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if rec := flush(""); rec.Code != http.StatusNoContent {
+		t.Errorf("without timeout: status = %d; want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := flush("?timeout=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad timeout: status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	check := func(rec *httptest.ResponseRecorder, wantCode int, want c2nLogFlushResponse, wantErr bool) {
+		t.Helper()
+		if rec.Code != wantCode {
+			t.Fatalf("status = %d; want %d: %s", rec.Code, wantCode, rec.Body.Bytes())
+		}
+		var got c2nLogFlushResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if (got.Err != "") != wantErr {
+			t.Errorf("Err = %q; want error: %v", got.Err, wantErr)
+		}
+		got.Err = ""
+		if got != want {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	}
+	check(flush("?timeout=1"), http.StatusOK, c2nLogFlushResponse{
+		Flushed:            true,
+		PendingBytesBefore: 100,
+		PendingBytesAfter:  0,
+	}, false)
+
+	pending = 10
+	check(flush("?timeout=0.01"), http.StatusAccepted, c2nLogFlushResponse{
+		PendingBytesBefore: 10,
+		PendingBytesAfter:  10,
+	}, true)
+}
+
+func TestHandleC2NSockstatsCurrent(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	get := func() c2nSockStatsResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/sockstats/current", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		var res c2nSockStatsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	tstest.Replace(t, &c2nSockStats, func() *sockstats.SockStats { return nil })
+	if got := get(); got.Available || len(got.Stats) != 0 {
+		t.Errorf("without sockstats: got %+v; want empty", got)
+	}
+
+	tstest.Replace(t, &c2nSockStats, func() *sockstats.SockStats {
+		return &sockstats.SockStats{
+			Stats: map[sockstats.Label]sockstats.SockStat{
+				sockstats.LabelLogtailLogger:  {TxBytes: 100, RxBytes: 10},
+				sockstats.LabelDERPHTTPClient: {TxBytes: 5, RxBytes: 50},
+			},
+			CurrentInterfaceCellular: true,
+		}
+	})
+	want := c2nSockStatsResponse{
+		Available:                true,
+		CurrentInterfaceCellular: true,
+		Stats: map[string]sockstats.SockStat{
+			"LogtailLogger":  {TxBytes: 100, RxBytes: 10},
+			"DERPHTTPClient": {TxBytes: 5, RxBytes: 50},
+		},
+	}
+	if got := get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
+
+func TestHandleC2NHealth(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	health.SetDERPRegionHealth(123, "test problem")
+	t.Cleanup(func() { health.SetDERPRegionHealth(123, "") })
+
+	get := func() (res struct {
+		Healthy  bool             `json:"healthy"`
+		Warnings []health.Warning `json:"warnings"`
+	}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/health", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	found := func(ws []health.Warning) bool {
+		for _, w := range ws {
+			if w.Code == "derp-region-problem" && w.Message == "derp123: test problem" {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := get()
+	if res.Healthy || !found(res.Warnings) {
+		t.Errorf("got %+v; want unhealthy with the DERP region problem", res)
+	}
+	health.SetDERPRegionHealth(123, "")
+	if res := get(); found(res.Warnings) {
+		t.Errorf("after it's resolved, got %+v", res)
+	}
+}
+
+func TestHandleC2NComponentLogging(t *testing.T) {
+	sys := new(tsd.System)
+	sys.Set(new(mem.Store))
+	eng, err := wgengine.NewFakeUserspaceEngine(logger.Discard, sys.Set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(eng.Close)
+	sys.Set(eng)
+	b, err := NewLocalBackend(logger.Discard, logid.PublicID{}, sys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b.clock = clock
+
+	type response struct {
+		Error   string
+		Until   *time.Time
+		Enabled map[string]time.Time
+	}
+	get := func(query string) (res response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/debug/component-logging?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", query, rec.Code, rec.Body.Bytes())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := get("component=magicsock&secs=60")
+	want := clock.Now().Add(time.Minute)
+	if res.Error != "" || res.Until == nil || !res.Until.Equal(want) {
+		t.Fatalf("enable: got %+v; want Until %v", res, want)
+	}
+	if got := res.Enabled["magicsock"]; !got.Equal(want) || len(res.Enabled) != 1 {
+		t.Errorf("enable: Enabled = %v; want only magicsock until %v", res.Enabled, want)
+	}
+
+	res = get("component=magicsock&secs=0")
+	if res.Error != "" || res.Until != nil || len(res.Enabled) != 0 {
+		t.Errorf("disable: got %+v; want disabled", res)
+	}
+	if got := b.GetComponentDebugLogging("magicsock"); !got.IsZero() {
+		t.Errorf("after disable, enabled until %v", got)
+	}
+
+	if res := get("component=bogus&secs=60"); res.Error == "" || res.Until != nil {
+		t.Errorf("unknown component: got %+v; want error", res)
+	}
+
+	status := func() map[string]int64 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/component-logging/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		var m map[string]int64
+		if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	if m := status(); len(m) != 0 {
+		t.Errorf("status with none enabled = %v; want empty", m)
+	}
+	get("component=magicsock&secs=90")
+	clock.Advance(500 * time.Millisecond)
+	if m := status(); len(m) != 1 || m["magicsock"] != 90 {
+		t.Errorf("status = %v; want magicsock: 90", m)
+	}
+	// Checking the status doesn't change it.
+	if got := b.GetComponentDebugLogging("magicsock"); got.IsZero() {
+		t.Error("magicsock disabled by status")
+	}
+
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/debug/component-logging?component=magicsock&secs=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad secs: status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetSSHUsernamesCached(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	b := &LocalBackend{clock: clock}
+	var calls int
+	tstest.Replace(t, &c2nSSHUsernames, func(b *LocalBackend, req *tailcfg.C2NSSHUsernamesRequest) (*tailcfg.C2NSSHUsernamesResponse, error) {
+		calls++
+		return &tailcfg.C2NSSHUsernamesResponse{Usernames: []string{fmt.Sprintf("user%d", calls)}}, nil
+	})
+	get := func(req *tailcfg.C2NSSHUsernamesRequest) string {
+		t.Helper()
+		res, err := b.getSSHUsernamesCached(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(res.Usernames, ",")
+	}
+	check := func(name string, req *tailcfg.C2NSSHUsernamesRequest, want string) {
+		t.Helper()
+		if got := get(req); got != want {
+			t.Errorf("%s: got %q; want %q", name, got, want)
+		}
+	}
+
+	req := &tailcfg.C2NSSHUsernamesRequest{Max: 3, Exclude: map[string]bool{"root": true}}
+	check("first", req, "user1")
+	clock.Advance(sshUsernamesCacheTTL - time.Second)
+	check("within TTL", &tailcfg.C2NSSHUsernamesRequest{Max: 3, Exclude: map[string]bool{"root": true}}, "user1")
+	check("different request", &tailcfg.C2NSSHUsernamesRequest{Max: 4}, "user2")
+	check("NoCache", &tailcfg.C2NSSHUsernamesRequest{Max: 3, Exclude: map[string]bool{"root": true}, NoCache: true}, "user3")
+	check("after NoCache", req, "user3")
+	clock.Advance(sshUsernamesCacheTTL)
+	check("after TTL", req, "user4")
+
+	b.mu.Lock()
+	b.invalidateSSHUsernamesCacheLocked()
+	b.mu.Unlock()
+	check("after invalidation", req, "user5")
+}
+
+func TestC2NRoutes(t *testing.T) {
+	valid := map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, c2nAnyMethod: true}
+	for path, route := range c2nRoutes {
+		if len(route.methods) == 0 {
+			t.Errorf("%s: no methods declared", path)
+		}
+		if slices.Contains(route.methods, c2nAnyMethod) && len(route.methods) != 1 {
+			t.Errorf("%s: %q accepts any method, and more", path, route.methods)
+		}
+		if slices.Contains(route.methods, c2nAnyMethod) && route.mutates {
+			t.Errorf("%s: mutates, but accepts any method", path)
+		}
+		seen := map[string]bool{}
+		for _, m := range route.methods {
+			if !valid[m] || seen[m] {
+				t.Errorf("%s: bad or repeated method %q in %q", path, m, route.methods)
+			}
+			seen[m] = true
+		}
+		if route.mutates && !seen["POST"] && !seen["PUT"] && !seen["PATCH"] && !seen["DELETE"] {
+			t.Errorf("%s: mutates, but only accepts %q", path, route.methods)
+		}
+		if route.handle == nil {
+			t.Errorf("%s: no handler", path)
+		}
+	}
+}
+
+// c2nStateChangingPaths are the c2n paths whose non-GET requests change the
+// node's configuration or how it connects, and so must be refused unless
+// the node has opted in to c2n mutations. Add to it when adding such a path.
+var c2nStateChangingPaths = []string{
+	"/prefs",
+	"/prefs/os-version",
+	"/prefs/exitnode",
+	"/prefs/shieldsup",
+	"/prefs/routes",
+	"/keyexpiry",
+	"/logtail/level",
+	"/dns/reapply",
+	"/debug/ipfamily",
+	"/debug/disable-derp",
+	"/debug/derp/pin",
+	"/debug/rebind",
+	"/debug/derp-failover-test",
+	"/debug/disco-rekey",
+	"/debug/certs/renew",
+	"/debug/portmap",
+}
+
+// c2nUngatedStateChangingPaths are the c2n paths whose non-GET requests
+// change some state, but which aren't marked mutates, for the reasons given
+// in the c2nRoute.mutates docs.
+var c2nUngatedStateChangingPaths = []string{
+	"/update",
+	"/restart",
+	"/logtail/rotate",
+	"/logtail/tail",
+	"/debug/panics",
+	"/update/history",
+	"/debug/drops",
+	"/debug/handshake-failures",
+	"/debug/magicsock/stats",
+	"/refresh",
+	"/debug/captive-portal/recheck",
+}
+
+func TestC2NStateChangingRoutesMutate(t *testing.T) {
+	want := map[string]bool{}
+	for _, path := range c2nStateChangingPaths {
+		want[path] = true
+		if route, ok := c2nRoutes[path]; !ok {
+			t.Errorf("%s: not a c2n route", path)
+		} else if !route.mutates {
+			t.Errorf("%s: changes state, but isn't marked mutates", path)
+		}
+	}
+	for path, route := range c2nRoutes {
+		if route.mutates && !want[path] {
+			t.Errorf("%s: marked mutates, but not in c2nStateChangingPaths", path)
+		}
+	}
+	for _, path := range c2nUngatedStateChangingPaths {
+		if route, ok := c2nRoutes[path]; !ok {
+			t.Errorf("%s: not a c2n route", path)
+		} else if route.mutates {
+			t.Errorf("%s: in c2nUngatedStateChangingPaths, but marked mutates", path)
+		}
+	}
+}
+
+// TestHandleC2NBaselineMethods pins the methods accepted by the c2n paths
+// that existed before c2nRoutes, which must keep accepting what they did.
+func TestHandleC2NBaselineMethods(t *testing.T) {
+	setC2NExpensiveInterval(t, "-1s")
+	b := newC2NPrefsTestBackend(t)
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/echo", http.StatusOK},
+		{"PUT", "/echo", http.StatusOK},
+		{"DELETE", "/echo", http.StatusOK},
+		{"GET", "/update", http.StatusOK},
+		{"PUT", "/update", http.StatusMethodNotAllowed},
+		{"GET", "/logtail/flush", http.StatusMethodNotAllowed},
+		{"PUT", "/debug/goroutines", http.StatusOK},
+		{"DELETE", "/debug/prefs", http.StatusOK},
+		{"PATCH", "/debug/metrics", http.StatusOK},
+		{"PUT", "/debug/component-logging", http.StatusOK},
+		{"PUT", "/debug/logheap", http.StatusOK},
+		{"PUT", "/ssh/usernames", http.StatusOK},
+		{"GET", "/sockstats", http.StatusMethodNotAllowed},
+		{"GET", "/no-such-path", http.StatusBadRequest},
+		{"PUT", "/no-such-path", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d; want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body.Bytes())
+		}
+	}
+}
+
+func TestHandleC2NDispatch(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/echo", http.StatusOK},
+		{"PUT", "/echo/info", http.StatusMethodNotAllowed},
+		{"GET", "/no-such-path", http.StatusBadRequest},
+		{"POST", "/sockstats/current", http.StatusMethodNotAllowed},
+		{"PUT", "/debug/panics", http.StatusMethodNotAllowed},
+		{"GET", "/debug/disco-rekey", http.StatusMethodNotAllowed},
+		// Mutating routes are refused, as this node hasn't opted in.
+		{"POST", "/debug/disco-rekey", http.StatusForbidden},
+		{"POST", "/debug/derp-failover-test", http.StatusForbidden},
+		{"POST", "/debug/certs/renew", http.StatusForbidden},
+		{"POST", "/prefs/os-version", http.StatusForbidden},
+		{"POST", "/debug/ipfamily?force=ipv4", http.StatusForbidden},
+		{"POST", "/debug/disable-derp?secs=60", http.StatusForbidden},
+		{"POST", "/debug/derp/pin?pin=1", http.StatusForbidden},
+		{"POST", "/debug/portmap", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: got status %d; want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleC2NDebugIPFamilyBadSecs(t *testing.T) {
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	for _, secs := range []string{"abc", "1.5", "60s"} {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/debug/ipfamily?force=ipv4&secs="+secs, nil))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid 'secs' parameter") {
+			t.Errorf("secs=%s: got %d %q; want 400 invalid 'secs' parameter", secs, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestC2NClampToDeadline(t *testing.T) {
+	if got := c2nClampToDeadline(context.Background(), time.Hour); got != time.Hour {
+		t.Errorf("without a deadline = %v; want 1h", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if got := c2nClampToDeadline(ctx, time.Hour); got > time.Minute || got < 50*time.Second {
+		t.Errorf("with a deadline in 1m = %v; want about 1m", got)
+	}
+	if got := c2nClampToDeadline(ctx, time.Second); got != time.Second {
+		t.Errorf("before the deadline = %v; want 1s", got)
+	}
+}
+
+func TestHandleC2NDebugPathEvents(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+
+	// The window ends at the request's deadline, well before "secs".
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	b.handleC2N(rec, httptest.NewRequest("POST", "/debug/pathevents?secs=30", nil).WithContext(ctx))
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("took %v; want it to end at the request's deadline", d)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+	}
+	// With no path changes, there's just the last record, which reports
+	// drops in the body as control doesn't get trailers.
+	var end c2nPathEventsEnd
+	if err := json.Unmarshal(rec.Body.Bytes(), &end); err != nil {
+		t.Fatalf("%q: %v", rec.Body.Bytes(), err)
+	}
+	if !end.Done || end.DroppedEvents != 0 {
+		t.Errorf("last record = %+v; want done with no drops", end)
+	}
+	if len(rec.Result().Trailer) != 0 {
+		t.Errorf("trailers = %v; want none", rec.Result().Trailer)
+	}
+}
+
+func TestHandleC2NDNSReapply(t *testing.T) {
+	old := envknob.String("TS_ALLOW_C2N_MUTATIONS")
+	envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", "true")
+	t.Cleanup(func() { envknob.Setenv("TS_ALLOW_C2N_MUTATIONS", old) })
+
+	osCfg, _ := dns.NewNoopManager()
+	dm := dns.NewManager(t.Logf, osCfg, nil, new(tsdial.Dialer), nil)
+	sys := new(tsd.System)
+	sys.Set(dm)
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}, sys: sys}
+
+	reapply := func() (res c2nDNSReapplyResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("POST", "/dns/reapply", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := reapply(); res.Applied || res.Error == "" {
+		t.Errorf("before the config is set: got %+v; want an error", res)
+	}
+
+	if err := dm.Set(dns.Config{SearchDomains: []dnsname.FQDN{"ts.com."}}); err != nil {
+		t.Fatal(err)
+	}
+	res := reapply()
+	if !res.Applied || res.Error != "" {
+		t.Fatalf("got %+v; want applied, with no error", res)
+	}
+	if res.Flushed == res.FlushSkipped || res.FlushSkipped != !dm.CanFlushCaches() {
+		t.Errorf("got Flushed %v, FlushSkipped %v; want FlushSkipped %v and Flushed the opposite", res.Flushed, res.FlushSkipped, !dm.CanFlushCaches())
+	}
+	if len(res.DNS.SearchDomains) != 1 || res.DNS.SearchDomains[0] != "ts.com." {
+		t.Errorf("applied search domains = %v; want [ts.com.]", res.DNS.SearchDomains)
+	}
+}
+
+func TestHandleC2NEchoInfo(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("GET", "/echo/info", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+	}
+	var res c2nEchoInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// Not via controlclient, so there's nothing to say about the transport.
+	if res.Path != "control" || res.Transport != "unknown" || res.RemoteAddr != "" {
+		t.Errorf("got %+v; want path control, transport unknown", res)
+	}
+}
+
+func TestHandleC2NDebugSubnetRoutes(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	pfx := netip.MustParsePrefix
+	get := func(wantCode int) (res c2nSubnetRoutes) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/subnet-routes", nil))
+		if rec.Code != wantCode {
+			t.Fatalf("status = %d; want %d: %s", rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	get(http.StatusServiceUnavailable) // no netmap yet
+
+	b.netMap = &netmap.NetworkMap{SelfNode: (&tailcfg.Node{
+		AllowedIPs:    []netip.Prefix{pfx("100.64.0.1/32"), pfx("10.0.0.0/24")},
+		PrimaryRoutes: []netip.Prefix{pfx("10.0.0.0/24")},
+	}).View()}
+	tests := []struct {
+		name         string
+		routes       []netip.Prefix
+		wantRoutes   []c2nSubnetRoute
+		wantProblems []string // that must be among the Problems
+	}{
+		{
+			name:         "none",
+			wantProblems: []string{"no routes are advertised"},
+		},
+		{
+			name:   "approved and not",
+			routes: []netip.Prefix{pfx("10.0.0.0/24"), pfx("10.1.0.0/24")},
+			wantRoutes: []c2nSubnetRoute{
+				{Prefix: pfx("10.0.0.0/24"), Approved: true, Primary: true},
+				{Prefix: pfx("10.1.0.0/24")},
+			},
+			wantProblems: []string{"route 10.1.0.0/24 is advertised but not approved"},
+		},
+	}
+	for _, tt := range tests {
+		if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+			Prefs:              ipn.Prefs{AdvertiseRoutes: tt.routes},
+			AdvertiseRoutesSet: true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		res := get(http.StatusOK)
+		if !reflect.DeepEqual(res.Routes, tt.wantRoutes) {
+			t.Errorf("%s: routes = %+v; want %+v", tt.name, res.Routes, tt.wantRoutes)
+		}
+		for _, p := range tt.wantProblems {
+			if !slices.Contains(res.Problems, p) {
+				t.Errorf("%s: problems = %q; want %q among them", tt.name, res.Problems, p)
+			}
+		}
+		if res.NetfilterMode == "" {
+			t.Errorf("%s: no NetfilterMode", tt.name)
+		}
+	}
+}
+
+func TestHandleC2NDebugMagicDNSLookup(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	type response struct {
+		Name     string
+		Addrs    []netip.Addr
+		MagicDNS bool
+	}
+	get := func(query string, wantCode int) (res response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/magicdns-lookup?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s: status = %d; want %d: %s", query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	get("name=peer", http.StatusServiceUnavailable) // no netmap yet
+
+	b.netMap = &netmap.NetworkMap{
+		Name:      "self.tail-scale.ts.net.",
+		Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+		Peers: []tailcfg.NodeView{(&tailcfg.Node{
+			ID:        2,
+			Name:      "peer.tail-scale.ts.net.",
+			Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32"), netip.MustParsePrefix("fd7a:115c:a1e0::2/128")},
+		}).View()},
+	}
+	tests := []struct {
+		query    string
+		wantCode int
+		wantName string
+	}{
+		{"", http.StatusBadRequest, ""},
+		{"name=nobody", http.StatusNotFound, ""},
+		{"name=peer.example.com", http.StatusNotFound, ""},
+		{"name=peer", http.StatusOK, "peer.tail-scale.ts.net."},
+		{"name=peer.tail-scale.ts.net", http.StatusOK, "peer.tail-scale.ts.net."},
+		{"name=peer.tail-scale.ts.net.", http.StatusOK, "peer.tail-scale.ts.net."},
+		{"name=self", http.StatusOK, "self.tail-scale.ts.net."},
+	}
+	for _, tt := range tests {
+		res := get(tt.query, tt.wantCode)
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		if res.Name != tt.wantName {
+			t.Errorf("%s: name = %q; want %q", tt.query, res.Name, tt.wantName)
+		}
+		// The self node has only an IPv4 address, so MagicDNS leaves out
+		// the peer's IPv6 one.
+		if len(res.Addrs) != 1 || !res.Addrs[0].Is4() {
+			t.Errorf("%s: addrs = %v; want one IPv4 address", tt.query, res.Addrs)
+		}
+	}
+}
+
+func TestHandleC2NDebugAdvertisedTags(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	type response struct {
+		Requested, Granted, Missing, Extra []string
+	}
+	get := func(wantCode int) (res response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/advertised-tags", nil))
+		if rec.Code != wantCode {
+			t.Fatalf("status = %d; want %d: %s", rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	get(http.StatusServiceUnavailable) // no netmap yet
+
+	tests := []struct {
+		name      string
+		requested []string
+		granted   []string
+		want      response
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:      "all granted",
+			requested: []string{"tag:a", "tag:b"},
+			granted:   []string{"tag:b", "tag:a"},
+			want:      response{Requested: []string{"tag:a", "tag:b"}, Granted: []string{"tag:b", "tag:a"}},
+		},
+		{
+			name:      "missing and extra",
+			requested: []string{"tag:a", "tag:b"},
+			granted:   []string{"tag:a", "tag:authkey"},
+			want: response{
+				Requested: []string{"tag:a", "tag:b"},
+				Granted:   []string{"tag:a", "tag:authkey"},
+				Missing:   []string{"tag:b"},
+				Extra:     []string{"tag:authkey"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+			Prefs:            ipn.Prefs{AdvertiseTags: tt.requested},
+			AdvertiseTagsSet: true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		b.netMap = &netmap.NetworkMap{SelfNode: (&tailcfg.Node{Tags: tt.granted}).View()}
+		if got := get(http.StatusOK); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleC2NDebugCaptivePortalRecheck(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	do := func(method string, wantCode int) (res magicsock.CaptivePortalCheck) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/debug/captive-portal/recheck", nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s: status = %d; want %d: %s", method, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res
+	}
+	do("GET", http.StatusMethodNotAllowed)
+	do("POST", http.StatusBadGateway) // no DERP map yet
+
+	// A portal that intercepts the DERP server's /generate_204.
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "please log in")
+	}))
+	defer portal.Close()
+	mc, err := b.magicConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc.SetDERPMap(&tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+		1: {RegionID: 1, Nodes: []*tailcfg.DERPNode{
+			{Name: "1a", RegionID: 1, HostName: portal.Listener.Addr().String(), STUNPort: -1},
+		}},
+	}})
+	res := do("POST", http.StatusOK)
+	if !res.Detected || res.CheckedAt.IsZero() {
+		t.Errorf("got %+v; want a captive portal detected", res)
+	}
+	if got := mc.CaptivePortal(); got.Detected != res.Detected || !got.CheckedAt.Equal(res.CheckedAt) {
+		t.Errorf("CaptivePortal = %+v; want the recheck's %+v", got, res)
+	}
+}
+
+func TestHandleC2NDebugDrops(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	do := func(method, query string, wantCode int) map[dropstats.Reason]int64 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(method, "/debug/drops?"+query, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: status = %d; want %d: %s", method, query, rec.Code, wantCode, rec.Body.Bytes())
+		}
+		var res struct {
+			Drops map[dropstats.Reason]int64
+		}
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.Drops
+	}
+
+	dropstats.Add(dropstats.ReasonDiscoParse)
+	if got := do("GET", "", http.StatusOK); got[dropstats.ReasonDiscoParse] == 0 || len(got) != 3 {
+		t.Errorf("GET = %v; want all reasons, with a disco-parse drop", got)
+	}
+	do("POST", "", http.StatusBadRequest)
+	do("POST", "reset=1", http.StatusBadRequest)
+	if got := do("GET", "", http.StatusOK); got[dropstats.ReasonDiscoParse] == 0 {
+		t.Errorf("refused reset zeroed the counts: %v", got)
+	}
+	if got := do("POST", "reset=true", http.StatusOK); got[dropstats.ReasonDiscoParse] == 0 {
+		t.Errorf("reset = %v; want the counts before the reset", got)
+	}
+	if got := do("GET", "", http.StatusOK); got[dropstats.ReasonDiscoParse] != 0 {
+		t.Errorf("after reset, GET = %v; want zeroes", got)
+	}
+}
+
+func TestHandleC2NDebugHandshakeFailures(t *testing.T) {
+	b := newC2NPrefsTestBackend(t)
+	b.netMap = &netmap.NetworkMap{Peers: []tailcfg.NodeView{(&tailcfg.Node{
+		ID:       2,
+		StableID: "peer2",
+		Key:      key.NewNode().Public(),
+	}).View()}}
+	tests := []struct {
+		method, query string
+		want          int
+	}{
+		{"GET", "peer=peer2", http.StatusOK},
+		{"GET", "", http.StatusBadRequest},
+		{"GET", "peer=nobody", http.StatusNotFound},
+		{"POST", "peer=peer2", http.StatusBadRequest},
+		{"POST", "peer=peer2&reset=1", http.StatusBadRequest},
+		{"POST", "peer=peer2&reset=true", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest(tt.method, "/debug/handshake-failures?"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d; want %d: %s", tt.method, tt.query, rec.Code, tt.want, rec.Body.Bytes())
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		var res struct {
+			Peer     tailcfg.StableNodeID
+			Failures int64
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Peer != "peer2" || res.Failures != 0 {
+			t.Errorf("%s %s: got %+v; want peer2 with no failures", tt.method, tt.query, res)
+		}
+	}
+}
+
+func TestHandleC2NDebugPower(t *testing.T) {
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("GET", "/debug/power", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+	}
+	var res map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// The timings are reported under a name that doesn't suggest that
+	// they adapt to the power source.
+	if _, ok := res["FixedDiscoTimings"]; !ok || len(res) != 2 || string(res["Power"]) == `""` {
+		t.Errorf("got %s; want Power and FixedDiscoTimings", rec.Body.Bytes())
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/version"
+)
+
+// c2nUpdateHistorySize is how many c2n /update attempts are remembered for
+// c2n /update/history.
+const c2nUpdateHistorySize = 10
+
+// c2nUpdateAttempt is a c2n /update attempt, as reported by c2n
+// /update/history.
+type c2nUpdateAttempt struct {
+	Time          time.Time `json:"time"`
+	FromVersion   string    `json:"fromVersion"`
+	TargetVersion string    `json:"targetVersion,omitempty"` // empty if the latest version wasn't known
+	Started       bool      `json:"started"`
+	Err           string    `json:"err,omitempty"`
+	ErrReason     string    `json:"errReason,omitempty"` // see tailcfg.C2NUpdateResponse.ErrReason
+}
+
+// recordC2NUpdateAttempt adds the c2n /update attempt made at start, to
+// update to target, with the result res, to b.c2nUpdateHistory.
+func (b *LocalBackend) recordC2NUpdateAttempt(start time.Time, target string, res tailcfg.C2NUpdateResponse) {
+	a := c2nUpdateAttempt{
+		Time:          start,
+		FromVersion:   version.Long(),
+		TargetVersion: target,
+		Started:       res.Started,
+		Err:           res.Err,
+		ErrReason:     res.ErrReason,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.c2nUpdateHistory) >= c2nUpdateHistorySize {
+		b.c2nUpdateHistory = slices.Delete(b.c2nUpdateHistory, 0, len(b.c2nUpdateHistory)-c2nUpdateHistorySize+1)
+	}
+	b.c2nUpdateHistory = append(b.c2nUpdateHistory, a)
+}
+
+// handleC2NUpdateHistory reports the most recent c2n /update attempts since
+// tailscaled started, oldest first. A DELETE forgets them.
+func (b *LocalBackend) handleC2NUpdateHistory(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	if r.Method == "DELETE" {
+		b.c2nUpdateHistory = nil
+		b.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	attempts := append([]c2nUpdateAttempt{}, b.c2nUpdateHistory...)
+	b.mu.Unlock()
+	writeJSON(w, struct{ Attempts []c2nUpdateAttempt }{attempts})
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/version"
+)
+
+func TestHandleC2NUpdateHistory(t *testing.T) {
+	fakeCmdTailscale(t, true)
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+
+	history := func() []c2nUpdateAttempt {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/update/history", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		var res struct{ Attempts []c2nUpdateAttempt }
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res.Attempts
+	}
+	if got := history(); len(got) != 0 {
+		t.Fatalf("initial history = %+v; want empty", got)
+	}
+
+	// GETs of /update aren't attempts.
+	b.handleC2NUpdate(httptest.NewRecorder(), httptest.NewRequest("GET", "/update", nil))
+	b.handleC2NUpdate(httptest.NewRecorder(), httptest.NewRequest("POST", "/update", nil))
+	got := history()
+	if len(got) != 1 {
+		t.Fatalf("history = %+v; want 1 attempt", got)
+	}
+	if a := got[0]; a.Time.IsZero() || a.FromVersion != version.Long() || a.TargetVersion != "1.99.0" || a.Started || !strings.HasPrefix(a.Err, "failed to start") {
+		t.Errorf("attempt = %+v; want a failed attempt to start 1.99.0", a)
+	}
+
+	// Only the most recent attempts are kept.
+	for i := 0; i < c2nUpdateHistorySize+5; i++ {
+		b.recordC2NUpdateAttempt(b.clock.Now(), "1.100.0", tailcfg.C2NUpdateResponse{Started: true})
+	}
+	got = history()
+	if len(got) != c2nUpdateHistorySize {
+		t.Fatalf("got %d attempts; want %d", len(got), c2nUpdateHistorySize)
+	}
+	for _, a := range got {
+		if a.TargetVersion != "1.100.0" {
+			t.Errorf("got old attempt %+v", a)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	b.handleC2N(rec, httptest.NewRequest("DELETE", "/update/history", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d; want 204", rec.Code)
+	}
+	if got := history(); len(got) != 0 {
+		t.Errorf("history after DELETE = %+v; want empty", got)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+
+	"tailscale.com/clientupdate"
+	"tailscale.com/version"
+)
+
+// c2nUpdateInfo is the response to c2n /update/info.
+type c2nUpdateInfo struct {
+	// InstallMethod is how Tailscale appears to have been installed: one
+	// of the clientupdate.InstallMethod* constants, such as "apt" or
+	// "msi". It's "unknown" if clientupdate doesn't know how to update
+	// this installation.
+	InstallMethod string `json:"installMethod"`
+
+	// Channel is the release track that the running version is on,
+	// "stable" or "unstable".
+	Channel string `json:"channel"`
+
+	// CanSelfUpdate is whether a POST to c2n /update could update this
+	// node, if remote updates were enabled, and UnsupportedReason is why
+	// not if it can't.
+	CanSelfUpdate     bool   `json:"canSelfUpdate"`
+	UnsupportedReason string `json:"unsupportedReason,omitempty"`
+
+	CurrentVersion     string `json:"currentVersion"`
+	LatestKnownVersion string `json:"latestKnownVersion,omitempty"` // empty if it couldn't be found
+}
+
+// handleC2NUpdateInfo reports how this node was installed and whether c2n
+// /update can update it.
+func (b *LocalBackend) handleC2NUpdateInfo(w http.ResponseWriter, r *http.Request) {
+	unsupported, _ := c2nUpdateUnsupported()
+	res := c2nUpdateInfo{
+		InstallMethod:     c2nInstallMethod(),
+		Channel:           clientupdate.Track(),
+		CanSelfUpdate:     unsupported == "",
+		UnsupportedReason: unsupported,
+		CurrentVersion:    version.Long(),
+	}
+	if res.InstallMethod == clientupdate.InstallMethodUnknown && res.CanSelfUpdate {
+		// Don't claim that an installation we can't identify can be
+		// updated.
+		res.CanSelfUpdate = false
+		res.UnsupportedReason = c2nUpdateErrUnsupported
+	}
+	// Best effort, like a GET of /update.
+	res.LatestKnownVersion, _ = c2nLatestVersion()
+	writeJSON(w, res)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/clientupdate"
+	"tailscale.com/tstime"
+	"tailscale.com/version"
+)
+
+func TestHandleC2NUpdateInfo(t *testing.T) {
+	oldUnsupported, oldMethod, oldLatest := c2nUpdateUnsupported, c2nInstallMethod, c2nLatestVersion
+	t.Cleanup(func() {
+		c2nUpdateUnsupported, c2nInstallMethod, c2nLatestVersion = oldUnsupported, oldMethod, oldLatest
+	})
+	b := &LocalBackend{logf: t.Logf, clock: tstime.StdClock{}}
+
+	tests := []struct {
+		name        string
+		method      string
+		unsupported string
+		latestErr   error
+		want        c2nUpdateInfo
+	}{
+		{
+			name:   "apt",
+			method: clientupdate.InstallMethodApt,
+			want: c2nUpdateInfo{
+				InstallMethod:      clientupdate.InstallMethodApt,
+				CanSelfUpdate:      true,
+				LatestKnownVersion: "1.99.0",
+			},
+		},
+		{
+			name:        "macsys_ext",
+			method:      clientupdate.InstallMethodMacSys,
+			unsupported: c2nUpdateErrMacSysExt,
+			want: c2nUpdateInfo{
+				InstallMethod:      clientupdate.InstallMethodMacSys,
+				UnsupportedReason:  c2nUpdateErrMacSysExt,
+				LatestKnownVersion: "1.99.0",
+			},
+		},
+		{
+			name:      "unknown_method",
+			method:    clientupdate.InstallMethodUnknown,
+			latestErr: errors.New("offline"),
+			want: c2nUpdateInfo{
+				InstallMethod:     clientupdate.InstallMethodUnknown,
+				UnsupportedReason: c2nUpdateErrUnsupported,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c2nInstallMethod = func() string { return tt.method }
+			c2nUpdateUnsupported = func() (string, string) { return tt.unsupported, clientupdate.ReasonUnsupported }
+			c2nLatestVersion = func() (string, error) {
+				if tt.latestErr != nil {
+					return "", tt.latestErr
+				}
+				return "1.99.0", nil
+			}
+			rec := httptest.NewRecorder()
+			b.handleC2N(rec, httptest.NewRequest("GET", "/update/info", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+			}
+			var got c2nUpdateInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Channel = clientupdate.Track()
+			tt.want.CurrentVersion = version.Long()
+			if got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
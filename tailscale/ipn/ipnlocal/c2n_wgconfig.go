@@ -0,0 +1,119 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http"
+	"net/netip"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// c2nWGConfig is the response to c2n /debug/wgconfig: the node's WireGuard
+// config, without its private key or network logging IDs.
+//
+// It's built field by field, rather than from a scrubbed copy of the
+// wgcfg.Config, so that fields added to wgcfg later can't leak into it.
+type c2nWGConfig struct {
+	Name           string               `json:"name,omitempty"`
+	NodeID         tailcfg.StableNodeID `json:"nodeID,omitempty"`
+	PublicKey      string               `json:"publicKey,omitempty"`
+	Addresses      []netip.Prefix       `json:"addresses"`
+	MTU            uint16               `json:"mtu,omitempty"`
+	DNS            []netip.Addr         `json:"dns,omitempty"`
+	NetworkLogging bool                 `json:"networkLogging"` // whether it's enabled; its IDs are secret
+	Peers          []c2nWGPeer          `json:"peers"`
+}
+
+// c2nWGPeer is a peer in a c2nWGConfig.
+type c2nWGPeer struct {
+	PublicKey           string         `json:"publicKey"`
+	DiscoKey            string         `json:"discoKey,omitempty"`
+	AllowedIPs          []netip.Prefix `json:"allowedIPs"`
+	V4MasqAddr          *netip.Addr    `json:"v4MasqAddr,omitempty"`
+	PersistentKeepalive uint16         `json:"persistentKeepalive,omitempty"`
+
+	// DERP and Endpoints are the peer's home DERP region and endpoints,
+	// from the netmap.
+	DERP      string   `json:"derp,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// Live is whether the peer is currently configured in wireguard-go,
+	// which idle peers are trimmed from.
+	Live bool `json:"live"`
+
+	// LastHandshake is when the peer's last WireGuard handshake completed,
+	// and LastHandshakeAgeSecs how long ago that was. Both are omitted if
+	// it's not live or has never completed one.
+	LastHandshake        *time.Time `json:"lastHandshake,omitempty"`
+	LastHandshakeAgeSecs *float64   `json:"lastHandshakeAgeSecs,omitempty"`
+
+	RxBytes int64 `json:"rxBytes,omitempty"`
+	TxBytes int64 `json:"txBytes,omitempty"`
+}
+
+// handleC2NDebugWGConfig reports the WireGuard config that's installed. With
+// "short=1", public keys are truncated.
+func (b *LocalBackend) handleC2NDebugWGConfig(w http.ResponseWriter, r *http.Request) {
+	short := r.FormValue("short") == "1"
+	fmtKey := func(k key.NodePublic) string {
+		if short {
+			return k.ShortString()
+		}
+		return k.String()
+	}
+
+	cfg, live := b.e.WireGuardConfig()
+	res := c2nWGConfig{
+		Name:           cfg.Name,
+		NodeID:         cfg.NodeID,
+		Addresses:      cfg.Addresses,
+		MTU:            cfg.MTU,
+		DNS:            cfg.DNS,
+		NetworkLogging: !cfg.NetworkLogging.NodeID.IsZero() && !cfg.NetworkLogging.DomainID.IsZero(),
+		Peers:          make([]c2nWGPeer, 0, len(cfg.Peers)),
+	}
+	if !cfg.PrivateKey.IsZero() {
+		res.PublicKey = fmtKey(cfg.PrivateKey.Public())
+	}
+
+	b.mu.Lock()
+	nm := b.netMap
+	b.mu.Unlock()
+	peers := make(map[key.NodePublic]tailcfg.NodeView)
+	if nm != nil {
+		for _, p := range nm.Peers {
+			peers[p.Key()] = p
+		}
+	}
+
+	now := b.clock.Now()
+	for _, p := range cfg.Peers {
+		wp := c2nWGPeer{
+			PublicKey:           fmtKey(p.PublicKey),
+			AllowedIPs:          p.AllowedIPs,
+			V4MasqAddr:          p.V4MasqAddr,
+			PersistentKeepalive: p.PersistentKeepalive,
+		}
+		if !p.DiscoKey.IsZero() {
+			wp.DiscoKey = p.DiscoKey.ShortString()
+		}
+		if n, ok := peers[p.PublicKey]; ok {
+			wp.DERP = n.DERP()
+			wp.Endpoints = n.Endpoints().AsSlice()
+		}
+		if st, ok := live[p.PublicKey]; ok {
+			wp.Live = true
+			wp.RxBytes, wp.TxBytes = st.RxBytes, st.TxBytes
+			if t := st.LastHandshake; !t.IsZero() {
+				age := now.Sub(t).Seconds()
+				wp.LastHandshake, wp.LastHandshakeAgeSecs = &t, &age
+			}
+		}
+		res.Peers = append(res.Peers, wp)
+	}
+	writeJSON(w, res)
+}
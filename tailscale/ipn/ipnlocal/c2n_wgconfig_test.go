@@ -0,0 +1,122 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tstest"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logid"
+	"tailscale.com/wgengine"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+// wgConfigEngine is a wgengine.Engine whose WireGuardConfig is canned.
+type wgConfigEngine struct {
+	wgengine.Engine
+	cfg  *wgcfg.Config
+	live map[key.NodePublic]ipnstate.PeerStatusLite
+}
+
+func (e *wgConfigEngine) WireGuardConfig() (*wgcfg.Config, map[key.NodePublic]ipnstate.PeerStatusLite) {
+	return e.cfg, e.live
+}
+
+func TestHandleC2NDebugWGConfig(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	priv := key.NewNode()
+	nodeLogID, err := logid.NewPrivateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	domainLogID, err := logid.NewPrivateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, idle := key.NewNode().Public(), key.NewNode().Public()
+	cfg := &wgcfg.Config{
+		Name:       "tailscale0",
+		PrivateKey: priv,
+		Addresses:  []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+		Peers: []wgcfg.Peer{
+			{PublicKey: live, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")}},
+			{PublicKey: idle, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.3/32")}},
+		},
+	}
+	cfg.NetworkLogging.NodeID = nodeLogID
+	cfg.NetworkLogging.DomainID = domainLogID
+	b := &LocalBackend{
+		logf:  t.Logf,
+		clock: clock,
+		e: &wgConfigEngine{cfg: cfg, live: map[key.NodePublic]ipnstate.PeerStatusLite{
+			live: {NodeKey: live, LastHandshake: clock.Now().Add(-time.Minute), RxBytes: 1, TxBytes: 2},
+		}},
+	}
+
+	get := func(query string) (string, c2nWGConfig) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		b.handleC2N(rec, httptest.NewRequest("GET", "/debug/wgconfig?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.Bytes())
+		}
+		var res c2nWGConfig
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Body.String(), res
+	}
+
+	body, res := get("")
+	// No form of the private key or the network logging IDs may appear.
+	rawPriv, err := hex.DecodeString(priv.UntypedHexString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privText, _ := priv.MarshalText()
+	secrets := []string{
+		string(privText),
+		priv.UntypedHexString(),
+		strings.ToUpper(priv.UntypedHexString()),
+		base64.StdEncoding.EncodeToString(rawPriv),
+		base64.RawURLEncoding.EncodeToString(rawPriv),
+		nodeLogID.String(),
+		domainLogID.String(),
+	}
+	for _, s := range secrets {
+		if strings.Contains(body, s) {
+			t.Errorf("response contains secret %q: %s", s, body)
+		}
+	}
+	for _, bad := range []string{"privkey:", "PrivateKey", "privateKey"} {
+		if strings.Contains(body, bad) {
+			t.Errorf("response contains %q: %s", bad, body)
+		}
+	}
+
+	if res.PublicKey != priv.Public().String() || !res.NetworkLogging || len(res.Peers) != 2 {
+		t.Fatalf("got %+v", res)
+	}
+	if p := res.Peers[0]; !p.Live || p.LastHandshakeAgeSecs == nil || *p.LastHandshakeAgeSecs != 60 || p.RxBytes != 1 {
+		t.Errorf("live peer = %+v", p)
+	}
+	if p := res.Peers[1]; p.Live || p.LastHandshake != nil || p.LastHandshakeAgeSecs != nil {
+		t.Errorf("idle peer = %+v; want not live, no handshake", p)
+	}
+
+	_, res = get("short=1")
+	if got, want := res.Peers[0].PublicKey, live.ShortString(); got != want {
+		t.Errorf("short peer key = %q; want %q", got, want)
+	}
+}
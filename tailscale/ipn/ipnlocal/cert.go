@@ -24,6 +24,7 @@
 	"log"
 	insecurerand "math/rand"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -55,8 +56,19 @@
 
 	renewMu     sync.Mutex // lock order: acmeMu before renewMu
 	renewCertAt = map[string]time.Time{}
+
+	// certIssueErr is the most recent failure to obtain a cert for each
+	// domain. Entries are removed once a cert is obtained. Guarded by
+	// renewMu.
+	certIssueErr = map[string]certIssueFailure{}
 )
 
+// certIssueFailure is a failed attempt to obtain a cert.
+type certIssueFailure struct {
+	at  time.Time
+	err error
+}
+
 // certDir returns (creating if needed) the directory in which cached
 // cert keypairs are stored.
 func (b *LocalBackend) certDir() (string, error) {
@@ -157,6 +169,18 @@ func (b *LocalBackend) domainRenewed(domain string) {
 	delete(renewCertAt, domain)
 }
 
+// noteCertIssueResult records the result of an attempt to obtain a cert for
+// domain, for reporting by certStatus.
+func noteCertIssueResult(domain string, at time.Time, err error) {
+	renewMu.Lock()
+	defer renewMu.Unlock()
+	if err == nil {
+		delete(certIssueErr, domain)
+	} else {
+		certIssueErr[domain] = certIssueFailure{at, err}
+	}
+}
+
 func (b *LocalBackend) domainRenewalTimeByExpiry(pair *TLSCertKeyPair) (time.Time, error) {
 	block, _ := pem.Decode(pair.CertPEM)
 	if block == nil {
@@ -225,6 +249,9 @@ type certStore interface {
 	// for now. If they're expired, it returns errCertExpired.
 	// If they don't exist, it returns ipn.ErrStateNotExist.
 	Read(domain string, now time.Time) (*TLSCertKeyPair, error)
+	// ReadCert returns the PEM-encoded cert chain for domain, without
+	// validating it. If it doesn't exist, it returns ipn.ErrStateNotExist.
+	ReadCert(domain string) ([]byte, error)
 	// WriteCert writes the cert for domain.
 	WriteCert(domain string, cert []byte) error
 	// WriteKey writes the key for domain.
@@ -306,6 +333,14 @@ func (f certFileStore) Read(domain string, now time.Time) (*TLSCertKeyPair, erro
 	return &TLSCertKeyPair{CertPEM: certPEM, KeyPEM: keyPEM, Cached: true}, nil
 }
 
+func (f certFileStore) ReadCert(domain string) ([]byte, error) {
+	certPEM, err := os.ReadFile(certFile(f.dir, domain))
+	if os.IsNotExist(err) {
+		return nil, ipn.ErrStateNotExist
+	}
+	return certPEM, err
+}
+
 func (f certFileStore) WriteCert(domain string, cert []byte) error {
 	return atomicfile.WriteFile(certFile(f.dir, domain), cert, 0644)
 }
@@ -338,6 +373,10 @@ func (s certStateStore) Read(domain string, now time.Time) (*TLSCertKeyPair, err
 	return &TLSCertKeyPair{CertPEM: certPEM, KeyPEM: keyPEM, Cached: true}, nil
 }
 
+func (s certStateStore) ReadCert(domain string) ([]byte, error) {
+	return s.ReadState(ipn.StateKey(domain + ".crt"))
+}
+
 func (s certStateStore) WriteCert(domain string, cert []byte) error {
 	return ipn.WriteState(s.StateStore, ipn.StateKey(domain+".crt"), cert)
 }
@@ -378,9 +417,10 @@ func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKey
 	return cs.Read(domain, now)
 }
 
-func (b *LocalBackend) getCertPEM(ctx context.Context, cs certStore, logf logger.Logf, traceACME func(any), domain string, now time.Time) (*TLSCertKeyPair, error) {
+func (b *LocalBackend) getCertPEM(ctx context.Context, cs certStore, logf logger.Logf, traceACME func(any), domain string, now time.Time) (_ *TLSCertKeyPair, err error) {
 	acmeMu.Lock()
 	defer acmeMu.Unlock()
+	defer func() { noteCertIssueResult(domain, now, err) }()
 
 	// In case this method was triggered multiple times in parallel (when
 	// serving incoming requests), check whether one of the other goroutines
@@ -535,6 +575,149 @@ func (b *LocalBackend) getCertPEM(ctx context.Context, cs certStore, logf logger
 	return &TLSCertKeyPair{CertPEM: certPEM.Bytes(), KeyPEM: privPEM.Bytes()}, nil
 }
 
+// certStatus is the status of the cert for a domain that the node can serve
+// TLS on, as returned by the c2n /debug/certs handler. It contains only
+// metadata; never the private key.
+type certStatus struct {
+	Domain string
+
+	// Status is one of "valid", "expired", "invalid" (present but not
+	// usable, e.g. not trusted or not matching its key), or "missing".
+	Status string
+
+	Subject   string    `json:",omitempty"`
+	Issuer    string    `json:",omitempty"`
+	NotBefore time.Time `json:",omitempty"`
+	NotAfter  time.Time `json:",omitempty"`
+
+	// RenewAt is when the cert is due for renewal, if that's been
+	// determined yet. RenewalPending is whether that time has passed
+	// without the cert having been renewed.
+	RenewAt        time.Time `json:",omitempty"`
+	RenewalPending bool
+
+	// LastError is the most recent error obtaining a cert for Domain, if
+	// the last attempt failed. LastErrorAt is when that attempt was.
+	LastError   string    `json:",omitempty"`
+	LastErrorAt time.Time `json:",omitempty"`
+}
+
+// getCertStatus returns the status of the cached cert for domain in cs.
+func getCertStatus(cs certStore, domain string, now time.Time) certStatus {
+	st := certStatus{Domain: domain, Status: "missing"}
+
+	renewMu.Lock()
+	if at, ok := renewCertAt[domain]; ok {
+		st.RenewAt = at
+		st.RenewalPending = now.After(at)
+	}
+	if f, ok := certIssueErr[domain]; ok {
+		st.LastError = f.err.Error()
+		st.LastErrorAt = f.at
+	}
+	renewMu.Unlock()
+
+	certPEM, err := cs.ReadCert(domain)
+	if err != nil {
+		if !errors.Is(err, ipn.ErrStateNotExist) {
+			st.Status = "invalid"
+		}
+		return st
+	}
+	st.Status = "invalid"
+	if block, _ := pem.Decode(certPEM); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			st.Subject = cert.Subject.String()
+			st.Issuer = cert.Issuer.String()
+			st.NotBefore = cert.NotBefore
+			st.NotAfter = cert.NotAfter
+			if now.After(cert.NotAfter) {
+				st.Status = "expired"
+				return st
+			}
+		}
+	}
+	if _, err := cs.Read(domain, now); err == nil {
+		st.Status = "valid"
+	}
+	return st
+}
+
+func (b *LocalBackend) handleC2NDebugCerts(w http.ResponseWriter, r *http.Request) {
+	nm := b.NetMap()
+	if nm == nil {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	cs, err := b.getCertStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := b.clock.Now()
+	res := struct {
+		Certs []certStatus
+	}{
+		Certs: []certStatus{}, // so "no cert domains" encodes as []
+	}
+	for _, domain := range nm.DNS.CertDomains {
+		if !validLookingCertDomain(domain) {
+			continue
+		}
+		res.Certs = append(res.Certs, getCertStatus(cs, domain, now))
+	}
+	writeJSON(w, res)
+}
+
+// c2nCertRenewTimeout bounds how long /debug/certs/renew waits for a cert.
+const c2nCertRenewTimeout = 2 * time.Minute
+
+func (b *LocalBackend) handleC2NDebugCertRenew(w http.ResponseWriter, r *http.Request) {
+	domain := r.FormValue("domain")
+	if !validLookingCertDomain(domain) {
+		http.Error(w, "invalid domain", http.StatusBadRequest)
+		return
+	}
+	nm := b.NetMap()
+	if nm == nil {
+		http.Error(w, "no netmap", http.StatusServiceUnavailable)
+		return
+	}
+	if !slices.Contains(nm.DNS.CertDomains, domain) {
+		http.Error(w, "not a cert domain of this node", http.StatusNotFound)
+		return
+	}
+	cs, err := b.getCertStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Mark the cert as due for renewal so getCertPEM re-issues it even if
+	// the cached one is still good. getCertPEM clears this on success.
+	renewMu.Lock()
+	renewCertAt[domain] = time.Time{}
+	renewMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), c2nCertRenewTimeout)
+	defer cancel()
+	logf := logger.WithPrefix(b.logf, fmt.Sprintf("cert(%q): ", domain))
+	logf("c2n: forcing renewal")
+	var res struct {
+		NotAfter time.Time `json:",omitempty"` // expiry of the new cert, on success
+		Error    string    `json:",omitempty"` // why the renewal failed
+	}
+	if _, err := b.getCertPEM(ctx, cs, logf, func(any) {}, domain, b.clock.Now()); err != nil {
+		res.Error = err.Error()
+		// Let the regular renewal schedule be recomputed, rather than
+		// retrying on every use of the cert.
+		b.domainRenewed(domain)
+	} else {
+		res.NotAfter = getCertStatus(cs, domain, b.clock.Now()).NotAfter
+	}
+	writeJSON(w, res)
+}
+
 // certRequest generates a CSR for the given common name cn and optional SANs.
 func certRequest(key crypto.Signer, cn string, ext []pkix.Extension, san ...string) ([]byte, error) {
 	req := &x509.CertificateRequest{
@@ -6,6 +6,7 @@
 import (
 	"context"
 	"errors"
+	"net/http"
 )
 
 type TLSCertKeyPair struct {
@@ -15,3 +16,11 @@ type TLSCertKeyPair struct {
 func (b *LocalBackend) GetCertPEM(ctx context.Context, domain string, syncRenewal bool) (*TLSCertKeyPair, error) {
 	return nil, errors.New("not implemented for js/wasm")
 }
+
+func (b *LocalBackend) handleC2NDebugCerts(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "not implemented for js/wasm", http.StatusNotImplemented)
+}
+
+func (b *LocalBackend) handleC2NDebugCertRenew(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "not implemented for js/wasm", http.StatusNotImplemented)
+}
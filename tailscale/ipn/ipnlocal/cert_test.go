@@ -13,6 +13,7 @@
 	"crypto/x509/pkix"
 	"embed"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"testing"
 	"time"
@@ -107,6 +108,57 @@ func TestCertStoreRoundTrip(t *testing.T) {
 	}
 }
 
+func TestGetCertStatus(t *testing.T) {
+	const testDomain = "example.com"
+	testNow := time.Date(2023, time.February, 10, 0, 0, 0, 0, time.UTC) // see TestCertStoreRoundTrip
+
+	testRoot, err := certTestFS.ReadFile("testdata/rootCA.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(testRoot) {
+		t.Fatal("Unable to add test CA to the cert pool")
+	}
+	testCert, err := certTestFS.ReadFile("testdata/example.com.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKey, err := certTestFS.ReadFile("testdata/example.com-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := certStateStore{StateStore: new(mem.Store), testRoots: roots}
+	if st := getCertStatus(cs, testDomain, testNow); st.Status != "missing" {
+		t.Errorf("before write: Status = %q; want missing", st.Status)
+	}
+
+	if err := cs.WriteCert(testDomain, testCert); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.WriteKey(testDomain, testKey); err != nil {
+		t.Fatal(err)
+	}
+	st := getCertStatus(cs, testDomain, testNow)
+	if st.Status != "valid" {
+		t.Errorf("Status = %q; want valid", st.Status)
+	}
+	if st.NotAfter.IsZero() || st.Issuer == "" {
+		t.Errorf("missing cert metadata: %+v", st)
+	}
+
+	if st := getCertStatus(cs, testDomain, st.NotAfter.Add(time.Hour)); st.Status != "expired" {
+		t.Errorf("after NotAfter: Status = %q; want expired", st.Status)
+	}
+
+	noteCertIssueResult(testDomain, testNow, errors.New("rate limited"))
+	defer noteCertIssueResult(testDomain, testNow, nil)
+	if st := getCertStatus(cs, testDomain, testNow); st.LastError != "rate limited" {
+		t.Errorf("LastError = %q; want %q", st.LastError, "rate limited")
+	}
+}
+
 func TestShouldStartDomainRenewal(t *testing.T) {
 	reset := func() {
 		renewMu.Lock()
@@ -38,6 +38,10 @@ type expiryManager struct {
 	//    time.Now().Add(clockDelta) == MapResponse.ControlTime
 	clockDelta syncs.AtomicValue[time.Duration]
 
+	// lastSkew is the most recent measurement of the delta from the
+	// current time to control's time, even if it's below minClockDelta.
+	lastSkew syncs.AtomicValue[clockSkew]
+
 	logf  logger.Logf
 	clock tstime.Clock
 }
@@ -55,6 +59,7 @@ func newExpiryManager(logf logger.Logf) *expiryManager {
 func (em *expiryManager) onControlTime(t time.Time) {
 	localNow := em.clock.Now()
 	delta := t.Sub(localNow)
+	em.lastSkew.Store(clockSkew{Delta: delta, At: localNow})
 	if delta.Abs() > minClockDelta {
 		em.logf("[v1] netmap: flagExpiredPeers: setting clock delta to %v", delta)
 		em.clockDelta.Store(delta)
@@ -63,6 +68,12 @@ func (em *expiryManager) onControlTime(t time.Time) {
 	}
 }
 
+// clockSkew is a measurement of the local clock against control's.
+type clockSkew struct {
+	Delta time.Duration // such that local time + Delta == control time
+	At    time.Time     // local time of the measurement
+}
+
 // flagExpiredPeers updates mapRes.Peers, mutating all peers that have expired,
 // taking into account any clock skew detected by using the ControlTime field
 // in the MapResponse. We don't actually remove expired peers from the Peers
@@ -146,7 +146,7 @@ type LocalBackend struct {
 	pm                    *profileManager
 	store                 ipn.StateStore // non-nil; TODO(bradfitz): remove; use sys
 	dialer                *tsdial.Dialer // non-nil; TODO(bradfitz): remove; use sys
-	backendLogID          logid.PublicID
+	backendLogID          logid.PublicID // guarded by mu; changed by c2n /logtail/rotate
 	unregisterNetMon      func()
 	unregisterHealthWatch func()
 	portpoll              *portlist.Poller // may be nil
@@ -161,6 +161,31 @@ type LocalBackend struct {
 	debugSink             *capture.Sink
 	sockstatLogger        *sockstatlog.Logger
 
+	// logIDRotateFunc switches log uploads to a new log ID. It's nil if
+	// SetLogIDRotator wasn't called.
+	logIDRotateFunc func() (oldID, newID logid.PublicID, err error)
+
+	// logPendingFunc and logFlushWaitFunc report how many bytes of logs
+	// are waiting to be uploaded, and wait for them to be. They're nil if
+	// SetLogFlushWaiter wasn't called.
+	logPendingFunc   func() int64
+	logFlushWaitFunc func(context.Context) error
+
+	// recentLogsFunc and takeRecentLogsFunc read the in-memory ring of
+	// recent logs, as logtail.Logger.RecentLogs and TakeRecentLogs do.
+	// They're nil if SetRecentLogsReader wasn't called.
+	recentLogsFunc     func(n int) [][]byte
+	takeRecentLogsFunc func(n int) [][]byte
+
+	// setLogUploadFilterFunc sets which logs are uploaded, as
+	// logtail.Logger.SetUploadFilter does. It's nil if
+	// SetLogUploadFilterer wasn't called.
+	setLogUploadFilterFunc func(keep func(level int, msg []byte) bool)
+
+	// c2nLogLevel is the c2n /logtail/level override of which logs are
+	// uploaded, or nil if there isn't one. It's guarded by mu.
+	c2nLogLevel *c2nLogLevelOverride
+
 	// getTCPHandlerForFunnelFlow returns a handler for an incoming TCP flow for
 	// the provided srcAddr and dstPort if one exists.
 	//
@@ -202,8 +227,23 @@ type LocalBackend struct {
 	capTailnetLock bool // whether netMap contains the tailnet lock capability
 	// hostinfo is mutated in-place while mu is held.
 	hostinfo *tailcfg.Hostinfo
+	// osVersionOverride, if non-empty, replaces the OSVersion reported in
+	// hostinfo. It's set via c2n for debugging and isn't persisted.
+	osVersionOverride string
+	// c2nUpdateRunning is whether a c2n /update process is running, and
+	// c2nUpdateStarted is when the last one started.
+	c2nUpdateRunning bool
+	c2nUpdateStarted time.Time
+	// c2nUpdateHistory is the most recent c2n /update attempts, oldest
+	// first. It's not persisted.
+	c2nUpdateHistory []c2nUpdateAttempt
+	// c2nUpdateCheck is the last lookup of the latest version by a c2n
+	// /update GET, or nil if there hasn't been one.
+	c2nUpdateCheck *c2nUpdateCheck
 	// netMap is not mutated in-place once set.
 	netMap           *netmap.NetworkMap
+	netMapSetAt      time.Time              // when netMap was last set
+	netMapGen        uint64                 // incremented each time netMap is set
 	nmExpiryTimer    tstime.TimerController // for updating netMap on node expiry; can be nil
 	nodeByAddr       map[netip.Addr]tailcfg.NodeView
 	activeLogin      string // last logged LoginName from netMap
@@ -219,6 +259,7 @@ type LocalBackend struct {
 	peerAPIServer    *peerAPIServer // or nil
 	peerAPIListeners []*peerAPIListener
 	loginFlags       controlclient.LoginFlags
+	authKeyUsed      *c2nAuthKey // the last auth key passed to Start, redacted; nil if none
 	incomingFiles    map[*incomingFile]bool
 	fileWaiters      set.HandleSet[context.CancelFunc] // of wake-up funcs
 	notifyWatchers   set.HandleSet[chan *ipn.Notify]
@@ -239,6 +280,27 @@ type LocalBackend struct {
 	directFileDoFinalRename bool // false on macOS, true on several NAS platforms
 	componentLogUntil       map[string]componentLogState
 
+	// sshUsernamesCache is the results of recent c2n /ssh/usernames
+	// requests, keyed by sshUsernamesCacheKey. sshUsernamesCacheGen is
+	// incremented whenever it's invalidated.
+	sshUsernamesCache    map[string]sshUsernamesCacheEntry
+	sshUsernamesCacheGen int
+
+	// c2nLimiters are the rate limiters for c2nExpensivePaths, keyed by
+	// path. They're created as needed by allowC2NRequest.
+	c2nLimiters map[string]c2nLimiter
+
+	// c2nExitNode, if non-nil, is the exit node most recently set by c2n
+	// /prefs/exitnode.
+	c2nExitNode *c2nExitNodeOverride
+
+	// c2nCapturing is whether a c2n /debug/capture is running.
+	c2nCapturing bool
+
+	// c2nRefreshStarted is when a c2n /refresh restarted the map poll,
+	// if the netmap that results hasn't arrived yet. It's zero otherwise.
+	c2nRefreshStarted time.Time
+
 	// ServeConfig fields. (also guarded by mu)
 	lastServeConfJSON mem.RO              // last JSON that was parsed into serveConfig
 	serveConfig       ipn.ServeConfigView // or !Valid if none
@@ -266,6 +328,13 @@ type LocalBackend struct {
 	// at the moment that tkaSyncLock is taken).
 	tkaSyncLock sync.Mutex
 	clock       tstime.Clock
+
+	// c2nRebindMu makes c2n /debug/rebind requests exclusive, so that
+	// rapid ones are coalesced. It guards c2nLastRebind, the result of
+	// the last one, or nil if there hasn't been one. It must not be
+	// taken while mu is held.
+	c2nRebindMu   sync.Mutex
+	c2nLastRebind *c2nRebindResult
 }
 
 // clientGen is a func that creates a control plane client.
@@ -391,7 +460,29 @@ func componentStateKey(component string) ipn.StateKey {
 func (b *LocalBackend) SetComponentDebugLogging(component string, until time.Time) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	return b.setComponentDebugLoggingLocked(component, until)
+}
 
+// SetComponentDebugLoggingFor is like SetComponentDebugLogging, but enables
+// component's debug logging for d from now, or disables it immediately if d
+// isn't positive. It returns the time that it's enabled until, or the zero
+// time if it's disabled.
+func (b *LocalBackend) SetComponentDebugLoggingFor(component string, d time.Duration) (until time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d > 0 {
+		until = b.clock.Now().Add(d)
+	}
+	if err := b.setComponentDebugLoggingLocked(component, until); err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// setComponentDebugLoggingLocked implements SetComponentDebugLogging.
+//
+// b.mu must be held.
+func (b *LocalBackend) setComponentDebugLoggingLocked(component string, until time.Time) error {
 	var setEnabled func(bool)
 	switch component {
 	case "magicsock":
@@ -467,6 +558,22 @@ func (b *LocalBackend) GetComponentDebugLogging(component string) time.Time {
 	return ls.until
 }
 
+// ComponentDebugLoggingStates returns the time that each component whose
+// debug logging is currently enabled has it enabled until.
+func (b *LocalBackend) ComponentDebugLoggingStates() map[string]time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	ret := make(map[string]time.Time)
+	for component, ls := range b.componentLogUntil {
+		if ls.until.After(now) {
+			ret[component] = ls.until
+		}
+	}
+	return ret
+}
+
 // Dialer returns the backend's dialer.
 // It is always non-nil.
 func (b *LocalBackend) Dialer() *tsdial.Dialer {
@@ -914,6 +1021,7 @@ func (b *LocalBackend) SetControlClientStatus(st controlclient.Status) {
 	// Handle node expiry in the netmap
 	if st.NetMap != nil {
 		now := b.clock.Now()
+		b.c2nRefreshStarted = time.Time{}
 		b.em.flagExpiredPeers(st.NetMap, now)
 
 		// Always stop the existing netmap timer if we have a netmap;
@@ -1402,6 +1510,9 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 		persistv = new(persist.Persist)
 	}
 	b.updateFilterLocked(nil, ipn.PrefsView{})
+	if opts.AuthKey != "" {
+		b.authKeyUsed = ptr.To(redactAuthKey(opts.AuthKey))
+	}
 	b.mu.Unlock()
 
 	if b.portpoll != nil {
@@ -1485,6 +1596,7 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 		}
 		tkaHead = string(head)
 	}
+	blid := b.backendLogID.String()
 	b.mu.Unlock()
 
 	if endpoints != nil {
@@ -1494,7 +1606,6 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 
 	b.e.SetNetInfoCallback(b.setNetInfo)
 
-	blid := b.backendLogID.String()
 	b.logf("Backend: logs: be:%v fe:%v", blid, opts.FrontendLogID)
 	b.send(ipn.Notify{BackendLogID: &blid})
 	b.send(ipn.Notify{Prefs: &prefs})
@@ -1903,6 +2014,9 @@ func (b *LocalBackend) ResendHostinfoIfNeeded() {
 	if b.hostinfo != nil {
 		hi.Services = b.hostinfo.Services
 	}
+	if v := b.osVersionOverride; v != "" {
+		hi.OSVersion = v
+	}
 	b.hostinfo = hi
 	b.mu.Unlock()
 
@@ -2773,6 +2887,7 @@ func (b *LocalBackend) wantIngressLocked() bool {
 func (b *LocalBackend) setPrefsLockedOnEntry(caller string, newp *ipn.Prefs) ipn.PrefsView {
 	netMap := b.netMap
 	b.setAtomicValuesFromPrefsLocked(newp.View())
+	b.invalidateSSHUsernamesCacheLocked()
 
 	oldp := b.pm.CurrentPrefs()
 	if oldp.Valid() {
@@ -3292,6 +3407,41 @@ func (b *LocalBackend) SetLogFlusher(flushFunc func()) {
 	b.logFlushFunc = flushFunc
 }
 
+// SetLogIDRotator sets a func to be called to switch log uploads to a new
+// log ID. It returns the previous and new public log IDs.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetLogIDRotator(rotateFunc func() (oldID, newID logid.PublicID, err error)) {
+	b.logIDRotateFunc = rotateFunc
+}
+
+// SetLogFlushWaiter sets funcs to report how many bytes of logs are
+// waiting to be uploaded, and to flush them and wait until they have been.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetLogFlushWaiter(pending func() int64, wait func(context.Context) error) {
+	b.logPendingFunc = pending
+	b.logFlushWaitFunc = wait
+}
+
+// SetRecentLogsReader sets funcs to read the in-memory ring of recent logs,
+// and to read and discard them, as logtail.Logger.RecentLogs and
+// TakeRecentLogs do, for c2n /logtail/tail.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetRecentLogsReader(recent, take func(n int) [][]byte) {
+	b.recentLogsFunc = recent
+	b.takeRecentLogsFunc = take
+}
+
+// SetLogUploadFilterer sets a func that sets which logs are uploaded, as
+// logtail.Logger.SetUploadFilter does, for c2n /logtail/level.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetLogUploadFilterer(setFilter func(keep func(level int, msg []byte) bool)) {
+	b.setLogUploadFilterFunc = setFilter
+}
+
 // TryFlushLogs calls the log flush function. It returns false if a log flush
 // function was never initialized with SetLogFlusher.
 //
@@ -3624,6 +3774,9 @@ func (b *LocalBackend) applyPrefsToHostinfoLocked(hi *tailcfg.Hostinfo, prefs ip
 	hi.RoutableIPs = prefs.AdvertiseRoutes().AsSlice()
 	hi.RequestTags = prefs.AdvertiseTags().AsSlice()
 	hi.ShieldsUp = prefs.ShieldsUp()
+	if v := b.osVersionOverride; v != "" {
+		hi.OSVersion = v
+	}
 
 	var sshHostKeys []string
 	if prefs.RunSSH() && envknob.CanSSHD() {
@@ -3977,6 +4130,8 @@ func (b *LocalBackend) setNetMapLocked(nm *netmap.NetworkMap) {
 		login = cmpx.Or(nm.UserProfiles[nm.User()].LoginName, "<missing-profile>")
 	}
 	b.netMap = nm
+	b.netMapSetAt = b.clock.Now()
+	b.netMapGen++
 	if login != b.activeLogin {
 		b.logf("active login: %v", login)
 		b.activeLogin = login
@@ -4919,6 +5074,7 @@ func (b *LocalBackend) resetForProfileChangeLockedOnEntry() error {
 	}
 	b.lastServeConfJSON = mem.B(nil)
 	b.serveConfig = ipn.ServeConfigView{}
+	b.invalidateSSHUsernamesCacheLocked()
 	b.enterStateLockedOnEntry(ipn.NoState) // Reset state.
 	health.SetLocalLogConfigHealth(nil)
 	return b.Start(ipn.Options{})
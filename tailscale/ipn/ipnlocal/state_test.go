@@ -258,6 +258,10 @@ func (cc *mockControl) SetTKAHead(head string) {
 	cc.logf("SetTKAHead: %s", head)
 }
 
+func (cc *mockControl) SetDiscoPublicKey(k key.DiscoPublic) {
+	cc.logf("SetDiscoPublicKey: %v", k.ShortString())
+}
+
 func (cc *mockControl) UpdateEndpoints(endpoints []tailcfg.Endpoint) {
 	// validate endpoint information here?
 	cc.logf("UpdateEndpoints:  ep=%v", endpoints)
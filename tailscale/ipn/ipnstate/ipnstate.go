@@ -633,6 +633,11 @@ type PingResult struct {
 	// It is not currently set for TSMP pings.
 	DERPRegionCode string
 
+	// Purpose is why the disco ping that got this result was sent,
+	// such as "CLI". It's empty if the result didn't come from a disco
+	// ping.
+	Purpose string `json:",omitempty"`
+
 	// PeerAPIPort is set by TSMP ping responses for peers that
 	// are running a peerapi server. This is the port they're
 	// running the server on.
@@ -110,6 +110,10 @@ type Policy struct {
 	PublicID logid.PublicID
 	// Logf is where to write informational messages about this Logger.
 	Logf logger.Logf
+
+	rotateMu   sync.Mutex // held by RotateLogID
+	config     *Config    // or nil if not created by New
+	configPath string     // where config is saved, or empty
 }
 
 // NewConfig creates a Config with collection and a newly generated PrivateID.
@@ -640,10 +644,45 @@ func NewWithConfigPath(collection, dir, cmdName string, netMon *netmon.Monitor,
 	}
 
 	return &Policy{
-		Logtail:  lw,
-		PublicID: newc.PublicID,
-		Logf:     logf,
+		Logtail:    lw,
+		PublicID:   newc.PublicID,
+		Logf:       logf,
+		config:     newc,
+		configPath: cfgPath,
+	}
+}
+
+// RotateLogID switches the logger to a new, randomly generated log ID, and
+// saves it so that it's also used after a restart. Logs written before
+// RotateLogID returns are uploaded under the old ID.
+//
+// It should not be called concurrently with reads of p.PublicID.
+func (p *Policy) RotateLogID() (oldID, newID logid.PublicID, err error) {
+	p.rotateMu.Lock()
+	defer p.rotateMu.Unlock()
+	if p.config == nil {
+		return oldID, newID, errors.New("log ID rotation not supported")
+	}
+	oldID = p.PublicID
+	priv, err := logid.NewPrivateID()
+	if err != nil {
+		return oldID, newID, err
+	}
+	if err := p.Logtail.SetPrivateID(priv); err != nil {
+		return oldID, newID, err
+	}
+	p.config.PrivateID = priv
+	p.config.PublicID = priv.Public()
+	p.PublicID = p.config.PublicID
+	if p.configPath != "" {
+		if err := p.config.Save(p.configPath); err != nil {
+			// The new ID's still in use; it just won't survive
+			// a restart.
+			p.Logf("logpolicy: saving rotated log ID: %v", err)
+		}
 	}
+	p.Logf("LogID: %v (rotated from %v)", p.PublicID, oldID)
+	return oldID, p.PublicID, nil
 }
 
 // dialLog is used by NewLogtailTransport to log the happy path of its
@@ -10,6 +10,7 @@
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -84,6 +85,11 @@ type Config struct {
 	// being included in the logs. The sequence number is incremented for each
 	// log message sent, but is not persisted across process restarts.
 	IncludeProcSequence bool
+
+	// RecentLogs is how many of the most recent logs to keep in memory, for
+	// Logger.RecentLogs. If zero, a default is used (currently 256, or 32
+	// with LowMemory). Negative means to keep none.
+	RecentLogs int
 }
 
 func NewLogger(cfg Config, logf tslogger.Logf) *Logger {
@@ -106,6 +112,12 @@ func NewLogger(cfg Config, logf tslogger.Logf) *Logger {
 		}
 		cfg.Buffer = NewMemoryBuffer(pendingSize)
 	}
+	if cfg.RecentLogs == 0 {
+		cfg.RecentLogs = defaultRecentLogs
+		if cfg.LowMemory {
+			cfg.RecentLogs = defaultRecentLogsLowMem
+		}
+	}
 	var procID uint32
 	if cfg.IncludeProcID {
 		keyBytes := make([]byte, 4)
@@ -136,7 +148,8 @@ func NewLogger(cfg Config, logf tslogger.Logf) *Logger {
 		stderr:         cfg.Stderr,
 		stderrLevel:    int64(cfg.StderrLevel),
 		httpc:          cfg.HTTPC,
-		url:            cfg.BaseURL + "/c/" + cfg.Collection + "/" + cfg.PrivateID.String() + urlSuffix,
+		urlPrefix:      cfg.BaseURL + "/c/" + cfg.Collection + "/",
+		urlSuffix:      urlSuffix,
 		lowMem:         cfg.LowMemory,
 		buffer:         cfg.Buffer,
 		skipClientTime: cfg.SkipClientTime,
@@ -145,6 +158,7 @@ func NewLogger(cfg Config, logf tslogger.Logf) *Logger {
 		flushDelayFn:   cfg.FlushDelayFn,
 		clock:          cfg.Clock,
 		metricsDelta:   cfg.MetricsDelta,
+		recent:         newRecentLogs(max(0, cfg.RecentLogs)),
 
 		procID:              procID,
 		includeProcSequence: cfg.IncludeProcSequence,
@@ -152,6 +166,10 @@ func NewLogger(cfg Config, logf tslogger.Logf) *Logger {
 		shutdownStart: make(chan struct{}),
 		shutdownDone:  make(chan struct{}),
 	}
+	l.url = l.urlForID(cfg.PrivateID)
+	var nonce [8]byte
+	rand.Read(nonce[:])
+	l.flushPrefix = fmt.Sprintf("%s%x:", flushMarker, nonce)
 	l.SetSockstatsLabel(sockstats.LabelLogtailLogger)
 	if cfg.NewZstdEncoder != nil {
 		l.zstdEncoder = cfg.NewZstdEncoder()
@@ -171,7 +189,10 @@ type Logger struct {
 	stderr         io.Writer
 	stderrLevel    int64 // accessed atomically
 	httpc          *http.Client
-	url            string
+	urlPrefix      string // url without the private ID and urlSuffix
+	urlSuffix      string
+	url            string // where uploads go; only accessed by the uploading goroutine
+	nextURL        string // if non-empty, url after the current batch's upload; see SetPrivateID
 	lowMem         bool
 	skipClientTime bool
 	netMonitor     *netmon.Monitor
@@ -184,16 +205,36 @@ type Logger struct {
 	zstdEncoder    Encoder
 	uploadCancel   func()
 	explainedRaw   bool
-	metricsDelta   func() string // or nil
-	privateID      logid.PrivateID
+	metricsDelta   func() string   // or nil
+	privateID      logid.PrivateID // guarded by writeLock
 	httpDoCalls    atomic.Int32
 	sockstatsLabel atomicSocktatsLabel
+	recent         *recentLogs // or nil
 
 	procID              uint32
 	includeProcSequence bool
 
-	writeLock    sync.Mutex // guards procSequence, flushTimer, buffer.Write calls
+	// uploadFilter, if non-nil, decides which logs are uploaded; see
+	// SetUploadFilter.
+	uploadFilter atomic.Pointer[func(level int, msg []byte) bool]
+
+	// writtenBytes and uploadedBytes count the bytes of logs written to
+	// buffer and uploaded from it, for PendingBytes. drainedBytes is how
+	// many are in the batch being uploaded; it's only accessed by the
+	// uploading goroutine, as is drainedFlushSeq.
+	writtenBytes    atomic.Int64
+	uploadedBytes   atomic.Int64
+	drainedBytes    int64
+	drainedFlushSeq uint64 // highest FlushAndWait sequence number in the batch being uploaded
+
+	flushMu          sync.Mutex
+	uploadedFlushSeq uint64        // highest FlushAndWait sequence number uploaded
+	flushUploaded    chan struct{} // if non-nil, closed when uploadedFlushSeq next advances
+
+	writeLock    sync.Mutex // guards procSequence, flushTimer, buffer.Write calls, privateID, flushSeq
 	procSequence uint64
+	flushSeq     uint64                 // last sequence number given to a FlushAndWait call
+	flushPrefix  string                 // flushMarker and a random string unique to this Logger
 	flushTimer   tstime.TimerController // used when flushDelay is >0
 
 	shutdownStartMu sync.Mutex    // guards the closing of shutdownStart
@@ -213,6 +254,19 @@ func (l *Logger) SetVerbosityLevel(level int) {
 	atomic.StoreInt64(&l.stderrLevel, int64(level))
 }
 
+// SetUploadFilter sets a func that's called with each log written to l, and
+// its verbosity level, to decide whether it's uploaded. Logs that keep
+// returns false for are still written to stderr, if their level allows, but
+// are otherwise dropped. A nil keep, the default, uploads all logs. keep
+// must be safe for concurrent use.
+func (l *Logger) SetUploadFilter(keep func(level int, msg []byte) bool) {
+	if keep == nil {
+		l.uploadFilter.Store(nil)
+	} else {
+		l.uploadFilter.Store(&keep)
+	}
+}
+
 // SetNetMon sets the optional the network monitor.
 //
 // It should not be changed concurrently with log writes and should
@@ -229,7 +283,109 @@ func (l *Logger) SetSockstatsLabel(label sockstats.Label) {
 // PrivateID returns the logger's private log ID.
 //
 // It exists for internal use only.
-func (l *Logger) PrivateID() logid.PrivateID { return l.privateID }
+func (l *Logger) PrivateID() logid.PrivateID {
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+	return l.privateID
+}
+
+// setPrivateIDMarker is the prefix of the line that SetPrivateID writes to
+// the buffer, followed by the new private ID. It can't be confused with an
+// encoded log, which always starts with '{'.
+const setPrivateIDMarker = "\x00logtail-set-private-id:"
+
+// SetPrivateID switches l to uploading to the log stream with private ID id.
+//
+// Logs written before SetPrivateID returns are uploaded to the previous
+// stream, and logs written afterwards to the new one, even if some of them
+// are still waiting to be uploaded. It fails if there's no room in the
+// buffer to record the switch, in which case l keeps using the previous
+// stream.
+func (l *Logger) SetPrivateID(id logid.PrivateID) error {
+	if id.IsZero() {
+		return errors.New("logtail: zero private ID")
+	}
+	l.writeLock.Lock()
+	defer l.writeLock.Unlock()
+	if id == l.privateID {
+		return nil
+	}
+	if _, err := l.buffer.Write([]byte(setPrivateIDMarker + id.String() + "\n")); err != nil {
+		return fmt.Errorf("logtail: recording private ID change: %w", err)
+	}
+	l.privateID = id
+	l.tryDrainWake()
+	return nil
+}
+
+// flushMarker is the prefix of the line that FlushAndWait writes to the
+// buffer, followed by a string unique to the Logger (so that those left in
+// a filch buffer by a previous process are ignored) and its sequence
+// number. Like setPrivateIDMarker, it can't be confused with an encoded log.
+const flushMarker = "\x00logtail-flush:"
+
+// PendingBytes returns roughly how many bytes of logs are waiting to be
+// uploaded.
+func (l *Logger) PendingBytes() int64 {
+	return max(0, l.writtenBytes.Load()-l.uploadedBytes.Load())
+}
+
+// FlushAndWait starts uploading any pending logs, like StartFlush, and
+// waits until all the logs written before it was called have been
+// successfully uploaded, or ctx is done.
+func (l *Logger) FlushAndWait(ctx context.Context) error {
+	l.writeLock.Lock()
+	l.flushSeq++
+	seq := l.flushSeq
+	_, err := l.buffer.Write([]byte(l.flushPrefix + strconv.FormatUint(seq, 10) + "\n"))
+	l.writeLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("logtail: recording flush: %w", err)
+	}
+	l.tryDrainWake()
+
+	for {
+		l.flushMu.Lock()
+		done := l.uploadedFlushSeq >= seq
+		if l.flushUploaded == nil {
+			l.flushUploaded = make(chan struct{})
+		}
+		ch := l.flushUploaded
+		l.flushMu.Unlock()
+		if done {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// noteUploaded is called by the uploading goroutine when the batch most
+// recently returned by drainPending has been uploaded.
+func (l *Logger) noteUploaded() {
+	l.uploadedBytes.Add(l.drainedBytes)
+	l.drainedBytes = 0
+	if l.drainedFlushSeq == 0 {
+		return
+	}
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	if l.drainedFlushSeq > l.uploadedFlushSeq {
+		l.uploadedFlushSeq = l.drainedFlushSeq
+		if l.flushUploaded != nil {
+			close(l.flushUploaded)
+			l.flushUploaded = nil
+		}
+	}
+	l.drainedFlushSeq = 0
+}
+
+func (l *Logger) urlForID(id logid.PrivateID) string {
+	return l.urlPrefix + id.String() + l.urlSuffix
+}
 
 // Shutdown gracefully shuts down the logger while completing any
 // remaining uploads.
@@ -296,6 +452,10 @@ func (l *Logger) drainBlock() (shuttingDown bool) {
 // It uses scratch as its initial buffer.
 // If no logs are available, drainPending blocks until logs are available.
 func (l *Logger) drainPending(scratch []byte) (res []byte) {
+	if l.nextURL != "" {
+		// The previous batch was the last for the previous private ID.
+		l.url, l.nextURL = l.nextURL, ""
+	}
 	buf := bytes.NewBuffer(scratch[:0])
 	buf.WriteByte('[')
 	entries := 0
@@ -321,6 +481,24 @@ func (l *Logger) drainPending(scratch []byte) (res []byte) {
 		if len(b) == 0 {
 			continue
 		}
+		if idStr, ok := bytes.CutPrefix(b, []byte(setPrivateIDMarker)); ok {
+			var id logid.PrivateID
+			if err := id.UnmarshalText(bytes.TrimSpace(idStr)); err == nil {
+				// Upload what's been drained so far to the
+				// current URL, and anything after to the new one.
+				l.nextURL = l.urlForID(id)
+				batchDone = true
+				continue
+			}
+		}
+		if bytes.HasPrefix(b, []byte(flushMarker)) {
+			if seqStr, ok := bytes.CutPrefix(b, []byte(l.flushPrefix)); ok {
+				if seq, err := strconv.ParseUint(string(bytes.TrimSpace(seqStr)), 10, 64); err == nil {
+					l.drainedFlushSeq = max(l.drainedFlushSeq, seq)
+				}
+			}
+			continue
+		}
 		if b[0] != '{' || !json.Valid(b) {
 			// This is probably a log added to stderr by filch
 			// outside of the logtail logger. Encode it.
@@ -336,6 +514,10 @@ func (l *Logger) drainPending(scratch []byte) (res []byte) {
 			// been written a long time ago. Don't include instance key or ID
 			// either, since this came from a different instance.
 			b = l.encodeText(b, true, 0, 0, 0)
+		} else {
+			// Only logs written by sendLocked are counted, not those
+			// from filch.
+			l.drainedBytes += int64(len(bytes.TrimSuffix(b, []byte("\n"))))
 		}
 
 		if entries > 0 {
@@ -407,6 +589,9 @@ func (l *Logger) uploading(ctx context.Context) {
 				break
 			}
 		}
+		if ctx.Err() == nil {
+			l.noteUploaded()
+		}
 
 		select {
 		case <-l.shutdownStart:
@@ -531,11 +716,16 @@ func (l *Logger) tryDrainWake() {
 
 func (l *Logger) sendLocked(jsonBlob []byte) (int, error) {
 	tapSend(jsonBlob)
+	l.recent.add(jsonBlob)
 	if logtailDisabled.Load() {
 		return len(jsonBlob), nil
 	}
 
 	n, err := l.buffer.Write(jsonBlob)
+	if err == nil {
+		// Not counting the newline, which TryReadLine may strip.
+		l.writtenBytes.Add(int64(len(bytes.TrimSuffix(jsonBlob, []byte("\n")))))
+	}
 
 	flushDelay := defaultFlushDelay
 	if l.flushDelayFn != nil {
@@ -747,6 +937,10 @@ func (l *Logger) Write(buf []byte) (int, error) {
 		}
 	}
 
+	if keep := l.uploadFilter.Load(); keep != nil && !(*keep)(level, buf) {
+		return len(buf), nil
+	}
+
 	l.writeLock.Lock()
 	defer l.writeLock.Unlock()
 
@@ -7,15 +7,22 @@
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"tailscale.com/tstest"
 	"tailscale.com/tstime"
+	"tailscale.com/types/logid"
+	"tailscale.com/util/must"
 )
 
 func TestFastShutdown(t *testing.T) {
@@ -379,3 +386,271 @@ func TestEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestSetPrivateID(t *testing.T) {
+	oldID := must.Get(logid.NewPrivateID())
+	newID := must.Get(logid.NewPrivateID())
+
+	var mu sync.Mutex
+	got := map[string][]int{} // private ID => line numbers uploaded to it
+	total := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := path.Base(r.URL.Path)
+		var ents []struct{ Text string }
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &ents); err != nil {
+			t.Errorf("bad upload %q: %v", body, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, e := range ents {
+			if n, err := strconv.Atoi(strings.TrimPrefix(e.Text, "line ")); err == nil {
+				got[id] = append(got[id], n)
+				total++
+			}
+		}
+	}))
+	defer srv.Close()
+
+	l := NewLogger(Config{
+		BaseURL:      srv.URL,
+		PrivateID:    oldID,
+		Buffer:       NewMemoryBuffer(1000),
+		FlushDelayFn: func() time.Duration { return 0 },
+		Stderr:       io.Discard,
+	}, t.Logf)
+
+	// Log concurrently with the switch, so that some lines are likely
+	// still buffered when it happens.
+	const lines = 500
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < lines; i++ {
+			l.Logf("line %d", i)
+		}
+	}()
+	if err := l.SetPrivateID(newID); err != nil {
+		t.Fatal(err)
+	}
+	if l.PrivateID() != newID {
+		t.Errorf("PrivateID = %v; want %v", l.PrivateID(), newID)
+	}
+	<-done
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		n := total
+		mu.Unlock()
+		if n >= lines {
+			break
+		}
+	}
+	if err := l.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	oldLines, newLines := got[oldID.String()], got[newID.String()]
+	if len(oldLines)+len(newLines) != lines {
+		t.Fatalf("got %d lines for old ID and %d for new; want %d total", len(oldLines), len(newLines), lines)
+	}
+	// Every line written before the switch went to the old ID, and every
+	// one after to the new ID.
+	all := append(oldLines, newLines...)
+	for i, n := range all {
+		if n != i {
+			t.Fatalf("line %d uploaded in position %d; old ID got %v, new ID got %v", n, i, oldLines, newLines)
+		}
+	}
+}
+
+func TestFlushAndWait(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []string
+	unblock := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		var ents []struct{ Text string }
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &ents); err != nil {
+			t.Errorf("bad upload %q: %v", body, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, e := range ents {
+			uploaded = append(uploaded, e.Text)
+		}
+	}))
+	defer srv.Close()
+
+	l := NewLogger(Config{
+		BaseURL:      srv.URL,
+		Buffer:       NewMemoryBuffer(100),
+		FlushDelayFn: func() time.Duration { return 0 },
+		Stderr:       io.Discard,
+	}, t.Logf)
+	defer l.Shutdown(context.Background())
+
+	l.Logf("hello")
+	if got := l.PendingBytes(); got == 0 {
+		t.Errorf("PendingBytes = 0 with an upload blocked")
+	}
+
+	// While the server is blocked, the wait times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.FlushAndWait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("FlushAndWait with blocked server = %v; want deadline exceeded", err)
+	}
+
+	close(unblock)
+	l.Logf("world")
+	if err := l.FlushAndWait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	got := strings.Join(uploaded, ",")
+	mu.Unlock()
+	if !strings.HasSuffix(got, "hello,world") {
+		t.Errorf("uploaded %q; want it to end with hello,world", got)
+	}
+	if got := l.PendingBytes(); got != 0 {
+		t.Errorf("PendingBytes after FlushAndWait = %d; want 0", got)
+	}
+}
+
+func TestUploadFilter(t *testing.T) {
+	lg := &Logger{
+		clock:  tstime.StdClock{},
+		buffer: NewMemoryBuffer(1024),
+		stderr: io.Discard,
+	}
+	buffered := func() (lines []string) {
+		for {
+			b, err := lg.buffer.TryReadLine()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b == nil {
+				return lines
+			}
+			lines = append(lines, string(b))
+		}
+	}
+
+	lg.SetUploadFilter(func(level int, msg []byte) bool {
+		return level == 0 && !strings.Contains(string(msg), "skip")
+	})
+	lg.Write([]byte("[v1] verbose\n"))
+	lg.Write([]byte("skip me\n"))
+	lg.Write([]byte("keep me\n"))
+	if got := buffered(); len(got) != 1 || !strings.Contains(got[0], "keep me") {
+		t.Errorf("with filter, buffered %q; want just keep me", got)
+	}
+
+	lg.SetUploadFilter(nil)
+	lg.Write([]byte("[v1] verbose\n"))
+	if got := buffered(); len(got) != 1 || !strings.Contains(got[0], "verbose") {
+		t.Errorf("without filter, buffered %q; want the verbose line", got)
+	}
+}
+
+func TestRecentLogs(t *testing.T) {
+	lg := &Logger{
+		clock:          tstime.StdClock{},
+		buffer:         NewMemoryBuffer(1024),
+		stderr:         io.Discard,
+		skipClientTime: true,
+		recent:         newRecentLogs(3),
+	}
+	texts := func(logs [][]byte) (ret []string) {
+		for _, b := range logs {
+			var m struct{ Text string }
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatalf("%q: %v", b, err)
+			}
+			ret = append(ret, strings.TrimSpace(m.Text))
+		}
+		return ret
+	}
+
+	if got := lg.RecentLogs(10); len(got) != 0 {
+		t.Errorf("initially = %q; want none", got)
+	}
+	lg.Write([]byte("one\n"))
+	lg.Write([]byte("two\n"))
+	if got, want := texts(lg.RecentLogs(10)), []string{"one", "two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	lg.SetUploadFilter(func(level int, msg []byte) bool { return level == 0 })
+	lg.Write([]byte("three\n"))
+	lg.Write([]byte("[v1] dropped\n"))
+	lg.Write([]byte("four\n"))
+	if got, want := texts(lg.RecentLogs(10)), []string{"two", "three", "four"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after wrapping, got %q; want %q", got, want)
+	}
+	if got, want := texts(lg.RecentLogs(2)), []string{"three", "four"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("last 2 = %q; want %q", got, want)
+	}
+
+	if got, want := texts(lg.TakeRecentLogs(2)), []string{"two", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("take 2 = %q; want %q", got, want)
+	}
+	lg.Write([]byte("five\n"))
+	if got, want := texts(lg.RecentLogs(10)), []string{"four", "five"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after taking and writing, got %q; want %q", got, want)
+	}
+	if got, want := texts(lg.TakeRecentLogs(10)), []string{"four", "five"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("take all = %q; want %q", got, want)
+	}
+	if got := lg.TakeRecentLogs(10); len(got) != 0 {
+		t.Errorf("after taking all = %q; want none", got)
+	}
+
+	// A Logger without a ring keeps nothing.
+	lg.recent = nil
+	lg.Write([]byte("six\n"))
+	if got := lg.RecentLogs(10); len(got) != 0 {
+		t.Errorf("without a ring = %q; want none", got)
+	}
+}
+
+func TestTakeRecentLogsConcurrent(t *testing.T) {
+	const logs = 10000
+	r := newRecentLogs(logs)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < logs; i++ {
+			r.add([]byte(strconv.Itoa(i)))
+		}
+	}()
+
+	// Every log is taken exactly once, in order, however the takes
+	// interleave with the adds.
+	var next int
+	take := func() (took int) {
+		for _, b := range r.take(100) {
+			if got := string(b); got != strconv.Itoa(next) {
+				t.Fatalf("took %q; want %d", got, next)
+			}
+			next++
+			took++
+		}
+		return took
+	}
+	for {
+		select {
+		case <-done:
+			for take() > 0 {
+			}
+			if next != logs {
+				t.Errorf("took %d logs; want %d", next, logs)
+			}
+			return
+		default:
+			take()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logtail
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Default sizes of a Logger's ring of recent logs, if Config.RecentLogs is 0.
+const (
+	defaultRecentLogs       = 256
+	defaultRecentLogsLowMem = 32
+)
+
+// recentLogs is a bounded ring of the most recently written logs, as encoded
+// for upload, so that they can be read locally even when uploads are
+// failing. Its zero value keeps nothing.
+type recentLogs struct {
+	mu    sync.Mutex
+	logs  [][]byte // len is the capacity of the ring
+	start int      // index in logs of the oldest log
+	n     int      // how many logs are in the ring
+}
+
+func newRecentLogs(n int) *recentLogs {
+	return &recentLogs{logs: make([][]byte, n)}
+}
+
+// add records the encoded log b, evicting the oldest log if the ring is
+// full. It retains a copy of b.
+func (r *recentLogs) add(b []byte) {
+	if r == nil || len(r.logs) == 0 {
+		return
+	}
+	b = bytes.Clone(bytes.TrimSuffix(b, []byte("\n")))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs[(r.start+r.n)%len(r.logs)] = b
+	if r.n < len(r.logs) {
+		r.n++
+	} else {
+		r.start = (r.start + 1) % len(r.logs)
+	}
+}
+
+// last returns up to the n most recent logs, oldest first.
+func (r *recentLogs) last(n int) [][]byte {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n = min(n, r.n)
+	ret := make([][]byte, 0, n)
+	for i := r.n - n; i < r.n; i++ {
+		ret = append(ret, r.logs[(r.start+i)%len(r.logs)])
+	}
+	return ret
+}
+
+// take removes and returns up to the n oldest logs, oldest first.
+func (r *recentLogs) take(n int) [][]byte {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n = min(n, r.n)
+	ret := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		j := (r.start + i) % len(r.logs)
+		ret = append(ret, r.logs[j])
+		r.logs[j] = nil
+	}
+	if n > 0 {
+		r.start = (r.start + n) % len(r.logs)
+		r.n -= n
+	}
+	return ret
+}
+
+// RecentLogs returns up to the n most recent logs written to l, oldest first,
+// each as the JSON object that was or will be uploaded, without its trailing
+// newline. It returns only logs that are uploaded: those that SetUploadFilter
+// drops aren't included. The returned slices must not be modified.
+func (l *Logger) RecentLogs(n int) [][]byte {
+	return l.recent.last(n)
+}
+
+// TakeRecentLogs is like RecentLogs, but returns up to the n oldest logs
+// that RecentLogs would, and discards them in the same operation. So
+// repeated calls return each log once, none lost in between, unless more
+// are written between calls than are kept. It doesn't affect their upload.
+func (l *Logger) TakeRecentLogs(n int) [][]byte {
+	return l.recent.take(n)
+}
@@ -8,6 +8,9 @@
 	"os/exec"
 )
 
+// canFlushCaches is whether flushCaches flushes the OS's resolver cache.
+const canFlushCaches = true
+
 func flushCaches() error {
 	out, err := exec.Command("ipconfig", "/flushdns").CombinedOutput()
 	if err != nil {
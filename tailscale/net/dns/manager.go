@@ -14,6 +14,7 @@
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -62,6 +63,12 @@ type Manager struct {
 
 	resolver *resolver.Resolver
 	os       OSConfigurator
+
+	mu     sync.Mutex // guards status
+	status Status     // as of the last Set
+
+	setMu   sync.Mutex // serializes Set and Reapply; guards lastCfg
+	lastCfg *Config    // the last config passed to Set, or nil if none
 }
 
 // NewManagers created a new manager from the given config.
@@ -85,12 +92,35 @@ func NewManager(logf logger.Logf, oscfg OSConfigurator, netMon *netmon.Monitor,
 func (m *Manager) Resolver() *resolver.Resolver { return m.resolver }
 
 func (m *Manager) Set(cfg Config) error {
+	m.setMu.Lock()
+	defer m.setMu.Unlock()
+	m.lastCfg = &cfg
+	return m.setLocked(cfg)
+}
+
+// Reapply sets m's config again, to reprogram the OS with it if something
+// else has changed the OS's DNS settings since.
+func (m *Manager) Reapply() error {
+	m.setMu.Lock()
+	defer m.setMu.Unlock()
+	if m.lastCfg == nil {
+		return errors.New("no DNS config to reapply")
+	}
+	m.logf("reapplying config")
+	return m.setLocked(*m.lastCfg)
+}
+
+// setLocked applies cfg.
+//
+// m.setMu must be held.
+func (m *Manager) setLocked(cfg Config) error {
 	m.logf("Set: %v", logger.ArgWriter(func(w *bufio.Writer) {
 		cfg.WriteToBufioWriter(w)
 	}))
 
 	rcfg, ocfg, err := m.compileConfig(cfg)
 	if err != nil {
+		m.noteSet(nil, nil, err)
 		return err
 	}
 
@@ -100,10 +130,14 @@ func (m *Manager) Set(cfg Config) error {
 	m.logf("OScfg: %+v", ocfg)
 
 	if err := m.resolver.SetConfig(rcfg); err != nil {
+		m.noteSet(nil, nil, err)
 		return err
 	}
+	// Recorded before SetDNS, which takes ownership of ocfg.
+	m.noteSet(&rcfg, &ocfg, nil)
 	if err := m.os.SetDNS(ocfg); err != nil {
 		health.SetDNSOSHealth(err)
+		m.noteSet(nil, nil, err)
 		return err
 	}
 	health.SetDNSOSHealth(nil)
@@ -455,6 +489,12 @@ func (m *Manager) FlushCaches() error {
 	return flushCaches()
 }
 
+// CanFlushCaches reports whether FlushCaches flushes the OS's resolver cache
+// on this platform. If not, it does nothing.
+func (m *Manager) CanFlushCaches() bool {
+	return canFlushCaches
+}
+
 // Cleanup restores the system DNS configuration to its original state
 // in case the Tailscale daemon terminated without closing the router.
 // No other state needs to be instantiated before this runs.
@@ -4,6 +4,7 @@
 package dns
 
 import (
+	"errors"
 	"net/netip"
 	"runtime"
 	"strings"
@@ -23,9 +24,14 @@ type fakeOSConfigurator struct {
 
 	OSConfig       OSConfig
 	ResolverConfig resolver.Config
+
+	SetDNSErr error // if non-nil, returned by SetDNS
 }
 
 func (c *fakeOSConfigurator) SetDNS(cfg OSConfig) error {
+	if c.SetDNSErr != nil {
+		return c.SetDNSErr
+	}
 	if !c.SplitDNS && len(cfg.MatchDomains) > 0 {
 		panic("split DNS config passed to non-split OSConfigurator")
 	}
@@ -629,6 +635,98 @@ func TestManager(t *testing.T) {
 	}
 }
 
+func TestManagerStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skipf("test's assumptions break because of https://github.com/tailscale/corp/issues/1662")
+	}
+	f := fakeOSConfigurator{SplitDNS: true}
+	m := NewManager(t.Logf, &f, nil, new(tsdial.Dialer), nil)
+
+	if st := m.Status(); !st.SetAt.IsZero() || st.LastErr != "" || !st.SupportsSplitDNS {
+		t.Errorf("before Set: got %+v; want unset, supporting split DNS", st)
+	}
+
+	cfg := Config{
+		Routes: upstreams(
+			"corp.com.", "2.2.2.2",
+			"ts.com.", ""),
+		Hosts: hosts(
+			"dave.ts.com.", "1.2.3.4",
+			"bradfitz.ts.com.", "2.3.4.5"),
+		SearchDomains: fqdns("ts.com."),
+	}
+	if err := m.Set(cfg); err != nil {
+		t.Fatalf("m.Set: %v", err)
+	}
+	st := m.Status()
+	if st.OSConfigurator != "*dns.fakeOSConfigurator" {
+		t.Errorf("OSConfigurator = %q; want *dns.fakeOSConfigurator", st.OSConfigurator)
+	}
+	if st.SetAt.IsZero() || st.LastErr != "" {
+		t.Errorf("got SetAt %v, LastErr %q; want set, no error", st.SetAt, st.LastErr)
+	}
+	if !st.SplitDNS || !st.MagicDNS {
+		t.Errorf("got SplitDNS %v, MagicDNS %v; want both", st.SplitDNS, st.MagicDNS)
+	}
+	if diff := cmp.Diff(st.Nameservers, mustIPs("100.100.100.100"), cmp.Comparer(func(a, b netip.Addr) bool { return a == b })); diff != "" {
+		t.Errorf("wrong Nameservers (-got+want)\n%s", diff)
+	}
+	if diff := cmp.Diff(st.MatchDomains, fqdns("corp.com.", "ts.com.")); diff != "" {
+		t.Errorf("wrong MatchDomains (-got+want)\n%s", diff)
+	}
+	if diff := cmp.Diff(st.LocalDomains, fqdns("ts.com.")); diff != "" {
+		t.Errorf("wrong LocalDomains (-got+want)\n%s", diff)
+	}
+	if rs := st.Routes["corp.com."]; len(rs) != 1 || rs[0].Addr != "2.2.2.2" {
+		t.Errorf("corp.com. routes = %v; want 2.2.2.2", rs)
+	}
+	if st.NumHosts != 2 {
+		t.Errorf("NumHosts = %d; want 2", st.NumHosts)
+	}
+
+	f.SetDNSErr = errors.New("open /etc/resolv.conf: permission denied")
+	if err := m.Set(cfg); err == nil {
+		t.Fatal("m.Set succeeded; want error")
+	}
+	st = m.Status()
+	if st.LastErr != f.SetDNSErr.Error() || st.LastErrAt.Before(st.SetAt) {
+		t.Errorf("got LastErr %q at %v, SetAt %v; want %q, not before SetAt", st.LastErr, st.LastErrAt, st.SetAt, f.SetDNSErr)
+	}
+
+	f.SetDNSErr = nil
+	if err := m.Set(cfg); err != nil {
+		t.Fatalf("m.Set: %v", err)
+	}
+	if st = m.Status(); st.LastErr == "" || !st.LastErrAt.Before(st.SetAt) {
+		t.Errorf("after recovering: got LastErr %q at %v, SetAt %v; want the old error, before SetAt", st.LastErr, st.LastErrAt, st.SetAt)
+	}
+}
+
+func TestManagerReapply(t *testing.T) {
+	f := fakeOSConfigurator{}
+	m := NewManager(t.Logf, &f, nil, new(tsdial.Dialer), nil)
+	if err := m.Reapply(); err == nil {
+		t.Error("Reapply before Set succeeded; want error")
+	}
+
+	cfg := Config{
+		DefaultResolvers: mustRes("1.1.1.1"),
+		SearchDomains:    fqdns("ts.com."),
+	}
+	if err := m.Set(cfg); err != nil {
+		t.Fatalf("m.Set: %v", err)
+	}
+	want := f.OSConfig
+	// Something else clobbers the OS's DNS settings.
+	f.OSConfig = OSConfig{}
+	if err := m.Reapply(); err != nil {
+		t.Fatalf("m.Reapply: %v", err)
+	}
+	if diff := cmp.Diff(f.OSConfig, want, cmp.Comparer(func(a, b netip.Addr) bool { return a == b }), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("wrong OSConfig after Reapply (-got+want)\n%s", diff)
+	}
+}
+
 func mustIPs(strs ...string) (ret []netip.Addr) {
 	for _, s := range strs {
 		ret = append(ret, netip.MustParseAddr(s))
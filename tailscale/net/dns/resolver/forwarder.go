@@ -200,6 +200,8 @@ type forwarder struct {
 	// /etc/resolv.conf is missing/corrupt, and the peerapi ExitDNS stub
 	// resolver lookup.
 	cloudHostFallback []resolverAndDelay
+
+	upstreamErrs upstreamErrors // see upstream_errors.go
 }
 
 func init() {
@@ -578,17 +580,17 @@ func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAn
 }
 
 // resolvers returns the resolvers to use for domain.
-func (f *forwarder) resolvers(domain dnsname.FQDN) []resolverAndDelay {
+func (f *forwarder) resolvers(domain dnsname.FQDN) (suffix dnsname.FQDN, _ []resolverAndDelay) {
 	f.mu.Lock()
 	routes := f.routes
 	cloudHostFallback := f.cloudHostFallback
 	f.mu.Unlock()
 	for _, route := range routes {
 		if route.Suffix == "." || route.Suffix.Contains(domain) {
-			return route.Resolvers
+			return route.Suffix, route.Resolvers
 		}
 	}
-	return cloudHostFallback // or nil if no fallback
+	return "", cloudHostFallback // or nil if no fallback
 }
 
 // forwardQuery is information and state about a forwarded DNS query that's
@@ -662,8 +664,9 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 
 	clampEDNSSize(query.bs, maxResponseBytes)
 
+	var route dnsname.FQDN // the route resolvers are for, if any
 	if len(resolvers) == 0 {
-		resolvers = f.resolvers(domain)
+		route, resolvers = f.resolvers(domain)
 		if len(resolvers) == 0 {
 			metricDNSFwdErrorNoUpstream.Add(1)
 			f.logf("no upstream resolvers set, returning SERVFAIL")
@@ -705,6 +708,11 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 			}
 			resb, err := f.send(ctx, fq, *rr)
 			if err != nil {
+				if !errors.Is(ctx.Err(), context.Canceled) {
+					// Not just abandoned because another
+					// resolver answered first.
+					f.upstreamErrs.add(route, rr.name.Addr, err)
+				}
 				select {
 				case errc <- err:
 				case <-ctx.Done():
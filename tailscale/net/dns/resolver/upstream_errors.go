@@ -0,0 +1,124 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"tailscale.com/util/dnsname"
+	"tailscale.com/util/ringbuffer"
+)
+
+// Kinds of upstream errors, as used in UpstreamError.Kind.
+const (
+	UpstreamErrTimeout  = "timeout"  // no response in time
+	UpstreamErrServFail = "servfail" // responded with SERVFAIL
+	UpstreamErrRefused  = "refused"  // connection refused (or ICMP port unreachable)
+	UpstreamErrOther    = "other"
+)
+
+const (
+	// maxUpstreamErrors is the number of recent UpstreamErrors retained.
+	maxUpstreamErrors = 64
+	// maxUpstreamErrorStats bounds the number of (route, upstream) pairs
+	// that errors are counted for, in case the set of upstreams changes
+	// often.
+	maxUpstreamErrorStats = 256
+)
+
+// UpstreamError is a failed query to an upstream DNS resolver.
+type UpstreamError struct {
+	When     time.Time
+	Route    dnsname.FQDN // the split DNS suffix routed to Upstream ("." for the default route), or empty if none
+	Upstream string       // the resolver's address
+	Kind     string       // one of the UpstreamErr* constants
+	Error    string
+}
+
+// UpstreamErrorStats counts the failed queries to one upstream resolver for
+// one route.
+type UpstreamErrorStats struct {
+	Route    dnsname.FQDN
+	Upstream string
+	Counts   map[string]int64 // keyed by UpstreamErr* kind
+}
+
+// upstreamErrors records a forwarder's upstream errors.
+type upstreamErrors struct {
+	mu     sync.Mutex
+	recent *ringbuffer.RingBuffer[UpstreamError] // lazily allocated
+	stats  map[upstreamErrorKey]map[string]int64
+}
+
+type upstreamErrorKey struct {
+	route    dnsname.FQDN
+	upstream string
+}
+
+// classifyUpstreamError returns the UpstreamErr* kind of err.
+func classifyUpstreamError(err error) string {
+	switch {
+	case errors.Is(err, errServerFailure):
+		return UpstreamErrServFail
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return UpstreamErrTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return UpstreamErrRefused
+	}
+	return UpstreamErrOther
+}
+
+func (e *upstreamErrors) add(route dnsname.FQDN, upstream string, err error) {
+	ue := UpstreamError{
+		When:     time.Now(),
+		Route:    route,
+		Upstream: upstream,
+		Kind:     classifyUpstreamError(err),
+		Error:    err.Error(),
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.recent == nil {
+		e.recent = ringbuffer.New[UpstreamError](maxUpstreamErrors)
+		e.stats = make(map[upstreamErrorKey]map[string]int64)
+	}
+	e.recent.Add(ue)
+	k := upstreamErrorKey{route, upstream}
+	counts, ok := e.stats[k]
+	if !ok {
+		if len(e.stats) >= maxUpstreamErrorStats {
+			return
+		}
+		counts = make(map[string]int64)
+		e.stats[k] = counts
+	}
+	counts[ue.Kind]++
+}
+
+func (e *upstreamErrors) get() (stats []UpstreamErrorStats, recent []UpstreamError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.recent == nil {
+		return nil, nil
+	}
+	for k, counts := range e.stats {
+		s := UpstreamErrorStats{Route: k.route, Upstream: k.upstream, Counts: make(map[string]int64, len(counts))}
+		for kind, n := range counts {
+			s.Counts[kind] = n
+		}
+		stats = append(stats, s)
+	}
+	return stats, e.recent.GetAll()
+}
+
+// UpstreamErrors returns the number of failed queries to each upstream
+// resolver, and the most recent failures, oldest first.
+func (r *Resolver) UpstreamErrors() (stats []UpstreamErrorStats, recent []UpstreamError) {
+	return r.forwarder.upstreamErrs.get()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyUpstreamError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errServerFailure, UpstreamErrServFail},
+		{fmt.Errorf("wrapped: %w", errServerFailure), UpstreamErrServFail},
+		{context.DeadlineExceeded, UpstreamErrTimeout},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, UpstreamErrTimeout},
+		{&net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "recvfrom", Err: syscall.ECONNREFUSED}}, UpstreamErrRefused},
+		{errors.New("something else"), UpstreamErrOther},
+	}
+	for _, tt := range tests {
+		if got := classifyUpstreamError(tt.err); got != tt.want {
+			t.Errorf("classifyUpstreamError(%v) = %q; want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	var e upstreamErrors
+	if stats, recent := e.get(); stats != nil || recent != nil {
+		t.Fatalf("got %v, %v before any errors; want nil", stats, recent)
+	}
+	for i := 0; i < maxUpstreamErrors+10; i++ {
+		e.add("example.com.", "1.1.1.1", errServerFailure)
+	}
+	e.add(".", "8.8.8.8", context.DeadlineExceeded)
+
+	stats, recent := e.get()
+	if len(recent) != maxUpstreamErrors {
+		t.Fatalf("got %d recent errors; want %d", len(recent), maxUpstreamErrors)
+	}
+	if last := recent[len(recent)-1]; last.Upstream != "8.8.8.8" || last.Route != "." || last.Kind != UpstreamErrTimeout {
+		t.Errorf("last error = %+v", last)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %d stats; want 2", len(stats))
+	}
+	for _, s := range stats {
+		switch s.Upstream {
+		case "1.1.1.1":
+			if n := s.Counts[UpstreamErrServFail]; n != maxUpstreamErrors+10 {
+				t.Errorf("1.1.1.1 servfails = %d; want %d", n, maxUpstreamErrors+10)
+			}
+		case "8.8.8.8":
+			if n := s.Counts[UpstreamErrTimeout]; n != 1 {
+				t.Errorf("8.8.8.8 timeouts = %d; want 1", n)
+			}
+		default:
+			t.Errorf("unexpected upstream %q", s.Upstream)
+		}
+	}
+
+	// Counting stops for new upstreams once the limit's reached, but the
+	// errors are still kept as samples.
+	for i := 0; i < maxUpstreamErrorStats; i++ {
+		e.add(".", fmt.Sprintf("10.0.0.%d", i), errServerFailure)
+	}
+	if stats, _ := e.get(); len(stats) != maxUpstreamErrorStats {
+		t.Errorf("got %d stats; want %d", len(stats), maxUpstreamErrorStats)
+	}
+}
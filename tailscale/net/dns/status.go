@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dns
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"time"
+
+	"tailscale.com/net/dns/resolver"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/dnstype"
+	"tailscale.com/util/dnsname"
+)
+
+// Status is the DNS configuration that a Manager has applied, for
+// debugging. This is not a stable interface and could change at any time.
+type Status struct {
+	// OSConfigurator is the type of the OSConfigurator programming the
+	// OS's DNS settings, such as "*dns.resolvedManager" for
+	// systemd-resolved or "*dns.directManager" for /etc/resolv.conf.
+	OSConfigurator string
+	// SupportsSplitDNS is whether OSConfigurator can install resolvers
+	// for specific DNS suffixes only.
+	SupportsSplitDNS bool
+
+	// SetAt is when the Manager's config was last set, or zero if never.
+	SetAt time.Time `json:",omitempty"`
+
+	// Nameservers, SearchDomains and MatchDomains are as last given to
+	// OSConfigurator. A non-empty MatchDomains means split DNS is in use,
+	// so Nameservers are only used for those suffixes.
+	Nameservers   []netip.Addr
+	SearchDomains []dnsname.FQDN
+	MatchDomains  []dnsname.FQDN
+	SplitDNS      bool
+	// MagicDNS is whether the OS is using 100.100.100.100 as a
+	// nameserver, so that queries go to tailscaled's resolver.
+	MagicDNS bool
+
+	// Routes are the upstream resolvers that tailscaled's resolver
+	// forwards queries to, by DNS suffix; "." is for all other names.
+	Routes map[dnsname.FQDN][]*dnstype.Resolver
+	// LocalDomains are the suffixes that tailscaled's resolver answers
+	// itself, from its Hosts, of which there are NumHosts.
+	LocalDomains []dnsname.FQDN
+	NumHosts     int
+
+	// LastErr is the most recent error setting the Manager's config, if
+	// any, from LastErrAt. If LastErrAt is before SetAt, it's since been
+	// set successfully.
+	LastErr   string    `json:",omitempty"`
+	LastErrAt time.Time `json:",omitempty"`
+}
+
+// Status returns the DNS configuration that m has applied, and the most
+// recent error applying it.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.status
+	st.OSConfigurator = fmt.Sprintf("%T", m.os)
+	st.SupportsSplitDNS = m.os.SupportsSplitDNS()
+	st.Nameservers = slices.Clone(st.Nameservers)
+	st.SearchDomains = slices.Clone(st.SearchDomains)
+	st.MatchDomains = slices.Clone(st.MatchDomains)
+	st.Routes = maps.Clone(st.Routes)
+	st.LocalDomains = slices.Clone(st.LocalDomains)
+	return st
+}
+
+// noteSet records the outcome of setting m's config in m.status: either
+// the configs being applied, or err.
+func (m *Manager) noteSet(rcfg *resolver.Config, ocfg *OSConfig, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if err != nil {
+		m.status.LastErr = err.Error()
+		m.status.LastErrAt = now
+		return
+	}
+	m.status.SetAt = now
+	m.status.Nameservers = slices.Clone(ocfg.Nameservers)
+	m.status.SearchDomains = slices.Clone(ocfg.SearchDomains)
+	m.status.MatchDomains = slices.Clone(ocfg.MatchDomains)
+	m.status.SplitDNS = len(ocfg.MatchDomains) > 0
+	m.status.MagicDNS = slices.ContainsFunc(ocfg.Nameservers, func(ip netip.Addr) bool {
+		return ip == tsaddr.TailscaleServiceIP() || ip == tsaddr.TailscaleServiceIPv6()
+	})
+	m.status.Routes = maps.Clone(rcfg.Routes)
+	m.status.LocalDomains = slices.Clone(rcfg.LocalDomains)
+	m.status.NumHosts = len(rcfg.Hosts)
+}
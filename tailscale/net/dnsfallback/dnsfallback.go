@@ -34,6 +34,7 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/panics"
 	"tailscale.com/util/slicesx"
 )
 
@@ -64,6 +65,7 @@ func MakeLookupFunc(logf logger.Logf, netMon *netmon.Monitor) func(ctx context.C
 				if r := recover(); r != nil {
 					logf("bootstrap DNS: recovered panic: %v", r)
 					metricRecursiveErrors.Add(1)
+					panics.RecordPanic("dnsfallback-recursive", r)
 				}
 			}()
 
@@ -0,0 +1,58 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package dropstats counts inbound packets that tailscaled dropped, by
+// reason. Unlike the equivalent clientmetrics, the counts can be reset, so
+// that it's possible to see which kind of drop a reproduction triggers.
+//
+// WireGuard packets that fail to decrypt aren't counted, as wireguard-go
+// drops them in its own decryption workers without telling tailscaled.
+package dropstats
+
+import "sync/atomic"
+
+// Reason is why an inbound packet was dropped.
+type Reason string
+
+const (
+	// ReasonACL is a packet from a peer that the packet filter rejected.
+	ReasonACL Reason = "acl"
+	// ReasonUnknownPeer is a WireGuard packet from an address or DERP
+	// node key that doesn't belong to any peer.
+	ReasonUnknownPeer Reason = "unknown-peer"
+	// ReasonDiscoParse is a disco message that was authenticated but
+	// couldn't be parsed.
+	ReasonDiscoParse Reason = "disco-parse"
+)
+
+// counters is populated once and never modified, so it's safe for concurrent
+// reads.
+var counters = map[Reason]*atomic.Int64{
+	ReasonACL:         new(atomic.Int64),
+	ReasonUnknownPeer: new(atomic.Int64),
+	ReasonDiscoParse:  new(atomic.Int64),
+}
+
+// Add records that a packet was dropped for reason r.
+func Add(r Reason) {
+	counters[r].Add(1)
+}
+
+// Counts returns the number of packets dropped for each reason since the
+// process started or the last Reset.
+func Counts() map[Reason]int64 {
+	ret := make(map[Reason]int64, len(counters))
+	for r, c := range counters {
+		ret[r] = c.Load()
+	}
+	return ret
+}
+
+// Reset zeroes the counts and returns their values before the reset.
+func Reset() map[Reason]int64 {
+	ret := make(map[Reason]int64, len(counters))
+	for r, c := range counters {
+		ret[r] = c.Swap(0)
+	}
+	return ret
+}
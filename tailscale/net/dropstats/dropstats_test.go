@@ -0,0 +1,30 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package dropstats
+
+import "testing"
+
+func TestCounts(t *testing.T) {
+	Reset()
+	Add(ReasonACL)
+	Add(ReasonACL)
+	Add(ReasonDiscoParse)
+
+	want := map[Reason]int64{ReasonACL: 2, ReasonUnknownPeer: 0, ReasonDiscoParse: 1}
+	check := func(name string, got map[Reason]int64) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s = %v; want %v", name, got, want)
+		}
+		for r, n := range want {
+			if got[r] != n {
+				t.Errorf("%s[%q] = %d; want %d", name, r, got[r], n)
+			}
+		}
+	}
+	check("Counts", Counts())
+	check("Reset", Reset())
+	want = map[Reason]int64{ReasonACL: 0, ReasonUnknownPeer: 0, ReasonDiscoParse: 0}
+	check("Counts after Reset", Counts())
+}
@@ -1040,6 +1040,13 @@ func (c *Client) finishAndStoreReport(rs *reportState, dm *tailcfg.DERPMap) *Rep
 	Timeout:   http.DefaultClient.Timeout,
 }
 
+// CheckCaptivePortal immediately does the captive portal check that full
+// reports include, against a DERP server in preferredDERP (or a random
+// region if zero). It reports whether we think we have a captive portal.
+func (c *Client) CheckCaptivePortal(ctx context.Context, dm *tailcfg.DERPMap, preferredDERP int) (bool, error) {
+	return c.checkCaptivePortal(ctx, dm, preferredDERP)
+}
+
 // checkCaptivePortal reports whether or not we think the system is behind a
 // captive portal, detected by making a request to a URL that we know should
 // return a "204 No Content" response and checking if that's what we get.
@@ -116,6 +116,9 @@ type mapping interface {
 	RenewAfter() time.Time
 	// External indicates what port the mapping can be reached from on the outside.
 	External() netip.AddrPort
+	// MappingType returns the protocol the mapping was made with: "pmp",
+	// "pcp" or "upnp".
+	MappingType() string
 }
 
 // HaveMapping reports whether we have a current valid mapping.
@@ -146,6 +149,7 @@ func (m *pmpMapping) externalValid() bool {
 func (p *pmpMapping) GoodUntil() time.Time     { return p.goodUntil }
 func (p *pmpMapping) RenewAfter() time.Time    { return p.renewAfter }
 func (p *pmpMapping) External() netip.AddrPort { return p.external }
+func (p *pmpMapping) MappingType() string      { return "pmp" }
 
 // Release does a best effort fire-and-forget release of the PMP mapping m.
 func (m *pmpMapping) Release(ctx context.Context) {
@@ -419,6 +423,83 @@ func (c *Client) createMapping() {
 	}
 }
 
+// Mapping describes a port mapping, for debugging.
+type Mapping struct {
+	Type       string // "pmp", "pcp" or "upnp"
+	External   netip.AddrPort
+	GoodUntil  time.Time // when the mapping expires
+	RenewAfter time.Time // when it's due to be renewed
+}
+
+func mappingInfo(m mapping) Mapping {
+	return Mapping{
+		Type:       m.MappingType(),
+		External:   m.External(),
+		GoodUntil:  m.GoodUntil(),
+		RenewAfter: m.RenewAfter(),
+	}
+}
+
+// CurrentMapping returns the current port mapping, if there's a valid one.
+// Unlike GetCachedMappingOrStartCreatingOne, it never starts creating one.
+func (c *Client) CurrentMapping() (m Mapping, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mapping == nil || !time.Now().Before(c.mapping.GoodUntil()) {
+		return Mapping{}, false
+	}
+	return mappingInfo(c.mapping), true
+}
+
+// RecentServices reports which port mapping services have been seen on the
+// network recently, without probing for them.
+func (c *Client) RecentServices() ProbeResult {
+	return ProbeResult{
+		PCP:  c.sawPCPRecently(),
+		PMP:  c.sawPMPRecently(),
+		UPnP: c.sawUPnPRecently(),
+	}
+}
+
+// ErrMappingInProgress is returned by CreateMapping if a mapping is already
+// being created.
+var ErrMappingInProgress = errors.New("a port mapping is already being created")
+
+// CreateMapping creates a port mapping, or renews the current one if it's
+// due, as GetCachedMappingOrStartCreatingOne does in the background, and
+// waits for the result. It runs the onChange hook on success, as that does.
+//
+// If no mapping is available, the error will be of type NoMappingError; see
+// IsNoMappingError.
+func (c *Client) CreateMapping(ctx context.Context) (Mapping, error) {
+	c.mu.Lock()
+	if c.runningCreate {
+		c.mu.Unlock()
+		return Mapping{}, ErrMappingInProgress
+	}
+	c.runningCreate = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.runningCreate = false
+	}()
+
+	if _, err := c.createOrGetMapping(ctx); err != nil {
+		return Mapping{}, err
+	}
+	if c.onChange != nil {
+		go c.onChange()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mapping == nil {
+		// Invalidated since; it's as if it had failed.
+		return Mapping{}, NoMappingError{ErrNoPortMappingServices}
+	}
+	return mappingInfo(c.mapping), nil
+}
+
 // wildcardIP is used when the previous external IP is not known for PCP port mapping.
 var wildcardIP = netip.MustParseAddr("0.0.0.0")
 
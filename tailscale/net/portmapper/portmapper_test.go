@@ -122,3 +122,42 @@ func TestPCPIntegration(t *testing.T) {
 		t.Errorf("got nil mapping after successful createOrGetMapping")
 	}
 }
+
+func TestCreateMapping(t *testing.T) {
+	igd, err := NewTestIGD(t.Logf, TestIGDOptions{PCP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer igd.Close()
+
+	c := newTestClient(t, igd)
+	defer c.Close()
+	c.SetLocalPort(1234)
+	if _, ok := c.CurrentMapping(); ok {
+		t.Fatal("have a mapping before creating one")
+	}
+	if _, err := c.Probe(context.Background()); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if got := c.RecentServices(); got != (ProbeResult{PCP: true}) {
+		t.Errorf("RecentServices = %+v; want just PCP", got)
+	}
+
+	m, err := c.CreateMapping(context.Background())
+	if err != nil {
+		t.Fatalf("CreateMapping: %v", err)
+	}
+	if m.Type != "pcp" || !m.External.IsValid() || !m.GoodUntil.After(time.Now()) || m.RenewAfter.After(m.GoodUntil) {
+		t.Errorf("CreateMapping = %+v", m)
+	}
+	if cur, ok := c.CurrentMapping(); !ok || cur != m {
+		t.Errorf("CurrentMapping = %+v, %v; want %+v", cur, ok, m)
+	}
+
+	c.mu.Lock()
+	c.runningCreate = true
+	c.mu.Unlock()
+	if _, err := c.CreateMapping(context.Background()); err != ErrMappingInProgress {
+		t.Errorf("CreateMapping while creating one = %v; want ErrMappingInProgress", err)
+	}
+}
@@ -59,6 +59,7 @@ type upnpMapping struct {
 func (u *upnpMapping) GoodUntil() time.Time     { return u.goodUntil }
 func (u *upnpMapping) RenewAfter() time.Time    { return u.renewAfter }
 func (u *upnpMapping) External() netip.AddrPort { return u.external }
+func (u *upnpMapping) MappingType() string      { return "upnp" }
 func (u *upnpMapping) Release(ctx context.Context) {
 	u.client.DeletePortMapping(ctx, "", u.external.Port(), upnpProtocolUDP)
 }
@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package proxystats tracks the usage of the outbound proxies (SOCKS5 and
+// HTTP) that tailscaled can run on behalf of local applications.
+package proxystats
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Proxy types, as used in Stats.Type.
+const (
+	TypeSOCKS5 = "socks5"
+	TypeHTTP   = "http"
+)
+
+// Dialer is the signature of the dialers used by the proxies for outgoing
+// connections.
+type Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Proxy counts the connections made by a single proxy server.
+// Its methods are safe for concurrent use.
+type Proxy struct {
+	typ  string
+	addr string
+
+	activeConns atomic.Int64
+	totalConns  atomic.Int64
+	dialErrors  atomic.Int64
+	bytesSent   atomic.Int64 // from the app, to the destination
+	bytesRecv   atomic.Int64 // from the destination, to the app
+}
+
+// Stats is a snapshot of a Proxy's counters.
+type Stats struct {
+	Type        string // TypeSOCKS5 or TypeHTTP
+	Addr        string // listen address
+	ActiveConns int64  // outgoing connections currently open
+	TotalConns  int64  // outgoing connections ever opened
+	DialErrors  int64  // outgoing connections that failed to dial
+	BytesSent   int64  // bytes proxied from apps to destinations
+	BytesRecv   int64  // bytes proxied from destinations to apps
+}
+
+var (
+	mu      sync.Mutex
+	proxies []*Proxy
+)
+
+// Register records that a proxy of the given type (TypeSOCKS5 or TypeHTTP)
+// is listening on addr, and returns the Proxy with which to count its
+// connections.
+func Register(typ, addr string) *Proxy {
+	p := &Proxy{typ: typ, addr: addr}
+	mu.Lock()
+	defer mu.Unlock()
+	proxies = append(proxies, p)
+	return p
+}
+
+// Snapshot returns the stats of all registered proxies, in the order they
+// were registered. It returns nil if no proxy is running.
+func Snapshot() []Stats {
+	mu.Lock()
+	defer mu.Unlock()
+	var ret []Stats
+	for _, p := range proxies {
+		ret = append(ret, p.Stats())
+	}
+	return ret
+}
+
+// Stats returns a snapshot of p's counters.
+func (p *Proxy) Stats() Stats {
+	return Stats{
+		Type:        p.typ,
+		Addr:        p.addr,
+		ActiveConns: p.activeConns.Load(),
+		TotalConns:  p.totalConns.Load(),
+		DialErrors:  p.dialErrors.Load(),
+		BytesSent:   p.bytesSent.Load(),
+		BytesRecv:   p.bytesRecv.Load(),
+	}
+}
+
+// WrapDialer returns a Dialer that dials with d and counts the resulting
+// connections and their traffic against p.
+func (p *Proxy) WrapDialer(d Dialer) Dialer {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := d(ctx, network, addr)
+		if err != nil {
+			p.dialErrors.Add(1)
+			return nil, err
+		}
+		p.totalConns.Add(1)
+		p.activeConns.Add(1)
+		return &countingConn{Conn: c, p: p}, nil
+	}
+}
+
+// countingConn is a net.Conn that counts its traffic against a Proxy.
+type countingConn struct {
+	net.Conn
+	p         *Proxy
+	closeOnce sync.Once
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.p.bytesRecv.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.p.bytesSent.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	c.closeOnce.Do(func() { c.p.activeConns.Add(-1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package proxystats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestWrapDialer(t *testing.T) {
+	p := &Proxy{typ: TypeSOCKS5, addr: "localhost:1080"}
+
+	var srv net.Conn
+	d := p.WrapDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == "bad:1" {
+			return nil, errors.New("nope")
+		}
+		c1, c2 := net.Pipe()
+		srv = c2
+		return c1, nil
+	})
+
+	if _, err := d(context.Background(), "tcp", "bad:1"); err == nil {
+		t.Fatal("expected error")
+	}
+	c, err := d(context.Background(), "tcp", "good:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 5)
+		io.ReadFull(srv, buf)
+		srv.Write([]byte("pong!!"))
+	}()
+	if _, err := c.Write([]byte("ping!")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(c, make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.Stats()
+	want := Stats{
+		Type:        TypeSOCKS5,
+		Addr:        "localhost:1080",
+		ActiveConns: 1,
+		TotalConns:  1,
+		DialErrors:  1,
+		BytesSent:   5,
+		BytesRecv:   6,
+	}
+	if got != want {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	c.Close()
+	c.Close()
+	if n := p.Stats().ActiveConns; n != 0 {
+		t.Errorf("ActiveConns after close = %d; want 0", n)
+	}
+}
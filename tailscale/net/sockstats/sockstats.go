@@ -10,6 +10,8 @@
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"tailscale.com/net/netmon"
 	"tailscale.com/types/logger"
@@ -113,8 +115,42 @@ func SetNetMon(netMon *netmon.Monitor) {
 	setNetMon(netMon)
 }
 
+// DebugSockStats contains debug information about the tracked statistics.
+type DebugSockStats struct {
+	// RadioHighPercent is roughly the percentage of the last hour that
+	// the cellular radio spent in its high power state.
+	RadioHighPercent int64
+
+	// RadioActive has one sample per second for the last hour, oldest
+	// first: 1 if the cellular radio was used in that second, else 0.
+	RadioActive []int64
+}
+
+// String returns the debug information in the form returned by DebugInfo.
+func (s *DebugSockStats) String() string {
+	if s == nil {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "radio high percent: %d\n", s.RadioHighPercent)
+	fmt.Fprintf(&b, "radio activity for the last hour (one minute per line):\n")
+	for i, a := range s.RadioActive {
+		fmt.Fprintf(&b, "%d", a)
+		if i%60 == 59 {
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+	return b.String()
+}
+
+// GetDebug returns debug information about the tracked statistics, or nil
+// if sockstats aren't available.
+func GetDebug() *DebugSockStats {
+	return getDebug()
+}
+
 // DebugInfo returns a string containing debug information about the tracked
 // statistics.
 func DebugInfo() string {
-	return debugInfo()
+	return GetDebug().String()
 }
@@ -33,6 +33,6 @@ func getValidation() *ValidationSockStats {
 func setNetMon(netMon *netmon.Monitor) {
 }
 
-func debugInfo() string {
-	return ""
+func getDebug() *DebugSockStats {
+	return nil
 }
@@ -0,0 +1,30 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package sockstats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebugSockStatsString(t *testing.T) {
+	var nilStats *DebugSockStats
+	if got := nilStats.String(); got != "" {
+		t.Errorf("nil String = %q; want empty", got)
+	}
+
+	s := &DebugSockStats{
+		RadioHighPercent: 42,
+		RadioActive:      make([]int64, 120),
+	}
+	s.RadioActive[0] = 1
+	s.RadioActive[119] = 1
+	want := "radio high percent: 42\n" +
+		"radio activity for the last hour (one minute per line):\n" +
+		"1" + strings.Repeat("0", 59) + "\n" +
+		strings.Repeat("0", 59) + "1\n"
+	if got := s.String(); got != want {
+		t.Errorf("String = %q; want %q", got, want)
+	}
+}
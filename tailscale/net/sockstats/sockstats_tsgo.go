@@ -293,17 +293,12 @@ func setNetMon(netMon *netmon.Monitor) {
 	})
 }
 
-func debugInfo() string {
-	var b strings.Builder
-	fmt.Fprintf(&b, "radio high percent: %d\n", radio.radioHighPercent())
-	fmt.Fprintf(&b, "radio activity for the last hour (one minute per line):\n")
-	for i, a := range radio.radioActive() {
-		fmt.Fprintf(&b, "%d", a)
-		if i%60 == 59 {
-			fmt.Fprintf(&b, "\n")
-		}
+func getDebug() *DebugSockStats {
+	active := radio.radioActive()
+	return &DebugSockStats{
+		RadioHighPercent: radio.radioHighPercent(),
+		RadioActive:      active[:],
 	}
-	return b.String()
 }
 
 func isLikelyCellularInterface(ifName string) bool {
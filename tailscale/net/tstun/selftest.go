@@ -0,0 +1,100 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tstun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/ipproto"
+)
+
+// Stages of SelfTest, as reported in SelfTestError.Stage.
+const (
+	SelfTestStageWrite = "write" // writing the probe to the tun device
+	SelfTestStageRead  = "read"  // reading the OS's reply back from the tun device
+)
+
+// SelfTestError is the error returned by SelfTest when a stage fails.
+type SelfTestError struct {
+	Stage string // SelfTestStageWrite or SelfTestStageRead
+	Err   error
+}
+
+func (e *SelfTestError) Error() string { return fmt.Sprintf("tun self-test %s: %v", e.Stage, e.Err) }
+func (e *SelfTestError) Unwrap() error { return e.Err }
+
+// selfTestProbe is a SelfTest waiting for its reply.
+type selfTestProbe struct {
+	local, remote netip.Addr
+	idSeq         uint32
+	gotReply      chan struct{}
+	once          sync.Once
+}
+
+// matches reports whether p is the OS's reply to probe.
+func (pr *selfTestProbe) matches(p *packet.Parsed) bool {
+	return p.IsEchoResponse() &&
+		p.Src.Addr() == pr.local &&
+		p.Dst.Addr() == pr.remote &&
+		p.EchoIDSeq() == pr.idSeq
+}
+
+// SelfTest checks that packets can be both written to and read from t's tun
+// device. It writes an ICMP echo request to local (which must be one of the
+// node's Tailscale addresses) as if it came from the Tailscale service IP,
+// then waits until ctx is done for the OS's echo reply to be read back.
+//
+// It returns a *SelfTestError naming the stage that failed, if any. Only one
+// SelfTest may run at a time.
+func (t *Wrapper) SelfTest(ctx context.Context, local netip.Addr) error {
+	var h packet.Header
+	pr := &selfTestProbe{local: local, gotReply: make(chan struct{})}
+	idSeq, payload := packet.ICMPEchoPayload(nil)
+	pr.idSeq = idSeq
+	if local.Is4() {
+		pr.remote = tsaddr.TailscaleServiceIP()
+		h = &packet.ICMP4Header{
+			IP4Header: packet.IP4Header{IPProto: ipproto.ICMPv4, Src: pr.remote, Dst: local},
+			Type:      packet.ICMP4EchoRequest,
+		}
+	} else {
+		pr.remote = tsaddr.TailscaleServiceIPv6()
+		h = &packet.ICMP6Header{
+			IP6Header: packet.IP6Header{IPProto: ipproto.ICMPv6, Src: pr.remote, Dst: local},
+			Type:      packet.ICMP6EchoRequest,
+		}
+	}
+
+	if !t.selfTest.CompareAndSwap(nil, pr) {
+		return errors.New("tun self-test already running")
+	}
+	defer t.selfTest.Store(nil)
+
+	if err := t.InjectInboundCopy(packet.Generate(h, payload)); err != nil {
+		return &SelfTestError{SelfTestStageWrite, err}
+	}
+	select {
+	case <-pr.gotReply:
+		return nil
+	case <-ctx.Done():
+		return &SelfTestError{SelfTestStageRead, fmt.Errorf("no reply from OS: %w", ctx.Err())}
+	}
+}
+
+// handleSelfTestReply reports whether p is the reply to a running SelfTest,
+// in which case it's consumed.
+func (t *Wrapper) handleSelfTestReply(p *packet.Parsed) bool {
+	pr := t.selfTest.Load()
+	if pr == nil || !pr.matches(p) {
+		return false
+	}
+	pr.once.Do(func() { close(pr.gotReply) })
+	return true
+}
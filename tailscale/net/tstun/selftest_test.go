@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tstun
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/packet"
+)
+
+func TestSelfTest(t *testing.T) {
+	chtun, tun := newChannelTUN(t.Logf, true)
+	defer tun.Close()
+	local := netip.MustParseAddr("100.101.102.103")
+
+	// Play the OS: answer the echo request written to the tun device.
+	go func() {
+		var p packet.Parsed
+		p.Decode(<-chtun.Inbound)
+		if !p.IsEchoRequest() || p.Dst.Addr() != local {
+			t.Errorf("unexpected probe %v", p.String())
+			return
+		}
+		h := p.ICMP4Header()
+		h.ToResponse()
+		chtun.Outbound <- packet.Generate(&h, p.Payload())
+	}()
+	go func() {
+		buffs := [][]byte{make([]byte, MaxPacketSize)}
+		sizes := make([]int, 1)
+		for {
+			n, err := tun.Read(buffs, sizes, 0)
+			if err != nil {
+				return
+			}
+			if n > 0 {
+				t.Errorf("self-test reply not consumed")
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tun.SelfTest(ctx, local); err != nil {
+		t.Fatal(err)
+	}
+
+	// With nothing answering, it fails at the read stage.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	go func() { <-chtun.Inbound }()
+	err := tun.SelfTest(ctx, local)
+	var se *SelfTestError
+	if !errors.As(err, &se) || se.Stage != SelfTestStageRead {
+		t.Fatalf("err = %v; want read stage failure", err)
+	}
+}
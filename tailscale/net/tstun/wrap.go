@@ -24,6 +24,7 @@
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"tailscale.com/disco"
 	"tailscale.com/net/connstats"
+	"tailscale.com/net/dropstats"
 	"tailscale.com/net/packet"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/net/tstun/table"
@@ -188,6 +189,9 @@ type Wrapper struct {
 	stats atomic.Pointer[connstats.Statistics]
 
 	captureHook syncs.AtomicValue[capture.Callback]
+
+	// selfTest is the SelfTest in progress, if any.
+	selfTest atomic.Pointer[selfTestProbe]
 }
 
 // tunInjectedRead is an injected packet pretending to be a tun.Read().
@@ -644,6 +648,10 @@ func (t *Wrapper) SetWGConfig(wcfg *wgcfg.Config) {
 )
 
 func (t *Wrapper) filterPacketOutboundToWireGuard(p *packet.Parsed) filter.Response {
+	if t.handleSelfTestReply(p) {
+		return filter.DropSilently
+	}
+
 	// Fake ICMP echo responses to MagicDNS (100.100.100.100).
 	if p.IsEchoRequest() {
 		switch p.Dst {
@@ -881,6 +889,7 @@ func (t *Wrapper) filterPacketInboundFromWireGuard(p *packet.Parsed, captHook ca
 
 	if outcome != filter.Accept {
 		metricPacketInDropFilter.Add(1)
+		dropstats.Add(dropstats.ReasonACL)
 
 		// Tell them, via TSMP, we're dropping them due to the ACL.
 		// Their host networking stack can translate this into ICMP
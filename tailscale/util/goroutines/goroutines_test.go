@@ -3,7 +3,11 @@
 
 package goroutines
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestScrubbedGoroutineDump(t *testing.T) {
 	t.Logf("Got:\n%s\n", ScrubbedGoroutineDump(true))
@@ -27,3 +31,58 @@ func TestScrubHex(t *testing.T) {
 		}
 	}
 }
+
+func TestParse(t *testing.T) {
+	dump := `goroutine 1 [running]:
+main.main()
+	/src/main.go:10 +0x1d
+
+goroutine 7 [chan receive, 5 minutes, locked to thread]:
+net/http.(*Server).Serve(v1%0_, {v2%1_, v3%2_})
+	/go/src/net/http/server.go:3056 +v4%3_
+...additional frames elided...
+created by main.start in goroutine 1
+	/src/start.go:3 +v5%4_
+
+goroutine 9 [select]:
+created by main.start
+	/src/start.go:4 +v6%5_
+`
+	got := Parse([]byte(dump))
+	want := []Goroutine{
+		{
+			ID:     1,
+			State:  "running",
+			Frames: []Frame{{"main.main", "/src/main.go", 10}},
+		},
+		{
+			ID:             7,
+			State:          "chan receive",
+			Wait:           5 * time.Minute,
+			LockedToThread: true,
+			Frames:         []Frame{{"net/http.(*Server).Serve", "/go/src/net/http/server.go", 3056}},
+			CreatedBy:      &Frame{"main.start", "/src/start.go", 3},
+		},
+		{
+			ID:        9,
+			State:     "select",
+			CreatedBy: &Frame{"main.start", "/src/start.go", 4},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\n\nwant %+v", got, want)
+	}
+}
+
+func TestScrubbedGoroutines(t *testing.T) {
+	gs := ScrubbedGoroutines()
+	if len(gs) == 0 {
+		t.Fatal("no goroutines")
+	}
+	for _, f := range gs[0].Frames {
+		if f.Function == "tailscale.com/util/goroutines.ScrubbedGoroutineDump" {
+			return
+		}
+	}
+	t.Errorf("first goroutine's frames %+v don't include the dump", gs[0].Frames)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package goroutines
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Goroutine is a goroutine parsed from a stack dump.
+type Goroutine struct {
+	ID    int
+	State string // such as "running" or "chan receive"
+
+	// Wait is roughly how long the goroutine has been blocked, which the
+	// runtime only reports in whole minutes, and only after a minute.
+	Wait time.Duration `json:",omitempty"`
+
+	LockedToThread bool `json:",omitempty"`
+
+	// Frames is the goroutine's stack, innermost call first.
+	Frames []Frame
+
+	// CreatedBy is the go statement that started the goroutine, or nil
+	// for the main goroutine.
+	CreatedBy *Frame `json:",omitempty"`
+}
+
+// Frame is a single call in a Goroutine's stack.
+type Frame struct {
+	Function string // such as "net/http.(*Server).Serve"
+	File     string
+	Line     int
+}
+
+// ScrubbedGoroutines returns all goroutines, parsed from
+// ScrubbedGoroutineDump. Their arguments aren't included.
+func ScrubbedGoroutines() []Goroutine {
+	return Parse(ScrubbedGoroutineDump(true))
+}
+
+// Parse parses a stack dump in the format written by runtime.Stack. It
+// skips anything it doesn't understand.
+func Parse(dump []byte) []Goroutine {
+	var ret []Goroutine
+	var cur *Goroutine
+	var fn string // function of the frame whose location is on the next line
+	var created bool
+	s := bufio.NewScanner(bytes.NewReader(dump))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case line == "":
+			cur = nil
+		case strings.HasPrefix(line, "goroutine "):
+			g, ok := parseGoroutineHeader(line)
+			if !ok {
+				cur = nil
+				continue
+			}
+			ret = append(ret, g)
+			cur = &ret[len(ret)-1]
+			fn, created = "", false
+		case cur == nil:
+		case strings.HasPrefix(line, "\t"):
+			if fn == "" {
+				continue
+			}
+			f := parseFrameLocation(fn, line)
+			if created {
+				cur.CreatedBy = &f
+			} else {
+				cur.Frames = append(cur.Frames, f)
+			}
+			fn = ""
+		case strings.HasPrefix(line, "created by "):
+			fn, _, _ = strings.Cut(strings.TrimPrefix(line, "created by "), " in goroutine ")
+			created = true
+		case strings.HasPrefix(line, "..."):
+			// "...additional frames elided..."
+		default:
+			fn = line
+			if i := strings.LastIndexByte(fn, '('); i > 0 {
+				fn = fn[:i]
+			}
+			created = false
+		}
+	}
+	return ret
+}
+
+// parseGoroutineHeader parses a line like
+// "goroutine 7 [chan receive, 5 minutes, locked to thread]:".
+func parseGoroutineHeader(line string) (g Goroutine, ok bool) {
+	rest := strings.TrimPrefix(line, "goroutine ")
+	idStr, rest, ok := strings.Cut(rest, " [")
+	if !ok {
+		return g, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return g, false
+	}
+	rest, ok = strings.CutSuffix(rest, "]:")
+	if !ok {
+		return g, false
+	}
+	g.ID = id
+	for i, part := range strings.Split(rest, ", ") {
+		switch {
+		case i == 0:
+			g.State = part
+		case part == "locked to thread":
+			g.LockedToThread = true
+		case strings.HasSuffix(part, " minutes"):
+			if n, err := strconv.Atoi(strings.TrimSuffix(part, " minutes")); err == nil {
+				g.Wait = time.Duration(n) * time.Minute
+			}
+		}
+	}
+	return g, true
+}
+
+// parseFrameLocation returns the Frame for fn, given the line after it,
+// like "\t/usr/local/go/src/net/fd_unix.go:172 +0x35".
+func parseFrameLocation(fn, line string) Frame {
+	f := Frame{Function: fn}
+	loc := strings.TrimPrefix(line, "\t")
+	if i := strings.LastIndex(loc, " +"); i >= 0 {
+		loc = loc[:i]
+	}
+	f.File = loc
+	if i := strings.LastIndexByte(loc, ':'); i >= 0 {
+		if n, err := strconv.Atoi(loc[i+1:]); err == nil {
+			f.File, f.Line = loc[:i], n
+		}
+	}
+	return f
+}
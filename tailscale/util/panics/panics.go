@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package panics keeps a bounded in-memory record of recovered panics and
+// significant internal errors, so that latent bugs that don't crash the
+// process can still be reported later (e.g. over c2n).
+package panics
+
+import (
+	"fmt"
+	"time"
+
+	"tailscale.com/util/goroutines"
+	"tailscale.com/util/ringbuffer"
+)
+
+// maxRecords is the number of records retained; older records are
+// overwritten.
+const maxRecords = 32
+
+var recent = ringbuffer.New[Record](maxRecords)
+
+// Record is a single recovered panic or noted internal error.
+type Record struct {
+	When  time.Time // when it was recorded
+	Where string    // the subsystem or call site that recorded it
+	Kind  string    // "panic" or "error"
+	Value string    // the scrubbed panic value, or the error text
+
+	// Stack is the scrubbed stack of the goroutine that recorded it, as
+	// returned by goroutines.ScrubbedGoroutineDump. Empty for errors.
+	Stack string `json:",omitempty"`
+}
+
+// Recover recovers a panic, if any, and records it. It must be deferred
+// directly (as in "defer panics.Recover(where)") so that recover works.
+// The panic is not re-raised.
+//
+// Callers that need to act on the panic (e.g. to log it or return an
+// error) should call recover themselves and use RecordPanic.
+func Recover(where string) {
+	if r := recover(); r != nil {
+		RecordPanic(where, r)
+	}
+}
+
+// RecordPanic records r, a value returned from recover, along with the
+// stack of the calling goroutine. Both are scrubbed by goroutines.Scrub, as
+// the value may include the same arguments as the stack.
+func RecordPanic(where string, r any) {
+	recent.Add(Record{
+		When:  time.Now(),
+		Where: where,
+		Kind:  "panic",
+		Value: goroutines.Scrub(fmt.Sprint(r)),
+		Stack: string(goroutines.ScrubbedGoroutineDump(false)),
+	})
+}
+
+// NoteError records err as a significant internal error. It's a no-op if
+// err is nil.
+func NoteError(where string, err error) {
+	if err == nil {
+		return
+	}
+	recent.Add(Record{
+		When:  time.Now(),
+		Where: where,
+		Kind:  "error",
+		Value: err.Error(),
+	})
+}
+
+// Recent returns the retained records, oldest first.
+func Recent() []Record {
+	return recent.GetAll()
+}
+
+// Clear removes all retained records.
+func Clear() {
+	recent.Clear()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package panics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	Clear()
+	t.Cleanup(Clear)
+
+	func() {
+		defer Recover("test")
+		panic("boom")
+	}()
+	NoteError("test", errors.New("oops"))
+	NoteError("test", nil)
+
+	got := Recent()
+	if len(got) != 2 {
+		t.Fatalf("got %d records; want 2", len(got))
+	}
+	if got[0].Kind != "panic" || got[0].Value != "boom" || got[0].Where != "test" {
+		t.Errorf("bad panic record: %+v", got[0])
+	}
+	if !strings.Contains(got[0].Stack, "TestRecover") {
+		t.Errorf("panic stack missing caller:\n%s", got[0].Stack)
+	}
+	if got[1].Kind != "error" || got[1].Value != "oops" || got[1].Stack != "" {
+		t.Errorf("bad error record: %+v", got[1])
+	}
+
+	Clear()
+	if n := len(Recent()); n != 0 {
+		t.Errorf("after Clear, got %d records", n)
+	}
+}
+
+func TestRecordPanicScrubsValue(t *testing.T) {
+	Clear()
+	t.Cleanup(Clear)
+
+	RecordPanic("test", fmt.Errorf("bad pointer 0x%x", 0xc000123456))
+	got := Recent()
+	if len(got) != 1 {
+		t.Fatalf("got %d records; want 1", len(got))
+	}
+	if v := got[0].Value; strings.Contains(v, "c000123456") || !strings.HasPrefix(v, "bad pointer v1%6") {
+		t.Errorf("Value = %q; want the address scrubbed", v)
+	}
+}
+
+func TestBounded(t *testing.T) {
+	Clear()
+	t.Cleanup(Clear)
+	for i := 0; i < maxRecords*2; i++ {
+		NoteError("test", errors.New("x"))
+	}
+	if n := len(Recent()); n != maxRecords {
+		t.Errorf("got %d records; want %d", n, maxRecords)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package sysresources
+
+// PowerSource is what the system is currently running on.
+type PowerSource string
+
+const (
+	PowerUnknown PowerSource = "unavailable" // can't be determined on this platform
+	PowerAC      PowerSource = "ac"
+	PowerBattery PowerSource = "battery"
+)
+
+// CurrentPowerSource reports whether the system is running on AC power or
+// on battery. It returns PowerUnknown if that can't be determined.
+func CurrentPowerSource() PowerSource {
+	return powerSourceImpl()
+}
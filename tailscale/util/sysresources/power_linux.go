@@ -0,0 +1,55 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !android
+
+package sysresources
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func powerSourceImpl() PowerSource {
+	return powerSourceFromSysfs("/sys/class/power_supply")
+}
+
+// powerSourceFromSysfs determines the power source from the Linux
+// power_supply class directory dir.
+func powerSourceFromSysfs(dir string) PowerSource {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return PowerUnknown
+	}
+	read := func(supply, attr string) string {
+		b, _ := os.ReadFile(filepath.Join(dir, supply, attr))
+		return strings.TrimSpace(string(b))
+	}
+	var haveMains, haveBattery bool
+	for _, ent := range ents {
+		name := ent.Name()
+		switch read(name, "type") {
+		case "Mains", "USB":
+			haveMains = true
+			if read(name, "online") == "1" {
+				return PowerAC
+			}
+		case "Battery":
+			haveBattery = true
+			if read(name, "status") == "Discharging" {
+				return PowerBattery
+			}
+		}
+	}
+	switch {
+	case haveMains && haveBattery:
+		// No online AC adapter, but the battery isn't discharging
+		// either (e.g. "Unknown" or "Not charging"); call it battery.
+		return PowerBattery
+	case haveBattery:
+		// A battery that's charging or full implies external power.
+		return PowerAC
+	}
+	return PowerUnknown
+}
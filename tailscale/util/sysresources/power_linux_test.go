@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux && !android
+
+package sysresources
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPowerSourceFromSysfs(t *testing.T) {
+	type supply struct {
+		name  string
+		attrs map[string]string
+	}
+	tests := []struct {
+		name     string
+		supplies []supply
+		want     PowerSource
+	}{
+		{"none", nil, PowerUnknown},
+		{"ac-online", []supply{
+			{"AC", map[string]string{"type": "Mains", "online": "1"}},
+			{"BAT0", map[string]string{"type": "Battery", "status": "Charging"}},
+		}, PowerAC},
+		{"discharging", []supply{
+			{"AC", map[string]string{"type": "Mains", "online": "0"}},
+			{"BAT0", map[string]string{"type": "Battery", "status": "Discharging"}},
+		}, PowerBattery},
+		{"battery-full-no-adapter", []supply{
+			{"BAT0", map[string]string{"type": "Battery", "status": "Full"}},
+		}, PowerAC},
+		{"adapter-offline-not-charging", []supply{
+			{"AC", map[string]string{"type": "Mains", "online": "0"}},
+			{"BAT0", map[string]string{"type": "Battery", "status": "Not charging"}},
+		}, PowerBattery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, s := range tt.supplies {
+				if err := os.Mkdir(filepath.Join(dir, s.name), 0755); err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range s.attrs {
+					if err := os.WriteFile(filepath.Join(dir, s.name, k), []byte(v+"\n"), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if got := powerSourceFromSysfs(dir); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
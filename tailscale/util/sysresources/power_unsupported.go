@@ -0,0 +1,8 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux || android
+
+package sysresources
+
+func powerSourceImpl() PowerSource { return PowerUnknown }
@@ -59,6 +59,25 @@ func AtLeast(version string, minimum string) bool {
 	}
 }
 
+// SameMajorMinor reports whether a and b are Tailscale versions with the
+// same major and minor version numbers, such as "1.56.0" and
+// "1.56.1-t1234abcd". OSS build datestamps are only the same if they're
+// equal. It returns false if either doesn't parse.
+func SameMajorMinor(a, b string) bool {
+	pa, ok := parse(a)
+	if !ok {
+		return false
+	}
+	pb, ok := parse(b)
+	if !ok {
+		return false
+	}
+	if pa.Datestamp != 0 || pb.Datestamp != 0 {
+		return pa.Datestamp == pb.Datestamp
+	}
+	return pa.Major == pb.Major && pa.Minor == pb.Minor
+}
+
 type parsed struct {
 	Major, Minor, Patch, ExtraCommits int // for Tailscale version e.g. e.g. "0.99.1-20"
 	Datestamp                         int // for OSS version e.g. "date.20200612"
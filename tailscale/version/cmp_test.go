@@ -80,3 +80,25 @@ func TestAtLeast(t *testing.T) {
 		}
 	}
 }
+
+func TestSameMajorMinor(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.56.1", "1.56.1", true},
+		{"1.56.1-t1234abcd-g5678", "1.56.1-tabcd1234-g8765", true},
+		{"1.56.0", "1.56.1-4", true},
+		{"1.56.1", "1.58.1", false},
+		{"1.56.1", "2.56.1", false},
+		{"date.20200612", "date.20200612", true},
+		{"date.20200612", "date.20200701", false},
+		{"date.20200612", "1.56.1", false},
+		{"borkbork", "borkbork", false},
+	}
+	for _, test := range tests {
+		if got := version.SameMajorMinor(test.a, test.b); got != test.want {
+			t.Errorf("SameMajorMinor(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -325,6 +325,58 @@ func (f *Filter) CheckTCP(srcIP, dstIP netip.Addr, dstPort uint16) Response {
 	return f.RunIn(pkt, 0)
 }
 
+// Check is a dry run of RunIn for the first packet of an inbound flow of
+// proto from srcIP to dstIP:dstPort (a SYN, for TCP; an echo request, for
+// ICMP). It reports the verdict, the reason for it as RunIn would log it, and
+// the first rule that accepts the packet, if any. It doesn't log or modify
+// f's state.
+func (f *Filter) Check(srcIP, dstIP netip.Addr, proto ipproto.Proto, dstPort uint16) (r Response, why string, rule *Match) {
+	q := &packet.Parsed{}
+	q.Decode(dummyPacket) // initialize private fields
+	switch {
+	case srcIP.Is4() != dstIP.Is4():
+		return Drop, "mismatched address families", nil
+	case srcIP.Is4():
+		q.IPVersion = 4
+	default:
+		q.IPVersion = 6
+	}
+	q.Src = netip.AddrPortFrom(srcIP, 0)
+	q.Dst = netip.AddrPortFrom(dstIP, dstPort)
+	q.IPProto = proto
+	if proto == ipproto.TCP {
+		q.TCPFlags = packet.TCPSyn
+	}
+
+	if r = f.pre(q, 0, in); r == Accept || r == Drop {
+		return r, "multicast or link-local destination", nil
+	}
+	ms := f.matches4
+	if q.IPVersion == 4 {
+		r, why = f.runIn4(q)
+	} else {
+		ms = f.matches6
+		r, why = f.runIn6(q)
+	}
+	if r != Accept {
+		return r, why, nil
+	}
+	matchFn := matches.match
+	switch proto {
+	case ipproto.ICMPv4, ipproto.ICMPv6:
+		matchFn = matches.matchIPsOnly
+	case ipproto.TCP, ipproto.UDP, ipproto.SCTP:
+	default:
+		matchFn = matches.matchProtoAndIPsOnlyIfAllPorts
+	}
+	for i := range ms {
+		if matchFn(ms[i:i+1], q) {
+			return r, why, &ms[i]
+		}
+	}
+	return r, why, nil // accepted without a rule; see why
+}
+
 // CapsWithValues appends to base the capabilities that srcIP has talking
 // to dstIP.
 func (f *Filter) CapsWithValues(srcIP, dstIP netip.Addr) tailcfg.PeerCapMap {
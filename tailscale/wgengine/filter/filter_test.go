@@ -159,6 +159,49 @@ type InOut struct {
 	}
 }
 
+func TestCheck(t *testing.T) {
+	acl := newFilter(t.Logf)
+	ip := netip.MustParseAddr
+	tests := []struct {
+		name          string
+		src, dst      string
+		proto         ipproto.Proto
+		port          uint16
+		want          Response
+		wantWhy       string
+		wantRuleDst   string // first rule Dst, or "" for no rule
+		wantRuleProto ipproto.Proto
+	}{
+		{"tcp", "8.1.1.1", "1.2.3.4", ipproto.TCP, 22, Accept, "tcp ok", "1.2.3.4/32:22", 0},
+		{"tcp-later-rule", "8.1.1.1", "5.6.7.8", ipproto.TCP, 27, Accept, "tcp ok", "5.6.7.8/32:27-28", 0},
+		{"tcp-denied", "8.1.1.1", "1.2.3.4", ipproto.TCP, 21, Drop, "no rules matched", "", 0},
+		{"icmp", "8.1.1.1", "1.2.3.4", ipproto.ICMPv4, 0, Accept, "icmp ok", "1.2.3.4/32:22", 0},
+		{"sctp", "9.1.1.1", "1.2.3.4", ipproto.SCTP, 22, Accept, "ok", "1.2.3.4/32:22", ipproto.SCTP},
+		{"other", "1.2.3.4", "5.6.7.8", testAllowedProto, 0, Accept, "other-portless ok", "0.0.0.0/0:*", testAllowedProto},
+		{"tsmp", "1.2.3.4", "5.6.7.8", ipproto.TSMP, 0, Accept, "tsmp ok", "", 0},
+		{"v6", "::1", "2001::1", ipproto.TCP, 22, Accept, "tcp ok", "2001::1/128:22", 0},
+		{"not-local", "8.1.1.1", "9.9.9.9", ipproto.TCP, 22, Drop, "destination not allowed", "", 0},
+		{"mixed-families", "8.1.1.1", "2001::1", ipproto.TCP, 22, Drop, "mismatched address families", "", 0},
+		{"multicast", "8.1.1.1", "224.0.0.1", ipproto.UDP, 5353, Drop, "multicast or link-local destination", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, why, rule := acl.Check(ip(tt.src), ip(tt.dst), tt.proto, tt.port)
+			if r != tt.want || why != tt.wantWhy {
+				t.Errorf("got %v %q; want %v %q", r, why, tt.want, tt.wantWhy)
+			}
+			switch {
+			case tt.wantRuleDst == "" && rule != nil:
+				t.Errorf("got rule %v; want none", rule)
+			case tt.wantRuleDst != "" && (rule == nil || rule.Dsts[0].String() != tt.wantRuleDst):
+				t.Errorf("got rule %v; want one with Dst %v", rule, tt.wantRuleDst)
+			case tt.wantRuleProto != 0 && !slices.Contains(rule.IPProto, tt.wantRuleProto):
+				t.Errorf("got rule %v; want one for %v", rule, tt.wantRuleProto)
+			}
+		})
+	}
+}
+
 func TestUDPState(t *testing.T) {
 	acl := newFilter(t.Logf)
 	flags := LogDrops | LogAccepts
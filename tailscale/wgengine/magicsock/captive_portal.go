@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"tailscale.com/net/netcheck"
+)
+
+// CaptivePortalCheck is the result of the most recent netcheck that checked
+// for a captive portal. Only full netchecks do, so it can lag behind the
+// latest netcheck.
+type CaptivePortalCheck struct {
+	Detected  bool      // whether the check found a captive portal
+	CheckedAt time.Time // zero if there's been no check
+}
+
+// noteCaptivePortalCheck records the captive portal check in report, if it
+// has one.
+func (c *Conn) noteCaptivePortalCheck(report *netcheck.Report, now time.Time) {
+	if detected, ok := report.CaptivePortal.Get(); ok {
+		c.captivePortal.Store(CaptivePortalCheck{Detected: detected, CheckedAt: now})
+	}
+}
+
+// CaptivePortal returns the result of the most recent check for a captive
+// portal intercepting HTTP traffic.
+func (c *Conn) CaptivePortal() CaptivePortalCheck {
+	return c.captivePortal.Load()
+}
+
+// RecheckCaptivePortal checks for a captive portal now, rather than waiting
+// for the next full netcheck, and returns the result. If there's no captive
+// portal, as after the user logs in to one, it also starts a full netcheck
+// so that connectivity recovers without waiting.
+func (c *Conn) RecheckCaptivePortal(ctx context.Context) (CaptivePortalCheck, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return CaptivePortalCheck{}, errConnClosed
+	}
+	dm, home := c.derpMap, c.myDerp
+	c.mu.Unlock()
+	if dm == nil {
+		return CaptivePortalCheck{}, errors.New("no DERP map")
+	}
+	detected, err := c.netChecker.CheckCaptivePortal(ctx, dm, home)
+	if err != nil {
+		return CaptivePortalCheck{}, err
+	}
+	res := CaptivePortalCheck{Detected: detected, CheckedAt: time.Now()}
+	c.captivePortal.Store(res)
+	if !detected {
+		c.netChecker.MakeNextReportFull()
+		c.ReSTUN("captive-portal-recheck")
+	}
+	return res, nil
+}
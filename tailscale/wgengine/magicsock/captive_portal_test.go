@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/net/netcheck"
+)
+
+func TestNoteCaptivePortalCheck(t *testing.T) {
+	c := newConn()
+	if got := c.CaptivePortal(); !got.CheckedAt.IsZero() {
+		t.Fatalf("got %+v before any netcheck; want zero", got)
+	}
+
+	t0 := time.Unix(1000, 0)
+	r := &netcheck.Report{}
+	r.CaptivePortal.Set(true)
+	c.noteCaptivePortalCheck(r, t0)
+	want := CaptivePortalCheck{Detected: true, CheckedAt: t0}
+	if got := c.CaptivePortal(); got != want {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	// An incremental report that didn't check leaves the last result.
+	c.noteCaptivePortalCheck(&netcheck.Report{}, t0.Add(time.Minute))
+	if got := c.CaptivePortal(); got != want {
+		t.Errorf("after unchecked report, got %+v; want %+v", got, want)
+	}
+}
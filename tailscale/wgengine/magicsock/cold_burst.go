@@ -0,0 +1,90 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"runtime"
+	"time"
+
+	"tailscale.com/tstime/mono"
+)
+
+// A cold peer is one that nothing's been sent to for sessionActiveTimeout.
+// When wireguard-go sends it a packet, which is usually a handshake
+// initiation that's waiting on a path, de.send pings all its endpoints as
+// usual, then starts a burst of coldPeerBurstRounds-1 more rounds of
+// discovery pings, coldPeerBurstInterval apart, so that a lost ping or an
+// unopened NAT mapping doesn't leave it on DERP until the next discoPingInterval.
+const (
+	// coldPeerBurstRounds is how many rounds of pings a burst sends,
+	// including the one sent by de.send itself.
+	coldPeerBurstRounds = 3
+
+	// maxColdPeerBursts is how many peers may be bursting at once, so
+	// that a flood of packets to new destinations doesn't become a flood
+	// of pings. Peers beyond that only get the usual discovery.
+	maxColdPeerBursts = 16
+)
+
+// coldPeerBurstInterval is the time between rounds of a burst. It's a var
+// for tests.
+var coldPeerBurstInterval = 250 * time.Millisecond
+
+// startColdBurstLocked starts a burst of discovery pings to de, which was
+// cold until now, unless it's already bursting or too many peers are.
+//
+// de.mu must be held.
+func (de *endpoint) startColdBurstLocked() {
+	if runtime.GOOS == "js" || de.isWireguardOnly || de.coldBurstTimer != nil {
+		return
+	}
+	if de.c.coldBursts.Add(1) > maxColdPeerBursts {
+		de.c.coldBursts.Add(-1)
+		metricColdBurstSkipped.Add(1)
+		return
+	}
+	metricColdBurstStarted.Add(1)
+	de.coldBurstRounds = 1
+	de.coldBurstTimer = time.AfterFunc(coldPeerBurstInterval, de.coldBurstRound)
+}
+
+// coldBurstRound sends the next round of de's cold peer burst, ending it once
+// there's a trusted direct path or it's sent coldPeerBurstRounds rounds.
+func (de *endpoint) coldBurstRound() {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	if de.coldBurstTimer == nil {
+		return // stopped
+	}
+	now := mono.Now()
+	if de.expired || (de.bestAddr.IsValid() && now.Before(de.trustBestAddrUntil)) {
+		de.stopColdBurstLocked()
+		return
+	}
+	for ep, st := range de.endpointState {
+		if st.shouldDeleteLocked() {
+			continue // left to sendDiscoPingsLocked to clean up
+		}
+		de.startDiscoPingLocked(ep, now, pingDiscovery, 0, nil, nil)
+	}
+	de.coldBurstRounds++
+	if de.coldBurstRounds >= coldPeerBurstRounds {
+		de.stopColdBurstLocked()
+		return
+	}
+	de.coldBurstTimer.Reset(coldPeerBurstInterval)
+}
+
+// stopColdBurstLocked ends de's cold peer burst, if any.
+//
+// de.mu must be held.
+func (de *endpoint) stopColdBurstLocked() {
+	if de.coldBurstTimer == nil {
+		return
+	}
+	de.coldBurstTimer.Stop()
+	de.coldBurstTimer = nil
+	de.coldBurstRounds = 0
+	de.c.coldBursts.Add(-1)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/stun"
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+func TestColdPeerBurst(t *testing.T) {
+	defer func(d time.Duration) { coldPeerBurstInterval = d }(coldPeerBurstInterval)
+	coldPeerBurstInterval = 50 * time.Millisecond
+
+	// The Conn is closed so that its pings fail without a network, but
+	// each is still reported as a DiscoEvent.
+	c := &Conn{logf: t.Logf, closed: true}
+	events, unsubscribe := c.SubscribeDiscoEvents()
+	defer unsubscribe()
+
+	addrs := []netip.AddrPort{
+		netip.MustParseAddrPort("1.2.3.4:567"),
+		netip.MustParseAddrPort("[2001:db8::1]:567"),
+	}
+	newPeer := func() *endpoint {
+		de := &endpoint{
+			c:                 c,
+			publicKey:         key.NewNode().Public(),
+			sentPing:          map[stun.TxID]sentPing{},
+			endpointState:     map[netip.AddrPort]*endpointState{},
+			heartbeatDisabled: true,
+		}
+		de.disco.Store(&endpointDisco{key: key.NewDisco().Public(), short: "disco"})
+		for _, a := range addrs {
+			de.endpointState[a] = &endpointState{}
+		}
+		return de
+	}
+	// pings counts the discovery pings sent (or rather, attempted) to de
+	// over wait.
+	pings := func(de *endpoint, wait time.Duration) int {
+		var n int
+		timeout := time.After(wait)
+		for {
+			select {
+			case ev := <-events:
+				if ev.Peer == de.publicKey && ev.Purpose == pingDiscovery.String() {
+					n++
+				}
+			case <-timeout:
+				return n
+			}
+		}
+	}
+	burstTime := coldPeerBurstRounds*coldPeerBurstInterval + 500*time.Millisecond
+
+	de := newPeer()
+	de.send(nil)
+	if got, want := pings(de, burstTime), coldPeerBurstRounds*len(addrs); got != want {
+		t.Errorf("pings after the first packet = %d; want %d", got, want)
+	}
+	if n := c.coldBursts.Load(); n != 0 {
+		t.Errorf("%d bursts after it ended; want 0", n)
+	}
+
+	// Once it's warm, packets don't start another.
+	de.send(nil)
+	de.mu.Lock()
+	bursting := de.coldBurstTimer != nil
+	de.mu.Unlock()
+	if bursting {
+		t.Error("warm peer started a burst")
+	}
+
+	// Nor do they once too many peers are bursting; only the usual
+	// discovery pings are sent.
+	c.coldBursts.Store(maxColdPeerBursts)
+	de = newPeer()
+	de.send(nil)
+	if got, want := pings(de, burstTime), len(addrs); got != want {
+		t.Errorf("pings with too many bursts = %d; want %d", got, want)
+	}
+	c.coldBursts.Store(0)
+
+	// A trusted direct path ends a burst early.
+	de = newPeer()
+	de.send(nil)
+	de.mu.Lock()
+	de.bestAddr = addrLatency{AddrPort: addrs[0]}
+	de.trustBestAddrUntil = mono.Now().Add(time.Hour)
+	de.mu.Unlock()
+	if got, want := pings(de, burstTime), len(addrs); got != want {
+		t.Errorf("pings with a trusted path = %d; want %d", got, want)
+	}
+	if c.coldBursts.Load() != 0 {
+		t.Errorf("%d bursts after the path was found; want 0", c.coldBursts.Load())
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import "tailscale.com/envknob"
+
+// Sources of a ConfigParam's value, as used in ConfigParam.Source.
+const (
+	ConfigSourceDefault = "default" // the built-in value
+	ConfigSourceEnvknob = "envknob" // overridden by the ConfigParam's Envknob
+)
+
+// ConfigParam is the value in effect for one of magicsock's tunable
+// parameters. This is not a stable interface and could change at any time.
+type ConfigParam struct {
+	Name    string
+	Value   any
+	Source  string // ConfigSourceDefault or ConfigSourceEnvknob
+	Envknob string `json:",omitempty"` // the environment variable that overrides it, if any
+}
+
+// CurrentConfig returns the values in effect for magicsock's tunable
+// parameters, and whether each was overridden.
+func CurrentConfig() []ConfigParam {
+	fixed := func(name string, v any) ConfigParam {
+		return ConfigParam{Name: name, Value: v, Source: ConfigSourceDefault}
+	}
+	knob := func(name, env string, v any) ConfigParam {
+		p := ConfigParam{Name: name, Value: v, Source: ConfigSourceDefault, Envknob: env}
+		if debugKnobsEnabled && envknob.String(env) != "" {
+			p.Source = ConfigSourceEnvknob
+		}
+		return p
+	}
+	return []ConfigParam{
+		fixed("heartbeatInterval", heartbeatInterval),
+		fixed("heartbeatLossTimeout", heartbeatLossTimeout),
+		fixed("trustUDPAddrDuration", trustUDPAddrDuration),
+		fixed("sessionActiveTimeout", sessionActiveTimeout),
+		fixed("upgradeInterval", upgradeInterval),
+		fixed("discoPingInterval", discoPingInterval),
+		fixed("pingTimeoutDuration", pingTimeoutDuration),
+		fixed("endpointsFreshEnoughDuration", endpointsFreshEnoughDuration),
+		fixed("derpInactiveCleanupTime", derpInactiveCleanupTime),
+		fixed("derpCleanStaleInterval", derpCleanStaleInterval),
+		fixed("socketBufferSize", socketBufferSize),
+		knob("debugDisco", "TS_DEBUG_DISCO", debugDisco()),
+		knob("debugOmitLocalAddresses", "TS_DEBUG_OMIT_LOCAL_ADDRS", debugOmitLocalAddresses()),
+		knob("debugUseDerpRoute", "TS_DEBUG_ENABLE_DERP_ROUTE", debugUseDerpRoute()),
+		knob("logDerpVerbose", "TS_DEBUG_DERP", logDerpVerbose()),
+		knob("debugReSTUNStopOnIdle", "TS_DEBUG_RESTUN_STOP_ON_IDLE", debugReSTUNStopOnIdle()),
+		knob("debugAlwaysDERP", "TS_DEBUG_ALWAYS_USE_DERP", debugAlwaysDERP()),
+		knob("debugUseDERPAddr", "TS_DEBUG_USE_DERP_ADDR", debugUseDERPAddr()),
+		knob("debugUseDERPHTTP", "TS_DEBUG_USE_DERP_HTTP", debugUseDERPHTTP()),
+		knob("debugEnableSilentDisco", "TS_DEBUG_ENABLE_SILENT_DISCO", debugEnableSilentDisco()),
+		knob("debugSendCallMeUnknownPeer", "TS_DEBUG_SEND_CALLME_UNKNOWN_PEER", debugSendCallMeUnknownPeer()),
+		knob("debugBindSocket", "TS_DEBUG_MAGICSOCK_BIND_SOCKET", debugBindSocket()),
+		knob("debugRingBufferMaxSizeBytes", "TS_DEBUG_MAGICSOCK_RING_BUFFER_MAX_SIZE_BYTES", debugRingBufferMaxSizeBytes()),
+		knob("debugPMTUD", "TS_DEBUG_ENABLE_PMTUD", debugPMTUD()),
+		knob("heartbeatBackoffIdle", "TS_DEBUG_HEARTBEAT_BACKOFF_IDLE", heartbeatBackoffIdle()),
+		knob("heartbeatBackoffMax", "TS_DEBUG_HEARTBEAT_BACKOFF_MAX", heartbeatBackoffMax()),
+	}
+}
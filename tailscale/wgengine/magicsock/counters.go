@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Counters are counts of what a Conn has done since it was created or its
+// counters were last reset. Unlike the package's clientmetrics, which are
+// process-wide and only ever increase, they're per-Conn and can be reset to
+// measure a window of time. This is not a stable interface and could change
+// at any time.
+type Counters struct {
+	// Since is when counting started: when the Conn was created or its
+	// counters were last reset.
+	Since time.Time
+
+	// SendDirect is how many WireGuard packets were sent directly over
+	// UDP, and SendDirectErrors how many failed to be.
+	SendDirect       int64
+	SendDirectErrors int64
+
+	// SendDERP is how many WireGuard packets were queued to be sent over
+	// DERP, and SendDERPDropped how many couldn't be, because the queue
+	// was full or there was no connection to the region.
+	SendDERP        int64
+	SendDERPDropped int64
+
+	// RecvDirectIPv4, RecvDirectIPv6 and RecvDERP are how many WireGuard
+	// packets were received over each path.
+	RecvDirectIPv4 int64
+	RecvDirectIPv6 int64
+	RecvDERP       int64
+
+	// DiscoPingsSent is how many disco pings were sent. DiscoPongsRecv is
+	// how many pongs to them came back, and DiscoPingTimeouts how many
+	// didn't in time.
+	DiscoPingsSent    int64
+	DiscoPongsRecv    int64
+	DiscoPingTimeouts int64
+
+	// DiscoRecvBad is how many disco messages were dropped because they
+	// were from an unknown peer, for the wrong key, or couldn't be parsed.
+	DiscoRecvBad int64
+
+	// HeartbeatsLost is how many direct paths stopped answering heartbeat
+	// pings. See HeartbeatLoss.
+	HeartbeatsLost int64
+}
+
+// connCounters are a Conn's Counters as they're counted.
+type connCounters struct {
+	sendDirect        atomic.Int64
+	sendDirectErrors  atomic.Int64
+	sendDERP          atomic.Int64
+	sendDERPDropped   atomic.Int64
+	recvDirectIPv4    atomic.Int64
+	recvDirectIPv6    atomic.Int64
+	recvDERP          atomic.Int64
+	discoPingsSent    atomic.Int64
+	discoPongsRecv    atomic.Int64
+	discoPingTimeouts atomic.Int64
+	discoRecvBad      atomic.Int64
+	heartbeatsLost    atomic.Int64
+}
+
+// Counters returns c's counters.
+func (c *Conn) Counters() Counters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readCountersLocked(false)
+}
+
+// ResetCounters returns c's counters and resets them to zero. Each counter
+// is read and reset in one atomic operation, so a count made concurrently
+// is in either the returned counters or the next ones, never lost.
+func (c *Conn) ResetCounters() Counters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readCountersLocked(true)
+}
+
+// readCountersLocked returns c's counters and, if reset, resets them.
+//
+// c.mu must be held.
+func (c *Conn) readCountersLocked(reset bool) Counters {
+	read := func(v *atomic.Int64) int64 {
+		if reset {
+			return v.Swap(0)
+		}
+		return v.Load()
+	}
+	cc := &c.counters
+	ret := Counters{
+		Since:             c.countersSince,
+		SendDirect:        read(&cc.sendDirect),
+		SendDirectErrors:  read(&cc.sendDirectErrors),
+		SendDERP:          read(&cc.sendDERP),
+		SendDERPDropped:   read(&cc.sendDERPDropped),
+		RecvDirectIPv4:    read(&cc.recvDirectIPv4),
+		RecvDirectIPv6:    read(&cc.recvDirectIPv6),
+		RecvDERP:          read(&cc.recvDERP),
+		DiscoPingsSent:    read(&cc.discoPingsSent),
+		DiscoPongsRecv:    read(&cc.discoPongsRecv),
+		DiscoPingTimeouts: read(&cc.discoPingTimeouts),
+		DiscoRecvBad:      read(&cc.discoRecvBad),
+		HeartbeatsLost:    read(&cc.heartbeatsLost),
+	}
+	if reset {
+		c.countersSince = time.Now()
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/util/ringbuffer"
+)
+
+func TestCounters(t *testing.T) {
+	c := &Conn{
+		logf:            t.Logf,
+		heartbeatLosses: ringbuffer.New[HeartbeatLoss](maxHeartbeatLosses),
+	}
+	de := &endpoint{c: c}
+	start := mono.Now()
+	de.checkHeartbeatLossLocked(netip.MustParseAddrPort("1.2.3.4:567"), start)
+	de.checkHeartbeatLossLocked(netip.MustParseAddrPort("1.2.3.4:567"), start.Add(heartbeatLossTimeout))
+	c.counters.sendDirect.Add(3)
+
+	if got := c.Counters(); got.HeartbeatsLost != 1 || got.SendDirect != 3 {
+		t.Errorf("Counters = %+v; want 1 heartbeat lost and 3 direct sends", got)
+	}
+	before := c.Counters().Since
+	if got := c.ResetCounters(); got.HeartbeatsLost != 1 || got.SendDirect != 3 || !got.Since.Equal(before) {
+		t.Errorf("ResetCounters = %+v; want the same counters", got)
+	}
+	if got := c.Counters(); got.HeartbeatsLost != 0 || got.SendDirect != 0 || !got.Since.After(before) {
+		t.Errorf("after reset, Counters = %+v; want zero since the reset", got)
+	}
+}
+
+func TestResetCountersConcurrent(t *testing.T) {
+	c := &Conn{}
+	const workers, perWorker = 4, 10000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				c.counters.recvDERP.Add(1)
+			}
+		}()
+	}
+
+	// Every count is in exactly one of the resets, however they
+	// interleave with the counting.
+	var total int64
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			total += c.ResetCounters().RecvDERP
+			if total != workers*perWorker {
+				t.Errorf("counted %d across resets; want %d", total, workers*perWorker)
+			}
+			return
+		default:
+			total += c.ResetCounters().RecvDERP
+		}
+	}
+}
@@ -49,10 +49,19 @@
 	debugRingBufferMaxSizeBytes = envknob.RegisterInt("TS_DEBUG_MAGICSOCK_RING_BUFFER_MAX_SIZE_BYTES")
 	// debugPMTUD enables path MTU discovery. Currently only sets the Don't Fragment sockopt.
 	debugPMTUD = envknob.RegisterBool("TS_DEBUG_ENABLE_PMTUD")
+	// debugHeartbeatBackoffIdle and debugHeartbeatBackoffMax override
+	// how long a peer must be idle for its heartbeats to back off, and
+	// the longest interval they back off to. See heartbeat_backoff.go.
+	debugHeartbeatBackoffIdle = envknob.RegisterDuration("TS_DEBUG_HEARTBEAT_BACKOFF_IDLE")
+	debugHeartbeatBackoffMax  = envknob.RegisterDuration("TS_DEBUG_HEARTBEAT_BACKOFF_MAX")
 	// Hey you! Adding a new debugknob? Make sure to stub it out in the debugknob_stubs.go
-	// file too.
+	// file too, and list it in CurrentConfig.
 )
 
+// debugKnobsEnabled is whether the knobs above are read from the
+// environment on this platform.
+const debugKnobsEnabled = true
+
 // inTest reports whether the running program is a test that set the
 // IN_TS_TEST environment variable.
 //
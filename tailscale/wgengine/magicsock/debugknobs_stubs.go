@@ -5,7 +5,11 @@
 
 package magicsock
 
-import "tailscale.com/types/opt"
+import (
+	"time"
+
+	"tailscale.com/types/opt"
+)
 
 // All knobs are disabled on iOS and Wasm.
 //
@@ -26,3 +30,8 @@ func debugUseDerpRouteEnv() string     { return "" }
 func debugUseDerpRoute() opt.Bool      { return "" }
 func debugRingBufferMaxSizeBytes() int { return 0 }
 func inTest() bool                     { return false }
+
+func debugHeartbeatBackoffIdle() time.Duration { return 0 }
+func debugHeartbeatBackoffMax() time.Duration  { return 0 }
+
+const debugKnobsEnabled = false
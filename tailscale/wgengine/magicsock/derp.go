@@ -13,6 +13,7 @@
 	"net/netip"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -24,6 +25,7 @@
 	"tailscale.com/health"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/dnscache"
+	"tailscale.com/net/dropstats"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
@@ -117,9 +119,15 @@ func (c *Conn) pickDERPFallback() int {
 	// We used to do the above for legacy clients, but never updated
 	// it for disco.
 
-	if c.myDerp != 0 {
+	if c.myDerp != 0 && c.myDerp != c.derpFailedRegion {
 		return c.myDerp
 	}
+	if failed := c.derpFailedRegion; failed != 0 {
+		ids = slices.DeleteFunc(ids, func(id int) bool { return id == failed })
+		if len(ids) == 0 {
+			return 0
+		}
+	}
 
 	h := fnv.New64()
 	fmt.Fprintf(h, "%p/%d", c, processStartUnixNano) // arbitrary
@@ -629,6 +637,7 @@ func (c *connBind) receiveDERP(buffs [][]byte, sizes []int, eps []conn.Endpoint)
 			continue
 		}
 		metricRecvDataDERP.Add(1)
+		c.counters.recvDERP.Add(1)
 		sizes[0] = n
 		eps[0] = ep
 		return 1, nil
@@ -661,6 +670,7 @@ func (c *Conn) processDERPReadResult(dm derpReadResult, b []byte) (n int, ep *en
 	if !ok {
 		// We don't know anything about this node key, nothing to
 		// record or process.
+		dropstats.Add(dropstats.ReasonUnknownPeer)
 		return 0, nil
 	}
 
@@ -732,7 +742,7 @@ func (c *Conn) SetDERPMap(dm *tailcfg.DERPMap) {
 
 	go c.ReSTUN("derp-map-update")
 }
-func (c *Conn) wantDerpLocked() bool { return c.derpMap != nil }
+func (c *Conn) wantDerpLocked() bool { return c.derpMap != nil && c.derpDisabledUntil.IsZero() }
 
 // c.mu must be held.
 func (c *Conn) closeAllDerpLocked(why string) {
@@ -922,12 +932,27 @@ func (c *Conn) derpRegionCodeOfIDLocked(regionID int) string {
 type derpAddrFamSelector struct{ c *Conn }
 
 func (s derpAddrFamSelector) PreferIPv6() bool {
+	if s.c.forceIPFamily.Load() == 6 {
+		return true
+	}
 	if r := s.c.lastNetCheckReport.Load(); r != nil {
 		return r.IPv6
 	}
 	return false
 }
 
+// AllowDialProto implements derphttp.AddressFamilyRestrictor, honoring any
+// override set by Conn.ForceIPFamily.
+func (s derpAddrFamSelector) AllowDialProto(proto string) bool {
+	switch s.c.forceIPFamily.Load() {
+	case 4:
+		return proto == "tcp4"
+	case 6:
+		return proto == "tcp6"
+	}
+	return true
+}
+
 const (
 	// derpInactiveCleanupTime is how long a non-home DERP connection
 	// needs to be idle (last written to) before we close it.
@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxDisableDERPDuration is the longest that DisableDERP will keep DERP
+// disabled.
+const maxDisableDERPDuration = 10 * time.Minute
+
+// DisableDERP temporarily stops c from using DERP at all, leaving only
+// direct paths. After d (clamped to maxDisableDERPDuration) elapses, DERP is
+// re-enabled. A d of zero re-enables DERP immediately.
+//
+// It's intended for debugging, to tell whether a connectivity problem
+// persists with direct paths alone. Peers reachable only via DERP become
+// unreachable while it's in effect. It returns when DERP will be
+// re-enabled, which is zero if it's not disabled.
+func (c *Conn) DisableDERP(d time.Duration) (until time.Time, err error) {
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("invalid duration %v", d)
+	}
+	d = min(d, maxDisableDERPDuration)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return time.Time{}, errConnClosed
+	}
+	wasDisabled := !c.derpDisabledUntil.IsZero()
+	if c.derpDisabledTimer != nil {
+		c.derpDisabledTimer.Stop()
+		c.derpDisabledTimer = nil
+	}
+	c.derpDisabledUntil = time.Time{}
+	c.derpDisabledGen++
+	if d > 0 {
+		gen := c.derpDisabledGen
+		c.derpDisabledUntil = time.Now().Add(d)
+		c.derpDisabledTimer = time.AfterFunc(d, func() { c.expireDisabledDERP(gen) })
+	}
+	until = c.derpDisabledUntil
+	disabled := !until.IsZero()
+	if disabled && !wasDisabled {
+		c.logf("magicsock: DERP disabled until %v", until)
+		c.closeAllDerpLocked("derp-disabled")
+		c.myDerp = 0
+	} else if !disabled && wasDisabled {
+		c.logf("magicsock: DERP re-enabled")
+	}
+	c.mu.Unlock()
+
+	if disabled != wasDisabled {
+		// Re-discover paths without DERP (or find a DERP home again).
+		c.resetEndpointStates()
+		c.ReSTUN("derp-disable-change")
+	}
+	return until, nil
+}
+
+// expireDisabledDERP re-enables DERP after the DisableDERP call with
+// generation gen, unless it's since been replaced.
+func (c *Conn) expireDisabledDERP(gen int) {
+	c.mu.Lock()
+	current := c.derpDisabledGen == gen
+	c.mu.Unlock()
+	if current {
+		c.DisableDERP(0)
+	}
+}
+
+// DERPDisabledUntil returns when DERP will be re-enabled after a call to
+// DisableDERP, or the zero time if DERP isn't disabled.
+func (c *Conn) DERPDisabledUntil() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.derpDisabledUntil
+}
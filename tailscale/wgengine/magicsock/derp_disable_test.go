@@ -0,0 +1,65 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestDisableDERP(t *testing.T) {
+	conn, err := NewConn(Options{
+		EndpointsFunc: func(eps []tailcfg.Endpoint) {},
+		Logf:          t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDERPMap(&tailcfg.DERPMap{})
+
+	wantDERP := func() bool {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return conn.wantDerpLocked()
+	}
+	if !wantDERP() {
+		t.Fatal("DERP unwanted before DisableDERP")
+	}
+
+	until, err := conn.DisableDERP(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := time.Now().Add(maxDisableDERPDuration); until.IsZero() || until.After(max) {
+		t.Errorf("until = %v; want non-zero, clamped to %v", until, max)
+	}
+	if wantDERP() {
+		t.Error("DERP wanted while disabled")
+	}
+	if got := conn.DERPDisabledUntil(); got != until {
+		t.Errorf("DERPDisabledUntil = %v; want %v", got, until)
+	}
+
+	// A stale expiry timer doesn't re-enable a newer override.
+	conn.mu.Lock()
+	staleGen := conn.derpDisabledGen - 1
+	conn.mu.Unlock()
+	conn.expireDisabledDERP(staleGen)
+	if wantDERP() {
+		t.Error("DERP re-enabled by stale timer")
+	}
+
+	if until, err := conn.DisableDERP(0); err != nil || !until.IsZero() {
+		t.Errorf("DisableDERP(0) = %v, %v; want zero, nil", until, err)
+	}
+	if !wantDERP() {
+		t.Error("DERP unwanted after re-enabling")
+	}
+	if _, err := conn.DisableDERP(-time.Second); err == nil {
+		t.Error("DisableDERP accepted a negative duration")
+	}
+}
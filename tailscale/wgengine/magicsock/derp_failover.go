@@ -0,0 +1,99 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"tailscale.com/net/netcheck"
+)
+
+// derpFailoverPollInterval is how often TestDERPFailover checks whether a
+// new home DERP region has been picked.
+const derpFailoverPollInterval = 100 * time.Millisecond
+
+// DERPFailoverResult is the outcome of TestDERPFailover.
+type DERPFailoverResult struct {
+	FailedRegion int           // the home region that was treated as failed
+	NewRegion    int           // the region failed over to
+	Duration     time.Duration // from the failure until connecting to NewRegion
+}
+
+// TestDERPFailover treats c's home DERP region as failed, by disconnecting
+// from it and excluding it from home selection, and waits for c to pick and
+// connect to a new home region. Whatever the outcome, the region stops
+// being treated as failed when it returns, so normal home selection
+// resumes. ctx bounds how long to wait for the failover.
+func (c *Conn) TestDERPFailover(ctx context.Context) (DERPFailoverResult, error) {
+	c.mu.Lock()
+	switch {
+	case c.closed:
+		c.mu.Unlock()
+		return DERPFailoverResult{}, errConnClosed
+	case !c.wantDerpLocked():
+		c.mu.Unlock()
+		return DERPFailoverResult{}, errors.New("DERP not in use")
+	case c.myDerp == 0:
+		c.mu.Unlock()
+		return DERPFailoverResult{}, errors.New("no home DERP region")
+	case c.derpFailedRegion != 0:
+		c.mu.Unlock()
+		return DERPFailoverResult{}, errors.New("DERP failover test already running")
+	}
+	res := DERPFailoverResult{FailedRegion: c.myDerp}
+	c.derpFailedRegion = c.myDerp
+	c.logf("magicsock: DERP failover test: treating derp-%d as failed", c.myDerp)
+	c.closeDerpLocked(c.myDerp, "derp-failover-test")
+	c.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		c.mu.Lock()
+		c.derpFailedRegion = 0
+		c.mu.Unlock()
+		c.ReSTUN("derp-failover-test-done")
+	}()
+	c.ReSTUN("derp-failover-test")
+
+	t := time.NewTicker(derpFailoverPollInterval)
+	defer t.Stop()
+	for {
+		c.mu.Lock()
+		home := c.myDerp
+		ad, ok := c.activeDerp[home]
+		c.mu.Unlock()
+		if home != 0 && home != res.FailedRegion && ok {
+			if err := ad.c.Connect(ctx); err != nil {
+				return res, err
+			}
+			res.NewRegion = home
+			res.Duration = time.Since(start)
+			c.logf("magicsock: DERP failover test: failed over to derp-%d in %v", home, res.Duration.Round(time.Millisecond))
+			return res, nil
+		}
+		select {
+		case <-ctx.Done():
+			return res, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// bestDERPExcluding returns the DERP region with the lowest latency in
+// report, other than exclude, or zero if there's none.
+func bestDERPExcluding(report *netcheck.Report, exclude int) int {
+	var best int
+	var bestLatency time.Duration
+	for rid, d := range report.RegionLatency {
+		if rid == exclude {
+			continue
+		}
+		if best == 0 || d < bestLatency || (d == bestLatency && rid < best) {
+			best, bestLatency = rid, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+)
+
+func TestBestDERPExcluding(t *testing.T) {
+	report := &netcheck.Report{
+		RegionLatency: map[int]time.Duration{
+			1: 10 * time.Millisecond,
+			2: 20 * time.Millisecond,
+			3: 20 * time.Millisecond,
+		},
+	}
+	if got := bestDERPExcluding(report, 0); got != 1 {
+		t.Errorf("excluding none = %d; want 1", got)
+	}
+	if got := bestDERPExcluding(report, 1); got != 2 {
+		t.Errorf("excluding 1 = %d; want 2", got)
+	}
+	if got := bestDERPExcluding(&netcheck.Report{}, 1); got != 0 {
+		t.Errorf("empty report = %d; want 0", got)
+	}
+}
+
+func TestPickDERPFallbackExcludesFailed(t *testing.T) {
+	c := newConn()
+	c.derpMap = &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: {RegionID: 1},
+			2: {RegionID: 2},
+		},
+	}
+	c.myDerp = 1
+	if got := c.pickDERPFallback(); got != 1 {
+		t.Fatalf("pickDERPFallback = %d; want current home 1", got)
+	}
+	c.derpFailedRegion = 1
+	if got := c.pickDERPFallback(); got != 2 {
+		t.Errorf("pickDERPFallback with 1 failed = %d; want 2", got)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"time"
+)
+
+// DERPFlow describes the flow-control state of one of the node's DERP
+// connections. This is not a stable interface and could change at any time.
+type DERPFlow struct {
+	RegionID     int
+	RegionCode   string
+	Home         bool          // whether this is the node's home DERP region
+	Connected    bool          // whether the connection is currently established
+	ConnectedFor time.Duration // since the connection was created
+
+	// QueuedWrites is the number of packets waiting to be written to the
+	// DERP server. Once it reaches QueueCapacity, further packets are
+	// dropped.
+	QueuedWrites  int
+	QueueCapacity int
+
+	PacketsSent int64
+	BytesSent   int64
+	PacketsRecv int64
+	BytesRecv   int64
+
+	// SendBytesPerSecond and RecvBytesPerSecond are the average payload
+	// rates over the life of the connection.
+	SendBytesPerSecond float64
+	RecvBytesPerSecond float64
+
+	// Throttled is whether the DERP server has asked the node to limit its
+	// send rate. RateLimitBytesPerSecond and RateLimitBurst are that limit,
+	// and PacketsRateLimited is how many packets it has caused to be dropped.
+	Throttled               bool
+	RateLimitBytesPerSecond int `json:",omitempty"`
+	RateLimitBurst          int `json:",omitempty"`
+	PacketsRateLimited      int64
+}
+
+// DERPFlows returns the flow-control state of each of c's active DERP
+// connections, sorted by region ID.
+func (c *Conn) DERPFlows() []DERPFlow {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var ret []DERPFlow
+	c.foreachActiveDerpSortedLocked(func(regionID int, ad activeDerp) {
+		f := DERPFlow{
+			RegionID:      regionID,
+			RegionCode:    c.derpRegionCodeLocked(regionID),
+			Home:          regionID == c.myDerp,
+			ConnectedFor:  now.Sub(ad.createTime).Round(time.Second),
+			QueuedWrites:  len(ad.writeCh),
+			QueueCapacity: cap(ad.writeCh),
+		}
+		st, ok := ad.c.Stats()
+		if ok {
+			f.Connected = true
+			f.PacketsSent = st.PacketsSent
+			f.BytesSent = st.BytesSent
+			f.PacketsRecv = st.PacketsRecv
+			f.BytesRecv = st.BytesRecv
+			f.PacketsRateLimited = st.PacketsRateLimited
+			f.RateLimitBytesPerSecond = st.RateLimitBytesPerSecond
+			f.RateLimitBurst = st.RateLimitBurst
+			f.Throttled = st.RateLimitBytesPerSecond > 0
+		}
+		if secs := now.Sub(ad.createTime).Seconds(); secs > 0 {
+			f.SendBytesPerSecond = float64(f.BytesSent) / secs
+			f.RecvBytesPerSecond = float64(f.BytesRecv) / secs
+		}
+		ret = append(ret, f)
+	})
+	return ret
+}
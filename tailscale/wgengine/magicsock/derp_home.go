@@ -0,0 +1,196 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"tailscale.com/net/netcheck"
+)
+
+// maxPinDERPHomeDuration is the longest that PinDERPHome will keep a home
+// DERP region pinned.
+const maxPinDERPHomeDuration = time.Hour
+
+// Reasons for the choice of home DERP region, as reported in
+// DERPHome.Reason.
+const (
+	// DERPHomeReasonNone means there's no home region, because DERP
+	// is disabled, there's no DERP map, or no netcheck has run yet.
+	DERPHomeReasonNone = "none"
+	// DERPHomeReasonPinned means the region was pinned by PinDERPHome.
+	DERPHomeReasonPinned = "pinned"
+	// DERPHomeReasonLatency means netcheck preferred the region for its
+	// latency. To avoid flapping, netcheck keeps the previous home
+	// region unless another is substantially faster.
+	DERPHomeReasonLatency = "latency"
+	// DERPHomeReasonFailoverTest means the region was the fastest other
+	// than the one that TestDERPFailover is treating as failed.
+	DERPHomeReasonFailoverTest = "failover-test"
+	// DERPHomeReasonFallback means netcheck measured no latencies (for
+	// instance, if UDP is blocked), so the previous home region was
+	// kept, or one was picked arbitrarily.
+	DERPHomeReasonFallback = "fallback"
+)
+
+// DERPHome describes c's home DERP region and how it was picked.
+type DERPHome struct {
+	Region int    // the home region, or zero if none
+	Reason string // why Region was picked; one of the DERPHomeReason constants
+
+	// PinnedRegion, if non-zero, is the region pinned by PinDERPHome
+	// until PinnedUntil. It's not Region if it's since left the DERP map.
+	PinnedRegion int       `json:",omitempty"`
+	PinnedUntil  time.Time `json:",omitempty"`
+
+	// Latency is the latency to each region in the DERP map, as of the
+	// last netcheck at CheckedAt. Regions that didn't respond are nil.
+	Latency   map[int]*time.Duration
+	CheckedAt time.Time `json:",omitempty"`
+}
+
+// DERPHome returns c's home DERP region, how it was picked, and the latency
+// to each region from the last netcheck.
+func (c *Conn) DERPHome() DERPHome {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := DERPHome{
+		Region:       c.myDerp,
+		Reason:       c.derpHomeReason,
+		PinnedRegion: c.derpPinnedRegion,
+		PinnedUntil:  c.derpPinnedUntil,
+		Latency:      map[int]*time.Duration{},
+	}
+	if h.Region == 0 || h.Reason == "" {
+		h.Reason = DERPHomeReasonNone
+	}
+	report := c.lastNetCheckReport.Load()
+	if report != nil {
+		h.CheckedAt = c.lastNetCheckAt
+	}
+	if c.derpMap != nil {
+		for rid := range c.derpMap.Regions {
+			if report == nil {
+				h.Latency[rid] = nil
+				continue
+			}
+			if d, ok := report.RegionLatency[rid]; ok {
+				h.Latency[rid] = &d
+			} else {
+				h.Latency[rid] = nil
+			}
+		}
+	}
+	return h
+}
+
+// PinDERPHome makes region c's home DERP region for d (clamped to
+// maxPinDERPHomeDuration), regardless of latency, for testing. A region or
+// d of zero unpins it immediately. It returns when the pin expires, which
+// is zero if there's none.
+func (c *Conn) PinDERPHome(region int, d time.Duration) (until time.Time, err error) {
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("invalid duration %v", d)
+	}
+	d = min(d, maxPinDERPHomeDuration)
+	if region == 0 {
+		d = 0
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return time.Time{}, errConnClosed
+	}
+	if d > 0 && (c.derpMap == nil || c.derpMap.Regions[region] == nil) {
+		c.mu.Unlock()
+		return time.Time{}, fmt.Errorf("unknown DERP region %d", region)
+	}
+	wasPinned := c.derpPinnedRegion
+	if c.derpPinTimer != nil {
+		c.derpPinTimer.Stop()
+		c.derpPinTimer = nil
+	}
+	c.derpPinnedRegion = 0
+	c.derpPinnedUntil = time.Time{}
+	c.derpPinGen++
+	if d > 0 {
+		gen := c.derpPinGen
+		c.derpPinnedRegion = region
+		c.derpPinnedUntil = time.Now().Add(d)
+		c.derpPinTimer = time.AfterFunc(d, func() { c.expireDERPHomePin(gen) })
+		c.logf("magicsock: home DERP pinned to derp-%d until %v", region, c.derpPinnedUntil)
+	} else if wasPinned != 0 {
+		c.logf("magicsock: home DERP unpinned")
+	}
+	until = c.derpPinnedUntil
+	changed := c.derpPinnedRegion != wasPinned
+	c.mu.Unlock()
+
+	if changed {
+		c.ReSTUN("derp-home-pin")
+	}
+	return until, nil
+}
+
+// expireDERPHomePin unpins the home DERP region after the PinDERPHome call
+// with generation gen, unless it's since been replaced.
+func (c *Conn) expireDERPHomePin(gen int) {
+	c.mu.Lock()
+	current := c.derpPinGen == gen
+	c.mu.Unlock()
+	if current {
+		c.PinDERPHome(0, 0)
+	}
+}
+
+// RemeasureDERPHome runs a full netcheck and waits for it to finish, then
+// returns the resulting home DERP region.
+func (c *Conn) RemeasureDERPHome(ctx context.Context) (DERPHome, error) {
+	checkedAt := func() time.Time {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.lastNetCheckAt
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return DERPHome{}, errConnClosed
+	}
+	last := checkedAt()
+	c.netChecker.MakeNextReportFull()
+	c.ReSTUN("derp-home-remeasure")
+
+	t := time.NewTicker(derpFailoverPollInterval)
+	defer t.Stop()
+	for checkedAt() == last {
+		select {
+		case <-ctx.Done():
+			return c.DERPHome(), ctx.Err()
+		case <-t.C:
+		}
+	}
+	return c.DERPHome(), nil
+}
+
+// pickDERPHomeLocked returns the home DERP region that c should use given
+// report, and why, before falling back to pickDERPFallback.
+//
+// c.mu must be held.
+func (c *Conn) pickDERPHomeLocked(report *netcheck.Report) (region int, reason string) {
+	if pinned := c.derpPinnedRegion; pinned != 0 && c.derpMap != nil && c.derpMap.Regions[pinned] != nil {
+		return pinned, DERPHomeReasonPinned
+	}
+	region, reason = report.PreferredDERP, DERPHomeReasonLatency
+	if failed := c.derpFailedRegion; failed != 0 && region == failed {
+		region, reason = bestDERPExcluding(report, failed), DERPHomeReasonFailoverTest
+	}
+	if region == 0 {
+		reason = DERPHomeReasonFallback
+	}
+	return region, reason
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+)
+
+func TestPickDERPHome(t *testing.T) {
+	c := newConn()
+	c.derpMap = &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+		1: {RegionID: 1},
+		2: {RegionID: 2},
+		3: {RegionID: 3},
+	}}
+	report := &netcheck.Report{
+		PreferredDERP: 1,
+		RegionLatency: map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond},
+	}
+	tests := []struct {
+		name       string
+		pinned     int
+		failed     int
+		report     *netcheck.Report
+		wantRegion int
+		wantReason string
+	}{
+		{"latency", 0, 0, report, 1, DERPHomeReasonLatency},
+		{"pinned", 3, 0, report, 3, DERPHomeReasonPinned},
+		{"pinned-gone", 4, 0, report, 1, DERPHomeReasonLatency},
+		{"failover-test", 0, 1, report, 2, DERPHomeReasonFailoverTest},
+		{"pinned-over-failover-test", 3, 1, report, 3, DERPHomeReasonPinned},
+		{"fallback", 0, 0, &netcheck.Report{}, 0, DERPHomeReasonFallback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.derpPinnedRegion = tt.pinned
+			c.derpFailedRegion = tt.failed
+			region, reason := c.pickDERPHomeLocked(tt.report)
+			if region != tt.wantRegion || reason != tt.wantReason {
+				t.Errorf("got %d, %q; want %d, %q", region, reason, tt.wantRegion, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestDERPHomeLatency(t *testing.T) {
+	c := newConn()
+	c.derpMap = &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+		1: {RegionID: 1},
+		2: {RegionID: 2},
+	}}
+	h := c.DERPHome()
+	if h.Reason != DERPHomeReasonNone || len(h.Latency) != 2 || h.Latency[1] != nil || h.Latency[2] != nil {
+		t.Errorf("before netcheck: got %+v; want no home, and nil latencies for both regions", h)
+	}
+
+	c.lastNetCheckReport.Store(&netcheck.Report{
+		RegionLatency: map[int]time.Duration{1: 15 * time.Millisecond},
+	})
+	c.myDerp = 1
+	c.derpHomeReason = DERPHomeReasonLatency
+	h = c.DERPHome()
+	if h.Region != 1 || h.Reason != DERPHomeReasonLatency {
+		t.Errorf("got region %d, %q; want 1, latency", h.Region, h.Reason)
+	}
+	if d := h.Latency[1]; d == nil || *d != 15*time.Millisecond {
+		t.Errorf("region 1 latency = %v; want 15ms", d)
+	}
+	// A region that timed out is reported, as nil.
+	if d, ok := h.Latency[2]; !ok || d != nil {
+		t.Errorf("region 2 latency = %v, %v; want nil, true", d, ok)
+	}
+}
+
+func TestPinDERPHome(t *testing.T) {
+	conn, err := NewConn(Options{
+		EndpointsFunc: func(eps []tailcfg.Endpoint) {},
+		Logf:          t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDERPMap(&tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{
+		1: {RegionID: 1},
+	}})
+	// Make ReSTUN a no-op, as if stopped, so that pinning doesn't start
+	// a netcheck.
+	conn.mu.Lock()
+	conn.everHadKey = true
+	conn.mu.Unlock()
+
+	if _, err := conn.PinDERPHome(2, time.Minute); err == nil {
+		t.Error("pinned unknown region")
+	}
+	until, err := conn.PinDERPHome(1, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := time.Now().Add(maxPinDERPHomeDuration); until.IsZero() || until.After(max) {
+		t.Errorf("until = %v; want non-zero, clamped to %v", until, max)
+	}
+	if h := conn.DERPHome(); h.PinnedRegion != 1 || h.PinnedUntil != until {
+		t.Errorf("got pinned %d until %v; want 1 until %v", h.PinnedRegion, h.PinnedUntil, until)
+	}
+
+	// A stale expiry timer doesn't unpin a newer pin.
+	conn.mu.Lock()
+	staleGen := conn.derpPinGen - 1
+	conn.mu.Unlock()
+	conn.expireDERPHomePin(staleGen)
+	if h := conn.DERPHome(); h.PinnedRegion != 1 {
+		t.Error("unpinned by stale timer")
+	}
+
+	if until, err := conn.PinDERPHome(0, time.Minute); err != nil || !until.IsZero() {
+		t.Errorf("PinDERPHome(0) = %v, %v; want zero, nil", until, err)
+	}
+	if h := conn.DERPHome(); h.PinnedRegion != 0 {
+		t.Errorf("still pinned to %d", h.PinnedRegion)
+	}
+}
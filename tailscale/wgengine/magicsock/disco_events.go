@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+// DiscoEvent types, as used in DiscoEvent.Type.
+const (
+	DiscoEventPingSent    = "ping-sent"    // we sent a disco ping
+	DiscoEventPingTimeout = "ping-timeout" // a ping we sent wasn't answered
+	DiscoEventPong        = "pong"         // a peer answered our ping
+	DiscoEventPathChange  = "path-change"  // a peer's best direct path changed
+	DiscoEventError       = "error"        // a disco message couldn't be sent
+)
+
+// discoEventBufferSize is how many DiscoEvents a subscriber can fall behind
+// by before further events are dropped for it.
+const discoEventBufferSize = 128
+
+// DiscoEvent is a single disco event, as delivered to subscribers of
+// SubscribeDiscoEvents. This is not a stable interface and could change at
+// any time.
+type DiscoEvent struct {
+	When time.Time
+	Type string // one of the DiscoEvent* constants
+	Peer key.NodePublic
+	Addr netip.AddrPort // the ping's destination (a magic DERP address if DERP), or the new path (zero if none)
+
+	PrevAddr netip.AddrPort // for DiscoEventPathChange, the previous path (zero if none)
+	Purpose  string         `json:",omitempty"` // for pings, their discoPingPurpose
+	Latency  time.Duration  `json:",omitempty"` // for DiscoEventPong
+	Error    string         `json:",omitempty"` // for DiscoEventError
+}
+
+// discoEvents is the set of subscribers to a Conn's DiscoEvents.
+type discoEvents struct {
+	n    atomic.Int32 // len(subs), for checking without mu
+	mu   sync.Mutex
+	subs map[chan DiscoEvent]bool
+}
+
+// SubscribeDiscoEvents returns a channel on which c's DiscoEvents are
+// delivered as they happen, until unsubscribe is called. Events are dropped
+// if the subscriber falls too far behind, rather than slowing down disco.
+func (c *Conn) SubscribeDiscoEvents() (events <-chan DiscoEvent, unsubscribe func()) {
+	ch := make(chan DiscoEvent, discoEventBufferSize)
+	e := &c.discoEvents
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subs == nil {
+		e.subs = make(map[chan DiscoEvent]bool)
+	}
+	e.subs[ch] = true
+	e.n.Store(int32(len(e.subs)))
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subs, ch)
+		e.n.Store(int32(len(e.subs)))
+	}
+}
+
+// emitDiscoEvent delivers ev to c's DiscoEvent subscribers, if any.
+// It may be called with any locks held.
+func (c *Conn) emitDiscoEvent(ev DiscoEvent) {
+	e := &c.discoEvents
+	if e.n.Load() == 0 {
+		return
+	}
+	ev.When = time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
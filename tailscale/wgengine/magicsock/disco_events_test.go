@@ -0,0 +1,31 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import "testing"
+
+func TestDiscoEvents(t *testing.T) {
+	c := &Conn{}
+	c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPong}) // no subscribers; no-op
+
+	events, unsubscribe := c.SubscribeDiscoEvents()
+	c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPingSent, Purpose: pingHeartbeat.String()})
+	ev := <-events
+	if ev.Type != DiscoEventPingSent || ev.Purpose != "Heartbeat" || ev.When.IsZero() {
+		t.Errorf("got %+v", ev)
+	}
+
+	// A subscriber that falls behind loses events rather than blocking.
+	for i := 0; i < discoEventBufferSize+10; i++ {
+		c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPong})
+	}
+	if n := len(events); n != discoEventBufferSize {
+		t.Errorf("buffered %d events; want %d", n, discoEventBufferSize)
+	}
+
+	unsubscribe()
+	if n := c.discoEvents.n.Load(); n != 0 {
+		t.Errorf("%d subscribers after unsubscribe; want 0", n)
+	}
+}
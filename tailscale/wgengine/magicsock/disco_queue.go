@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"sync"
+	"time"
+
+	"tailscale.com/net/stun"
+	"tailscale.com/tstime/mono"
+)
+
+// DiscoQueueDepth describes the disco pings of one purpose that are waiting
+// to be sent; see Conn.DiscoQueue.
+type DiscoQueueDepth struct {
+	Depth     int           // pings being sent
+	OldestAge time.Duration // how long the oldest of them has been waiting
+}
+
+// pendingDiscoPings tracks the disco pings that have been started but not yet
+// handed off to the network (or DERP) by sendDiscoMessage.
+type pendingDiscoPings struct {
+	mu      sync.Mutex
+	pending map[discoPingPurpose]map[stun.TxID]mono.Time
+}
+
+func (p *pendingDiscoPings) add(txid stun.TxID, purpose discoPingPurpose) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[discoPingPurpose]map[stun.TxID]mono.Time)
+	}
+	m, ok := p.pending[purpose]
+	if !ok {
+		m = make(map[stun.TxID]mono.Time)
+		p.pending[purpose] = m
+	}
+	m[txid] = mono.Now()
+}
+
+func (p *pendingDiscoPings) remove(txid stun.TxID, purpose discoPingPurpose) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending[purpose], txid)
+}
+
+func (p *pendingDiscoPings) depths(now mono.Time) map[string]DiscoQueueDepth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := make(map[string]DiscoQueueDepth)
+	for purpose, m := range p.pending {
+		if len(m) == 0 {
+			continue
+		}
+		var d DiscoQueueDepth
+		for _, start := range m {
+			d.Depth++
+			d.OldestAge = max(d.OldestAge, now.Sub(start))
+		}
+		ret[purpose.String()] = d
+	}
+	return ret
+}
+
+// DiscoQueue returns the disco pings that are waiting to be sent, keyed by
+// the ping's purpose. Pings of a purpose that has none waiting are omitted.
+//
+// Pings are sent as soon as they're started, so a non-empty result means
+// that the write path (a UDP socket or a DERP connection) is slow.
+func (c *Conn) DiscoQueue() map[string]DiscoQueueDepth {
+	return c.pendingPings.depths(mono.Now())
+}
@@ -0,0 +1,36 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/net/stun"
+	"tailscale.com/tstime/mono"
+)
+
+func TestPendingDiscoPings(t *testing.T) {
+	var p pendingDiscoPings
+	if got := p.depths(mono.Now()); len(got) != 0 {
+		t.Fatalf("got %v before any pings; want empty", got)
+	}
+	tx1, tx2, tx3 := stun.NewTxID(), stun.NewTxID(), stun.NewTxID()
+	p.add(tx1, pingHeartbeat)
+	p.add(tx2, pingHeartbeat)
+	p.add(tx3, pingDiscovery)
+	p.remove(tx3, pingDiscovery)
+
+	got := p.depths(mono.Now().Add(time.Second))
+	if len(got) != 1 {
+		t.Fatalf("got %v; want only Heartbeat", got)
+	}
+	hb := got[pingHeartbeat.String()]
+	if hb.Depth != 2 {
+		t.Errorf("Heartbeat depth = %d; want 2", hb.Depth)
+	}
+	if hb.OldestAge < time.Second {
+		t.Errorf("Heartbeat OldestAge = %v; want >= 1s", hb.OldestAge)
+	}
+}
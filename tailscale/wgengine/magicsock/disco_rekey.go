@@ -0,0 +1,34 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import "tailscale.com/types/key"
+
+// RekeyDisco replaces c's disco key with a newly generated one, for recovering
+// from disco state that's inconsistent with peers. Everything c learned from
+// peers over disco was negotiated with the old key, so each peer's disco
+// state is reset and it's reachable only via DERP until paths are
+// rediscovered, which requires peers to learn the new key from control.
+//
+// It returns the new key, which the caller must advertise to control and
+// give to the tstun.Wrapper (see Wrapper.SetDiscoKey).
+func (c *Conn) RekeyDisco() (key.DiscoPublic, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return key.DiscoPublic{}, errConnClosed
+	}
+	oldShort := c.discoShort
+	c.discoPrivate = key.NewDisco()
+	c.discoPublic = c.discoPrivate.Public()
+	c.discoShort = c.discoPublic.ShortString()
+
+	// discoInfo holds keys shared with our old private key.
+	c.discoInfo = make(map[key.DiscoPublic]*discoInfo)
+	c.peerMap.forEachEndpoint(func(ep *endpoint) {
+		ep.stopAndReset()
+	})
+	c.logf("magicsock: disco key rekeyed from %v to %v", oldShort, c.discoShort)
+	return c.discoPublic, nil
+}
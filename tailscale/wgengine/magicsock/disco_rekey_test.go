@@ -0,0 +1,84 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/net/stun"
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+	"tailscale.com/util/ringbuffer"
+)
+
+func TestRekeyDisco(t *testing.T) {
+	c := newConn()
+	c.logf = t.Logf
+	oldPub := c.DiscoPublicKey()
+
+	peerDisco := key.NewDisco().Public()
+	ep := &endpoint{
+		c:             c,
+		publicKey:     key.NewNode().Public(),
+		sentPing:      map[stun.TxID]sentPing{},
+		endpointState: map[netip.AddrPort]*endpointState{},
+		debugUpdates:  ringbuffer.New[EndpointChange](1),
+	}
+	ep.disco.Store(&endpointDisco{key: peerDisco, short: peerDisco.ShortString()})
+	c.peerMap.upsertEndpoint(ep, key.DiscoPublic{})
+
+	addr := netip.MustParseAddrPort("1.2.3.4:567")
+	now := mono.Now()
+	c.mu.Lock()
+	oldInfo := c.discoInfoLocked(peerDisco)
+	c.mu.Unlock()
+	ep.mu.Lock()
+	ep.bestAddr = addrLatency{AddrPort: addr}
+	ep.trustBestAddrUntil = now.Add(trustUDPAddrDuration)
+	ep.endpointState[addr] = &endpointState{lastPing: now}
+	ep.lastFullPing = now
+	ep.mu.Unlock()
+
+	newPub, err := c.RekeyDisco()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newPub == oldPub || c.DiscoPublicKey() != newPub {
+		t.Fatalf("disco key = %v after rekey to %v; was %v", c.DiscoPublicKey(), newPub, oldPub)
+	}
+	if c.discoShort != newPub.ShortString() {
+		t.Errorf("discoShort = %q; want %q", c.discoShort, newPub.ShortString())
+	}
+
+	// Keys shared with the old private key must not be reused.
+	c.mu.Lock()
+	newInfo := c.discoInfoLocked(peerDisco)
+	c.mu.Unlock()
+	if newInfo == oldInfo {
+		t.Error("discoInfo not reset")
+	}
+	if newInfo.sharedKey.Equal(oldInfo.sharedKey) {
+		t.Error("shared key not rederived")
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.bestAddr.IsValid() || ep.trustBestAddrUntil != 0 || ep.lastFullPing != 0 {
+		t.Errorf("endpoint disco state not reset: bestAddr=%v trust=%v lastFullPing=%v", ep.bestAddr, ep.trustBestAddrUntil, ep.lastFullPing)
+	}
+	if ep.endpointState[addr].lastPing != 0 {
+		t.Error("endpointState.lastPing not reset")
+	}
+	if addr, _, _ := ep.addrForSendLocked(now); addr.IsValid() {
+		t.Errorf("sending to %v after rekey; want DERP only", addr)
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	if _, err := c.RekeyDisco(); err == nil {
+		t.Error("RekeyDisco succeeded on closed Conn")
+	}
+}
@@ -15,6 +15,7 @@
 	"net/netip"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,6 +30,7 @@
 	"tailscale.com/tstime/mono"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/mak"
 	"tailscale.com/util/ringbuffer"
 )
@@ -70,6 +72,44 @@ type endpoint struct {
 	sentPing           map[stun.TxID]sentPing
 	endpointState      map[netip.AddrPort]*endpointState
 	isCallMeMaybeEP    map[netip.AddrPort]bool
+	offered            map[netip.AddrPort]*offeredEndpoint // history of endpoints the peer offered; see endpoint_offers.go
+
+	// heartbeatPongAt is when we last got a heartbeat pong from bestAddr,
+	// or when we started heartbeating it; zero if neither.
+	// heartbeatLost is whether a loss has been recorded since then.
+	// See heartbeat_loss.go.
+	heartbeatPongAt mono.Time
+	heartbeatLost   bool
+
+	// heartbeatBackoff is the interval between heartbeats while they're
+	// backed off because the peer's idle, or zero at the normal
+	// heartbeatInterval. See heartbeat_backoff.go.
+	heartbeatBackoff time.Duration
+
+	rttSamples *ringbuffer.RingBuffer[RTTSample] // recent pong latencies; nil until the first pong; see rtt.go
+
+	// mtuProbedAddr is the direct path that pingMTU probes were last
+	// sent to, and discoveredMTU is what they found. See mtu_probe.go.
+	mtuProbedAddr netip.AddrPort
+	discoveredMTU pathMTU
+
+	// The last disco ping and pong received from the peer, and the
+	// paths they came from. See reachability.go.
+	lastPingRecv     mono.Time
+	lastPingRecvFrom netip.AddrPort
+	lastPongRecv     mono.Time
+	lastPongRecvFrom netip.AddrPort
+
+	lastPingOutcome *PingOutcome // nil until a ping is answered or times out; see peer_state.go
+
+	lastPath netip.AddrPort // as of the last PathEvent; see path_events.go
+
+	// coldBurstTimer sends the next round of discovery pings of a burst
+	// started by the first packet to a cold peer, and coldBurstRounds is
+	// how many rounds it's sent. The timer is nil if there's no burst.
+	// See cold_burst.go.
+	coldBurstTimer  *time.Timer
+	coldBurstRounds int
 
 	// The following fields are related to the new "silent disco"
 	// implementation that's a WIP as of 2022-10-20.
@@ -92,6 +132,7 @@ type sentPing struct {
 	at      mono.Time
 	timer   *time.Timer // timeout timer
 	purpose discoPingPurpose
+	size    int                        // requested disco message size; zero for the minimum
 	res     *ipnstate.PingResult       // nil unless CLI ping
 	cb      func(*ipnstate.PingResult) // nil unless CLI ping
 }
@@ -206,7 +247,9 @@ func (de *endpoint) deleteEndpointLocked(why string, ep netip.AddrPort) {
 			What: "deleteEndpointLocked-bestAddr-" + why,
 			From: de.bestAddr,
 		})
+		de.c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPathChange, Peer: de.publicKey, PrevAddr: ep})
 		de.bestAddr = addrLatency{}
+		de.notePathLocked(mono.Now(), PathReasonEndpointDeleted, "")
 	}
 }
 
@@ -370,24 +413,35 @@ func (de *endpoint) heartbeat() {
 		return
 	}
 
-	if mono.Since(de.lastSend) > sessionActiveTimeout {
+	now := mono.Now()
+
+	// Paths change elsewhere for other reasons, which are noted there,
+	// leaving this to see when the direct path stops being trusted. It's
+	// noted here rather than on each send, so up to a heartbeat late.
+	de.notePathLocked(now, PathReasonExpired, "")
+
+	if now.Sub(de.lastSend) > sessionActiveTimeout {
 		// Session's idle. Stop heartbeating.
 		de.c.dlogf("[v1] magicsock: disco: ending heartbeats for idle session to %v (%v)", de.publicKey.ShortString(), de.discoShort())
 		return
 	}
 
-	now := mono.Now()
 	udpAddr, _, _ := de.addrForSendLocked(now)
 	if udpAddr.IsValid() {
-		// We have a preferred path. Ping that every 2 seconds.
+		// We have a preferred path. Ping that every heartbeat. Its
+		// pongs are too sparse to judge it by while backed off.
+		if de.heartbeatBackoff == 0 {
+			de.checkHeartbeatLossLocked(udpAddr, now)
+		}
 		de.startDiscoPingLocked(udpAddr, now, pingHeartbeat, 0, nil, nil)
+		de.startMTUProbesLocked(udpAddr, now)
 	}
 
 	if de.wantFullPingLocked(now) {
 		de.sendDiscoPingsLocked(now, true)
 	}
 
-	de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
+	de.heartBeatTimer = time.AfterFunc(de.nextHeartbeatIntervalLocked(now), de.heartbeat)
 }
 
 // wantFullPingLocked reports whether we should ping to all our peers looking for
@@ -416,7 +470,15 @@ func (de *endpoint) wantFullPingLocked(now mono.Time) bool {
 func (de *endpoint) noteActiveLocked() {
 	de.lastSend = mono.Now()
 	if de.heartBeatTimer == nil && !de.heartbeatDisabled {
+		// Heartbeats that stopped while backed off start again at the
+		// normal interval.
+		de.endHeartbeatBackoffLocked()
 		de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
+		// Heartbeats are (re)starting after being idle, so don't count the
+		// idle time against the path.
+		de.heartbeatPongAt = 0
+	} else {
+		de.endHeartbeatBackoffLocked()
 	}
 }
 
@@ -465,6 +527,7 @@ func (de *endpoint) send(buffs [][]byte) error {
 	}
 
 	now := mono.Now()
+	cold := de.lastSend.IsZero() || now.Sub(de.lastSend) > sessionActiveTimeout
 	udpAddr, derpAddr, startWGPing := de.addrForSendLocked(now)
 
 	if de.isWireguardOnly {
@@ -473,6 +536,9 @@ func (de *endpoint) send(buffs [][]byte) error {
 		}
 	} else if !udpAddr.IsValid() || now.After(de.trustBestAddrUntil) {
 		de.sendDiscoPingsLocked(now, true)
+		if cold {
+			de.startColdBurstLocked()
+		}
 	}
 	de.noteActiveLocked()
 	de.mu.Unlock()
@@ -482,7 +548,13 @@ func (de *endpoint) send(buffs [][]byte) error {
 	}
 	var err error
 	if udpAddr.IsValid() {
-		_, err = de.c.sendUDPBatch(udpAddr, buffs)
+		var sent bool
+		sent, err = de.c.sendUDPBatch(udpAddr, buffs)
+		if err != nil {
+			de.c.counters.sendDirectErrors.Add(int64(len(buffs)))
+		} else if sent {
+			de.c.counters.sendDirect.Add(int64(len(buffs)))
+		}
 
 		// If the error is known to indicate that the endpoint is no longer
 		// usable, clear the endpoint statistics so that the next send will
@@ -507,7 +579,10 @@ func (de *endpoint) send(buffs [][]byte) error {
 			if stats := de.c.stats.Load(); stats != nil {
 				stats.UpdateTxPhysical(de.nodeAddr, derpAddr, len(buff))
 			}
-			if !ok {
+			if ok {
+				de.c.counters.sendDERP.Add(1)
+			} else {
+				de.c.counters.sendDERPDropped.Add(1)
 				allOk = false
 			}
 		}
@@ -525,9 +600,12 @@ func (de *endpoint) discoPingTimeout(txid stun.TxID) {
 	if !ok {
 		return
 	}
+	de.c.counters.discoPingTimeouts.Add(1)
 	if debugDisco() || !de.bestAddr.IsValid() || mono.Now().After(de.trustBestAddrUntil) {
 		de.c.dlogf("[v1] magicsock: disco: timeout waiting for pong %x from %v (%v, %v)", txid[:6], sp.to, de.publicKey.ShortString(), de.discoShort())
 	}
+	de.c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPingTimeout, Peer: de.publicKey, Addr: sp.to, Purpose: sp.purpose.String()})
+	de.notePingOutcomeLocked(sp, false, 0, mono.Now())
 	de.removeSentDiscoPingLocked(txid, sp)
 }
 
@@ -561,22 +639,36 @@ func (de *endpoint) removeSentDiscoPingLocked(txid stun.TxID, sp sentPing) {
 //
 // The caller should use de.discoKey as the discoKey argument.
 // It is passed in so that sendDiscoPing doesn't need to lock de.mu.
-func (de *endpoint) sendDiscoPing(ep netip.AddrPort, discoKey key.DiscoPublic, txid stun.TxID, size int, logLevel discoLogLevel) {
+func (de *endpoint) sendDiscoPing(ep netip.AddrPort, discoKey key.DiscoPublic, txid stun.TxID, size int, purpose discoPingPurpose, logLevel discoLogLevel) {
 	padding := 0
-	if size > int(tstun.DefaultMTU()) {
-		size = int(tstun.DefaultMTU())
+	maxSize := int(tstun.DefaultMTU())
+	if purpose == pingMTU {
+		maxSize = maxMTUProbeSize
+	}
+	if size > maxSize {
+		size = maxSize
 	}
 	if size-discoPingSize > 0 {
 		padding = size - discoPingSize
 	}
-	sent, _ := de.c.sendDiscoMessage(ep, de.publicKey, discoKey, &disco.Ping{
+	de.c.pendingPings.add(txid, purpose)
+	sent, err := de.c.sendDiscoMessage(ep, de.publicKey, discoKey, &disco.Ping{
 		TxID:    [12]byte(txid),
 		NodeKey: de.c.publicKeyAtomic.Load(),
 		Padding: padding,
 	}, logLevel)
+	de.c.pendingPings.remove(txid, purpose)
 	if !sent {
 		de.forgetDiscoPing(txid)
+		ev := DiscoEvent{Type: DiscoEventError, Peer: de.publicKey, Addr: ep, Purpose: purpose.String(), Error: "ping not sent"}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		de.c.emitDiscoEvent(ev)
+		return
 	}
+	metricSentDiscoPingByPurpose[purpose].Add(1)
+	de.c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPingSent, Peer: de.publicKey, Addr: ep, Purpose: purpose.String()})
 }
 
 // discoPingPurpose is the reason why a discovery ping message was sent.
@@ -595,8 +687,29 @@ func (de *endpoint) sendDiscoPing(ep netip.AddrPort, discoKey key.DiscoPublic, t
 	// pingCLI means that the user is running "tailscale ping"
 	// from the CLI. These types of pings can go over DERP.
 	pingCLI
+
+	// pingMTU means that the purpose of a ping was to discover the
+	// path MTU of a direct path, by being padded to a particular size.
+	// Their pongs (or lack of them) say nothing about whether the
+	// path's alive.
+	pingMTU
 )
 
+// numDiscoPingPurposes is the number of discoPingPurpose values, which are
+// numbered from zero. It comes from the stringer output so that it can't
+// go stale.
+const numDiscoPingPurposes = len(_discoPingPurpose_index) - 1
+
+// discoPingPurposeCounters returns a counter for each discoPingPurpose,
+// indexed by it, named prefix followed by its lowercased String.
+func discoPingPurposeCounters(prefix string) []*clientmetric.Metric {
+	ret := make([]*clientmetric.Metric, numDiscoPingPurposes)
+	for i := range ret {
+		ret[i] = clientmetric.NewCounter(prefix + strings.ToLower(discoPingPurpose(i).String()))
+	}
+	return ret
+}
+
 // startDiscoPingLocked sends a disco ping to ep in a separate
 // goroutine. res and cb are for returning the results of CLI pings,
 // otherwise they are nil.
@@ -608,7 +721,7 @@ func (de *endpoint) startDiscoPingLocked(ep netip.AddrPort, now mono.Time, purpo
 	if epDisco == nil {
 		return
 	}
-	if purpose != pingCLI {
+	if purpose != pingCLI && purpose != pingMTU {
 		st, ok := de.endpointState[ep]
 		if !ok {
 			// Shouldn't happen. But don't ping an endpoint that's
@@ -625,15 +738,16 @@ func (de *endpoint) startDiscoPingLocked(ep netip.AddrPort, now mono.Time, purpo
 		at:      now,
 		timer:   time.AfterFunc(pingTimeoutDuration, func() { de.discoPingTimeout(txid) }),
 		purpose: purpose,
+		size:    size,
 		res:     res,
 		cb:      cb,
 	}
 
 	logLevel := discoLog
-	if purpose == pingHeartbeat {
+	if purpose == pingHeartbeat || purpose == pingMTU {
 		logLevel = discoVerboseLog
 	}
-	go de.sendDiscoPing(ep, epDisco.key, txid, size, logLevel)
+	go de.sendDiscoPing(ep, epDisco.key, txid, size, purpose, logLevel)
 }
 
 // sendDiscoPingsLocked starts pinging all of ep's endpoints.
@@ -803,12 +917,14 @@ func (de *endpoint) updateFromNode(n tailcfg.NodeView, heartbeatDisabled bool) {
 		}
 		de.derpAddr = newDerp
 	}
+	de.notePathLocked(mono.Now(), PathReasonDERPHomeChanged, "")
 
 	for _, st := range de.endpointState {
 		st.index = indexSentinelDeleted // assume deleted until updated in next loop
 	}
 
 	var newIpps []netip.AddrPort
+	offeredAt := time.Now()
 	for i := range n.Endpoints().LenIter() {
 		epStr := n.Endpoints().At(i)
 		if i > math.MaxInt16 {
@@ -820,6 +936,7 @@ func (de *endpoint) updateFromNode(n tailcfg.NodeView, heartbeatDisabled bool) {
 			de.c.logf("magicsock: bogus netmap endpoint %q", epStr)
 			continue
 		}
+		de.noteOfferedLocked(ipp, offerViaNetmap, offeredAt)
 		if st, ok := de.endpointState[ipp]; ok {
 			st.index = int16(i)
 		} else {
@@ -850,10 +967,12 @@ func (de *endpoint) updateFromNode(n tailcfg.NodeView, heartbeatDisabled bool) {
 // false.
 //
 // This is called once we've already verified that we got a valid
-// discovery message from de via ep.
+// discovery message from de via ep. It also records the ping for
+// reachability reporting.
 func (de *endpoint) addCandidateEndpoint(ep netip.AddrPort, forRxPingTxID stun.TxID) (duplicatePing bool) {
 	de.mu.Lock()
 	defer de.mu.Unlock()
+	de.notePingRecvLocked(ep, mono.Now())
 
 	if st, ok := de.endpointState[ep]; ok {
 		duplicatePing = forRxPingTxID == st.lastGotPingTxID
@@ -896,6 +1015,9 @@ func (de *endpoint) clearBestAddrLocked() {
 	de.bestAddr = addrLatency{}
 	de.bestAddrAt = 0
 	de.trustBestAddrUntil = 0
+	de.heartbeatPongAt = 0
+	de.heartbeatLost = false
+	de.mtuProbedAddr = netip.AddrPort{}
 }
 
 // noteBadEndpoint marks ipp as a bad endpoint that would need to be
@@ -906,6 +1028,7 @@ func (de *endpoint) noteBadEndpoint(ipp netip.AddrPort) {
 	defer de.mu.Unlock()
 
 	de.clearBestAddrLocked()
+	de.notePathLocked(mono.Now(), PathReasonSendError, "")
 
 	if st, ok := de.endpointState[ipp]; ok {
 		st.clear()
@@ -920,6 +1043,7 @@ func (de *endpoint) noteConnectivityChange() {
 	defer de.mu.Unlock()
 
 	de.clearBestAddrLocked()
+	de.notePathLocked(mono.Now(), PathReasonLinkChange, "")
 
 	for k := range de.endpointState {
 		de.endpointState[k].clear()
@@ -943,9 +1067,23 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 	}
 	knownTxID = true // for naked returns below
 	de.removeSentDiscoPingLocked(m.TxID, sp)
+	metricRecvDiscoPongByPurpose[sp.purpose].Add(1)
+	de.c.counters.discoPongsRecv.Add(1)
 
 	now := mono.Now()
 	latency := now.Sub(sp.at)
+	de.addRTTSampleLocked(sp, isDerp, latency, now.WallTime())
+	de.c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPong, Peer: de.publicKey, Addr: sp.to, Purpose: sp.purpose.String(), Latency: latency})
+	de.notePingOutcomeLocked(sp, true, latency, now)
+	if sp.purpose == pingMTU {
+		// Not a liveness signal; don't let it validate the path or
+		// keep it trusted.
+		if !isDerp {
+			de.noteMTUPongLocked(sp)
+		}
+		return
+	}
+	de.notePongRecvLocked(src, now)
 
 	if !isDerp {
 		st, ok := de.endpointState[sp.to]
@@ -962,6 +1100,7 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 			from:    src,
 			pongSrc: m.Src,
 		})
+		de.noteValidatedLocked(sp.to, sp.purpose, now.WallTime())
 	}
 
 	if sp.purpose != pingHeartbeat {
@@ -975,7 +1114,7 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 	// Currently only CLI ping uses this callback.
 	if sp.cb != nil {
 		if sp.purpose == pingCLI {
-			de.c.populateCLIPingResponseLocked(sp.res, latency, sp.to)
+			de.c.populateCLIPingResponseLocked(sp.res, sp.purpose, latency, sp.to)
 		}
 		go sp.cb(sp.res)
 	}
@@ -992,9 +1131,15 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 				From: de.bestAddr,
 				To:   thisPong,
 			})
+			de.c.emitDiscoEvent(DiscoEvent{Type: DiscoEventPathChange, Peer: de.publicKey, Addr: sp.to, PrevAddr: de.bestAddr.AddrPort})
 			de.bestAddr = thisPong
+			de.heartbeatPongAt = 0
+			de.heartbeatLost = false
 		}
 		if de.bestAddr.AddrPort == thisPong.AddrPort {
+			if sp.purpose == pingHeartbeat {
+				de.noteHeartbeatPongLocked(now)
+			}
 			de.debugUpdates.Add(EndpointChange{
 				When: time.Now(),
 				What: "handlePingLocked-bestAddr-latency",
@@ -1003,7 +1148,8 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 			})
 			de.bestAddr.latency = latency
 			de.bestAddrAt = now
-			de.trustBestAddrUntil = now.Add(trustUDPAddrDuration)
+			de.trustBestAddrUntil = now.Add(de.trustDurationLocked())
+			de.notePathLocked(now, PathReasonPong, sp.purpose.String())
 		}
 	}
 	return
@@ -1109,6 +1255,7 @@ func (de *endpoint) handleCallMeMaybe(m *disco.CallMeMaybe) {
 			continue
 		}
 		mak.Set(&de.isCallMeMaybeEP, ep, true)
+		de.noteOfferedLocked(ep, offerViaCallMeMaybe, now)
 		if es, ok := de.endpointState[ep]; ok {
 			es.callMeMaybeTime = now
 		} else {
@@ -1189,6 +1336,7 @@ func (de *endpoint) stopAndReset() {
 		What: "stopAndReset-resetLocked",
 	})
 	de.resetLocked()
+	de.stopColdBurstLocked()
 	if de.heartBeatTimer != nil {
 		de.heartBeatTimer.Stop()
 		de.heartBeatTimer = nil
@@ -1202,6 +1350,7 @@ func (de *endpoint) resetLocked() {
 	de.lastSend = 0
 	de.lastFullPing = 0
 	de.clearBestAddrLocked()
+	de.notePathLocked(mono.Now(), PathReasonReset, "")
 	for _, es := range de.endpointState {
 		es.lastPing = 0
 	}
@@ -0,0 +1,124 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// maxOfferedEndpoints is the maximum number of distinct endpoint addresses
+// whose offer history we retain per peer. When exceeded, the entry that was
+// least recently offered is dropped.
+const maxOfferedEndpoints = 64
+
+// Sources of an offered endpoint, as reported in EndpointOffer.Via.
+const (
+	offerViaNetmap      = "netmap"
+	offerViaCallMeMaybe = "callmemaybe"
+)
+
+// offeredEndpoint is the history of a single endpoint address that a peer
+// has offered us. All fields are guarded by endpoint.mu.
+type offeredEndpoint struct {
+	via           []string // offerVia* values, in order first seen
+	firstOffered  time.Time
+	lastOffered   time.Time
+	lastValidated time.Time        // zero if never validated
+	validatedFor  discoPingPurpose // purpose of the ping that last validated it
+}
+
+// EndpointOffer describes an endpoint address that a peer has offered us
+// over time, and whether we validated it. This is not a stable interface
+// and could change at any time.
+type EndpointOffer struct {
+	Addr         netip.AddrPort
+	Via          []string  // how it was offered: "netmap", "callmemaybe"
+	FirstOffered time.Time // when it was first offered
+	LastOffered  time.Time // when it was most recently offered
+	Current      bool      // whether it's still a current candidate endpoint
+
+	// LastValidated is when we last got a pong from Addr, if ever.
+	LastValidated time.Time `json:",omitempty"`
+	// ValidatedBy is the purpose of the disco ping that elicited that pong
+	// ("Discovery", "Heartbeat", "CLI"). Empty if never validated.
+	ValidatedBy string `json:",omitempty"`
+}
+
+// noteOfferedLocked records that the peer offered us ep via the given
+// source (one of the offerVia* constants).
+//
+// de.mu must be held.
+func (de *endpoint) noteOfferedLocked(ep netip.AddrPort, via string, now time.Time) {
+	oe, ok := de.offered[ep]
+	if !ok {
+		if de.offered == nil {
+			de.offered = make(map[netip.AddrPort]*offeredEndpoint)
+		}
+		if len(de.offered) >= maxOfferedEndpoints {
+			de.evictOldestOfferLocked()
+		}
+		oe = &offeredEndpoint{firstOffered: now}
+		de.offered[ep] = oe
+	}
+	oe.lastOffered = now
+	if !slices.Contains(oe.via, via) {
+		oe.via = append(oe.via, via)
+	}
+}
+
+// evictOldestOfferLocked removes the entry from de.offered that was least
+// recently offered.
+//
+// de.mu must be held.
+func (de *endpoint) evictOldestOfferLocked() {
+	var oldest netip.AddrPort
+	var oldestAt time.Time
+	for ep, oe := range de.offered {
+		if !oldest.IsValid() || oe.lastOffered.Before(oldestAt) {
+			oldest, oldestAt = ep, oe.lastOffered
+		}
+	}
+	delete(de.offered, oldest)
+}
+
+// noteValidatedLocked records that a pong was received from ep in reply to
+// a ping sent for purpose.
+//
+// de.mu must be held.
+func (de *endpoint) noteValidatedLocked(ep netip.AddrPort, purpose discoPingPurpose, now time.Time) {
+	if oe, ok := de.offered[ep]; ok {
+		oe.lastValidated = now
+		oe.validatedFor = purpose
+	}
+}
+
+// offersLocked returns the offer history of de, sorted by the time each
+// endpoint was first offered.
+//
+// de.mu must be held.
+func (de *endpoint) offersLocked() []EndpointOffer {
+	ret := make([]EndpointOffer, 0, len(de.offered))
+	for ep, oe := range de.offered {
+		o := EndpointOffer{
+			Addr:          ep,
+			Via:           slices.Clone(oe.via),
+			FirstOffered:  oe.firstOffered,
+			LastOffered:   oe.lastOffered,
+			LastValidated: oe.lastValidated,
+		}
+		if _, ok := de.endpointState[ep]; ok {
+			o.Current = true
+		}
+		if !oe.lastValidated.IsZero() {
+			o.ValidatedBy = oe.validatedFor.String()
+		}
+		ret = append(ret, o)
+	}
+	slices.SortFunc(ret, func(a, b EndpointOffer) int {
+		return a.FirstOffered.Compare(b.FirstOffered)
+	})
+	return ret
+}
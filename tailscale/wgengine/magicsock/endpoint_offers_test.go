@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEndpointOffers(t *testing.T) {
+	de := &endpoint{endpointState: map[netip.AddrPort]*endpointState{}}
+	t0 := time.Unix(1000, 0)
+	a := netip.MustParseAddrPort("1.2.3.4:41641")
+	b := netip.MustParseAddrPort("[fd00::1]:41641")
+
+	de.noteOfferedLocked(a, offerViaNetmap, t0)
+	de.noteOfferedLocked(b, offerViaCallMeMaybe, t0.Add(time.Second))
+	de.noteOfferedLocked(a, offerViaCallMeMaybe, t0.Add(2*time.Second))
+	de.endpointState[a] = &endpointState{}
+	de.noteValidatedLocked(a, pingHeartbeat, t0.Add(3*time.Second))
+
+	got := de.offersLocked()
+	want := []EndpointOffer{
+		{
+			Addr:          a,
+			Via:           []string{offerViaNetmap, offerViaCallMeMaybe},
+			FirstOffered:  t0,
+			LastOffered:   t0.Add(2 * time.Second),
+			Current:       true,
+			LastValidated: t0.Add(3 * time.Second),
+			ValidatedBy:   "Heartbeat",
+		},
+		{
+			Addr:         b,
+			Via:          []string{offerViaCallMeMaybe},
+			FirstOffered: t0.Add(time.Second),
+			LastOffered:  t0.Add(time.Second),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestEndpointOffersBounded(t *testing.T) {
+	de := &endpoint{}
+	t0 := time.Unix(1000, 0)
+	for i := 0; i < maxOfferedEndpoints+1; i++ {
+		ep := netip.MustParseAddrPort(fmt.Sprintf("10.0.0.%d:1", i))
+		de.noteOfferedLocked(ep, offerViaNetmap, t0.Add(time.Duration(i)*time.Second))
+	}
+	if n := len(de.offered); n != maxOfferedEndpoints {
+		t.Fatalf("got %d offers; want %d", n, maxOfferedEndpoints)
+	}
+	if _, ok := de.offered[netip.MustParseAddrPort("10.0.0.0:1")]; ok {
+		t.Errorf("oldest offer was not evicted")
+	}
+}
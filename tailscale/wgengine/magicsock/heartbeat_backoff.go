@@ -0,0 +1,102 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"time"
+
+	"tailscale.com/tstime/mono"
+)
+
+// Heartbeats to a peer that we haven't sent traffic to for
+// heartbeatBackoffIdle back off, doubling their interval each time up to
+// heartbeatBackoffMax, to save battery and data on idle mobile links. They
+// return to every heartbeatInterval as soon as we send the peer a packet.
+// Heartbeats stop altogether after sessionActiveTimeout.
+//
+// Backed-off heartbeats are further apart than trustUDPAddrDuration, so
+// their pongs extend the trust in bestAddr to match; see
+// trustDurationLocked.
+const (
+	heartbeatBackoffIdleDefault = 10 * time.Second
+
+	// heartbeatBackoffMaxDefault is shy of the 30 seconds at which UDP
+	// NAT mappings typically expire, so that backed-off heartbeats
+	// still keep them alive.
+	heartbeatBackoffMaxDefault = 24 * time.Second
+)
+
+// heartbeatBackoffIdle returns how long a peer must go without us sending
+// it traffic for its heartbeats to back off.
+func heartbeatBackoffIdle() time.Duration {
+	if d := debugHeartbeatBackoffIdle(); d > 0 {
+		return d
+	}
+	return heartbeatBackoffIdleDefault
+}
+
+// heartbeatBackoffMax returns the longest interval that heartbeats back off
+// to.
+func heartbeatBackoffMax() time.Duration {
+	if d := debugHeartbeatBackoffMax(); d > 0 {
+		return max(d, heartbeatInterval)
+	}
+	return heartbeatBackoffMaxDefault
+}
+
+// trustDurationLocked returns how long to trust bestAddr after a pong from
+// it. While heartbeats are backed off, that's long enough for the next
+// heartbeat's pong to arrive with the same slack that trustUDPAddrDuration
+// leaves over heartbeatInterval. Otherwise the path would expire between
+// every pair of heartbeats, sending packets over DERP too and each
+// heartbeat pinging every endpoint.
+//
+// de.mu must be held.
+func (de *endpoint) trustDurationLocked() time.Duration {
+	if de.heartbeatBackoff == 0 {
+		return trustUDPAddrDuration
+	}
+	return de.heartbeatBackoff + trustUDPAddrDuration - heartbeatInterval
+}
+
+// nextHeartbeatIntervalLocked returns how long to wait before de's next
+// heartbeat, backing off further if it's idle as of now.
+//
+// de.mu must be held.
+func (de *endpoint) nextHeartbeatIntervalLocked(now mono.Time) time.Duration {
+	if now.Sub(de.lastSend) < heartbeatBackoffIdle() {
+		de.endHeartbeatBackoffLocked()
+		return heartbeatInterval
+	}
+	if de.heartbeatBackoff == 0 {
+		de.c.dlogf("[v1] magicsock: disco: backing off heartbeats to idle %v (%v)", de.publicKey.ShortString(), de.discoShort())
+		metricDiscoHeartbeatBackoff.Add(1)
+	}
+	de.heartbeatBackoff = min(max(2*de.heartbeatBackoff, 2*heartbeatInterval), heartbeatBackoffMax())
+	return de.heartbeatBackoff
+}
+
+// endHeartbeatBackoffLocked returns de's heartbeats to every
+// heartbeatInterval, if they're backed off.
+//
+// de.mu must be held.
+func (de *endpoint) endHeartbeatBackoffLocked() {
+	if de.heartbeatBackoff == 0 {
+		return
+	}
+	de.heartbeatBackoff = 0
+	// The pongs were sparse while backed off, so don't count that time
+	// against the path.
+	de.heartbeatPongAt = 0
+	// Nor trust the path for longer than usual now that it's in use
+	// again.
+	if until := de.bestAddrAt.Add(trustUDPAddrDuration); de.trustBestAddrUntil.After(until) {
+		de.trustBestAddrUntil = until
+	}
+	// If the timer's already fired, heartbeat is waiting for de.mu and
+	// will schedule the next one at the normal interval itself.
+	if de.heartBeatTimer != nil && de.heartBeatTimer.Stop() {
+		de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tstime/mono"
+)
+
+func TestHeartbeatBackoff(t *testing.T) {
+	de := &endpoint{c: &Conn{logf: t.Logf}}
+	start := mono.Now()
+	de.lastSend = start
+
+	if got := de.nextHeartbeatIntervalLocked(start.Add(heartbeatBackoffIdle() - time.Second)); got != heartbeatInterval {
+		t.Fatalf("before idle: got %v; want %v", got, heartbeatInterval)
+	}
+
+	// Once idle, the interval doubles up to the max, and stays there.
+	idle := start.Add(heartbeatBackoffIdle())
+	want := []time.Duration{6 * time.Second, 12 * time.Second, 24 * time.Second, 24 * time.Second}
+	for i, w := range want {
+		if got := de.nextHeartbeatIntervalLocked(idle); got != w {
+			t.Errorf("idle heartbeat %d: got %v; want %v", i, got, w)
+		}
+	}
+
+	// The next packet sent snaps it back, rescheduling the pending
+	// heartbeat sooner.
+	var fired bool
+	de.heartBeatTimer = time.AfterFunc(time.Hour, func() { fired = true })
+	pending := de.heartBeatTimer
+	de.heartbeatPongAt = start
+	de.noteActiveLocked()
+	defer de.heartBeatTimer.Stop()
+	if de.heartbeatBackoff != 0 || de.heartbeatPongAt != 0 {
+		t.Errorf("after send: heartbeatBackoff %v, heartbeatPongAt %v; want both zero", de.heartbeatBackoff, de.heartbeatPongAt)
+	}
+	if de.heartBeatTimer == pending || pending.Stop() || fired {
+		t.Error("pending heartbeat wasn't replaced")
+	}
+	if got := de.nextHeartbeatIntervalLocked(mono.Now()); got != heartbeatInterval {
+		t.Errorf("after send: got %v; want %v", got, heartbeatInterval)
+	}
+}
+
+func TestHeartbeatBackoffKnobs(t *testing.T) {
+	if !debugKnobsEnabled {
+		t.Skip("debug knobs disabled on this platform")
+	}
+	t.Cleanup(func() {
+		envknob.Setenv("TS_DEBUG_HEARTBEAT_BACKOFF_IDLE", "")
+		envknob.Setenv("TS_DEBUG_HEARTBEAT_BACKOFF_MAX", "")
+	})
+	envknob.Setenv("TS_DEBUG_HEARTBEAT_BACKOFF_IDLE", "1s")
+	envknob.Setenv("TS_DEBUG_HEARTBEAT_BACKOFF_MAX", "8s")
+	if got := heartbeatBackoffIdle(); got != time.Second {
+		t.Errorf("heartbeatBackoffIdle = %v; want 1s", got)
+	}
+
+	de := &endpoint{c: &Conn{logf: t.Logf}}
+	de.lastSend = mono.Now()
+	idle := de.lastSend.Add(time.Second)
+	for i, w := range []time.Duration{6 * time.Second, 8 * time.Second} {
+		if got := de.nextHeartbeatIntervalLocked(idle); got != w {
+			t.Errorf("idle heartbeat %d: got %v; want %v", i, got, w)
+		}
+	}
+
+	// The max can't be below the normal interval.
+	envknob.Setenv("TS_DEBUG_HEARTBEAT_BACKOFF_MAX", "1s")
+	if got := heartbeatBackoffMax(); got != heartbeatInterval {
+		t.Errorf("heartbeatBackoffMax = %v; want %v", got, heartbeatInterval)
+	}
+}
+
+func TestHeartbeatBackoffTrust(t *testing.T) {
+	de := &endpoint{c: &Conn{logf: t.Logf}, bestAddr: addrLatency{AddrPort: netip.MustParseAddrPort("1.2.3.4:5")}}
+	now := mono.Now()
+	de.lastSend = now
+	de.lastFullPing = now
+	now = now.Add(heartbeatBackoffIdle())
+
+	// Each backed-off heartbeat's pong trusts the path until just past
+	// when the next one's should arrive, up to and including the max.
+	for de.heartbeatBackoff < heartbeatBackoffMax() {
+		interval := de.nextHeartbeatIntervalLocked(now)
+		de.bestAddrAt = now
+		de.trustBestAddrUntil = now.Add(de.trustDurationLocked())
+		next := now.Add(interval)
+		if next.After(de.trustBestAddrUntil) || de.wantFullPingLocked(next) {
+			t.Errorf("backoff %v: path expired by the next heartbeat", interval)
+		}
+		if late := next.Add(trustUDPAddrDuration - heartbeatInterval + time.Millisecond); !late.After(de.trustBestAddrUntil) {
+			t.Errorf("backoff %v: trusted until %v after the next heartbeat; want %v", interval, de.trustBestAddrUntil.Sub(next), trustUDPAddrDuration-heartbeatInterval)
+		}
+		now = next
+	}
+
+	// Sending to the peer again ends the extended trust.
+	de.noteActiveLocked()
+	defer de.heartBeatTimer.Stop()
+	if got, want := de.trustBestAddrUntil, de.bestAddrAt.Add(trustUDPAddrDuration); got != want {
+		t.Errorf("after send: trusted for %v after the last pong; want %v", got.Sub(de.bestAddrAt), trustUDPAddrDuration)
+	}
+	if got := de.trustDurationLocked(); got != trustUDPAddrDuration {
+		t.Errorf("after send: trustDurationLocked = %v; want %v", got, trustUDPAddrDuration)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+// heartbeatLossTimeout is how long a direct path can go without answering
+// heartbeat pings before we consider its heartbeat lost. It's longer than
+// trustUDPAddrDuration, so a single lost pong doesn't count, but shorter
+// than it takes WireGuard to give up on a handshake.
+const heartbeatLossTimeout = 4 * heartbeatInterval
+
+// maxHeartbeatLosses is how many HeartbeatLoss events a Conn retains.
+const maxHeartbeatLosses = 64
+
+// HeartbeatLoss records that a peer's established direct path stopped
+// answering heartbeat pings. This is not a stable interface and could
+// change at any time.
+type HeartbeatLoss struct {
+	When     time.Time
+	Peer     key.NodePublic
+	Addr     netip.AddrPort // the direct path that went silent
+	LastPong time.Time      // when it last answered (or heartbeats began)
+}
+
+// checkHeartbeatLossLocked is called before sending a heartbeat ping to
+// addr, de's current direct path. It records a HeartbeatLoss the first time
+// addr has gone heartbeatLossTimeout without answering one.
+//
+// de.mu must be held.
+func (de *endpoint) checkHeartbeatLossLocked(addr netip.AddrPort, now mono.Time) {
+	if de.heartbeatPongAt == 0 {
+		de.heartbeatPongAt = now
+		return
+	}
+	since := now.Sub(de.heartbeatPongAt)
+	if de.heartbeatLost || since < heartbeatLossTimeout {
+		return
+	}
+	de.heartbeatLost = true
+	metricDiscoHeartbeatLost.Add(1)
+	de.c.counters.heartbeatsLost.Add(1)
+	de.c.logf("magicsock: disco: heartbeat lost to %v (%v) at %v; no pong in %v", de.publicKey.ShortString(), de.discoShort(), addr, since.Round(time.Second))
+	wallNow := time.Now()
+	de.c.heartbeatLosses.Add(HeartbeatLoss{
+		When:     wallNow,
+		Peer:     de.publicKey,
+		Addr:     addr,
+		LastPong: wallNow.Add(-since),
+	})
+}
+
+// noteHeartbeatPongLocked is called when de's direct path answers a
+// heartbeat ping.
+//
+// de.mu must be held.
+func (de *endpoint) noteHeartbeatPongLocked(now mono.Time) {
+	if de.heartbeatLost {
+		de.c.logf("magicsock: disco: heartbeat to %v (%v) recovered after %v", de.publicKey.ShortString(), de.discoShort(), now.Sub(de.heartbeatPongAt).Round(time.Second))
+	}
+	de.heartbeatPongAt = now
+	de.heartbeatLost = false
+}
+
+// HeartbeatLosses returns the recent history of peers' direct paths that
+// stopped answering heartbeat pings, oldest first.
+func (c *Conn) HeartbeatLosses() []HeartbeatLoss {
+	return c.heartbeatLosses.GetAll()
+}
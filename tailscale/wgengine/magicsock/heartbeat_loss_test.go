@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/util/ringbuffer"
+)
+
+func TestHeartbeatLoss(t *testing.T) {
+	c := &Conn{
+		logf:            t.Logf,
+		heartbeatLosses: ringbuffer.New[HeartbeatLoss](maxHeartbeatLosses),
+	}
+	de := &endpoint{c: c}
+	addr := netip.MustParseAddrPort("1.2.3.4:567")
+	start := mono.Now()
+
+	de.checkHeartbeatLossLocked(addr, start)
+	if de.heartbeatPongAt != start {
+		t.Fatalf("heartbeatPongAt = %v; want %v", de.heartbeatPongAt, start)
+	}
+	de.checkHeartbeatLossLocked(addr, start.Add(heartbeatLossTimeout-time.Second))
+	if got := len(c.HeartbeatLosses()); got != 0 {
+		t.Fatalf("got %d losses before timeout; want 0", got)
+	}
+
+	// Crossing the timeout records exactly one loss, however many more
+	// heartbeats go unanswered.
+	for i := 0; i < 3; i++ {
+		de.checkHeartbeatLossLocked(addr, start.Add(heartbeatLossTimeout+time.Duration(i)*heartbeatInterval))
+	}
+	losses := c.HeartbeatLosses()
+	if len(losses) != 1 {
+		t.Fatalf("got %d losses; want 1", len(losses))
+	}
+	if losses[0].Addr != addr {
+		t.Errorf("loss addr = %v; want %v", losses[0].Addr, addr)
+	}
+	if !losses[0].LastPong.Before(losses[0].When) {
+		t.Errorf("LastPong %v not before When %v", losses[0].LastPong, losses[0].When)
+	}
+
+	// A pong resets it, so a later silence is recorded again.
+	pongAt := start.Add(2 * heartbeatLossTimeout)
+	de.noteHeartbeatPongLocked(pongAt)
+	if de.heartbeatLost {
+		t.Fatal("heartbeatLost still set after pong")
+	}
+	de.checkHeartbeatLossLocked(addr, pongAt.Add(heartbeatLossTimeout))
+	if got := len(c.HeartbeatLosses()); got != 2 {
+		t.Fatalf("got %d losses; want 2", got)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// IPFamily is an IP address family restriction, as used by ForceIPFamily.
+type IPFamily string
+
+const (
+	IPFamilyAuto IPFamily = "auto" // no restriction
+	IPFamilyV4   IPFamily = "v4"   // IPv4 only
+	IPFamilyV6   IPFamily = "v6"   // IPv6 only
+)
+
+// maxForceIPFamilyDuration is the longest that ForceIPFamily will keep an
+// override in effect.
+const maxForceIPFamilyDuration = time.Hour
+
+// ForceIPFamily temporarily restricts c to a single IP address family for
+// UDP sends, endpoint discovery, and DERP dials. After d (clamped to
+// maxForceIPFamilyDuration) elapses, c reverts to IPFamilyAuto. Passing
+// IPFamilyAuto removes any current override immediately.
+//
+// It's intended for debugging connectivity problems that only occur on one
+// address family. It returns the effective family and when it expires
+// (which is zero for IPFamilyAuto).
+func (c *Conn) ForceIPFamily(fam IPFamily, d time.Duration) (_ IPFamily, until time.Time, err error) {
+	var v int32
+	switch fam {
+	case IPFamilyAuto:
+	case IPFamilyV4:
+		v = 4
+	case IPFamilyV6:
+		v = 6
+	default:
+		return "", time.Time{}, fmt.Errorf("unknown IP family %q", fam)
+	}
+	if v != 0 && d <= 0 {
+		return "", time.Time{}, fmt.Errorf("invalid duration %v", d)
+	}
+	d = min(d, maxForceIPFamilyDuration)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return "", time.Time{}, errConnClosed
+	}
+	if c.forceIPFamilyTimer != nil {
+		c.forceIPFamilyTimer.Stop()
+		c.forceIPFamilyTimer = nil
+	}
+	c.forceIPFamilyUntil = time.Time{}
+	c.forceIPFamilyGen++
+	if v != 0 {
+		gen := c.forceIPFamilyGen
+		c.forceIPFamilyUntil = time.Now().Add(d)
+		c.forceIPFamilyTimer = time.AfterFunc(d, func() { c.expireForcedIPFamily(gen) })
+	}
+	until = c.forceIPFamilyUntil
+	changed := c.forceIPFamily.Swap(v) != v
+	if changed {
+		c.logf("magicsock: IP family override set to %v (until %v)", fam, until)
+		// Redial DERP so the home connection uses an allowed family.
+		c.closeAllDerpLocked("ipfamily-override")
+		c.startDerpHomeConnectLocked()
+	}
+	c.mu.Unlock()
+
+	if changed {
+		c.resetEndpointStates()
+		c.ReSTUN("ipfamily-override")
+	}
+	return fam, until, nil
+}
+
+// expireForcedIPFamily reverts the IP family override set by the
+// ForceIPFamily call with generation gen, unless it's since been replaced.
+func (c *Conn) expireForcedIPFamily(gen int) {
+	c.mu.Lock()
+	current := c.forceIPFamilyGen == gen
+	c.mu.Unlock()
+	if current {
+		c.ForceIPFamily(IPFamilyAuto, 0)
+	}
+}
+
+// ForcedIPFamily returns the current IP family override set by
+// ForceIPFamily and when it expires. If there's no override, it returns
+// IPFamilyAuto and the zero time.
+func (c *Conn) ForcedIPFamily() (IPFamily, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.forceIPFamily.Load() {
+	case 4:
+		return IPFamilyV4, c.forceIPFamilyUntil
+	case 6:
+		return IPFamilyV6, c.forceIPFamilyUntil
+	}
+	return IPFamilyAuto, time.Time{}
+}
+
+// ipFamilyAllowed reports whether a's address family is permitted by any
+// current ForceIPFamily override.
+func (c *Conn) ipFamilyAllowed(a netip.Addr) bool {
+	switch c.forceIPFamily.Load() {
+	case 4:
+		return a.Is4()
+	case 6:
+		return a.Is6()
+	}
+	return true
+}
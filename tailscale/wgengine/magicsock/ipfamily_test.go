@@ -0,0 +1,43 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPFamilyAllowed(t *testing.T) {
+	c := newConn()
+	v4 := netip.MustParseAddr("1.2.3.4")
+	v6 := netip.MustParseAddr("2001:db8::1")
+	sel := derpAddrFamSelector{c}
+
+	tests := []struct {
+		force      int32
+		v4ok, v6ok bool
+	}{
+		{0, true, true},
+		{4, true, false},
+		{6, false, true},
+	}
+	for _, tt := range tests {
+		c.forceIPFamily.Store(tt.force)
+		if got := c.ipFamilyAllowed(v4); got != tt.v4ok {
+			t.Errorf("force=%d: v4 allowed = %v; want %v", tt.force, got, tt.v4ok)
+		}
+		if got := c.ipFamilyAllowed(v6); got != tt.v6ok {
+			t.Errorf("force=%d: v6 allowed = %v; want %v", tt.force, got, tt.v6ok)
+		}
+		if got := sel.AllowDialProto("tcp4"); got != tt.v4ok {
+			t.Errorf("force=%d: AllowDialProto(tcp4) = %v; want %v", tt.force, got, tt.v4ok)
+		}
+		if got := sel.AllowDialProto("tcp6"); got != tt.v6ok {
+			t.Errorf("force=%d: AllowDialProto(tcp6) = %v; want %v", tt.force, got, tt.v6ok)
+		}
+	}
+	if _, _, err := c.ForceIPFamily("v5", 0); err == nil {
+		t.Error("ForceIPFamily accepted bogus family")
+	}
+}
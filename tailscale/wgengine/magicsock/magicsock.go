@@ -30,6 +30,7 @@
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/connstats"
+	"tailscale.com/net/dropstats"
 	"tailscale.com/net/interfaces"
 	"tailscale.com/net/netcheck"
 	"tailscale.com/net/neterror"
@@ -146,6 +147,10 @@ type Conn struct {
 	// Whether debugging logging is enabled.
 	debugLogging atomic.Bool
 
+	// forceIPFamily is the IP family override set by ForceIPFamily:
+	// 0 for none, or 4 or 6 to permit only that family.
+	forceIPFamily atomic.Int32
+
 	// havePrivateKey is whether privateKey is non-zero.
 	havePrivateKey  atomic.Bool
 	publicKeyAtomic syncs.AtomicValue[key.NodePublic] // or NodeKey zero value if !havePrivateKey
@@ -157,22 +162,52 @@ type Conn struct {
 
 	lastNetCheckReport atomic.Pointer[netcheck.Report]
 
+	// captivePortal is the most recent netcheck result that checked
+	// for a captive portal. See captive_portal.go.
+	captivePortal syncs.AtomicValue[CaptivePortalCheck]
+
 	// port is the preferred port from opts.Port; 0 means auto.
 	port atomic.Uint32
 
 	// stats maintains per-connection counters.
 	stats atomic.Pointer[connstats.Statistics]
 
+	// counters are the counts reported by Counters.
+	counters connCounters
+
 	// captureHook, if non-nil, is the pcap logging callback when capturing.
 	captureHook syncs.AtomicValue[capture.Callback]
 
+	// heartbeatLosses is the recent history of direct paths whose
+	// heartbeat pongs stopped arriving. See heartbeat_loss.go.
+	heartbeatLosses *ringbuffer.RingBuffer[HeartbeatLoss]
+
+	// discoEvents are the subscribers to disco activity.
+	// See disco_events.go.
+	discoEvents discoEvents
+
+	// pathEvents are the subscribers to peers' path changes.
+	// See path_events.go.
+	pathEvents pathEvents
+
+	// pendingPings are the disco pings being sent.
+	// See disco_queue.go.
+	pendingPings pendingDiscoPings
+
+	// coldBursts is how many peers have a cold peer burst of discovery
+	// pings in progress. See cold_burst.go.
+	coldBursts atomic.Int32
+
 	// discoPrivate is the private naclbox key used for active
-	// discovery traffic. It is always present, and immutable.
+	// discovery traffic. It is always present. It's only changed by
+	// RekeyDisco, with mu held, so reading it requires mu (except during
+	// construction).
 	discoPrivate key.DiscoPrivate
-	// public of discoPrivate. It is always present and immutable.
+	// public of discoPrivate. It is always present; guarded as
+	// discoPrivate.
 	discoPublic key.DiscoPublic
 	// ShortString of discoPublic (to save logging work later). It is always
-	// present and immutable.
+	// present; guarded as discoPrivate.
 	discoShort string
 
 	// ============================================================
@@ -276,6 +311,45 @@ type Conn struct {
 
 	// wgPinger is the WireGuard only pinger used for latency measurements.
 	wgPinger lazy.SyncValue[*ping.Pinger]
+
+	// forceIPFamilyTimer, if non-nil, reverts forceIPFamily at
+	// forceIPFamilyUntil. forceIPFamilyGen is incremented on each
+	// ForceIPFamily call so that stale timers are ignored.
+	forceIPFamilyTimer *time.Timer
+	forceIPFamilyUntil time.Time
+	forceIPFamilyGen   int
+
+	// derpDisabledUntil, if non-zero, is when a DisableDERP override
+	// expires; until then, no DERP connections are used. As with
+	// forceIPFamilyGen, derpDisabledGen invalidates stale timers.
+	derpDisabledTimer *time.Timer
+	derpDisabledUntil time.Time
+	derpDisabledGen   int
+
+	// derpFailedRegion, if non-zero, is the DERP region that a
+	// TestDERPFailover call is treating as failed, so it's not
+	// picked as the home region.
+	derpFailedRegion int
+
+	// derpPinnedRegion, if non-zero, is the home DERP region pinned by
+	// PinDERPHome until derpPinnedUntil. As with derpDisabledGen,
+	// derpPinGen invalidates stale timers.
+	derpPinTimer     *time.Timer
+	derpPinnedRegion int
+	derpPinnedUntil  time.Time
+	derpPinGen       int
+
+	// derpHomeReason is why myDerp was picked, as a DERPHomeReason
+	// constant, and lastNetCheckAt is when lastNetCheckReport was
+	// last used to pick it. lastNetCheckIncomplete is whether that
+	// netcheck ran out of time before all its probes finished.
+	derpHomeReason         string
+	lastNetCheckAt         time.Time
+	lastNetCheckIncomplete bool
+
+	// countersSince is when counters were last reset, or the Conn
+	// created. See counters.go.
+	countersSince time.Time
 }
 
 // SetDebugLoggingEnabled controls whether spammy debug logging is enabled.
@@ -372,6 +446,9 @@ func newConn() *Conn {
 		discoInfo:    make(map[key.DiscoPublic]*discoInfo),
 		discoPrivate: discoPrivate,
 		discoPublic:  discoPrivate.Public(),
+
+		heartbeatLosses: ringbuffer.New[HeartbeatLoss](maxHeartbeatLosses),
+		countersSince:   time.Now(),
 	}
 	c.discoShort = c.discoPublic.ShortString()
 	c.bind = &connBind{Conn: c, closed: true}
@@ -604,8 +681,10 @@ func (c *Conn) updateNetInfo(ctx context.Context) (*netcheck.Report, error) {
 	if err != nil {
 		return nil, err
 	}
+	incomplete := ctx.Err() != nil
 
 	c.lastNetCheckReport.Store(report)
+	c.noteCaptivePortalCheck(report, time.Now())
 	c.noV4.Store(!report.IPv4)
 	c.noV6.Store(!report.IPv6)
 	c.noV4Send.Store(!report.IPv4CanSend)
@@ -629,7 +708,10 @@ func (c *Conn) updateNetInfo(ctx context.Context) (*netcheck.Report, error) {
 	ni.OSHasIPv6.Set(report.OSHasIPv6)
 	ni.WorkingUDP.Set(report.UDP)
 	ni.WorkingICMPv4.Set(report.ICMPv4)
-	ni.PreferredDERP = report.PreferredDERP
+	c.mu.Lock()
+	var homeReason string
+	ni.PreferredDERP, homeReason = c.pickDERPHomeLocked(report)
+	c.mu.Unlock()
 
 	if ni.PreferredDERP == 0 {
 		// Perhaps UDP is blocked. Pick a deterministic but arbitrary
@@ -638,7 +720,13 @@ func (c *Conn) updateNetInfo(ctx context.Context) (*netcheck.Report, error) {
 	}
 	if !c.setNearestDERP(ni.PreferredDERP) {
 		ni.PreferredDERP = 0
+		homeReason = DERPHomeReasonNone
 	}
+	c.mu.Lock()
+	c.derpHomeReason = homeReason
+	c.lastNetCheckAt = time.Now()
+	c.lastNetCheckIncomplete = incomplete
+	c.mu.Unlock()
 	ni.FirewallMode = hostinfo.FirewallMode()
 
 	c.callNetInfoCallback(ni)
@@ -738,8 +826,9 @@ func (c *Conn) Ping(peer tailcfg.NodeView, res *ipnstate.PingResult, size int, c
 }
 
 // c.mu must be held
-func (c *Conn) populateCLIPingResponseLocked(res *ipnstate.PingResult, latency time.Duration, ep netip.AddrPort) {
+func (c *Conn) populateCLIPingResponseLocked(res *ipnstate.PingResult, purpose discoPingPurpose, latency time.Duration, ep netip.AddrPort) {
 	res.LatencySeconds = latency.Seconds()
+	res.Purpose = purpose.String()
 	if ep.Addr() != tailcfg.DerpMagicIPAddr {
 		res.Endpoint = ep.String()
 		return
@@ -768,8 +857,54 @@ func (c *Conn) GetEndpointChanges(peer tailcfg.NodeView) ([]EndpointChange, erro
 	return ep.debugUpdates.GetAll(), nil
 }
 
+// GetEndpointOffers returns the history of endpoints that peer has offered
+// us, via the netmap or CallMeMaybe, and whether we validated them. The
+// returned EndpointOffer structs are for debug use only.
+func (c *Conn) GetEndpointOffers(peer tailcfg.NodeView) ([]EndpointOffer, error) {
+	c.mu.Lock()
+	if c.privateKey.IsZero() {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("tailscaled stopped")
+	}
+	ep, ok := c.peerMap.endpointForNodeKey(peer.Key())
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown peer")
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.offersLocked(), nil
+}
+
+// GetPeerRTT returns the recent round-trip times measured to peer by disco
+// pings, oldest first.
+func (c *Conn) GetPeerRTT(peer tailcfg.NodeView) ([]RTTSample, error) {
+	c.mu.Lock()
+	if c.privateKey.IsZero() {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("tailscaled stopped")
+	}
+	ep, ok := c.peerMap.endpointForNodeKey(peer.Key())
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown peer")
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.rttSamples == nil {
+		return nil, nil
+	}
+	return ep.rttSamples.GetAll(), nil
+}
+
 // DiscoPublicKey returns the discovery public key.
 func (c *Conn) DiscoPublicKey() key.DiscoPublic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.discoPublic
 }
 
@@ -813,6 +948,9 @@ func (c *Conn) determineEndpoints(ctx context.Context) ([]tailcfg.Endpoint, erro
 		if !ipp.IsValid() || (debugOmitLocalAddresses() && et == tailcfg.EndpointLocal) {
 			return
 		}
+		if !c.ipFamilyAllowed(ipp.Addr()) {
+			return
+		}
 		if _, ok := already[ipp]; !ok {
 			mak.Set(&already, ipp, et)
 			eps = append(eps, tailcfg.Endpoint{Addr: ipp, Type: et})
@@ -941,6 +1079,15 @@ func (c *Conn) LocalPort() uint16 {
 	return uint16(laddr.Port)
 }
 
+// LocalPorts returns the current IPv4 and IPv6 listeners' port numbers, or
+// zero for either that isn't bound.
+func (c *Conn) LocalPorts() (v4, v6 uint16) {
+	if runtime.GOOS == "js" {
+		return 0, 0
+	}
+	return c.pconn4.Port(), c.pconn6.Port()
+}
+
 var errNetworkDown = errors.New("magicsock: network down")
 
 func (c *Conn) networkDown() bool { return !c.networkUp.Load() }
@@ -979,6 +1126,9 @@ func (c *Conn) sendUDPBatch(addr netip.AddrPort, buffs [][]byte) (sent bool, err
 	default:
 		panic("bogus sendUDPBatch addr type")
 	}
+	if !c.ipFamilyAllowed(addr.Addr()) {
+		return false, nil
+	}
 	if isIPv6 {
 		err = c.pconn6.WriteBatchTo(buffs, addr)
 	} else {
@@ -1014,6 +1164,9 @@ func (c *Conn) sendUDP(ipp netip.AddrPort, b []byte) (sent bool, err error) {
 // sendUDP sends UDP packet b to addr.
 // See sendAddr's docs on the return value meanings.
 func (c *Conn) sendUDPStd(addr netip.AddrPort, b []byte) (sent bool, err error) {
+	if !c.ipFamilyAllowed(addr.Addr()) {
+		return false, nil
+	}
 	switch {
 	case addr.Addr().Is4():
 		_, err = c.pconn4.WriteToUDPAddrPort(b, addr)
@@ -1096,17 +1249,17 @@ func (c *Conn) putReceiveBatch(batch *receiveBatch) {
 
 // receiveIPv4 creates an IPv4 ReceiveFunc reading from c.pconn4.
 func (c *Conn) receiveIPv4() conn.ReceiveFunc {
-	return c.mkReceiveFunc(&c.pconn4, &health.ReceiveIPv4, metricRecvDataIPv4)
+	return c.mkReceiveFunc(&c.pconn4, &health.ReceiveIPv4, metricRecvDataIPv4, &c.counters.recvDirectIPv4)
 }
 
 // receiveIPv6 creates an IPv6 ReceiveFunc reading from c.pconn6.
 func (c *Conn) receiveIPv6() conn.ReceiveFunc {
-	return c.mkReceiveFunc(&c.pconn6, &health.ReceiveIPv6, metricRecvDataIPv6)
+	return c.mkReceiveFunc(&c.pconn6, &health.ReceiveIPv6, metricRecvDataIPv6, &c.counters.recvDirectIPv6)
 }
 
 // mkReceiveFunc creates a ReceiveFunc reading from ruc.
 // The provided healthItem and metric are updated if non-nil.
-func (c *Conn) mkReceiveFunc(ruc *RebindingUDPConn, healthItem *health.ReceiveFuncStats, metric *clientmetric.Metric) conn.ReceiveFunc {
+func (c *Conn) mkReceiveFunc(ruc *RebindingUDPConn, healthItem *health.ReceiveFuncStats, metric *clientmetric.Metric, counter *atomic.Int64) conn.ReceiveFunc {
 	// epCache caches an IPPort->endpoint for hot flows.
 	var epCache ippEndpointCache
 
@@ -1141,6 +1294,7 @@ func (c *Conn) mkReceiveFunc(ruc *RebindingUDPConn, healthItem *health.ReceiveFu
 					if metric != nil {
 						metric.Add(1)
 					}
+					counter.Add(1)
 					eps[i] = ep
 					sizes[i] = msg.N
 					reportToCaller = true
@@ -1180,6 +1334,7 @@ func (c *Conn) receiveIP(b []byte, ipp netip.AddrPort, cache *ippEndpointCache)
 		de, ok := c.peerMap.endpointForIPPort(ipp)
 		c.mu.Unlock()
 		if !ok {
+			dropstats.Add(dropstats.ReasonUnknownPeer)
 			return nil, false
 		}
 		cache.ipp = ipp
@@ -1233,6 +1388,7 @@ func (c *Conn) sendDiscoMessage(dst netip.AddrPort, dstKey key.NodePublic, dstDi
 	pkt = append(pkt, disco.Magic...)
 	pkt = c.discoPublic.AppendTo(pkt)
 	di := c.discoInfoLocked(dstDisco)
+	discoShort := c.discoShort
 	c.mu.Unlock()
 
 	if isDERP {
@@ -1250,7 +1406,7 @@ func (c *Conn) sendDiscoMessage(dst netip.AddrPort, dstKey key.NodePublic, dstDi
 			if !dstKey.IsZero() {
 				node = dstKey.ShortString()
 			}
-			c.dlogf("[v1] magicsock: disco: %v->%v (%v, %v) sent %v len %v\n", c.discoShort, dstDisco.ShortString(), node, derpStr(dst.String()), disco.MessageSummary(m), len(pkt))
+			c.dlogf("[v1] magicsock: disco: %v->%v (%v, %v) sent %v len %v\n", discoShort, dstDisco.ShortString(), node, derpStr(dst.String()), disco.MessageSummary(m), len(pkt))
 		}
 		if isDERP {
 			metricSentDiscoDERP.Add(1)
@@ -1260,6 +1416,7 @@ func (c *Conn) sendDiscoMessage(dst netip.AddrPort, dstKey key.NodePublic, dstDi
 		switch m.(type) {
 		case *disco.Ping:
 			metricSentDiscoPing.Add(1)
+			c.counters.discoPingsSent.Add(1)
 		case *disco.Pong:
 			metricSentDiscoPong.Add(1)
 		case *disco.CallMeMaybe:
@@ -1328,6 +1485,7 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 
 	if !c.peerMap.anyEndpointForDiscoKey(sender) {
 		metricRecvDiscoBadPeer.Add(1)
+		c.counters.discoRecvBad.Add(1)
 		if debugDisco() {
 			c.logf("magicsock: disco: ignoring disco-looking frame, don't know endpoint for %v", sender.ShortString())
 		}
@@ -1358,6 +1516,7 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 			c.logf("magicsock: disco: failed to open naclbox from %v (wrong rcpt?) via %s", sender, via)
 		}
 		metricRecvDiscoBadKey.Add(1)
+		c.counters.discoRecvBad.Add(1)
 		return
 	}
 
@@ -1378,6 +1537,8 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 		// understand. Not even worth logging about, lest it
 		// be too spammy for old clients.
 		metricRecvDiscoBadParse.Add(1)
+		c.counters.discoRecvBad.Add(1)
+		dropstats.Add(dropstats.ReasonDiscoParse)
 		return
 	}
 
@@ -2026,6 +2187,12 @@ func (c *Conn) Close() error {
 		c.derpCleanupTimer.Stop()
 	}
 	c.stopPeriodicReSTUNTimerLocked()
+	if c.forceIPFamilyTimer != nil {
+		c.forceIPFamilyTimer.Stop()
+	}
+	if c.derpDisabledTimer != nil {
+		c.derpDisabledTimer.Stop()
+	}
 	c.portMapper.Close()
 
 	c.peerMap.forEachEndpoint(func(ep *endpoint) {
@@ -2105,6 +2272,10 @@ func (c *Conn) shouldDoPeriodicReSTUNLocked() bool {
 
 func (c *Conn) onPortMapChanged() { c.ReSTUN("portmap-changed") }
 
+// PortMapper returns c's NAT-PMP/PCP/UPnP client, for debugging. It must not
+// be closed or reconfigured.
+func (c *Conn) PortMapper() *portmapper.Client { return c.portMapper }
+
 // ReSTUN triggers an address discovery.
 // The provided why string is for debug logging only.
 func (c *Conn) ReSTUN(why string) {
@@ -2595,6 +2766,35 @@ func (c *Conn) SetStatistics(stats *connstats.Statistics) {
 	wireguardPingInterval = 5 * time.Second
 )
 
+// DiscoTimings are the intervals at which magicsock probes and maintains
+// paths to peers. They don't vary with the platform's power source: nothing
+// in magicsock adapts to running on battery. This is not a stable interface
+// and could change at any time.
+type DiscoTimings struct {
+	Heartbeat            time.Duration // between pings to a peer's best UDP path
+	HeartbeatBackoffIdle time.Duration // idle time after which heartbeats back off
+	HeartbeatBackoffMax  time.Duration // the longest interval heartbeats back off to
+	TrustUDPAddr         time.Duration // how long a UDP path is used alone without a pong
+	SessionActiveTimeout time.Duration // idle time after which heartbeats stop
+	Upgrade              time.Duration // between attempts to find a better path
+	DiscoPing            time.Duration // minimum time between pings to an endpoint
+	PingTimeout          time.Duration // how long to wait for a pong
+}
+
+// CurrentDiscoTimings returns the DiscoTimings in effect.
+func CurrentDiscoTimings() DiscoTimings {
+	return DiscoTimings{
+		Heartbeat:            heartbeatInterval,
+		HeartbeatBackoffIdle: heartbeatBackoffIdle(),
+		HeartbeatBackoffMax:  heartbeatBackoffMax(),
+		TrustUDPAddr:         trustUDPAddrDuration,
+		SessionActiveTimeout: sessionActiveTimeout,
+		Upgrade:              upgradeInterval,
+		DiscoPing:            discoPingInterval,
+		PingTimeout:          pingTimeoutDuration,
+	}
+}
+
 // indexSentinelDeleted is the temporary value that endpointState.index takes while
 // a endpoint's endpoints are being updated from a new network map.
 const indexSentinelDeleted = -1
@@ -2710,6 +2910,18 @@ type discoInfo struct {
 	metricRecvDiscoCallMeMaybeBadDisco = clientmetric.NewCounter("magicsock_disco_recv_callmemaybe_bad_disco")
 	metricRecvDiscoDERPPeerNotHere     = clientmetric.NewCounter("magicsock_disco_recv_derp_peer_not_here")
 	metricRecvDiscoDERPPeerGoneUnknown = clientmetric.NewCounter("magicsock_disco_recv_derp_peer_gone_unknown")
+	metricDiscoHeartbeatLost           = clientmetric.NewCounter("magicsock_disco_heartbeat_lost")
+	metricDiscoHeartbeatBackoff        = clientmetric.NewCounter("magicsock_disco_heartbeat_backoff")
+	metricPathEventsDropped            = clientmetric.NewCounter("magicsock_path_events_dropped")
+	metricColdBurstStarted             = clientmetric.NewCounter("magicsock_disco_cold_burst_started")
+	metricColdBurstSkipped             = clientmetric.NewCounter("magicsock_disco_cold_burst_skipped")
+
+	// metricSentDiscoPingByPurpose and metricRecvDiscoPongByPurpose count
+	// the disco pings sent, and the pongs received for them, of each
+	// discoPingPurpose, such as "magicsock_disco_sent_ping_heartbeat".
+	metricSentDiscoPingByPurpose = discoPingPurposeCounters("magicsock_disco_sent_ping_")
+	metricRecvDiscoPongByPurpose = discoPingPurposeCounters("magicsock_disco_recv_pong_")
+
 	// metricDERPHomeChange is how many times our DERP home region DI has
 	// changed from non-zero to a different non-zero.
 	metricDERPHomeChange = clientmetric.NewCounter("derp_home_change")
@@ -2850,3 +2850,17 @@ type endpointDetails struct {
 		})
 	}
 }
+
+func TestDiscoPingPurposeCounters(t *testing.T) {
+	if len(metricSentDiscoPingByPurpose) != numDiscoPingPurposes || len(metricRecvDiscoPongByPurpose) != numDiscoPingPurposes {
+		t.Fatalf("got %d, %d counters; want %d", len(metricSentDiscoPingByPurpose), len(metricRecvDiscoPongByPurpose), numDiscoPingPurposes)
+	}
+	for p := discoPingPurpose(0); p <= pingMTU; p++ {
+		if got := metricSentDiscoPingByPurpose[p].Name(); got != "magicsock_disco_sent_ping_"+strings.ToLower(p.String()) {
+			t.Errorf("sent counter for %v = %q", p, got)
+		}
+	}
+	if got := metricRecvDiscoPongByPurpose[pingHeartbeat].Name(); got != "magicsock_disco_recv_pong_heartbeat" {
+		t.Errorf("pong counter for heartbeat = %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+
+	"tailscale.com/tstime/mono"
+)
+
+// mtuProbeSizes are the sizes of the disco pings, including all disco
+// headers but excluding IP/UDP headers, that startMTUProbesLocked sends, in
+// increasing order. The largest fills a 1500 byte IPv4 packet.
+var mtuProbeSizes = []int{discoPingSize, 1280, 1400, 1472}
+
+// maxMTUProbeSize is the largest disco ping that may be sent for pingMTU.
+// Other pings are limited to tstun.DefaultMTU.
+var maxMTUProbeSize = mtuProbeSizes[len(mtuProbeSizes)-1]
+
+// pathMTU is the largest disco ping known to have crossed a direct path.
+type pathMTU struct {
+	addr netip.AddrPort
+	size int // disco message size, excluding IP/UDP headers
+}
+
+// startMTUProbesLocked sends a pingMTU of each of mtuProbeSizes to addr,
+// which should be de.bestAddr, unless it's already being probed. Each pong
+// raises de's discovered MTU for addr; pings that get no pong are ignored,
+// since they were likely dropped for being too large, not because the path
+// is dead.
+//
+// The probes are only meaningful with the Don't Fragment bit set, so they're
+// only sent if CanPMTUD.
+//
+// de.mu must be held.
+func (de *endpoint) startMTUProbesLocked(addr netip.AddrPort, now mono.Time) {
+	if !CanPMTUD() || !addr.IsValid() || de.mtuProbedAddr == addr {
+		return
+	}
+	de.mtuProbedAddr = addr
+	for _, size := range mtuProbeSizes {
+		de.startDiscoPingLocked(addr, now, pingMTU, size, nil, nil)
+	}
+}
+
+// noteMTUPongLocked records that sp, a pingMTU, was answered.
+//
+// de.mu must be held.
+func (de *endpoint) noteMTUPongLocked(sp sentPing) {
+	if de.discoveredMTU.addr != sp.to {
+		de.discoveredMTU = pathMTU{addr: sp.to}
+	}
+	if sp.size > de.discoveredMTU.size {
+		de.discoveredMTU.size = sp.size
+		de.c.dlogf("[v1] magicsock: disco: path MTU to %v (%v) at %v is at least %d", de.publicKey.ShortString(), de.discoShort(), sp.to, sp.size)
+	}
+}
+
+// discoveredMTULocked returns the largest disco message, excluding IP/UDP
+// headers, known to have crossed de's current direct path, or zero if
+// that's unknown.
+//
+// de.mu must be held.
+func (de *endpoint) discoveredMTULocked() int {
+	if !de.bestAddr.IsValid() || de.discoveredMTU.addr != de.bestAddr.AddrPort {
+		return 0
+	}
+	return de.discoveredMTU.size
+}
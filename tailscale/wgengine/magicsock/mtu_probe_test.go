@@ -0,0 +1,77 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/disco"
+	"tailscale.com/net/stun"
+	"tailscale.com/tstime/mono"
+)
+
+func TestMTUProbePongs(t *testing.T) {
+	c := &Conn{logf: t.Logf}
+	addr := netip.MustParseAddrPort("1.2.3.4:567")
+	now := mono.Now()
+	trustUntil := now.Add(time.Second)
+	de := &endpoint{
+		c:                  c,
+		bestAddr:           addrLatency{AddrPort: addr},
+		trustBestAddrUntil: trustUntil,
+		sentPing:           map[stun.TxID]sentPing{},
+	}
+	ping := func(size int) stun.TxID {
+		txid := stun.NewTxID()
+		de.sentPing[txid] = sentPing{
+			to:      addr,
+			at:      now,
+			timer:   time.AfterFunc(time.Hour, func() {}),
+			purpose: pingMTU,
+			size:    size,
+		}
+		return txid
+	}
+	pong := func(txid stun.TxID) {
+		if !de.handlePongConnLocked(&disco.Pong{TxID: txid, Src: addr}, nil, addr) {
+			t.Fatalf("pong %x not for a known ping", txid[:6])
+		}
+	}
+
+	if got := de.discoveredMTULocked(); got != 0 {
+		t.Fatalf("discoveredMTU before any pong = %d; want 0", got)
+	}
+	small, big, lost := ping(1280), ping(1400), ping(1472)
+	pong(big)
+	pong(small)
+	if got := de.discoveredMTULocked(); got != 1400 {
+		t.Errorf("discoveredMTU = %d; want 1400", got)
+	}
+
+	// A probe that's never answered lowers nothing and doesn't affect
+	// the path's liveness.
+	de.discoPingTimeout(lost)
+	if got := de.discoveredMTULocked(); got != 1400 {
+		t.Errorf("discoveredMTU after timeout = %d; want 1400", got)
+	}
+	if de.bestAddr.AddrPort != addr || de.heartbeatLost {
+		t.Errorf("bestAddr = %v, heartbeatLost = %v after MTU probe timeout", de.bestAddr, de.heartbeatLost)
+	}
+
+	// Their pongs aren't liveness signals either.
+	if de.trustBestAddrUntil != trustUntil {
+		t.Errorf("trustBestAddrUntil changed by MTU pongs")
+	}
+	if de.lastPongRecv != 0 {
+		t.Errorf("lastPongRecv set by MTU pong")
+	}
+
+	// It's only reported for the path that was probed.
+	de.bestAddr = addrLatency{AddrPort: netip.MustParseAddrPort("5.6.7.8:9")}
+	if got := de.discoveredMTULocked(); got != 0 {
+		t.Errorf("discoveredMTU for other path = %d; want 0", got)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"time"
+
+	"tailscale.com/net/netcheck"
+)
+
+// NetcheckReport is the result of a netcheck. This is not a stable
+// interface and could change at any time.
+type NetcheckReport struct {
+	// Report is the netcheck's report, or nil if none has finished.
+	Report *netcheck.Report
+
+	// At is when the netcheck finished.
+	At time.Time
+
+	// Incomplete is whether the netcheck ran out of time before all its
+	// probes finished, so Report may be missing some results. From
+	// RunNetcheck, it's also set if there was no time to wait for the
+	// new netcheck, in which case Report is the previous one.
+	Incomplete bool
+}
+
+// LastNetcheck returns the most recent netcheck's report, without running
+// one.
+func (c *Conn) LastNetcheck() NetcheckReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return NetcheckReport{
+		Report:     c.lastNetCheckReport.Load().Clone(),
+		At:         c.lastNetCheckAt,
+		Incomplete: c.lastNetCheckIncomplete,
+	}
+}
+
+// RunNetcheck runs a full netcheck, updating the node's endpoints and home
+// DERP region as the periodic ones do, and returns its report. If ctx is
+// done first, it returns the previous report, marked Incomplete.
+func (c *Conn) RunNetcheck(ctx context.Context) (NetcheckReport, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return NetcheckReport{}, errConnClosed
+	}
+	last := c.LastNetcheck().At
+	c.netChecker.MakeNextReportFull()
+	c.ReSTUN("netcheck-requested")
+
+	t := time.NewTicker(derpFailoverPollInterval)
+	defer t.Stop()
+	for {
+		r := c.LastNetcheck()
+		if !r.At.Equal(last) {
+			return r, nil
+		}
+		select {
+		case <-ctx.Done():
+			r.Incomplete = true
+			return r, nil
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tailscale.com/net/netcheck"
+)
+
+func TestLastNetcheck(t *testing.T) {
+	c := newConn()
+	if r := c.LastNetcheck(); r.Report != nil || !r.At.IsZero() || r.Incomplete {
+		t.Errorf("before netcheck: got %+v; want zero", r)
+	}
+
+	at := time.Now()
+	c.lastNetCheckReport.Store(&netcheck.Report{
+		UDP:           true,
+		PreferredDERP: 1,
+		RegionLatency: map[int]time.Duration{1: 15 * time.Millisecond},
+	})
+	c.lastNetCheckAt = at
+	c.lastNetCheckIncomplete = true
+	r := c.LastNetcheck()
+	if r.Report == nil || !r.Report.UDP || r.Report.PreferredDERP != 1 {
+		t.Fatalf("got report %+v; want the stored one", r.Report)
+	}
+	if !r.At.Equal(at) || !r.Incomplete {
+		t.Errorf("got At %v, Incomplete %v; want %v, true", r.At, r.Incomplete, at)
+	}
+	// The report is a copy.
+	r.Report.RegionLatency[1] = time.Second
+	if d := c.lastNetCheckReport.Load().RegionLatency[1]; d != 15*time.Millisecond {
+		t.Errorf("stored region 1 latency = %v after modifying the returned report; want 15ms", d)
+	}
+}
+
+func TestRunNetcheckClosed(t *testing.T) {
+	c := newConn()
+	c.closed = true
+	if _, err := c.RunNetcheck(context.Background()); !errors.Is(err, errConnClosed) {
+		t.Errorf("got error %v; want %v", err, errConnClosed)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+// maxPathComparePings is the most pings per path that ComparePaths sends.
+const maxPathComparePings = 20
+
+// PathRTTs are the round trip times measured over one path to a peer.
+type PathRTTs struct {
+	Addr netip.AddrPort  // the path; zero if there's none
+	RTTs []time.Duration // of the pings that were answered
+	Lost int             // pings that weren't answered
+	Mean time.Duration   `json:",omitempty"` // of RTTs
+}
+
+// ComparePaths pings peer count times (at most maxPathComparePings) over
+// both its current direct path, if any, and its DERP path, one ping per
+// path at a time, to compare their round trip times. ctx bounds how long
+// it waits for pongs.
+func (c *Conn) ComparePaths(ctx context.Context, peer key.NodePublic, count int) (direct, derp PathRTTs, err error) {
+	count = min(max(1, count), maxPathComparePings)
+	c.mu.Lock()
+	if c.privateKey.IsZero() {
+		c.mu.Unlock()
+		return direct, derp, errors.New("tailscaled stopped")
+	}
+	de, ok := c.peerMap.endpointForNodeKey(peer)
+	c.mu.Unlock()
+	if !ok {
+		return direct, derp, errors.New("unknown peer")
+	}
+	de.mu.Lock()
+	if de.expired {
+		de.mu.Unlock()
+		return direct, derp, errExpired
+	}
+	direct.Addr = de.bestAddr.AddrPort
+	derp.Addr = de.derpAddr
+	de.mu.Unlock()
+
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		var wg sync.WaitGroup
+		for _, p := range []*PathRTTs{&direct, &derp} {
+			if !p.Addr.IsValid() {
+				continue
+			}
+			wg.Add(1)
+			go func(p *PathRTTs) {
+				defer wg.Done()
+				if d, ok := de.pingAddr(ctx, p.Addr); ok {
+					p.RTTs = append(p.RTTs, d)
+				} else {
+					p.Lost++
+				}
+			}(p)
+		}
+		wg.Wait()
+	}
+	direct.Mean = meanDuration(direct.RTTs)
+	derp.Mean = meanDuration(derp.RTTs)
+	return direct, derp, nil
+}
+
+// pingAddr sends a single disco ping to de at addr, which may be a DERP
+// address, and returns its round trip time. It reports ok=false if there's
+// no pong before the ping times out or ctx is done.
+func (de *endpoint) pingAddr(ctx context.Context, addr netip.AddrPort) (rtt time.Duration, ok bool) {
+	pong := make(chan time.Duration, 1)
+	de.mu.Lock()
+	de.startDiscoPingLocked(addr, mono.Now(), pingCLI, 0, new(ipnstate.PingResult), func(res *ipnstate.PingResult) {
+		pong <- time.Duration(res.LatencySeconds * float64(time.Second))
+	})
+	de.mu.Unlock()
+	t := time.NewTimer(pingTimeoutDuration)
+	defer t.Stop()
+	select {
+	case d := <-pong:
+		return d, true
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return 0, false
+}
+
+func meanDuration(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return sum / time.Duration(len(ds))
+}
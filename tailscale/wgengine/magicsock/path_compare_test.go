@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+func TestComparePathsErrors(t *testing.T) {
+	c := newConn()
+	peer := key.NewNode().Public()
+	if _, _, err := c.ComparePaths(context.Background(), peer, 1); err == nil {
+		t.Error("no error with tailscaled stopped")
+	}
+	c.privateKey = key.NewNode()
+	if _, _, err := c.ComparePaths(context.Background(), peer, 1); err == nil {
+		t.Error("no error for unknown peer")
+	}
+}
+
+func TestMeanDuration(t *testing.T) {
+	if got := meanDuration(nil); got != 0 {
+		t.Errorf("meanDuration(nil) = %v; want 0", got)
+	}
+	if got := meanDuration([]time.Duration{time.Millisecond, 3 * time.Millisecond}); got != 2*time.Millisecond {
+		t.Errorf("meanDuration = %v; want 2ms", got)
+	}
+}
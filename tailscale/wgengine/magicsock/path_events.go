@@ -0,0 +1,137 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+// PathEvent reasons, as used in PathEvent.Reason.
+const (
+	PathReasonPong            = "pong"              // a disco pong confirmed a better direct path
+	PathReasonExpired         = "expired"           // the direct path wasn't reconfirmed in time; noted at the next heartbeat
+	PathReasonEndpointDeleted = "endpoint-deleted"  // the direct path's endpoint went away
+	PathReasonSendError       = "send-error"        // sending over the direct path failed
+	PathReasonLinkChange      = "link-change"       // our network changed
+	PathReasonReset           = "reset"             // the peer's p2p state was reset
+	PathReasonDERPHomeChanged = "derp-home-changed" // via DERP, and the peer's home DERP changed
+)
+
+// pathEventBufferSize is how many PathEvents a subscriber can fall behind
+// by before further events are dropped for it.
+const pathEventBufferSize = 128
+
+// PathEvent is a change in the path that traffic to a peer takes, as
+// delivered to subscribers of SubscribePathEvents. This is not a stable
+// interface and could change at any time.
+type PathEvent struct {
+	Time time.Time      `json:"time"`
+	Peer key.NodePublic `json:"peer"`
+
+	// OldAddr and NewAddr are the path before and after: a direct UDP
+	// address, or a magic DERP address if via DERP. Either is zero if
+	// there was no path.
+	OldAddr netip.AddrPort `json:"oldAddr"`
+	NewAddr netip.AddrPort `json:"newAddr"`
+
+	Reason  string `json:"reason"`            // one of the PathReason* constants
+	Purpose string `json:"purpose,omitempty"` // for PathReasonPong, the ping's discoPingPurpose
+}
+
+// pathEventSub is a subscriber to a Conn's PathEvents.
+type pathEventSub struct {
+	ch      chan PathEvent
+	dropped atomic.Int64
+}
+
+// pathEvents is the set of subscribers to a Conn's PathEvents.
+type pathEvents struct {
+	n    atomic.Int32 // len(subs), for checking without mu
+	mu   sync.Mutex
+	subs map[*pathEventSub]bool
+}
+
+// SubscribePathEvents returns a channel on which c's PathEvents are
+// delivered as they happen, until unsubscribe is called. Events are dropped
+// if the subscriber falls too far behind, rather than slowing down
+// magicsock; unsubscribe returns how many were.
+func (c *Conn) SubscribePathEvents() (events <-chan PathEvent, unsubscribe func() (dropped int64)) {
+	s := &pathEventSub{ch: make(chan PathEvent, pathEventBufferSize)}
+	e := &c.pathEvents
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subs == nil {
+		e.subs = make(map[*pathEventSub]bool)
+	}
+	e.subs[s] = true
+	e.n.Store(int32(len(e.subs)))
+	return s.ch, func() int64 {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subs, s)
+		e.n.Store(int32(len(e.subs)))
+		return s.dropped.Load()
+	}
+}
+
+// emitPathEvent delivers ev to c's PathEvent subscribers, if any.
+// It may be called with any locks held.
+func (c *Conn) emitPathEvent(ev PathEvent) {
+	e := &c.pathEvents
+	if e.n.Load() == 0 {
+		return
+	}
+	ev.Time = time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for s := range e.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped.Add(1)
+			metricPathEventsDropped.Add(1)
+		}
+	}
+}
+
+// pathLocked returns the path that traffic to de takes as of now: its best
+// direct address if that's trusted, or otherwise its DERP address.
+//
+// de.mu must be held.
+func (de *endpoint) pathLocked(now mono.Time) netip.AddrPort {
+	if de.bestAddr.IsValid() && !now.After(de.trustBestAddrUntil) {
+		return de.bestAddr.AddrPort
+	}
+	return de.derpAddr
+}
+
+// notePathLocked emits a PathEvent for de if its path has changed since it
+// was last noted, for the given reason (and ping purpose, if any).
+// WireGuard-only peers have no DERP path to change to or from, and so are
+// ignored.
+//
+// de.mu must be held.
+func (de *endpoint) notePathLocked(now mono.Time, reason, purpose string) {
+	if de.isWireguardOnly {
+		return
+	}
+	p := de.pathLocked(now)
+	if p == de.lastPath {
+		return
+	}
+	de.c.emitPathEvent(PathEvent{
+		Peer:    de.publicKey,
+		OldAddr: de.lastPath,
+		NewAddr: p,
+		Reason:  reason,
+		Purpose: purpose,
+	})
+	de.lastPath = p
+}
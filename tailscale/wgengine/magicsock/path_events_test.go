@@ -0,0 +1,79 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime/mono"
+)
+
+func TestPathEvents(t *testing.T) {
+	c := &Conn{logf: t.Logf}
+	c.emitPathEvent(PathEvent{Reason: PathReasonPong}) // no subscribers; no-op
+
+	events, unsubscribe := c.SubscribePathEvents()
+
+	derp := netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 1)
+	direct := netip.MustParseAddrPort("1.2.3.4:5")
+	de := &endpoint{c: c, derpAddr: derp}
+	now := mono.Now()
+	next := func() PathEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		default:
+			t.Fatal("no event")
+		}
+		panic("unreachable")
+	}
+
+	de.notePathLocked(now, PathReasonDERPHomeChanged, "")
+	if ev := next(); ev.OldAddr.IsValid() || ev.NewAddr != derp || ev.Reason != PathReasonDERPHomeChanged || ev.Time.IsZero() {
+		t.Errorf("initial DERP: got %+v", ev)
+	}
+
+	de.bestAddr = addrLatency{AddrPort: direct}
+	de.trustBestAddrUntil = now.Add(trustUDPAddrDuration)
+	de.notePathLocked(now, PathReasonPong, pingDiscovery.String())
+	if ev := next(); ev.OldAddr != derp || ev.NewAddr != direct || ev.Reason != PathReasonPong || ev.Purpose != "Discovery" {
+		t.Errorf("to direct: got %+v", ev)
+	}
+
+	// Nothing changes until the direct path expires, which the next
+	// heartbeat notices, rather than sends. (The session's idle, so the
+	// heartbeats stop there.)
+	de.lastSend = now.Add(-sessionActiveTimeout - time.Second)
+	de.heartbeat()
+	if len(events) != 0 {
+		t.Errorf("got %+v; want no event while direct path is trusted", next())
+	}
+	de.trustBestAddrUntil = now.Add(-time.Second)
+	de.addrForSendLocked(now)
+	if len(events) != 0 {
+		t.Errorf("got %+v; want no event from a send", next())
+	}
+	de.heartbeat()
+	if ev := next(); ev.OldAddr != direct || ev.NewAddr != derp || ev.Reason != PathReasonExpired {
+		t.Errorf("expired: got %+v", ev)
+	}
+
+	// A subscriber that falls behind loses events rather than blocking.
+	for i := 0; i < pathEventBufferSize+10; i++ {
+		c.emitPathEvent(PathEvent{Reason: PathReasonReset})
+	}
+	if n := len(events); n != pathEventBufferSize {
+		t.Errorf("buffered %d events; want %d", n, pathEventBufferSize)
+	}
+	if dropped := unsubscribe(); dropped != 10 {
+		t.Errorf("dropped %d events; want 10", dropped)
+	}
+	if n := c.pathEvents.n.Load(); n != 0 {
+		t.Errorf("%d subscribers after unsubscribe; want 0", n)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"time"
+
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+// PingOutcome is what became of a disco ping that we sent.
+type PingOutcome struct {
+	Purpose string         // such as "Heartbeat"; see discoPingPurpose
+	To      netip.AddrPort // a magic DERP address if via DERP
+	At      time.Time      // when the pong arrived, or the ping timed out
+
+	// Pong is whether the peer answered it, in Latency. If not, it timed
+	// out.
+	Pong    bool
+	Latency time.Duration `json:",omitempty"`
+}
+
+// PeerState is a summary of magicsock's state for a peer: which path it's
+// using, and why. This is not a stable interface and could change at any
+// time.
+type PeerState struct {
+	Peer key.NodePublic
+
+	// BestAddr is the direct path that's been found for the peer, if any.
+	// Direct is whether traffic is being sent over it; if not, it goes
+	// via DERP, using DERPRegion.
+	BestAddr   netip.AddrPort
+	Direct     bool
+	DERPRegion int
+
+	// Active is whether we've sent the peer traffic recently. LastSend
+	// and LastRecv are when we last sent and received it, if ever.
+	Active   bool
+	LastSend time.Time
+	LastRecv time.Time
+
+	// LastPing is the outcome of the most recent disco ping to the peer
+	// that's been answered or has timed out, if any.
+	LastPing *PingOutcome `json:",omitempty"`
+}
+
+// notePingOutcomeLocked records the outcome of sp, a disco ping that was
+// answered with the given latency if pong, or otherwise timed out.
+//
+// de.mu must be held.
+func (de *endpoint) notePingOutcomeLocked(sp sentPing, pong bool, latency time.Duration, now mono.Time) {
+	de.lastPingOutcome = &PingOutcome{
+		Purpose: sp.purpose.String(),
+		To:      sp.to,
+		At:      now.WallTime(),
+		Pong:    pong,
+		Latency: latency,
+	}
+}
+
+// peerStateLocked returns de's PeerState as of now.
+//
+// de.mu must be held.
+func (de *endpoint) peerStateLocked(now mono.Time) PeerState {
+	ps := PeerState{
+		Peer:       de.publicKey,
+		BestAddr:   de.bestAddr.AddrPort,
+		DERPRegion: int(de.derpAddr.Port()),
+		Active:     !de.lastSend.IsZero() && now.Sub(de.lastSend) < sessionActiveTimeout,
+	}
+	// Like addrForSendLocked, without its side effects for WireGuard-only
+	// peers, which are always direct.
+	ps.Direct = de.isWireguardOnly || (de.bestAddr.IsValid() && !now.After(de.trustBestAddrUntil))
+	if !de.lastSend.IsZero() {
+		ps.LastSend = de.lastSend.WallTime()
+	}
+	if lastRecv := de.lastRecv.LoadAtomic(); !lastRecv.IsZero() {
+		ps.LastRecv = lastRecv.WallTime()
+	}
+	if de.lastPingOutcome != nil {
+		po := *de.lastPingOutcome
+		ps.LastPing = &po
+	}
+	return ps
+}
+
+// PeerStates returns the state of each peer, or if activeOnly, of each peer
+// that we've sent traffic to recently.
+func (c *Conn) PeerStates(activeOnly bool) []PeerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := mono.Now()
+	var ret []PeerState
+	c.peerMap.forEachEndpoint(func(ep *endpoint) {
+		ep.mu.Lock()
+		defer ep.mu.Unlock()
+		if ps := ep.peerStateLocked(now); ps.Active || !activeOnly {
+			ret = append(ret, ps)
+		}
+	})
+	return ret
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/disco"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/net/stun"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime/mono"
+	"tailscale.com/util/ringbuffer"
+)
+
+func TestPeerState(t *testing.T) {
+	c := &Conn{logf: t.Logf}
+	direct := netip.MustParseAddrPort("1.2.3.4:567")
+	now := mono.Now()
+	de := &endpoint{
+		c:              c,
+		debugUpdates:   ringbuffer.New[EndpointChange](1),
+		derpAddr:       netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 7),
+		sentPing:       map[stun.TxID]sentPing{},
+		lastSend:       now,
+		heartBeatTimer: time.AfterFunc(time.Hour, func() {}),
+	}
+	defer de.heartBeatTimer.Stop()
+
+	ps := de.peerStateLocked(now)
+	if ps.Direct || ps.BestAddr.IsValid() || ps.DERPRegion != 7 || !ps.Active || ps.LastPing != nil {
+		t.Fatalf("before any pong, state = %+v; want idle DERP path", ps)
+	}
+
+	ping := func(purpose discoPingPurpose) stun.TxID {
+		txid := stun.NewTxID()
+		de.sentPing[txid] = sentPing{
+			to:      direct,
+			at:      now,
+			timer:   time.AfterFunc(time.Hour, func() {}),
+			purpose: purpose,
+		}
+		return txid
+	}
+
+	// A timed out ping is recorded, without changing the path.
+	de.discoPingTimeout(ping(pingDiscovery))
+	ps = de.peerStateLocked(now)
+	if ps.LastPing == nil || ps.LastPing.Pong || ps.LastPing.Purpose != "Discovery" || ps.LastPing.To != direct {
+		t.Errorf("after timeout, LastPing = %+v; want timed out Discovery", ps.LastPing)
+	}
+	if ps.Direct {
+		t.Errorf("after timeout, Direct = true")
+	}
+
+	// A pong makes the path direct.
+	de.endpointState = map[netip.AddrPort]*endpointState{direct: {}}
+	if !de.handlePongConnLocked(&disco.Pong{TxID: ping(pingDiscovery), Src: direct}, nil, direct) {
+		t.Fatal("pong not for a known ping")
+	}
+	ps = de.peerStateLocked(mono.Now())
+	if !ps.Direct || ps.BestAddr != direct {
+		t.Errorf("after pong, state = %+v; want direct via %v", ps, direct)
+	}
+	if ps.LastPing == nil || !ps.LastPing.Pong || ps.LastPing.Latency <= 0 {
+		t.Errorf("after pong, LastPing = %+v; want answered", ps.LastPing)
+	}
+
+	// Once the path is no longer trusted, it's back to DERP, and an idle
+	// peer is no longer active.
+	later := mono.Now().Add(sessionActiveTimeout + trustUDPAddrDuration)
+	if ps := de.peerStateLocked(later); ps.Direct || ps.Active {
+		t.Errorf("later, state = %+v; want inactive DERP path", ps)
+	}
+}
+
+func TestCLIPingResultPurpose(t *testing.T) {
+	c := &Conn{logf: t.Logf}
+	direct := netip.MustParseAddrPort("1.2.3.4:567")
+	de := &endpoint{
+		c:              c,
+		debugUpdates:   ringbuffer.New[EndpointChange](1),
+		endpointState:  map[netip.AddrPort]*endpointState{direct: {}},
+		sentPing:       map[stun.TxID]sentPing{},
+		heartBeatTimer: time.AfterFunc(time.Hour, func() {}),
+	}
+	defer de.heartBeatTimer.Stop()
+
+	txid := stun.NewTxID()
+	res := new(ipnstate.PingResult)
+	done := make(chan *ipnstate.PingResult, 1)
+	de.sentPing[txid] = sentPing{
+		to:      direct,
+		at:      mono.Now(),
+		timer:   time.AfterFunc(time.Hour, func() {}),
+		purpose: pingCLI,
+		res:     res,
+		cb:      func(res *ipnstate.PingResult) { done <- res },
+	}
+	if !de.handlePongConnLocked(&disco.Pong{TxID: txid, Src: direct}, nil, direct) {
+		t.Fatal("pong not for a known ping")
+	}
+	select {
+	case res := <-done:
+		if res.Purpose != "CLI" || res.Endpoint != direct.String() {
+			t.Errorf("got Purpose %q, Endpoint %q; want CLI, %v", res.Purpose, res.Endpoint, direct)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the ping result")
+	}
+}
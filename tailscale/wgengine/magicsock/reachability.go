@@ -0,0 +1,101 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+// inboundPingFreshness is how recently a peer must have sent us a disco ping
+// over a direct path for us to consider that it can reach us directly. Peers
+// heartbeat a direct path they're using every heartbeatInterval, so this
+// allows for a few lost pings.
+const inboundPingFreshness = heartbeatLossTimeout
+
+// PeerReachability is whether there's a direct path between us and a peer,
+// in each direction. Outbound reachability is known from the peer's pongs to
+// our pings; inbound reachability is inferred from the peer's pings to us,
+// which it only sends while it's discovering or using a path. The two
+// differing usually means a NAT or firewall that lets traffic through in
+// only one direction. This is not a stable interface and could change at
+// any time.
+type PeerReachability struct {
+	Peer key.NodePublic
+
+	// Outbound is whether we have a validated direct path to the peer.
+	// OutboundAddr is that path, and LastPong is when the peer last
+	// answered one of our pings on any path (LastPongFrom).
+	Outbound     bool
+	OutboundAddr netip.AddrPort
+	LastPong     time.Time
+	LastPongFrom netip.AddrPort
+
+	// Inbound is whether the peer has recently pinged us over a direct
+	// path. LastPing is when it last pinged us on any path (LastPingFrom,
+	// which is a magic DERP address if via DERP).
+	Inbound      bool
+	LastPing     time.Time
+	LastPingFrom netip.AddrPort
+}
+
+// notePingRecvLocked records that de sent us a disco ping from src.
+//
+// de.mu must be held.
+func (de *endpoint) notePingRecvLocked(src netip.AddrPort, now mono.Time) {
+	de.lastPingRecv = now
+	de.lastPingRecvFrom = src
+}
+
+// notePongRecvLocked records that de answered our disco ping from src.
+//
+// de.mu must be held.
+func (de *endpoint) notePongRecvLocked(src netip.AddrPort, now mono.Time) {
+	de.lastPongRecv = now
+	de.lastPongRecvFrom = src
+}
+
+// reachabilityLocked returns de's PeerReachability as of now.
+//
+// de.mu must be held.
+func (de *endpoint) reachabilityLocked(now mono.Time) PeerReachability {
+	r := PeerReachability{
+		Peer:         de.publicKey,
+		LastPongFrom: de.lastPongRecvFrom,
+		LastPingFrom: de.lastPingRecvFrom,
+	}
+	if de.bestAddr.AddrPort.IsValid() && now.Before(de.trustBestAddrUntil) {
+		r.Outbound = true
+		r.OutboundAddr = de.bestAddr.AddrPort
+	}
+	if de.lastPingRecvFrom.IsValid() && de.lastPingRecvFrom.Addr() != tailcfg.DerpMagicIPAddr {
+		r.Inbound = now.Sub(de.lastPingRecv) < inboundPingFreshness
+	}
+	if de.lastPongRecv != 0 {
+		r.LastPong = de.lastPongRecv.WallTime()
+	}
+	if de.lastPingRecv != 0 {
+		r.LastPing = de.lastPingRecv.WallTime()
+	}
+	return r
+}
+
+// PeerReachability returns the direct reachability of each peer, in both
+// directions.
+func (c *Conn) PeerReachability() []PeerReachability {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := mono.Now()
+	var ret []PeerReachability
+	c.peerMap.forEachEndpoint(func(ep *endpoint) {
+		ep.mu.Lock()
+		defer ep.mu.Unlock()
+		ret = append(ret, ep.reachabilityLocked(now))
+	})
+	return ret
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime/mono"
+)
+
+func TestReachability(t *testing.T) {
+	direct := netip.MustParseAddrPort("1.2.3.4:567")
+	viaDERP := netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 1)
+	now := mono.Now()
+
+	de := &endpoint{}
+	if r := de.reachabilityLocked(now); r.Outbound || r.Inbound || !r.LastPing.IsZero() {
+		t.Fatalf("new endpoint reachability = %+v; want none", r)
+	}
+
+	// We reach them directly, but they only reach us via DERP.
+	de.bestAddr = addrLatency{AddrPort: direct}
+	de.trustBestAddrUntil = now.Add(trustUDPAddrDuration)
+	de.notePongRecvLocked(direct, now)
+	de.notePingRecvLocked(viaDERP, now)
+	r := de.reachabilityLocked(now)
+	if !r.Outbound || r.OutboundAddr != direct || r.LastPongFrom != direct {
+		t.Errorf("outbound = %+v; want direct via %v", r, direct)
+	}
+	if r.Inbound || r.LastPingFrom != viaDERP {
+		t.Errorf("inbound = %+v; want DERP only", r)
+	}
+
+	// Once they ping us directly, they reach us until the ping goes
+	// stale; likewise our path to them once it's no longer trusted.
+	de.notePingRecvLocked(direct, now)
+	if r := de.reachabilityLocked(now); !r.Inbound {
+		t.Errorf("after direct ping, Inbound = false")
+	}
+	later := now.Add(inboundPingFreshness + time.Second)
+	if r := de.reachabilityLocked(later); r.Inbound || r.Outbound {
+		t.Errorf("after timeout, reachability = %+v; want none", r)
+	}
+}
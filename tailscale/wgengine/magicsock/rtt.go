@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"time"
+
+	"tailscale.com/util/ringbuffer"
+)
+
+// maxRTTSamples is the number of RTTSamples retained per peer.
+const maxRTTSamples = 32
+
+// RTTSample is a single round-trip time measured by a disco ping to a
+// peer. This is not a stable interface and could change at any time.
+type RTTSample struct {
+	When    time.Time      // when the pong was received
+	Addr    netip.AddrPort // where the ping was sent; a magic DERP address if DERP
+	DERP    bool           // whether the ping went via DERP
+	Latency time.Duration
+	Purpose string // the ping's purpose ("Discovery", "Heartbeat", "CLI", "MTU")
+}
+
+// addRTTSampleLocked records the latency of the pong answering sp.
+//
+// de.mu must be held.
+func (de *endpoint) addRTTSampleLocked(sp sentPing, isDerp bool, latency time.Duration, now time.Time) {
+	if de.rttSamples == nil {
+		// Allocated lazily so that peers we never ping cost nothing.
+		de.rttSamples = ringbuffer.New[RTTSample](maxRTTSamples)
+	}
+	de.rttSamples.Add(RTTSample{
+		When:    now,
+		Addr:    sp.to,
+		DERP:    isDerp,
+		Latency: latency,
+		Purpose: sp.purpose.String(),
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAddRTTSample(t *testing.T) {
+	de := &endpoint{}
+	addr := netip.MustParseAddrPort("1.2.3.4:567")
+	start := time.Now()
+	for i := 0; i < maxRTTSamples+5; i++ {
+		sp := sentPing{to: addr, purpose: pingHeartbeat}
+		de.addRTTSampleLocked(sp, false, time.Duration(i)*time.Millisecond, start.Add(time.Duration(i)*time.Second))
+	}
+	got := de.rttSamples.GetAll()
+	if len(got) != maxRTTSamples {
+		t.Fatalf("got %d samples; want %d", len(got), maxRTTSamples)
+	}
+	// Oldest samples are dropped first.
+	if got[0].Latency != 5*time.Millisecond {
+		t.Errorf("oldest latency = %v; want 5ms", got[0].Latency)
+	}
+	if got[0].Purpose != "Heartbeat" || got[0].Addr != addr || got[0].DERP {
+		t.Errorf("unexpected sample %+v", got[0])
+	}
+}
@@ -48,6 +48,7 @@
 	"tailscale.com/types/logger"
 	"tailscale.com/types/netmap"
 	"tailscale.com/types/nettype"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/version/distro"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/filter"
@@ -549,6 +550,14 @@ func (ns *Impl) peerAPIPortAtomic(ip netip.Addr) *atomic.Uint32 {
 
 var viaRange = tsaddr.TailscaleViaRange()
 
+// Metrics for 4via6 translations, by protocol. Their names all start with
+// "netstack_4via6_".
+var (
+	metric4via6TCP  = clientmetric.NewCounter("netstack_4via6_tcp")
+	metric4via6UDP  = clientmetric.NewCounter("netstack_4via6_udp")
+	metric4via6Ping = clientmetric.NewCounter("netstack_4via6_ping")
+)
+
 // shouldProcessInbound reports whether an inbound packet (a packet from a
 // WireGuard peer) should be handled by netstack.
 func (ns *Impl) shouldProcessInbound(p *packet.Parsed, t *tstun.Wrapper) bool {
@@ -768,6 +777,7 @@ func (ns *Impl) shouldHandlePing(p *packet.Parsed) (_ netip.Addr, ok bool) {
 		// IPv4 and expect to get a useful result. However, in this specific
 		// case things are safe because the 'userPing' function doesn't make
 		// use of the input packet.
+		metric4via6Ping.Add(1)
 		return tsaddr.UnmapVia(destIP), true
 	}
 
@@ -822,6 +832,7 @@ func (ns *Impl) acceptTCP(r *tcp.ForwarderRequest) {
 	if viaRange.Contains(dialIP) {
 		isTailscaleIP = false
 		dialIP = tsaddr.UnmapVia(dialIP)
+		metric4via6TCP.Add(1)
 	}
 
 	defer func() {
@@ -1098,6 +1109,7 @@ func (ns *Impl) forwardUDP(client *gonet.UDPConn, clientAddr, dstAddr netip.Addr
 	} else {
 		if dstIP := dstAddr.Addr(); viaRange.Contains(dstIP) {
 			dstAddr = netip.AddrPortFrom(tsaddr.UnmapVia(dstIP), dstAddr.Port())
+			metric4via6UDP.Add(1)
 		}
 		backendRemoteAddr = net.UDPAddrFromAddrPort(dstAddr)
 		if dstAddr.Addr().Is4() {
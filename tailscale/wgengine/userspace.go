@@ -13,6 +13,7 @@
 	"math"
 	"net/netip"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -946,6 +947,37 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 	return nil
 }
 
+func (e *userspaceEngine) PeerAllowedIPs(k key.NodePublic) ([]netip.Prefix, bool) {
+	e.wgLock.Lock()
+	defer e.wgLock.Unlock()
+	for _, p := range e.lastCfgFull.Peers {
+		if p.PublicKey == k {
+			return slices.Clone(p.AllowedIPs), true
+		}
+	}
+	return nil, false
+}
+
+func (e *userspaceEngine) PeerHandshakeStats(k key.NodePublic, reset bool) wglog.HandshakeStats {
+	return e.wgLogger.PeerHandshakeStats(k, reset)
+}
+
+func (e *userspaceEngine) WireGuardConfig() (*wgcfg.Config, map[key.NodePublic]ipnstate.PeerStatusLite) {
+	e.wgLock.Lock()
+	cfg := e.lastCfgFull.Clone()
+	e.wgLock.Unlock()
+	live := make(map[key.NodePublic]ipnstate.PeerStatusLite)
+	for _, p := range cfg.Peers {
+		if st, ok := e.getPeerStatusLite(p.PublicKey); ok {
+			if st.LastHandshake.UnixNano() == 0 {
+				st.LastHandshake = time.Time{} // never
+			}
+			live[p.PublicKey] = st
+		}
+	}
+	return cfg, live
+}
+
 func (e *userspaceEngine) GetFilter() *filter.Filter {
 	return e.tundev.GetFilter()
 }
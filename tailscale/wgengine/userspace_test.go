@@ -147,6 +147,18 @@ func TestUserspaceEngineReconfig(t *testing.T) {
 		if got := ue.trimmedNodes; !reflect.DeepEqual(got, wantTrimmedNodes) {
 			t.Errorf("wrong wantTrimmedNodes\n got: %v\nwant: %v\n", got, wantTrimmedNodes)
 		}
+
+		if got, ok := e.PeerAllowedIPs(nk); !ok || !reflect.DeepEqual(got, cfg.Peers[0].AllowedIPs) {
+			t.Errorf("PeerAllowedIPs = %v, %v; want %v, true", got, ok, cfg.Peers[0].AllowedIPs)
+		}
+
+		// The peer is trimmed, as it's idle, so it isn't live.
+		if got, live := e.WireGuardConfig(); !reflect.DeepEqual(got, cfg) || len(live) != 0 {
+			t.Errorf("WireGuardConfig = %+v, %v; want %+v, no live peers", got, live, cfg)
+		}
+	}
+	if _, ok := e.PeerAllowedIPs(key.NewNode().Public()); ok {
+		t.Error("PeerAllowedIPs found unknown peer")
 	}
 }
 
@@ -24,6 +24,7 @@
 	"tailscale.com/wgengine/filter"
 	"tailscale.com/wgengine/router"
 	"tailscale.com/wgengine/wgcfg"
+	"tailscale.com/wgengine/wglog"
 )
 
 // NewWatchdog wraps an Engine and makes sure that all methods complete
@@ -122,6 +123,18 @@ func (e *watchdogEngine) watchdog(name string, fn func()) {
 func (e *watchdogEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config, dnsCfg *dns.Config) error {
 	return e.watchdogErr("Reconfig", func() error { return e.wrap.Reconfig(cfg, routerCfg, dnsCfg) })
 }
+func (e *watchdogEngine) PeerAllowedIPs(k key.NodePublic) (ips []netip.Prefix, ok bool) {
+	e.watchdog("PeerAllowedIPs", func() { ips, ok = e.wrap.PeerAllowedIPs(k) })
+	return ips, ok
+}
+func (e *watchdogEngine) PeerHandshakeStats(k key.NodePublic, reset bool) (hs wglog.HandshakeStats) {
+	e.watchdog("PeerHandshakeStats", func() { hs = e.wrap.PeerHandshakeStats(k, reset) })
+	return hs
+}
+func (e *watchdogEngine) WireGuardConfig() (cfg *wgcfg.Config, live map[key.NodePublic]ipnstate.PeerStatusLite) {
+	e.watchdog("WireGuardConfig", func() { cfg, live = e.wrap.WireGuardConfig() })
+	return cfg, live
+}
 func (e *watchdogEngine) GetFilter() *filter.Filter {
 	return e.wrap.GetFilter()
 }
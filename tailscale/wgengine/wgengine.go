@@ -17,6 +17,7 @@
 	"tailscale.com/wgengine/filter"
 	"tailscale.com/wgengine/router"
 	"tailscale.com/wgengine/wgcfg"
+	"tailscale.com/wgengine/wglog"
 )
 
 // Status is the Engine status.
@@ -79,6 +80,22 @@ type Engine interface {
 	// if any. If none is found, (nil, false) is returned.
 	PeerForIP(netip.Addr) (_ PeerForIP, ok bool)
 
+	// PeerAllowedIPs returns the allowed IPs most recently configured for
+	// the peer with the given node key, as passed to Reconfig. It reports
+	// ok=false if the peer isn't in that config.
+	PeerAllowedIPs(key.NodePublic) (_ []netip.Prefix, ok bool)
+
+	// PeerHandshakeStats returns the outcomes of the WireGuard handshakes
+	// initiated with the peer with the given node key. If reset, they're
+	// zeroed after being read.
+	PeerHandshakeStats(_ key.NodePublic, reset bool) wglog.HandshakeStats
+
+	// WireGuardConfig returns a copy of the WireGuard config most recently
+	// passed to Reconfig, and the status of each of its peers that's
+	// currently configured in wireguard-go (which idle peers are trimmed
+	// from). A live peer's LastHandshake is zero if it's never had one.
+	WireGuardConfig() (_ *wgcfg.Config, live map[key.NodePublic]ipnstate.PeerStatusLite)
+
 	// GetFilter returns the current packet filter, if any.
 	GetFilter() *filter.Filter
 
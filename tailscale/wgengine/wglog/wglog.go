@@ -8,6 +8,7 @@
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tailscale/wireguard-go/device"
 	"tailscale.com/syncs"
@@ -21,8 +22,44 @@
 type Logger struct {
 	DeviceLogger *device.Logger
 	replace      syncs.AtomicValue[map[string]string]
-	mu           sync.Mutex                   // protects strs
-	strs         map[key.NodePublic]*strCache // cached strs used to populate replace
+	keys         syncs.AtomicValue[map[string]key.NodePublic] // wireguard-go peer string to key
+	mu           sync.Mutex                                   // protects strs and handshakes
+	strs         map[key.NodePublic]*strCache                 // cached strs used to populate replace
+	handshakes   map[key.NodePublic]*HandshakeStats
+}
+
+// HandshakeStats counts the outcomes of the WireGuard handshakes that
+// wireguard-go initiated with a peer, as learned from its logs.
+type HandshakeStats struct {
+	Successes   int64     // handshake responses received
+	Retries     int64     // handshakes that timed out and were retried
+	Failures    int64     // handshakes given up on after too many retries
+	LastSuccess time.Time `json:",omitempty"`
+	LastFailure time.Time `json:",omitempty"` // of the last retry or failure
+}
+
+// handshakeOutcome is the outcome of a handshake, as logged by wireguard-go.
+type handshakeOutcome int
+
+const (
+	handshakeSuccess handshakeOutcome = iota + 1
+	handshakeRetry
+	handshakeFailure
+)
+
+// handshakeOutcomeOf returns the outcome that wireguard-go's log message
+// format reports, or zero if it isn't about a handshake's outcome.
+func handshakeOutcomeOf(format string) handshakeOutcome {
+	switch {
+	case strings.Contains(format, "Received handshake response"):
+		return handshakeSuccess
+	case strings.Contains(format, "Handshake did not complete"):
+		if strings.Contains(format, "giving up") {
+			return handshakeFailure
+		}
+		return handshakeRetry
+	}
+	return 0
 }
 
 // strCache holds a wireguard-go and a Tailscale style peer string.
@@ -52,6 +89,9 @@ func NewLogger(logf logger.Logf) *Logger {
 			// See https://github.com/tailscale/tailscale/issues/1388.
 			return
 		}
+		if o := handshakeOutcomeOf(format); o != 0 && len(args) > 0 {
+			ret.noteHandshake(args[0], o)
+		}
 		replace := ret.replace.Load()
 		if replace == nil {
 			// No replacements specified; log as originally planned.
@@ -85,6 +125,56 @@ func NewLogger(logf logger.Logf) *Logger {
 		Errorf:   logger.WithPrefix(wrapper, prefix),
 	}
 	ret.strs = make(map[key.NodePublic]*strCache)
+	ret.handshakes = make(map[key.NodePublic]*HandshakeStats)
+	return ret
+}
+
+// noteHandshake records outcome o of a handshake with peer, which is the
+// *device.Peer argument to a wireguard-go log message.
+func (x *Logger) noteHandshake(peer any, o handshakeOutcome) {
+	s, ok := peer.(fmt.Stringer)
+	if !ok {
+		return
+	}
+	k, ok := x.keys.Load()[s.String()]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	hs, ok := x.handshakes[k]
+	if !ok {
+		hs = new(HandshakeStats)
+		x.handshakes[k] = hs
+	}
+	switch o {
+	case handshakeSuccess:
+		hs.Successes++
+		hs.LastSuccess = now
+	case handshakeRetry:
+		hs.Retries++
+		hs.LastFailure = now
+	case handshakeFailure:
+		hs.Failures++
+		hs.LastFailure = now
+	}
+}
+
+// PeerHandshakeStats returns the handshake outcomes with peer since it was
+// added with SetPeers, or since the stats were last reset. If reset, the
+// stats are zeroed after being read.
+func (x *Logger) PeerHandshakeStats(peer key.NodePublic, reset bool) HandshakeStats {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	hs, ok := x.handshakes[peer]
+	if !ok {
+		return HandshakeStats{}
+	}
+	ret := *hs
+	if reset {
+		delete(x.handshakes, peer)
+	}
 	return ret
 }
 
@@ -95,6 +185,7 @@ func (x *Logger) SetPeers(peers []wgcfg.Peer) {
 	defer x.mu.Unlock()
 	// Construct a new peer public key log rewriter.
 	replace := make(map[string]string)
+	keys := make(map[string]key.NodePublic)
 	for _, peer := range peers {
 		c, ok := x.strs[peer.PublicKey] // look up cached strs
 		if !ok {
@@ -105,15 +196,18 @@ func (x *Logger) SetPeers(peers []wgcfg.Peer) {
 		}
 		c.used = true
 		replace[c.wg] = c.ts
+		keys[c.wg] = peer.PublicKey
 	}
-	// Remove any unused cached strs.
+	// Remove any unused cached strs, and the stats of removed peers.
 	for k, c := range x.strs {
 		if !c.used {
 			delete(x.strs, k)
+			delete(x.handshakes, k)
 			continue
 		}
 		// Mark c as unused for next round.
 		c.used = false
 	}
 	x.replace.Store(replace)
+	x.keys.Store(keys)
 }
@@ -64,6 +64,38 @@ type log struct {
 	}
 }
 
+func TestHandshakeStats(t *testing.T) {
+	x := wglog.NewLogger(logger.Discard)
+	k := key.NewNode().Public()
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer(k.WireGuardGoString())
+
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+	x.DeviceLogger.Verbosef("%s - Handshake did not complete after %d seconds, retrying (try %d)", peer, 5, 2)
+	x.DeviceLogger.Verbosef("%s - Handshake did not complete after %d seconds, retrying (try %d)", peer, 5, 3)
+	x.DeviceLogger.Verbosef("%s - Handshake did not complete after %d attempts, giving up", peer, 20)
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+	x.DeviceLogger.Verbosef("%v - Received handshake response", stringer("peer(unknown)"))
+
+	hs := x.PeerHandshakeStats(k, true)
+	if hs.Successes != 1 || hs.Retries != 2 || hs.Failures != 1 {
+		t.Errorf("got %+v; want 1 success, 2 retries, 1 failure", hs)
+	}
+	if hs.LastSuccess.IsZero() || hs.LastFailure.IsZero() {
+		t.Errorf("got %+v; want last success and failure times", hs)
+	}
+	if hs := x.PeerHandshakeStats(k, false); hs != (wglog.HandshakeStats{}) {
+		t.Errorf("after reset, got %+v; want zero", hs)
+	}
+
+	// Removing the peer forgets its stats.
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+	x.SetPeers(nil)
+	if hs := x.PeerHandshakeStats(k, false); hs != (wglog.HandshakeStats{}) {
+		t.Errorf("after removing peer, got %+v; want zero", hs)
+	}
+}
+
 func stringer(s string) stringerString {
 	return stringerString(s)
 }